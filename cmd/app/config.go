@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"maragu.dev/env"
+	"maragu.dev/errors"
+	"maragu.dev/glue/sql"
+
+	"app/llm"
+	"app/model"
+	"app/sqlite"
+)
+
+// config reconciles the config file given in args into the database at DATABASE_PATH, like: app config config.yaml
+// The database is migrated first, so it also works on a new database.
+func config(log *slog.Logger, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: app config <config path>")
+	}
+
+	ctx := context.Background()
+
+	db := sqlite.NewDatabase(sqlite.NewDatabaseOptions{
+		H: sql.NewHelper(sql.NewHelperOptions{
+			Log: log.With("component", "sql.Database"),
+			SQLite: sql.SQLiteOptions{
+				Path: env.GetStringOrDefault("DATABASE_PATH", "app.db"),
+			},
+		}),
+		Log: log.With("component", "sql.Database"),
+	})
+	if err := db.H.Connect(ctx); err != nil {
+		return errors.Wrap(err, "error connecting to database")
+	}
+
+	if err := db.H.MigrateUp(ctx); err != nil {
+		return errors.Wrap(err, "error migrating database")
+	}
+
+	return reconcileConfig(ctx, log, db, args[0])
+}
+
+// reconcileConfig from the file at path, logging what was created, updated, or left unchanged.
+func reconcileConfig(ctx context.Context, log *slog.Logger, db *sqlite.Database, path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "error reading config file")
+	}
+
+	c, err := model.ParseConfig(b)
+	if err != nil {
+		return errors.Wrap(err, "error parsing config file")
+	}
+
+	for _, p := range c.Speakers {
+		if err := llm.ValidateSystem(p.System); err != nil {
+			return errors.Wrap(err, "error in system prompt of speaker %v", p.Name)
+		}
+	}
+
+	r, err := db.ReconcileConfig(ctx, c)
+	if err != nil {
+		return errors.Wrap(err, "error reconciling config")
+	}
+
+	for _, kind := range []struct {
+		name string
+		rs   []model.Reconciled
+	}{{"provider", r.Providers}, {"model", r.Models}, {"speaker", r.Speakers}} {
+		for _, re := range kind.rs {
+			log.Info("Reconciled config", "kind", kind.name, "name", re.Name, "change", re.Change)
+		}
+	}
+	log.Info("Reconciled config file", "path", path, "created", r.Count(model.ChangeCreated),
+		"updated", r.Count(model.ChangeUpdated), "unchanged", r.Count(model.ChangeUnchanged))
+
+	return nil
+}
@@ -2,13 +2,16 @@ package main
 
 import (
 	"context"
+	"encoding/base64"
 	"log/slog"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/honeycombio/otel-config-go/otelconfig"
+	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/sync/errgroup"
 	"maragu.dev/env"
 	"maragu.dev/errors"
@@ -20,6 +23,8 @@ import (
 	"app/html"
 	"app/http"
 	"app/jobs"
+	"app/llm"
+	"app/model"
 	"app/sqlite"
 )
 
@@ -33,6 +38,24 @@ func main() {
 		NoTime: env.GetBoolOrDefault("LOG_NO_TIME", false),
 	})
 
+	// The restore command restores a backup instead of starting the app, like: app restore backups/app-20250101T000000.000Z.db
+	if len(os.Args) > 1 && os.Args[1] == "restore" {
+		if err := restore(log, os.Args[2:]); err != nil {
+			log.Error("Error restoring backup", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// The config command reconciles a config file instead of starting the app, like: app config config.yaml
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		if err := config(log, os.Args[2:]); err != nil {
+			log.Error("Error reconciling config", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if err := start(log); err != nil {
 		log.Error("Error starting app", "error", err)
 		os.Exit(1)
@@ -49,8 +72,10 @@ func start(log *slog.Logger) error {
 
 	otelShutdown, err := otelconfig.ConfigureOpenTelemetry(
 		otelconfig.WithServiceName(appName), otelconfig.WithServiceVersion("TODO"),
+		// Metrics are exposed for Prometheus on /metrics on METRICS_ADDRESS instead
 		otelconfig.WithMetricsEnabled(false),
-		otelconfig.WithExporterProtocol(otelconfig.ProtocolHTTPProto), otelconfig.WithExporterEndpoint("https://api.honeycomb.io"),
+		otelconfig.WithExporterProtocol(otelconfig.ProtocolHTTPProto),
+		otelconfig.WithExporterEndpoint(env.GetStringOrDefault("OTEL_EXPORTER_OTLP_ENDPOINT", "https://api.honeycomb.io")),
 	)
 	if err != nil {
 		return errors.Wrap(err, "error setting up otel")
@@ -61,7 +86,19 @@ func start(log *slog.Logger) error {
 
 	jobTimeout := env.GetDurationOrDefault("JOB_QUEUE_TIMEOUT", 30*time.Second)
 
+	// CREDENTIALS_KEY is the base64 of 32 random bytes, like from: openssl rand -base64 32
+	var credentialsKey []byte
+	if v := env.GetStringOrDefault("CREDENTIALS_KEY", ""); v != "" {
+		credentialsKey, err = base64.StdEncoding.DecodeString(v)
+		if err != nil || len(credentialsKey) != 32 {
+			return errors.New("CREDENTIALS_KEY must be the base64 of 32 bytes")
+		}
+	}
+
 	db := sqlite.NewDatabase(sqlite.NewDatabaseOptions{
+		CredentialsKey: credentialsKey,
+		// Conversation documents are cached in memory, so polling conversations is cheap. Zero disables the cache.
+		DocumentCacheSize: env.GetIntOrDefault("DOCUMENT_CACHE_SIZE", 100),
 		H: sql.NewHelper(sql.NewHelperOptions{
 			JobQueue: sql.JobQueueOptions{
 				Timeout: jobTimeout,
@@ -81,6 +118,24 @@ func start(log *slog.Logger) error {
 		return errors.Wrap(err, "error migrating database")
 	}
 
+	// Providers, models, and speakers are reconciled from the config file at CONFIG_PATH on startup, if it's set
+	if path := env.GetStringOrDefault("CONFIG_PATH", ""); path != "" {
+		if err := reconcileConfig(ctx, log, db, path); err != nil {
+			return err
+		}
+	}
+
+	// Speakers are synced from the persona files in PERSONAS_DIR on startup, if it's set
+	if dir := env.GetStringOrDefault("PERSONAS_DIR", ""); dir != "" {
+		if err := syncPersonas(ctx, log, db, dir); err != nil {
+			return errors.Wrap(err, "error syncing personas")
+		}
+	}
+
+	if err := checkSystemPrompts(ctx, log, db); err != nil {
+		return err
+	}
+
 	runner := gluejobs.NewRunner(gluejobs.NewRunnerOpts{
 		Log:   log.With("component", "jobs.Runner"),
 		Queue: db.H.JobsQ,
@@ -88,20 +143,133 @@ func start(log *slog.Logger) error {
 
 	baseURL := env.GetStringOrDefault("BASE_URL", "http://localhost:8080")
 
+	// Limits per provider are set with LLM_<PROVIDER>_CONCURRENCY and LLM_<PROVIDER>_REQUESTS_PER_MINUTE,
+	// for example LLM_OPENAI_CONCURRENCY. Zero means no limit.
+	providerLimits := map[model.Provider]llm.Limits{}
+	for _, p := range []model.Provider{model.ProviderAnthropic, model.ProviderFireworks, model.ProviderGoogle, model.ProviderLlamaCPP, model.ProviderOpenAI} {
+		name := strings.ToUpper(string(p))
+		providerLimits[p] = llm.Limits{
+			Concurrency:       env.GetIntOrDefault("LLM_"+name+"_CONCURRENCY", 0),
+			RequestsPerMinute: env.GetIntOrDefault("LLM_"+name+"_REQUESTS_PER_MINUTE", 0),
+		}
+	}
+
+	llmClient := llm.NewClient(llm.NewClientOptions{
+		AnthropicKey: env.GetStringOrDefault("ANTHROPIC_API_KEY", ""),
+		CircuitBreaker: llm.CircuitBreakerOptions{
+			Threshold: env.GetIntOrDefault("LLM_CIRCUIT_BREAKER_THRESHOLD", 5),
+			Cooldown:  env.GetDurationOrDefault("LLM_CIRCUIT_BREAKER_COOLDOWN", time.Minute),
+		},
+		// Credentials are resolved from CREDENTIAL_<NAME> environment variables, files in CREDENTIALS_DIR, and the database
+		Credentials:  llm.NewCredentials(env.GetStringOrDefault("CREDENTIALS_DIR", ""), db),
+		FireworksKey: env.GetStringOrDefault("FIREWORKS_API_KEY", ""),
+		GoogleKey:    env.GetStringOrDefault("GOOGLE_API_KEY", ""),
+		Log:          log.With("component", "llm.Client"),
+		MaxRetries:   env.GetIntOrDefault("LLM_MAX_RETRIES", 3),
+		MaxRetryWait: env.GetDurationOrDefault("LLM_MAX_RETRY_WAIT", 10*time.Second),
+		ModelLimits: llm.Limits{
+			Concurrency:       env.GetIntOrDefault("LLM_MODEL_CONCURRENCY", 0),
+			RequestsPerMinute: env.GetIntOrDefault("LLM_MODEL_REQUESTS_PER_MINUTE", 0),
+		},
+		OpenAIKey:      env.GetStringOrDefault("OPENAI_API_KEY", ""),
+		ProviderLimits: providerLimits,
+	})
+
+	backupOpts := jobs.BackupOpts{
+		Dir:      env.GetStringOrDefault("BACKUP_DIR", ""),
+		Interval: env.GetDurationOrDefault("BACKUP_INTERVAL", 24*time.Hour),
+		Keep:     env.GetIntOrDefault("BACKUP_KEEP", 7),
+	}
+
+	// Conversations without activity for RETENTION_DAYS are deleted, or anonymized with RETENTION_ANONYMIZE,
+	// unless they're pinned. RETENTION_DRY_RUN only logs what would be purged.
+	retentionOpts := jobs.RetentionOpts{
+		Anonymize: env.GetBoolOrDefault("RETENTION_ANONYMIZE", false),
+		Days:      env.GetIntOrDefault("RETENTION_DAYS", 0),
+		DryRun:    env.GetBoolOrDefault("RETENTION_DRY_RUN", false),
+		Interval:  env.GetDurationOrDefault("RETENTION_INTERVAL", time.Hour),
+	}
+
+	// Conversations, turns, and speakers are permanently deleted after TRASH_DAYS in the trash
+	purgeTrashOpts := jobs.PurgeTrashOpts{
+		Days:     env.GetIntOrDefault("TRASH_DAYS", 30),
+		Interval: env.GetDurationOrDefault("TRASH_PURGE_INTERVAL", time.Hour),
+	}
+
+	// Memories are extracted from conversations every MEMORY_EXTRACTION_INTERVAL, once they've had no new turns
+	// for MEMORY_EXTRACTION_IDLE. Zero interval means extraction is off.
+	extractMemoriesOpts := jobs.ExtractMemoriesOpts{
+		Idle:     env.GetDurationOrDefault("MEMORY_EXTRACTION_IDLE", 10*time.Minute),
+		Interval: env.GetDurationOrDefault("MEMORY_EXTRACTION_INTERVAL", 0),
+	}
+
 	jobs.Register(runner, jobs.RegisterOpts{
-		Log: log.With("component", "jobs"),
+		Backup:                backupOpts,
+		DB:                    db,
+		ExtractMemories:       extractMemoriesOpts,
+		LLM:                   llmClient,
+		Log:                   log.With("component", "jobs"),
+		MaxConsecutiveAITurns: env.GetIntOrDefault("MAX_CONSECUTIVE_AI_TURNS", 10),
+		PurgeTrash:            purgeTrashOpts,
+		Retention:             retentionOpts,
 	})
 
+	prometheus.MustRegister(jobs.NewQueueDepthCollector(log.With("component", "jobs"), db))
+
+	// The first backup is taken right away, and the backup job schedules the next ones
+	if backupOpts.Dir != "" {
+		if err := db.EnsureJobScheduled(ctx, model.JobBackup, 0); err != nil {
+			return errors.Wrap(err, "error scheduling backup")
+		}
+	}
+
+	if retentionOpts.Days > 0 {
+		if err := db.EnsureJobScheduled(ctx, model.JobRetention, 0); err != nil {
+			return errors.Wrap(err, "error scheduling retention")
+		}
+	}
+
+	if extractMemoriesOpts.Interval > 0 {
+		if err := db.EnsureJobScheduled(ctx, model.JobExtractMemories, 0); err != nil {
+			return errors.Wrap(err, "error scheduling memory extraction")
+		}
+	}
+
+	if purgeTrashOpts.Days > 0 {
+		if err := db.EnsureJobScheduled(ctx, model.JobPurgeTrash, 0); err != nil {
+			return errors.Wrap(err, "error scheduling trash purge")
+		}
+	}
+
+	runnerMonitor := jobs.NewRunnerMonitor(jobs.NewRunnerMonitorOpts{
+		DB:      db,
+		MaxWait: env.GetDurationOrDefault("JOB_RUNNER_MAX_WAIT", time.Minute),
+	})
+
+	// Providers to probe for readiness are set with READINESS_PROBE_PROVIDERS, for example "llamacpp,openai"
+	var probeProviders []model.Provider
+	for _, p := range strings.Split(env.GetStringOrDefault("READINESS_PROBE_PROVIDERS", ""), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			probeProviders = append(probeProviders, model.Provider(p))
+		}
+	}
+
 	server := gluehttp.NewServer(gluehttp.NewServerOptions{
 		Address:            env.GetStringOrDefault("SERVER_ADDRESS", ":8080"),
 		BaseURL:            baseURL,
 		CSP:                http.CSP(env.GetBoolOrDefault("CSP_ALLOW_UNSAFE_INLINE", false)),
 		HTMLPage:           html.Page,
-		HTTPRouterInjector: http.InjectHTTPRouter(log, db),
+		HTTPRouterInjector: http.InjectHTTPRouter(log, db, llmClient, runnerMonitor, probeProviders),
 		Log:                log.With("component", "http.Server"),
 		SecureCookie:       env.GetBoolOrDefault("SECURE_COOKIE", true),
 	})
 
+	// Metrics are served apart from the app, on an address that shouldn't be reachable from the internet
+	metricsServer := http.NewMetricsServer(http.NewMetricsServerOptions{
+		Address: env.GetStringOrDefault("METRICS_ADDRESS", "localhost:9090"),
+		Log:     log.With("component", "http.MetricsServer"),
+	})
+
 	// An error group is used to start and wait for multiple goroutines that can each fail with an error.
 	eg, ctx := errgroup.WithContext(ctx)
 
@@ -110,7 +278,11 @@ func start(log *slog.Logger) error {
 	})
 
 	eg.Go(func() error {
-		runner.Start(ctx)
+		return metricsServer.Start()
+	})
+
+	eg.Go(func() error {
+		runnerMonitor.Start(ctx, runner)
 		return nil
 	})
 
@@ -123,6 +295,10 @@ func start(log *slog.Logger) error {
 		return server.Stop(ctx)
 	})
 
+	eg.Go(func() error {
+		return metricsServer.Stop(ctx)
+	})
+
 	if err := eg.Wait(); err != nil {
 		return err
 	}
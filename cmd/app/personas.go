@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"maragu.dev/errors"
+
+	"app/llm"
+	"app/model"
+	"app/sqlite"
+)
+
+// syncPersonas from the persona files in dir, which are YAML or JSON files with a .yaml, .yml, or .json extension.
+// The files are the source of truth, so speakers with the same names are replaced.
+// Files that can't be imported are logged and skipped, so one bad file doesn't stop the app from starting.
+func syncPersonas(ctx context.Context, log *slog.Logger, db *sqlite.Database, dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return errors.Wrap(err, "error reading persona directory")
+	}
+
+	for _, e := range entries {
+		if e.IsDir() || !slices.Contains([]string{".yaml", ".yml", ".json"}, filepath.Ext(e.Name())) {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return errors.Wrap(err, "error reading persona file")
+		}
+
+		p, err := model.ParsePersona(b)
+		if err != nil {
+			log.Info("Error parsing persona file, skipping", "path", path, "error", err)
+			continue
+		}
+
+		if err := llm.ValidateSystem(p.System); err != nil {
+			log.Info("Error in persona system prompt, skipping", "path", path, "name", p.Name, "error", err)
+			continue
+		}
+
+		_, change, err := db.ImportPersona(ctx, p, true)
+		if err != nil {
+			var domainErr model.Error
+			if !errors.As(err, &domainErr) {
+				return errors.Wrap(err, "error importing persona")
+			}
+			log.Info("Error importing persona file, skipping", "path", path, "name", p.Name, "error", err)
+			continue
+		}
+
+		log.Info("Synced persona file", "path", path, "name", p.Name, "change", change)
+	}
+
+	return nil
+}
+
+// checkSystemPrompts of all speakers, logging the ones that fail to render, since their turns can't be generated.
+// Speakers saved before system prompts were templates can have a literal {{ that needs changing, for example.
+func checkSystemPrompts(ctx context.Context, log *slog.Logger, db *sqlite.Database) error {
+	speakers, err := db.GetSpeakers(ctx)
+	if err != nil {
+		return errors.Wrap(err, "error getting speakers")
+	}
+
+	for _, s := range speakers {
+		if err := llm.ValidateSystem(s.System); err != nil {
+			log.Info("Error in speaker system prompt, turns by the speaker will fail until it's fixed", "id", s.ID, "name", s.Name, "error", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"maragu.dev/env"
+	"maragu.dev/errors"
+
+	"app/sqlite"
+)
+
+// restore the backup given in args to the database at DATABASE_PATH.
+// The app must be stopped first, since the database file is replaced.
+func restore(log *slog.Logger, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: app restore <backup path>")
+	}
+
+	backupPath := args[0]
+	path := env.GetStringOrDefault("DATABASE_PATH", "app.db")
+
+	log.Info("Restoring backup", "backup", backupPath, "path", path)
+
+	if err := sqlite.Restore(context.Background(), backupPath, path); err != nil {
+		return err
+	}
+
+	log.Info("Restored backup", "backup", backupPath, "path", path)
+
+	return nil
+}
@@ -19,6 +19,15 @@ var hashOnce sync.Once
 var appCSSPath, htmxJSPath, idiomorphJSPath, idiomorphExtJSPath, appJSPath string
 
 func Page(props PageProps, body ...Node) Node {
+	return page(props, header(props), body...)
+}
+
+// publicPage is a [Page] without navigation, for people without access to the rest of the app.
+func publicPage(props PageProps, body ...Node) Node {
+	return page(props, Div(container(false, Div(Class("py-2")))), body...)
+}
+
+func page(props PageProps, header Node, body ...Node) Node {
 	hashOnce.Do(func() {
 		appCSSPath = getHashedPath("public/styles/app.css")
 		htmxJSPath = getHashedPath("public/scripts/htmx.js")
@@ -49,7 +58,7 @@ func Page(props PageProps, body ...Node) Node {
 		Body: []Node{Class("bg-primary-800 text-gray-900 dark:text-white font-mono"),
 			hx.Ext("morph"),
 			Div(Class("min-h-dvh flex flex-col justify-between"),
-				header(props),
+				header,
 				Div(Class("grow bg-white dark:bg-gray-800 h-auto"),
 					container(true,
 						Group(body),
@@ -62,7 +71,14 @@ func Page(props PageProps, body ...Node) Node {
 
 func header(_ PageProps) Node {
 	return Div(
-		container(false),
+		container(false,
+			Nav(Class("py-2 flex gap-4 text-white"),
+				A(Href("/"), Text("Conversations")),
+				A(Href("/speakers"), Text("Speakers")),
+				A(Href("/credentials"), Text("Credentials")),
+				A(Href("/trash"), Text("Trash")),
+			),
+		),
 	)
 }
 
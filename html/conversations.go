@@ -1,48 +1,437 @@
 package html
 
 import (
+	"fmt"
+	"maps"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/yuin/goldmark"
 	. "maragu.dev/gomponents"
 	hx "maragu.dev/gomponents-htmx"
 	. "maragu.dev/gomponents/html"
 
+	"app/llm"
 	"app/model"
 )
 
-func ConversationsPage(props PageProps, cd model.ConversationDocument) Node {
+type ConversationsPageProps struct {
+	PageProps
+	Document         model.ConversationDocument
+	Folders          []model.Folder
+	Models           []model.Model
+	ProviderStatuses []llm.ProviderStatus
+	Shares           []model.Share
+	Speakers         []model.Speaker
+}
+
+func ConversationsPage(props ConversationsPageProps) Node {
+	cd := props.Document
+
 	props.Title = cd.Conversation.Topic
 	if props.Title == "" {
 		props.Title = cd.Conversation.ID.String()
 	}
 
-	return Page(props,
+	return Page(props.PageProps,
 		Group{
 			H1(Text(props.Title)),
 
-			Div(Class("space-y-8"), hx.Get("/conversations?id="+cd.Conversation.ID.String()), hx.Trigger("every 1s"),
-				TurnsPartial(cd),
+			Div(Class("mb-8 flex flex-wrap gap-4"),
+				pauseForm(cd.Conversation),
+				pinForm(cd.Conversation),
+				moveForm(cd.Conversation, props.Folders),
+				deleteConversationForm(cd.Conversation),
 			),
+
+			tags(cd),
+
+			shares(cd.Conversation, props.Shares),
+
+			systemForm(cd.Conversation),
+			variablesForm(cd.Conversation),
+
+			Div(Class("space-y-8"),
+				earlierTurnsButton(cd),
+
+				Div(Class("space-y-8"), hx.Get(pollURL(cd)), hx.Trigger("every 1s"),
+					TurnsPartial(cd, false),
+				),
+			),
+
+			providerStatuses(props.ProviderStatuses),
+
+			composer(cd.Conversation, props.Speakers, props.Models),
 		},
 	)
 }
 
-func TurnsPartial(cd model.ConversationDocument) Node {
-	return Map(cd.Turns, func(t model.Turn) Node {
-		s := cd.Speakers[t.SpeakerID]
+// providerStatuses warns about unhealthy providers, whose replies are delayed until they recover.
+func providerStatuses(statuses []llm.ProviderStatus) Node {
+	return Ul(Class("mt-8 text-primary-600"),
+		Map(statuses, func(s llm.ProviderStatus) Node {
+			if s.Healthy() {
+				return nil
+			}
+			return Li(Textf("Provider %v is unhealthy after %d failures, replies are paused until %v.",
+				s.Provider, s.Failures, s.OpenUntil.UTC().Format(time.TimeOnly)))
+		}),
+	)
+}
+
+// pauseForm switches whether AI speakers reply in the conversation.
+func pauseForm(c model.Conversation) Node {
+	return Form(Method("post"), Action("/conversations/pause"),
+		Input(Type("hidden"), Name("id"), Value(c.ID.String())),
+		If(c.Paused, Group{
+			Input(Type("hidden"), Name("paused"), Value("false")),
+			Span(Class("text-primary-600 mr-4"), Text("Paused, AI speakers don't reply.")),
+			Button(Type("submit"), Text("Resume")),
+		}),
+		If(!c.Paused, Group{
+			Input(Type("hidden"), Name("paused"), Value("true")),
+			Button(Type("submit"), Text("Pause conversation")),
+		}),
+	)
+}
 
-		var content string
-		var b strings.Builder
-		if err := goldmark.Convert([]byte(t.Content), &b); err != nil {
-			content = "Error converting markdown to HTML: " + err.Error()
+// pinForm switches whether the conversation is pinned, which keeps it regardless of retention.
+func pinForm(c model.Conversation) Node {
+	return Form(Method("post"), Action("/conversations/pin"),
+		Input(Type("hidden"), Name("id"), Value(c.ID.String())),
+		Input(Type("hidden"), Name("pinned"), Value(fmt.Sprint(!c.Pinned))),
+		If(c.Pinned, Button(Type("submit"), Text("Unpin"))),
+		If(!c.Pinned, Button(Type("submit"), Text("Pin"))),
+	)
+}
+
+// moveForm moves the conversation into a folder, or out of any folder.
+func moveForm(c model.Conversation, folders []model.Folder) Node {
+	var folderID model.FolderID
+	if c.FolderID != nil {
+		folderID = *c.FolderID
+	}
+
+	return Form(Method("post"), Action("/conversations/move"),
+		Input(Type("hidden"), Name("id"), Value(c.ID.String())),
+		Select(Name("folder_id"),
+			Option(Value(""), Text("No folder")),
+			folderOptions(folders, folderID),
+		),
+		Text(" "),
+		Button(Type("submit"), Text("Move")),
+	)
+}
+
+// tags of the conversation, each with a button to remove it, and a form to add a tag.
+func tags(cd model.ConversationDocument) Node {
+	id := cd.Conversation.ID.String()
+
+	return Div(Class("mb-8 flex flex-wrap items-center gap-2"),
+		Map(cd.Tags, func(t model.Tag) Node {
+			return Form(Class("border border-gray-200 rounded-lg px-2"), Method("post"), Action("/conversations/tags/delete"),
+				Input(Type("hidden"), Name("id"), Value(id)),
+				Input(Type("hidden"), Name("tag_id"), Value(t.ID.String())),
+				A(Href("/?tag="+t.ID.String()), Text(t.Name)),
+				Text(" "),
+				Button(Type("submit"), Title("Remove tag"), Text("×")),
+			)
+		}),
+		Form(Method("post"), Action("/conversations/tags"),
+			Input(Type("hidden"), Name("id"), Value(id)),
+			Input(Type("text"), Name("name"), Placeholder("Tag"), Required()),
+			Text(" "),
+			Button(Type("submit"), Text("Add tag")),
+		),
+	)
+}
+
+// systemForm edits the conversation's system context, which every speaker in the conversation gets with their own system prompt.
+func systemForm(c model.Conversation) Node {
+	return Details(Class("mb-8"), If(c.System != "", Attr("open")),
+		Summary(Class("cursor-pointer"), Text("System context")),
+		Form(Class("mt-4 space-y-4"), Method("post"), Action("/conversations/system"),
+			Input(Type("hidden"), Name("id"), Value(c.ID.String())),
+			P(Class("text-sm text-gray-500"), Text("Added to the system prompt of every speaker in this conversation.")),
+			Textarea(Class("w-full border border-gray-200 rounded-lg p-4"), Name("system"), Rows("4"), Text(c.System)),
+			Button(Type("submit"), Text("Save system context")),
+		),
+	)
+}
+
+// variablesForm sets the custom variables of the conversation, one name=value per line.
+func variablesForm(c model.Conversation) Node {
+	var lines []string
+	for _, name := range slices.Sorted(maps.Keys(c.Variables)) {
+		lines = append(lines, name+"="+c.Variables[name])
+	}
+
+	return Details(Class("mb-8"), If(len(c.Variables) > 0, Attr("open")),
+		Summary(Class("cursor-pointer"), Text("Variables")),
+		Form(Class("mt-4 space-y-4"), Method("post"), Action("/conversations/variables"),
+			Input(Type("hidden"), Name("id"), Value(c.ID.String())),
+			P(Class("text-sm text-gray-500"), Text("One name=value per line, used in speaker system prompts like {{.Vars.name}}.")),
+			Textarea(Class("w-full border border-gray-200 rounded-lg p-4"), Name("variables"), Rows("4"), Text(strings.Join(lines, "\n"))),
+			Button(Type("submit"), Text("Save variables")),
+		),
+	)
+}
+
+// deleteConversationForm moves the conversation to the trash.
+func deleteConversationForm(c model.Conversation) Node {
+	return Form(Method("post"), Action("/conversations/delete"),
+		Input(Type("hidden"), Name("id"), Value(c.ID.String())),
+		Button(Type("submit"), Text("Delete conversation")),
+	)
+}
+
+// composer is the form for adding a turn to the conversation, and choosing which speakers reply to it.
+// Choosing more than one speaker compares their replies side by side.
+// AI speakers can't be chosen while the conversation is paused.
+func composer(c model.Conversation, speakers []model.Speaker, models []model.Model) Node {
+	providers := map[model.ModelID]model.Provider{}
+	for _, m := range models {
+		providers[m.ID] = m.Provider
+	}
+
+	var humans, ais []model.Speaker
+	for _, s := range speakers {
+		if providers[s.ModelID] == model.ProviderBrain {
+			humans = append(humans, s)
 		} else {
-			content = b.String()
+			ais = append(ais, s)
 		}
+	}
+
+	return Form(Class("mt-8 space-y-4"), Method("post"), Action("/conversations/turns"),
+		Input(Type("hidden"), Name("id"), Value(c.ID.String())),
+
+		Label(Text("Speaking as "),
+			Select(Name("speaker_id"),
+				Map(humans, func(s model.Speaker) Node {
+					return Option(Value(s.ID.String()), Text(s.Name))
+				}),
+			),
+		),
 
-		return Div(Class("flex"),
+		Textarea(Class("w-full border border-gray-200 rounded-lg p-4"), Name("content"), Rows("4"), Required()),
+
+		FieldSet(If(c.Paused, Disabled()),
+			Legend(Text("Reply with (choose more than one to compare)")),
+			Map(ais, func(s model.Speaker) Node {
+				return Label(Class("mr-4"),
+					Input(Type("checkbox"), Name("reply_speaker_id"), Value(s.ID.String())),
+					Text(" "+s.Name),
+				)
+			}),
+		),
+
+		Button(Type("submit"), Text("Send")),
+	)
+}
+
+// pollURL for the turns shown when the page was loaded and the ones after them.
+func pollURL(cd model.ConversationDocument) string {
+	u := "/conversations?id=" + cd.Conversation.ID.String()
+	if len(cd.Turns) > 0 {
+		u += "&since=" + cd.Turns[0].ID.String()
+	}
+	return u
+}
+
+// earlierTurnsButton loads the page of turns before the first turn in the document, if there are any,
+// and is replaced by them.
+func earlierTurnsButton(cd model.ConversationDocument) Node {
+	if !cd.EarlierTurns || len(cd.Turns) == 0 {
+		return nil
+	}
+
+	return Button(Type("button"),
+		hx.Get("/conversations?id="+cd.Conversation.ID.String()+"&before="+cd.Turns[0].ID.String()),
+		hx.Swap("outerHTML"),
+		Text("Load earlier turns"),
+	)
+}
+
+// EarlierTurnsPartial is a page of earlier turns, with a button to load the turns before them.
+func EarlierTurnsPartial(cd model.ConversationDocument) Node {
+	return Group{
+		earlierTurnsButton(cd),
+		TurnsPartial(cd, false),
+	}
+}
+
+// TurnsPartial of the conversation document.
+// If readOnly, there are no links or buttons to change the conversation, such as on a shared page.
+func TurnsPartial(cd model.ConversationDocument, readOnly bool) Node {
+	// Candidates are shown side by side after the turn they reply to, until one of them is picked
+	candidates := map[model.TurnID][]model.Turn{}
+	picked := map[model.TurnID]bool{}
+	var thread []model.Turn
+	for _, t := range cd.Turns {
+		switch {
+		case t.Candidate && t.ReplyToID != nil:
+			candidates[*t.ReplyToID] = append(candidates[*t.ReplyToID], t)
+		default:
+			thread = append(thread, t)
+			if t.ReplyToID != nil {
+				picked[*t.ReplyToID] = true
+			}
+		}
+	}
+
+	return Map(thread, func(t model.Turn) Node {
+		return Group{
+			turn(cd, t, readOnly),
+
+			If(len(candidates[t.ID]) > 0 && !picked[t.ID],
+				Div(Class("grid grid-flow-col auto-cols-fr gap-4"),
+					Map(candidates[t.ID], func(t model.Turn) Node {
+						return Div(Class("space-y-2"),
+							turn(cd, t, readOnly),
+							If(!readOnly, Form(Method("post"), Action("/conversations/pick"),
+								Input(Type("hidden"), Name("id"), Value(t.ID.String())),
+								Button(Type("submit"), Text("Pick and continue")),
+							)),
+						)
+					}),
+				),
+			),
+		}
+	})
+}
+
+func turn(cd model.ConversationDocument, t model.Turn, readOnly bool) Node {
+	s := cd.Speakers[t.SpeakerID]
+	sr := cd.SpeakerRevisions[t.SpeakerRevisionID]
+
+	var content string
+	var b strings.Builder
+	if err := goldmark.Convert([]byte(t.Content), &b); err != nil {
+		content = "Error converting markdown to HTML: " + err.Error()
+	} else {
+		content = b.String()
+	}
+
+	return Div(Class("flex"),
+		Div(
 			P(Text(s.Name)),
-			Div(Class("border border-gray-200 rounded-lg w-full px-4 mx-4"), Raw(content)),
+			If(!readOnly, A(Class("text-sm text-gray-500"), Href("/speakers/revisions?id="+s.ID.String()), Textf("v%d", sr.Revision))),
+			If(readOnly, P(Class("text-sm text-gray-500"), Textf("v%d", sr.Revision))),
+			If(t.ModelID != nil, P(Class("text-sm text-gray-500"), Text(modelName(cd, t)))),
+			turnStatus(t, readOnly),
+			If(readOnly && t.Pinned, P(Class("text-sm text-gray-500"), Text("Pinned"))),
+			If(!readOnly, pinTurnForm(t)),
+			If(!readOnly && t.Content != "", rememberTurnForm(t, cd.RememberedTurns[t.ID])),
+			If(!readOnly, Form(Class("text-sm"), Method("post"), Action("/conversations/turns/delete"),
+				Input(Type("hidden"), Name("id"), Value(t.ID.String())),
+				Button(Type("submit"), Text("Delete")),
+			)),
+		),
+		Div(Class("border border-gray-200 rounded-lg w-full px-4 mx-4"),
+			reasoning(t),
+			If(t.Output != "", jsonTree([]byte(t.Output))),
+			If(t.Output == "", Raw(content)),
+			If(t.Error != "", P(Class("text-sm text-primary-600"), Text(t.Error))),
+		),
+	)
+}
+
+// pinTurnForm switches whether the turn is pinned, which always includes it in prompts.
+func pinTurnForm(t model.Turn) Node {
+	return Form(Class("text-sm"), Method("post"), Action("/conversations/turns/pin"),
+		Input(Type("hidden"), Name("id"), Value(t.ID.String())),
+		Input(Type("hidden"), Name("pinned"), Value(fmt.Sprint(!t.Pinned))),
+		If(t.Pinned, Button(Type("submit"), Title("Always included in prompts"), Text("Unpin"))),
+		If(!t.Pinned, Button(Type("submit"), Title("Always include in prompts"), Text("Pin"))),
+	)
+}
+
+// rememberTurnForm makes the AI speakers in the conversation remember the turn, or forget it if they remember it.
+func rememberTurnForm(t model.Turn, remembered bool) Node {
+	return Form(Class("text-sm"), Method("post"),
+		Input(Type("hidden"), Name("id"), Value(t.ID.String())),
+		If(remembered, Group{
+			Action("/conversations/turns/forget"),
+			Button(Type("submit"), Title("Speakers remember this"), Text("Forget this")),
+		}),
+		If(!remembered, Group{
+			Action("/conversations/turns/remember"),
+			Button(Type("submit"), Title("Speakers will remember this in other conversations"), Text("Remember this")),
+		}),
+	)
+}
+
+// reasoning blocks of the turn in collapsed sections, since they're usually long and not what the user came for.
+// Redacted blocks only say that they're there.
+// Once the turn is done generating, the sections are preserved when polling, so they stay open.
+func reasoning(t model.Turn) Node {
+	var blocks Group
+	for i, b := range t.Reasoning {
+		if b.Type == model.ReasoningBlockTypeRedacted {
+			blocks = append(blocks, P(Class("my-4 text-sm text-gray-500"), Text("Redacted thinking")))
+			continue
+		}
+
+		label := "Thinking"
+		if b.Type == model.ReasoningBlockTypeSummary {
+			label = "Reasoning summary"
+		}
+
+		blocks = append(blocks, Details(Class("my-4 text-sm text-gray-500"),
+			ID(fmt.Sprintf("reasoning-%v-%d", t.ID, i)), If(!t.Status.Generating(), hx.Preserve("true")),
+			Summary(Class("cursor-pointer"), Text(label)),
+			P(Class("mt-2 whitespace-pre-wrap"), Text(b.Text)),
+		))
+	}
+	return blocks
+}
+
+// turnStatus shows a spinner while the turn is generating, with a button to stop it,
+// and a button to retry the turn if it failed or was cancelled. If readOnly, there are no buttons.
+func turnStatus(t model.Turn, readOnly bool) Node {
+	switch t.Status {
+	case model.TurnStatusPending, model.TurnStatusStreaming:
+		label := "Waiting"
+		if t.Status == model.TurnStatusStreaming {
+			label = "Writing"
+		}
+		return Div(Class("text-sm text-gray-500"),
+			P(
+				Span(Class("inline-block size-3 mr-1 rounded-full border-2 border-gray-300 border-t-gray-600 animate-spin")),
+				Text(label),
+			),
+			If(!readOnly, Form(Method("post"), Action("/conversations/cancel"),
+				Input(Type("hidden"), Name("id"), Value(t.ID.String())),
+				Button(Type("submit"), Text("Stop")),
+			)),
 		)
-	})
+
+	case model.TurnStatusFailed, model.TurnStatusCancelled:
+		label := "Failed"
+		if t.Status == model.TurnStatusCancelled {
+			label = "Cancelled"
+		}
+		return Div(Class("text-sm"),
+			P(Class("text-primary-600"), Text(label)),
+			If(!readOnly, Form(Method("post"), Action("/conversations/retry"),
+				Input(Type("hidden"), Name("id"), Value(t.ID.String())),
+				Button(Type("submit"), Text("Retry")),
+			)),
+		)
+
+	default:
+		if t.Started.T.IsZero() || t.Finished.T.IsZero() {
+			return nil
+		}
+		return P(Class("text-sm text-gray-500"), Textf("%.1fs", t.Finished.T.Sub(t.Started.T).Seconds()))
+	}
+}
+
+func modelName(cd model.ConversationDocument, t model.Turn) string {
+	if t.ModelID == nil {
+		return ""
+	}
+	return cd.Models[*t.ModelID].Name
 }
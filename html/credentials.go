@@ -0,0 +1,48 @@
+package html
+
+import (
+	. "maragu.dev/gomponents"
+	. "maragu.dev/gomponents/html"
+
+	"app/model"
+)
+
+// CredentialsPage lists the credentials stored in the database by name, and lets the user add, replace, and delete them.
+// Values are write-only, so they're never shown.
+func CredentialsPage(props PageProps, credentials []model.Credential) Node {
+	props.Title = "Credentials"
+
+	return Page(props,
+		H1(Text(props.Title)),
+
+		P(Class("text-sm text-gray-500"),
+			Text(`Reference a credential from a model config with "credential": "name". `+
+				"Models without one use the credential named after their provider, like openai. "+
+				"Credentials are looked up in the CREDENTIAL_<NAME> environment variable, then a file in CREDENTIALS_DIR, and then here."),
+		),
+
+		If(len(credentials) == 0, P(Text("No credentials stored."))),
+
+		Ul(
+			Map(credentials, func(c model.Credential) Node {
+				return Li(
+					Text(c.Name+", updated "+c.Updated.Pretty()+" "),
+					Form(Class("inline"), Method("post"), Action("/credentials/delete"),
+						Input(Type("hidden"), Name("name"), Value(c.Name)),
+						Button(Type("submit"), Text("Delete")),
+					),
+				)
+			}),
+		),
+
+		Form(Class("space-y-4"), Method("post"), Action("/credentials"),
+			Label(Class("block"), Text("Name"),
+				Input(Class("block"), Type("text"), Name("name"), Required(), Pattern(`[a-z0-9][a-z0-9_.\-]{0,63}`)),
+			),
+			Label(Class("block"), Text("Value"),
+				Input(Class("block"), Type("password"), Name("value"), Required(), AutoComplete("off")),
+			),
+			Button(Type("submit"), Text("Save credential")),
+		),
+	)
+}
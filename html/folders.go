@@ -0,0 +1,54 @@
+package html
+
+import (
+	"strings"
+
+	. "maragu.dev/gomponents"
+	. "maragu.dev/gomponents/html"
+
+	"app/model"
+)
+
+// folderNode is a folder in a tree, with how deep it's nested.
+type folderNode struct {
+	Folder model.Folder
+	Depth  int
+}
+
+// folderChildren of each folder, keeping the order of the given folders.
+// Folders that aren't nested are the children of the empty ID.
+func folderChildren(folders []model.Folder) map[model.FolderID][]model.Folder {
+	children := map[model.FolderID][]model.Folder{}
+	for _, f := range folders {
+		var parentID model.FolderID
+		if f.ParentID != nil {
+			parentID = *f.ParentID
+		}
+		children[parentID] = append(children[parentID], f)
+	}
+	return children
+}
+
+// folderTree from a flat list of folders, ordered depth-first with each folder's children after it.
+func folderTree(folders []model.Folder) []folderNode {
+	children := folderChildren(folders)
+
+	var nodes []folderNode
+	var walk func(parentID model.FolderID, depth int)
+	walk = func(parentID model.FolderID, depth int) {
+		for _, f := range children[parentID] {
+			nodes = append(nodes, folderNode{Folder: f, Depth: depth})
+			walk(f.ID, depth+1)
+		}
+	}
+	walk("", 0)
+	return nodes
+}
+
+// folderOptions for a select, indented by nesting, with the given folder selected.
+func folderOptions(folders []model.Folder, selected model.FolderID) Node {
+	return Map(folderTree(folders), func(n folderNode) Node {
+		return Option(Value(n.Folder.ID.String()), Text(strings.Repeat("\u00a0\u00a0", n.Depth)+n.Folder.Name),
+			If(n.Folder.ID == selected, Selected()))
+	})
+}
@@ -1,7 +1,10 @@
 package html
 
 import (
+	"time"
+
 	. "maragu.dev/gomponents"
+	hx "maragu.dev/gomponents-htmx"
 	. "maragu.dev/gomponents/html"
 
 	"app/model"
@@ -9,18 +12,148 @@ import (
 
 type HomePageProps struct {
 	PageProps
+	Conversations []model.Conversation
+	Filter        model.GetConversationsFilter
+	Folders       []model.Folder
+	// MoreURL loads the next page of conversations, if there might be more.
+	MoreURL  string
+	Speakers []model.Speaker
+	Tags     []model.Tag
 }
 
-func HomePage(props HomePageProps, cs []model.Conversation) Node {
+func HomePage(props HomePageProps) Node {
 	return Page(props.PageProps,
-		Ol(
-			Map(cs, func(c model.Conversation) Node {
-				linkText := c.Topic
-				if linkText == "" {
-					linkText = c.ID.String()
-				}
-				return Li(A(Href("/conversations?id="+c.ID.String()), Text(linkText)))
-			}),
+		Div(Class("grid md:grid-cols-[16rem_1fr] gap-8"),
+			homeSidebar(props),
+
+			Div(
+				Form(Class("mb-8"), Method("post"), Action("/conversations"),
+					Input(Type("text"), Name("topic"), Placeholder("Topic")),
+					Button(Type("submit"), Text("New conversation")),
+				),
+
+				If(len(props.Conversations) == 0, P(Text("No conversations found."))),
+
+				Ol(
+					ConversationsPartial(props.Conversations, props.MoreURL),
+				),
+			),
+		),
+	)
+}
+
+// ConversationsPartial is a page of conversations in the list on the home page.
+// If there might be more, the last item loads the next page when it's scrolled into view, and is replaced by it.
+func ConversationsPartial(cs []model.Conversation, moreURL string) Node {
+	return Group{
+		Map(cs, func(c model.Conversation) Node {
+			linkText := c.Topic
+			if linkText == "" {
+				linkText = c.ID.String()
+			}
+			return Li(
+				If(c.Pinned, Span(Title("Pinned"), Text("★ "))),
+				A(Href("/conversations?id="+c.ID.String()), Text(linkText)),
+			)
+		}),
+
+		If(moreURL != "",
+			Li(Class("text-gray-500"), hx.Get(moreURL), hx.Trigger("revealed"), hx.Swap("outerHTML"), Text("Loading…")),
+		),
+	}
+}
+
+// homeSidebar filters the conversations on the home page, and has the folder tree.
+func homeSidebar(props HomePageProps) Node {
+	f := props.Filter
+
+	var to string
+	if !f.To.T.IsZero() {
+		// The filter's to date is exclusive, but the form's is inclusive
+		to = f.To.T.AddDate(0, 0, -1).Format(time.DateOnly)
+	}
+	var from string
+	if !f.From.T.IsZero() {
+		from = f.From.T.Format(time.DateOnly)
+	}
+
+	return Aside(Class("space-y-8"),
+		Form(Class("space-y-2"), Method("get"), Action("/"),
+			H2(Text("Filter")),
+
+			Label(Class("block"),
+				Input(Type("checkbox"), Name("pinned"), Value("true"), If(f.Pinned, Checked())),
+				Text(" Pinned"),
+			),
+
+			Label(Class("block"), Text("Folder "),
+				Select(Name("folder"),
+					Option(Value(""), Text("All")),
+					folderOptions(props.Folders, f.FolderID),
+				),
+			),
+
+			Label(Class("block"), Text("Tag "),
+				Select(Name("tag"),
+					Option(Value(""), Text("All")),
+					Map(props.Tags, func(t model.Tag) Node {
+						return Option(Value(t.ID.String()), Text(t.Name), If(t.ID == f.TagID, Selected()))
+					}),
+				),
+			),
+
+			Label(Class("block"), Text("Speaker "),
+				Select(Name("speaker"),
+					Option(Value(""), Text("All")),
+					Map(props.Speakers, func(s model.Speaker) Node {
+						return Option(Value(s.ID.String()), Text(s.Name), If(s.ID == f.SpeakerID, Selected()))
+					}),
+				),
+			),
+
+			Label(Class("block"), Text("From "), Input(Type("date"), Name("from"), Value(from))),
+			Label(Class("block"), Text("To "), Input(Type("date"), Name("to"), Value(to))),
+
+			Div(Class("flex gap-4"),
+				Button(Type("submit"), Text("Filter")),
+				A(Href("/"), Text("Clear")),
+			),
+		),
+
+		Div(Class("space-y-2"),
+			H2(Text("Folders")),
+
+			folderList(folderChildren(props.Folders), "", f.FolderID),
+
+			Form(Class("space-y-2"), Method("post"), Action("/folders"),
+				Input(Type("text"), Name("name"), Placeholder("Folder name"), Required()),
+				Select(Name("parent_id"),
+					Option(Value(""), Text("No parent folder")),
+					folderOptions(props.Folders, ""),
+				),
+				Button(Type("submit"), Text("New folder")),
+			),
 		),
 	)
 }
+
+// folderList of the folders in the parent folder, with the folders nested in each of them in a list of their own.
+func folderList(children map[model.FolderID][]model.Folder, parentID, selected model.FolderID) Node {
+	if len(children[parentID]) == 0 {
+		return nil
+	}
+
+	return Ul(If(parentID != "", Class("pl-4")),
+		Map(children[parentID], func(folder model.Folder) Node {
+			return Li(
+				A(If(folder.ID == selected, Class("font-bold")), Href("/?folder="+folder.ID.String()), Text(folder.Name)),
+				Text(" "),
+				Form(Class("inline"), Method("post"), Action("/folders/delete"),
+					Input(Type("hidden"), Name("id"), Value(folder.ID.String())),
+					Button(Type("submit"), Title("Delete folder and the folders in it"), Text("×")),
+				),
+				folderList(children, folder.ID, selected),
+			)
+		}),
+	)
+}
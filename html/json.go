@@ -0,0 +1,80 @@
+package html
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+
+	. "maragu.dev/gomponents"
+	. "maragu.dev/gomponents/html"
+)
+
+// jsonTree of the JSON value, with objects and arrays as nested lists, keeping the order of object keys.
+// Invalid JSON is shown as it is.
+func jsonTree(v []byte) Node {
+	dec := json.NewDecoder(bytes.NewReader(v))
+	dec.UseNumber()
+
+	n, err := jsonNode(dec)
+	if err != nil {
+		return Pre(Text(string(v)))
+	}
+	return Div(Class("my-4 font-mono text-sm"), n)
+}
+
+func jsonNode(dec *json.Decoder) (Node, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok := tok.(type) {
+	case json.Delim:
+		var items Group
+		for i := 0; dec.More(); i++ {
+			var label Node
+			if tok == '{' {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				label = Span(Class("font-bold"), Textf("%v: ", key))
+			} else {
+				label = Span(Class("text-gray-500"), Textf("%d: ", i))
+			}
+
+			n, err := jsonNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, Li(label, n))
+		}
+		// The closing delimiter
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+
+		if len(items) == 0 {
+			if tok == '{' {
+				return Span(Class("text-gray-500"), Text("{}")), nil
+			}
+			return Span(Class("text-gray-500"), Text("[]")), nil
+		}
+		return Ul(Class("pl-4 border-l border-gray-200"), items), nil
+
+	case string:
+		return Span(Class("text-green-700 dark:text-green-400"), Text(strconv.Quote(tok))), nil
+
+	case json.Number:
+		return Span(Class("text-blue-700 dark:text-blue-400"), Text(tok.String())), nil
+
+	case bool:
+		if tok {
+			return Span(Class("text-primary-600"), Text("true")), nil
+		}
+		return Span(Class("text-primary-600"), Text("false")), nil
+
+	default:
+		return Span(Class("text-gray-500"), Text("null")), nil
+	}
+}
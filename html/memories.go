@@ -0,0 +1,54 @@
+package html
+
+import (
+	. "maragu.dev/gomponents"
+	. "maragu.dev/gomponents/html"
+
+	"app/model"
+)
+
+// SpeakerMemoriesPage shows what a speaker remembers across conversations, newest first,
+// where each memory can be changed or forgotten, and new memories written.
+func SpeakerMemoriesPage(props PageProps, s model.Speaker, memories []model.Memory) Node {
+	props.Title = s.Name + " memories"
+
+	return Page(props,
+		H1(Text(props.Title)),
+
+		Div(Class("space-y-8"),
+			Form(Class("space-y-2"), Method("post"), Action("/speakers/memories"),
+				Input(Type("hidden"), Name("id"), Value(s.ID.String())),
+				Textarea(Class("w-full border border-gray-200 rounded-lg p-4"), Name("content"), Rows("2"), Required(),
+					Placeholder("Something "+s.Name+" should remember")),
+				Button(Type("submit"), Text("Remember")),
+			),
+
+			If(len(memories) == 0, P(Textf("%v doesn't remember anything yet.", s.Name))),
+
+			Map(memories, func(m model.Memory) Node {
+				return Div(Class("space-y-2"),
+					Form(Class("space-y-2"), Method("post"), Action("/speakers/memories"),
+						Input(Type("hidden"), Name("id"), Value(s.ID.String())),
+						Input(Type("hidden"), Name("memory_id"), Value(m.ID.String())),
+						Textarea(Class("w-full border border-gray-200 rounded-lg p-4"), Name("content"), Rows("2"), Required(), Text(m.Content)),
+						P(Class("text-sm text-gray-500"),
+							Text(m.Created.Pretty()),
+							Iff(m.ConversationID != nil, func() Node {
+								return Group{
+									Text(", from "),
+									A(Href("/conversations?id="+m.ConversationID.String()), Text("a conversation")),
+								}
+							}),
+						),
+						Button(Type("submit"), Text("Save")),
+					),
+					Form(Method("post"), Action("/speakers/memories/delete"),
+						Input(Type("hidden"), Name("id"), Value(s.ID.String())),
+						Input(Type("hidden"), Name("memory_id"), Value(m.ID.String())),
+						Button(Type("submit"), Text("Forget")),
+					),
+				)
+			}),
+		),
+	)
+}
@@ -0,0 +1,77 @@
+package html
+
+import (
+	"time"
+
+	. "maragu.dev/gomponents"
+	. "maragu.dev/gomponents/html"
+
+	"app/model"
+)
+
+// SharePage shows a shared conversation read-only, to anyone with the link.
+func SharePage(props PageProps, cd model.ConversationDocument) Node {
+	props.Title = cd.Conversation.Topic
+	if props.Title == "" {
+		props.Title = "Shared conversation"
+	}
+
+	return publicPage(props,
+		H1(Text(props.Title)),
+
+		Div(Class("space-y-8"),
+			TurnsPartial(cd, true),
+		),
+	)
+}
+
+// shares of the conversation, each with its link and a button to revoke it, and a form to create a share.
+func shares(c model.Conversation, shares []model.Share) Node {
+	now := time.Now()
+
+	return Details(Class("mb-8"),
+		Summary(Class("cursor-pointer"), Text("Share")),
+
+		Ul(Class("my-4 space-y-2"),
+			Map(shares, func(s model.Share) Node {
+				var status string
+				switch {
+				case !s.Revoked.T.IsZero():
+					status = "Revoked " + s.Revoked.Pretty()
+				case !s.Expires.T.IsZero() && !now.Before(s.Expires.T):
+					status = "Expired " + s.Expires.Pretty()
+				case !s.Expires.T.IsZero():
+					status = "Expires " + s.Expires.Pretty()
+				default:
+					status = "Doesn't expire"
+				}
+
+				return Li(Class("flex flex-wrap gap-4"),
+					If(s.Active(now), A(Href("/share?token="+s.Token), Text("Shared "+s.Created.Pretty()))),
+					If(!s.Active(now), Span(Class("text-gray-500"), Text("Shared "+s.Created.Pretty()))),
+					Span(Class("text-gray-500"), Text(status)),
+					If(s.Active(now), Form(Method("post"), Action("/conversations/shares/revoke"),
+						Input(Type("hidden"), Name("id"), Value(c.ID.String())),
+						Input(Type("hidden"), Name("share_id"), Value(s.ID.String())),
+						Button(Type("submit"), Text("Revoke")),
+					)),
+				)
+			}),
+		),
+
+		Form(Method("post"), Action("/conversations/shares"),
+			Input(Type("hidden"), Name("id"), Value(c.ID.String())),
+			P(Class("text-sm text-gray-500"), Text("Anyone with the link can read the conversation as it is now, without speaker system prompts.")),
+			Label(Text("Expires "),
+				Select(Name("days"),
+					Option(Value(""), Text("Never")),
+					Option(Value("1"), Text("After 1 day")),
+					Option(Value("7"), Text("After 7 days")),
+					Option(Value("30"), Text("After 30 days")),
+				),
+			),
+			Text(" "),
+			Button(Type("submit"), Text("Create link")),
+		),
+	)
+}
@@ -0,0 +1,343 @@
+package html
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	. "maragu.dev/gomponents"
+	hx "maragu.dev/gomponents-htmx"
+	. "maragu.dev/gomponents/components"
+	. "maragu.dev/gomponents/html"
+
+	"app/model"
+)
+
+func SpeakersPage(props PageProps, speakers []model.Speaker) Node {
+	props.Title = "Speakers"
+
+	return Page(props,
+		H1(Text(props.Title)),
+
+		P(A(Href("/speakers/edit"), Text("New speaker"))),
+
+		Form(Class("space-y-2"), Method("post"), Action("/speakers/import"), EncType("multipart/form-data"),
+			Label(Text("Import persona files (YAML or JSON) "),
+				Input(Type("file"), Name("files"), Multiple(), Accept(".yaml,.yml,.json"), Required()),
+			),
+			Label(Class("block"),
+				Input(Type("checkbox"), Name("replace"), Value("true")),
+				Text(" Replace speakers with the same name"),
+			),
+			Button(Type("submit"), Text("Import")),
+		),
+
+		Ol(
+			Map(speakers, func(s model.Speaker) Node {
+				return Li(
+					Text(s.Name+" "),
+					A(Href("/speakers/edit?id="+s.ID.String()), Text("Edit")), Text(" "),
+					A(Href("/speakers/revisions?id="+s.ID.String()), Text("Revisions")), Text(" "),
+					A(Href("/speakers/fallbacks?id="+s.ID.String()), Text("Fallback models")), Text(" "),
+					A(Href("/speakers/memories?id="+s.ID.String()), Text("Memories")), Text(" "),
+					A(Href("/speakers/export?id="+s.ID.String()), Text("Export YAML")), Text(" "),
+					A(Href("/speakers/export?format=json&id="+s.ID.String()), Text("Export JSON")), Text(" "),
+					Form(Class("inline"), Method("post"), Action("/speakers/delete"),
+						Input(Type("hidden"), Name("id"), Value(s.ID.String())),
+						Button(Type("submit"), Text("Delete")),
+					),
+				)
+			}),
+		),
+	)
+}
+
+// ImportedPersona is the result of importing a persona file.
+type ImportedPersona struct {
+	File   string
+	Name   string
+	Change model.Change
+	Error  string
+}
+
+// SpeakerImportPage reports what importing each persona file did, or why it failed.
+func SpeakerImportPage(props PageProps, imported []ImportedPersona) Node {
+	props.Title = "Imported speakers"
+
+	return Page(props,
+		H1(Text(props.Title)),
+
+		Ul(
+			Map(imported, func(i ImportedPersona) Node {
+				if i.Error != "" {
+					return Li(Textf("%v: ", i.File), Span(Class("text-red-600"), Text(i.Error)))
+				}
+				return Li(Textf("%v: %v %v", i.File, i.Name, i.Change))
+			}),
+		),
+
+		P(A(Href("/speakers"), Text("Back to speakers"))),
+	)
+}
+
+type SpeakerPageProps struct {
+	PageProps
+	Speaker model.Speaker
+	Models  []model.Model
+	// Preview of the speaker's rendered system prompt.
+	Preview Node
+}
+
+// SpeakerPage lets the user create a speaker, or edit an existing one.
+// The system prompt is a template, and its rendered preview updates while typing.
+func SpeakerPage(props SpeakerPageProps) Node {
+	props.Title = "New speaker"
+	if props.Speaker.ID != "" {
+		props.Title = props.Speaker.Name
+	}
+
+	config, outputSchema := splitOutputSchema(props.Speaker.Config)
+
+	return Page(props.PageProps,
+		H1(Text(props.Title)),
+
+		Form(Class("space-y-4"), Method("post"), Action("/speakers/edit"),
+			Input(Type("hidden"), Name("id"), Value(props.Speaker.ID.String())),
+
+			Label(Class("block"), Text("Name"),
+				Input(Class("block w-full"), Type("text"), Name("name"), Value(props.Speaker.Name), Required()),
+			),
+
+			Label(Class("block"), Text("Model"),
+				Select(Class("block"), Name("model_id"),
+					Map(props.Models, func(m model.Model) Node {
+						return Option(Value(m.ID.String()), Textf("%v (%v)", m.Name, m.Provider), If(m.ID == props.Speaker.ModelID, Selected()))
+					}),
+				),
+			),
+
+			Label(Class("block"), Text("System prompt"),
+				Textarea(Class("block w-full border border-gray-200 rounded-lg p-4"), Name("system"), Rows("8"),
+					hx.Post("/speakers/preview"), hx.Trigger("input changed delay:500ms"), hx.Target("#preview"), hx.Include("closest form"),
+					Text(props.Speaker.System),
+				),
+			),
+			P(Class("text-sm text-gray-500"),
+				Text("The system prompt is a Go template. Use {{.Date}}, {{.Now}}, {{.Speaker}}, {{.User}}, {{.Topic}}, "+
+					`{{join .Participants ", "}}, and the conversation's variables like {{.Vars.name}}.`),
+			),
+
+			Div(ID("preview"), props.Preview),
+
+			Label(Class("block"), Text("Config"),
+				Textarea(Class("block w-full border border-gray-200 rounded-lg p-4 font-mono"), Name("config"), Rows("4"), Text(config)),
+			),
+
+			Label(Class("block"), Text("Output schema"),
+				Textarea(Class("block w-full border border-gray-200 rounded-lg p-4 font-mono"), Name("output_schema"), Rows("8"), Text(outputSchema)),
+			),
+			P(Class("text-sm text-gray-500"),
+				Text("A JSON Schema that replies must match, like {\"type\": \"object\", \"properties\": {…}}. Leave empty for replies in plain text."),
+			),
+
+			Button(Type("submit"), Text("Save")),
+		),
+	)
+}
+
+// splitOutputSchema out of the speaker config, so it can be edited on its own.
+// Both are returned as indented JSON, and the schema is empty if the config doesn't have one.
+func splitOutputSchema(config model.JSON) (string, string) {
+	var c map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(config), &c); err != nil || c == nil {
+		if config == "" {
+			return "{}", ""
+		}
+		return string(config), ""
+	}
+
+	schema, ok := c["outputSchema"]
+	if !ok {
+		return string(config), ""
+	}
+	delete(c, "outputSchema")
+
+	rest, _ := json.MarshalIndent(c, "", "  ")
+	var indented bytes.Buffer
+	_ = json.Indent(&indented, schema, "", "  ")
+	return string(rest), indented.String()
+}
+
+// SpeakerPromptPreviewPartial shows the rendered system prompt of a speaker, or why it couldn't be rendered.
+func SpeakerPromptPreviewPartial(system string, err error) Node {
+	if err != nil {
+		return P(Class("text-red-600"), Text("Error in system prompt: "+err.Error()))
+	}
+	return Div(
+		P(Class("text-sm text-gray-500"), Text("Preview, with example values for a conversation:")),
+		Pre(Class("whitespace-pre-wrap border border-gray-200 rounded-lg p-4"), Text(system)),
+	)
+}
+
+type SpeakerRevisionsPageProps struct {
+	PageProps
+	Speaker   model.Speaker
+	Revisions []model.SpeakerRevision
+	From, To  model.SpeakerRevision
+}
+
+// SpeakerRevisionsPage shows the revision history of a speaker, a diff between two revisions,
+// and lets the user roll back to an earlier revision.
+func SpeakerRevisionsPage(props SpeakerRevisionsPageProps) Node {
+	props.Title = props.Speaker.Name + " revisions"
+
+	return Page(props.PageProps,
+		H1(Text(props.Title)),
+
+		Div(Class("space-y-8"),
+			Table(Class("w-full text-left"),
+				THead(Tr(Th(Text("Revision")), Th(Text("Created")), Th(Text("Name")), Th(), Th())),
+				TBody(
+					Map(props.Revisions, func(sr model.SpeakerRevision) Node {
+						return Tr(Classes{"font-bold": sr.ID == props.To.ID || sr.ID == props.From.ID},
+							Td(Textf("v%d", sr.Revision)),
+							Td(Text(sr.Created.Pretty())),
+							Td(Text(sr.Name)),
+							Td(If(sr.ID != props.To.ID,
+								A(Href(fmt.Sprintf("/speakers/revisions?id=%v&from=%d&to=%d", props.Speaker.ID, sr.Revision, props.To.Revision)),
+									Text("Compare")),
+							)),
+							Td(If(sr.Revision != props.Revisions[0].Revision,
+								Form(Method("post"), Action("/speakers/rollback"),
+									Input(Type("hidden"), Name("id"), Value(props.Speaker.ID.String())),
+									Input(Type("hidden"), Name("revision_id"), Value(sr.ID.String())),
+									Button(Type("submit"), Text("Roll back")),
+								),
+							)),
+						)
+					}),
+				),
+			),
+
+			H2(Textf("v%d → v%d", props.From.Revision, props.To.Revision)),
+
+			speakerRevisionDiff("Model", props.From.ModelID.String(), props.To.ModelID.String()),
+			speakerRevisionDiff("Name", props.From.Name, props.To.Name),
+			speakerRevisionDiff("System", props.From.System, props.To.System),
+			speakerRevisionDiff("Config", string(props.From.Config), string(props.To.Config)),
+		),
+	)
+}
+
+type SpeakerFallbackModelsPageProps struct {
+	PageProps
+	Speaker          model.Speaker
+	Models           []model.Model
+	FallbackModelIDs []model.ModelID
+}
+
+// SpeakerFallbackModelsPage lets the user choose the models to fall back to, in order,
+// when the speaker's own model is unavailable.
+func SpeakerFallbackModelsPage(props SpeakerFallbackModelsPageProps) Node {
+	props.Title = props.Speaker.Name + " fallback models"
+
+	// One extra choice, so a fallback model can be added
+	choices := append(slices.Clone(props.FallbackModelIDs), "")
+
+	return Page(props.PageProps,
+		H1(Text(props.Title)),
+
+		Form(Class("space-y-4"), Method("post"), Action("/speakers/fallbacks"),
+			Input(Type("hidden"), Name("id"), Value(props.Speaker.ID.String())),
+
+			Ol(Class("list-decimal list-inside"),
+				Map(choices, func(selected model.ModelID) Node {
+					return Li(
+						Select(Name("model_id"),
+							Option(Value(""), Text("None")),
+							Map(props.Models, func(m model.Model) Node {
+								if m.Provider == model.ProviderBrain || m.ID == props.Speaker.ModelID {
+									return nil
+								}
+								return Option(Value(m.ID.String()), Textf("%v (%v)", m.Name, m.Provider), If(m.ID == selected, Selected()))
+							}),
+						),
+					)
+				}),
+			),
+
+			Button(Type("submit"), Text("Save")),
+		),
+	)
+}
+
+func speakerRevisionDiff(label, from, to string) Node {
+	return Div(
+		H3(Text(label)),
+		Pre(Class("border border-gray-200 rounded-lg p-4 whitespace-pre-wrap"),
+			Map(diffLines(from, to), func(l diffLine) Node {
+				return Div(
+					Classes{
+						"bg-green-100 dark:bg-green-900": l.Op == '+',
+						"bg-red-100 dark:bg-red-900":     l.Op == '-',
+					},
+					Textf("%c %v", l.Op, l.Text),
+				)
+			}),
+		),
+	)
+}
+
+type diffLine struct {
+	Op   rune
+	Text string
+}
+
+// diffLines between a and b, using the longest common subsequence of lines.
+// Unchanged lines have a space as their op, removed lines '-', and added lines '+'.
+func diffLines(a, b string) []diffLine {
+	as := strings.Split(a, "\n")
+	bs := strings.Split(b, "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of as[i:] and bs[j:]
+	lcs := make([][]int, len(as)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bs)+1)
+	}
+	for i := len(as) - 1; i >= 0; i-- {
+		for j := len(bs) - 1; j >= 0; j-- {
+			if as[i] == bs[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(as) && j < len(bs) {
+		switch {
+		case as[i] == bs[j]:
+			lines = append(lines, diffLine{Op: ' ', Text: as[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, diffLine{Op: '-', Text: as[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{Op: '+', Text: bs[j]})
+			j++
+		}
+	}
+	for ; i < len(as); i++ {
+		lines = append(lines, diffLine{Op: '-', Text: as[i]})
+	}
+	for ; j < len(bs); j++ {
+		lines = append(lines, diffLine{Op: '+', Text: bs[j]})
+	}
+
+	return lines
+}
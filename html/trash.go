@@ -0,0 +1,86 @@
+package html
+
+import (
+	. "maragu.dev/gomponents"
+	. "maragu.dev/gomponents/html"
+
+	"app/model"
+)
+
+// TrashPage lists deleted conversations, turns, and speakers, each of which can be restored
+// until the trash is purged.
+func TrashPage(props PageProps, trash model.Trash) Node {
+	props.Title = "Trash"
+
+	return Page(props,
+		H1(Text(props.Title)),
+
+		If(len(trash.Conversations) == 0 && len(trash.Turns) == 0 && len(trash.Speakers) == 0,
+			P(Text("The trash is empty.")),
+		),
+
+		Div(Class("space-y-8"),
+			If(len(trash.Conversations) > 0, Div(
+				H2(Text("Conversations")),
+				trashTable(
+					Map(trash.Conversations, func(c model.Conversation) Node {
+						topic := c.Topic
+						if topic == "" {
+							topic = c.ID.String()
+						}
+						return trashRow("conversation", c.ID.String(), c.Deleted, Td(Text(topic)))
+					}),
+				),
+			)),
+
+			If(len(trash.Turns) > 0, Div(
+				H2(Text("Turns")),
+				trashTable(
+					Map(trash.Turns, func(t model.TrashedTurn) Node {
+						return trashRow("turn", t.ID.String(), t.Deleted,
+							Td(A(Href("/conversations?id="+t.ConversationID.String()), Text(t.Topic))),
+							Td(Text(t.SpeakerName+": "+excerpt(t.Content, 80))),
+						)
+					}),
+				),
+			)),
+
+			If(len(trash.Speakers) > 0, Div(
+				H2(Text("Speakers")),
+				trashTable(
+					Map(trash.Speakers, func(s model.Speaker) Node {
+						return trashRow("speaker", s.ID.String(), s.Deleted, Td(Text(s.Name)))
+					}),
+				),
+			)),
+		),
+	)
+}
+
+func trashTable(rows Node) Node {
+	return Table(Class("w-full text-left"), TBody(rows))
+}
+
+// trashRow with when the thing of the given type and ID was deleted, the given cells, and a button to restore it.
+func trashRow(typ, id string, deleted model.Time, cells ...Node) Node {
+	return Tr(
+		Td(Text(deleted.Pretty())),
+		Group(cells),
+		Td(
+			Form(Method("post"), Action("/trash/restore"),
+				Input(Type("hidden"), Name("type"), Value(typ)),
+				Input(Type("hidden"), Name("id"), Value(id)),
+				Button(Type("submit"), Text("Restore")),
+			),
+		),
+	)
+}
+
+// excerpt of s with at most n runes, cut off with an ellipsis if it's longer.
+func excerpt(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "…"
+}
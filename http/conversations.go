@@ -4,37 +4,574 @@ import (
 	"context"
 	"log/slog"
 	"net/http"
+	"strings"
 
+	"maragu.dev/errors"
 	. "maragu.dev/gomponents"
 	hx "maragu.dev/gomponents-htmx/http"
+	"maragu.dev/httph"
 
 	"app/html"
+	"app/llm"
 	"app/model"
 )
 
-type conversationGetter interface {
-	GetConversationDocument(ctx context.Context, id model.ConversationID) (model.ConversationDocument, error)
+type conversationsDB interface {
+	CancelTurn(ctx context.Context, id model.TurnID) error
+	DeleteConversation(ctx context.Context, id model.ConversationID) error
+	DeleteTurn(ctx context.Context, id model.TurnID) error
+	ForgetTurn(ctx context.Context, id model.TurnID) error
+	GetConversationDocumentPage(ctx context.Context, id model.ConversationID, f model.GetTurnsFilter) (model.ConversationDocument, error)
+	GetFolders(ctx context.Context) ([]model.Folder, error)
+	GetModels(ctx context.Context) ([]model.Model, error)
+	GetShares(ctx context.Context, id model.ConversationID) ([]model.Share, error)
+	GetSpeakers(ctx context.Context) ([]model.Speaker, error)
+	GetTurn(ctx context.Context, id model.TurnID) (model.Turn, error)
+	MoveConversation(ctx context.Context, id model.ConversationID, folderID *model.FolderID) error
+	PauseConversation(ctx context.Context, id model.ConversationID, paused bool) error
+	PickCandidate(ctx context.Context, id model.TurnID) error
+	PinConversation(ctx context.Context, id model.ConversationID, pinned bool) error
+	PinTurn(ctx context.Context, id model.TurnID, pinned bool) error
+	RememberTurn(ctx context.Context, id model.TurnID) ([]model.Memory, error)
+	RetryTurn(ctx context.Context, id model.TurnID) error
+	SaveConversation(ctx context.Context, c model.Conversation) (model.Conversation, error)
+	SaveTurnWithReplies(ctx context.Context, t model.Turn, speakerIDs []model.SpeakerID) (model.Turn, []model.Turn, error)
+	TagConversation(ctx context.Context, id model.ConversationID, name string) (model.Tag, error)
+	UntagConversation(ctx context.Context, id model.ConversationID, tagID model.TagID) error
+	UpdateConversationSystem(ctx context.Context, id model.ConversationID, system string) error
+	UpdateConversationVariables(ctx context.Context, id model.ConversationID, vars model.Variables) error
 }
 
-func Conversations(r *Router, log *slog.Logger, db conversationGetter) {
+type providerStatuser interface {
+	ProviderStatuses() []llm.ProviderStatus
+}
+
+// turnsPageSize is how many turns are shown at first, and loaded at a time when loading earlier turns.
+const turnsPageSize = 50
+
+func Conversations(r *Router, log *slog.Logger, db conversationsDB, ps providerStatuser) {
+	// The page shows the latest turns, and htmx requests either load earlier turns before a turn,
+	// or poll for changes to the turns since the first turn shown when the page was loaded
 	r.Get("/conversations", func(props html.PageProps) (Node, error) {
-		id := model.ConversationID(props.R.URL.Query().Get("id"))
+		q := props.R.URL.Query()
+		id := model.ConversationID(q.Get("id"))
 
 		if id == "" {
 			http.Error(props.W, "id is required", http.StatusBadRequest)
 			return nil, nil
 		}
 
-		cd, err := db.GetConversationDocument(props.Ctx, id)
+		f := model.GetTurnsFilter{Limit: turnsPageSize}
+		isHX := hx.IsRequest(props.R.Header)
+		switch {
+		case isHX && q.Get("before") != "":
+			f.Before = model.TurnID(q.Get("before"))
+		case isHX:
+			f = model.GetTurnsFilter{Since: model.TurnID(q.Get("since"))}
+		}
+
+		cd, err := db.GetConversationDocumentPage(props.Ctx, id, f)
 		if err != nil {
 			log.Info("Error getting conversation document", "error", err)
 			return html.ErrorPage(), err
 		}
 
-		if hx.IsRequest(props.R.Header) {
-			return html.TurnsPartial(cd), nil
+		if isHX {
+			if f.Before != "" {
+				return html.EarlierTurnsPartial(cd), nil
+			}
+			return html.TurnsPartial(cd, false), nil
+		}
+
+		speakers, err := db.GetSpeakers(props.Ctx)
+		if err != nil {
+			log.Info("Error getting speakers", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		models, err := db.GetModels(props.Ctx)
+		if err != nil {
+			log.Info("Error getting models", "error", err)
+			return html.ErrorPage(), err
 		}
 
-		return html.ConversationsPage(props, cd), nil
+		folders, err := db.GetFolders(props.Ctx)
+		if err != nil {
+			log.Info("Error getting folders", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		shares, err := db.GetShares(props.Ctx, id)
+		if err != nil {
+			log.Info("Error getting shares", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		return html.ConversationsPage(html.ConversationsPageProps{
+			PageProps:        props,
+			Document:         cd,
+			Folders:          folders,
+			Models:           models,
+			ProviderStatuses: ps.ProviderStatuses(),
+			Shares:           shares,
+			Speakers:         speakers,
+		}), nil
 	})
+
+	r.Post("/conversations", func(props html.PageProps) (Node, error) {
+		c, err := db.SaveConversation(props.Ctx, model.Conversation{Topic: props.R.FormValue("topic")})
+		if err != nil {
+			log.Info("Error saving conversation", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		http.Redirect(props.W, props.R, "/conversations?id="+c.ID.String(), http.StatusFound)
+		return nil, nil
+	})
+
+	r.Post("/conversations/turns", func(props html.PageProps) (Node, error) {
+		if err := props.R.ParseForm(); err != nil {
+			http.Error(props.W, "error parsing form", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		t := model.Turn{
+			ConversationID: model.ConversationID(props.R.Form.Get("id")),
+			SpeakerID:      model.SpeakerID(props.R.Form.Get("speaker_id")),
+			Content:        props.R.Form.Get("content"),
+		}
+
+		if t.ConversationID == "" || t.SpeakerID == "" {
+			http.Error(props.W, "id and speaker_id are required", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		var speakerIDs []model.SpeakerID
+		for _, id := range props.R.Form["reply_speaker_id"] {
+			speakerIDs = append(speakerIDs, model.SpeakerID(id))
+		}
+
+		if _, _, err := db.SaveTurnWithReplies(props.Ctx, t, speakerIDs); err != nil {
+			if errors.Is(err, model.ErrorConversationNotFound) || errors.Is(err, model.ErrorSpeakerNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			if errors.Is(err, model.ErrorConversationPaused) {
+				http.Error(props.W, "conversation is paused, resume it to get replies", http.StatusConflict)
+				return nil, nil
+			}
+			if errors.Is(err, model.ErrorSpeakerCannotReply) {
+				http.Error(props.W, "only AI speakers can reply", http.StatusBadRequest)
+				return nil, nil
+			}
+			log.Info("Error saving turn with replies", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		http.Redirect(props.W, props.R, "/conversations?id="+t.ConversationID.String(), http.StatusFound)
+		return nil, nil
+	})
+
+	r.Post("/conversations/pick", func(props html.PageProps) (Node, error) {
+		id := model.TurnID(props.R.FormValue("id"))
+
+		if id == "" {
+			http.Error(props.W, "id is required", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		t, err := db.GetTurn(props.Ctx, id)
+		if err != nil {
+			if errors.Is(err, model.ErrorTurnNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error getting turn", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		if err := db.PickCandidate(props.Ctx, id); err != nil {
+			if errors.Is(err, model.ErrorTurnNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error picking candidate", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		http.Redirect(props.W, props.R, "/conversations?id="+t.ConversationID.String(), http.StatusFound)
+		return nil, nil
+	})
+
+	r.Post("/conversations/cancel", func(props html.PageProps) (Node, error) {
+		id := model.TurnID(props.R.FormValue("id"))
+
+		if id == "" {
+			http.Error(props.W, "id is required", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		t, err := db.GetTurn(props.Ctx, id)
+		if err != nil {
+			if errors.Is(err, model.ErrorTurnNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error getting turn", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		if err := db.CancelTurn(props.Ctx, id); err != nil {
+			if errors.Is(err, model.ErrorTurnNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error cancelling turn", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		http.Redirect(props.W, props.R, "/conversations?id="+t.ConversationID.String(), http.StatusFound)
+		return nil, nil
+	})
+
+	r.Post("/conversations/retry", func(props html.PageProps) (Node, error) {
+		id := model.TurnID(props.R.FormValue("id"))
+
+		if id == "" {
+			http.Error(props.W, "id is required", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		t, err := db.GetTurn(props.Ctx, id)
+		if err != nil {
+			if errors.Is(err, model.ErrorTurnNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error getting turn", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		if err := db.RetryTurn(props.Ctx, id); err != nil {
+			if errors.Is(err, model.ErrorTurnNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			if errors.Is(err, model.ErrorConversationPaused) {
+				http.Error(props.W, "conversation is paused, resume it to retry", http.StatusConflict)
+				return nil, nil
+			}
+			log.Info("Error retrying turn", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		http.Redirect(props.W, props.R, "/conversations?id="+t.ConversationID.String(), http.StatusFound)
+		return nil, nil
+	})
+
+	r.Post("/conversations/pause", func(props html.PageProps) (Node, error) {
+		id := model.ConversationID(props.R.FormValue("id"))
+		paused := props.R.FormValue("paused") == "true"
+
+		if id == "" {
+			http.Error(props.W, "id is required", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		if err := db.PauseConversation(props.Ctx, id, paused); err != nil {
+			if errors.Is(err, model.ErrorConversationNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error pausing conversation", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		http.Redirect(props.W, props.R, "/conversations?id="+id.String(), http.StatusFound)
+		return nil, nil
+	})
+
+	r.Post("/conversations/pin", func(props html.PageProps) (Node, error) {
+		id := model.ConversationID(props.R.FormValue("id"))
+		pinned := props.R.FormValue("pinned") == "true"
+
+		if id == "" {
+			http.Error(props.W, "id is required", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		if err := db.PinConversation(props.Ctx, id, pinned); err != nil {
+			if errors.Is(err, model.ErrorConversationNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error pinning conversation", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		http.Redirect(props.W, props.R, "/conversations?id="+id.String(), http.StatusFound)
+		return nil, nil
+	})
+
+	r.Post("/conversations/system", func(props html.PageProps) (Node, error) {
+		id := model.ConversationID(props.R.FormValue("id"))
+
+		if id == "" {
+			http.Error(props.W, "id is required", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		system := strings.TrimSpace(props.R.FormValue("system"))
+		if err := db.UpdateConversationSystem(props.Ctx, id, system); err != nil {
+			if errors.Is(err, model.ErrorConversationNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error updating conversation system context", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		http.Redirect(props.W, props.R, "/conversations?id="+id.String(), http.StatusFound)
+		return nil, nil
+	})
+
+	r.Post("/conversations/variables", func(props html.PageProps) (Node, error) {
+		id := model.ConversationID(props.R.FormValue("id"))
+
+		if id == "" {
+			http.Error(props.W, "id is required", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		vars, err := parseVariables(props.R.FormValue("variables"))
+		if err != nil {
+			http.Error(props.W, err.Error(), http.StatusBadRequest)
+			return nil, nil
+		}
+
+		if err := db.UpdateConversationVariables(props.Ctx, id, vars); err != nil {
+			if errors.Is(err, model.ErrorConversationNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error updating conversation variables", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		http.Redirect(props.W, props.R, "/conversations?id="+id.String(), http.StatusFound)
+		return nil, nil
+	})
+
+	// Move the conversation into a folder, or out of any folder if folder_id is empty
+	r.Post("/conversations/move", func(props html.PageProps) (Node, error) {
+		id := model.ConversationID(props.R.FormValue("id"))
+
+		if id == "" {
+			http.Error(props.W, "id is required", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		var folderID *model.FolderID
+		if v := model.FolderID(props.R.FormValue("folder_id")); v != "" {
+			folderID = &v
+		}
+
+		if err := db.MoveConversation(props.Ctx, id, folderID); err != nil {
+			if errors.Is(err, model.ErrorConversationNotFound) || errors.Is(err, model.ErrorFolderNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error moving conversation", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		http.Redirect(props.W, props.R, "/conversations?id="+id.String(), http.StatusFound)
+		return nil, nil
+	})
+
+	r.Post("/conversations/tags", func(props html.PageProps) (Node, error) {
+		id := model.ConversationID(props.R.FormValue("id"))
+		name := strings.TrimSpace(props.R.FormValue("name"))
+
+		if id == "" || name == "" {
+			http.Error(props.W, "id and name are required", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		if _, err := db.TagConversation(props.Ctx, id, name); err != nil {
+			if errors.Is(err, model.ErrorConversationNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error tagging conversation", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		http.Redirect(props.W, props.R, "/conversations?id="+id.String(), http.StatusFound)
+		return nil, nil
+	})
+
+	r.Post("/conversations/tags/delete", func(props html.PageProps) (Node, error) {
+		id := model.ConversationID(props.R.FormValue("id"))
+		tagID := model.TagID(props.R.FormValue("tag_id"))
+
+		if id == "" || tagID == "" {
+			http.Error(props.W, "id and tag_id are required", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		if err := db.UntagConversation(props.Ctx, id, tagID); err != nil {
+			if errors.Is(err, model.ErrorTagNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error untagging conversation", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		http.Redirect(props.W, props.R, "/conversations?id="+id.String(), http.StatusFound)
+		return nil, nil
+	})
+
+	r.Post("/conversations/delete", func(props html.PageProps) (Node, error) {
+		id := model.ConversationID(props.R.FormValue("id"))
+
+		if id == "" {
+			http.Error(props.W, "id is required", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		if err := db.DeleteConversation(props.Ctx, id); err != nil {
+			if errors.Is(err, model.ErrorConversationNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error deleting conversation", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		http.Redirect(props.W, props.R, "/", http.StatusFound)
+		return nil, nil
+	})
+
+	r.Post("/conversations/turns/delete", func(props html.PageProps) (Node, error) {
+		id := model.TurnID(props.R.FormValue("id"))
+
+		if id == "" {
+			http.Error(props.W, "id is required", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		t, err := db.GetTurn(props.Ctx, id)
+		if err != nil {
+			if errors.Is(err, model.ErrorTurnNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error getting turn", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		if err := db.DeleteTurn(props.Ctx, id); err != nil {
+			if errors.Is(err, model.ErrorTurnNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error deleting turn", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		http.Redirect(props.W, props.R, "/conversations?id="+t.ConversationID.String(), http.StatusFound)
+		return nil, nil
+	})
+
+	r.Post("/conversations/turns/pin", func(props html.PageProps) (Node, error) {
+		id := model.TurnID(props.R.FormValue("id"))
+		pinned := props.R.FormValue("pinned") == "true"
+
+		if id == "" {
+			http.Error(props.W, "id is required", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		t, err := db.GetTurn(props.Ctx, id)
+		if err != nil {
+			if errors.Is(err, model.ErrorTurnNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error getting turn", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		if err := db.PinTurn(props.Ctx, id, pinned); err != nil {
+			if errors.Is(err, model.ErrorTurnNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error pinning turn", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		http.Redirect(props.W, props.R, "/conversations?id="+t.ConversationID.String(), http.StatusFound)
+		return nil, nil
+	})
+
+	// Make the AI speakers in the conversation remember the turn in other conversations
+	r.Post("/conversations/turns/remember", func(props html.PageProps) (Node, error) {
+		id := model.TurnID(props.R.FormValue("id"))
+
+		if id == "" {
+			http.Error(props.W, "id is required", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		t, err := db.GetTurn(props.Ctx, id)
+		if err != nil {
+			if errors.Is(err, model.ErrorTurnNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error getting turn", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		if _, err := db.RememberTurn(props.Ctx, id); err != nil {
+			if errors.Is(err, model.ErrorTurnNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error remembering turn", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		http.Redirect(props.W, props.R, "/conversations?id="+t.ConversationID.String(), http.StatusFound)
+		return nil, nil
+	})
+
+	r.Post("/conversations/turns/forget", func(props html.PageProps) (Node, error) {
+		id := model.TurnID(props.R.FormValue("id"))
+
+		if id == "" {
+			http.Error(props.W, "id is required", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		t, err := db.GetTurn(props.Ctx, id)
+		if err != nil {
+			if errors.Is(err, model.ErrorTurnNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error getting turn", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		if err := db.ForgetTurn(props.Ctx, id); err != nil {
+			if errors.Is(err, model.ErrorTurnNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error forgetting turn", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		http.Redirect(props.W, props.R, "/conversations?id="+t.ConversationID.String(), http.StatusFound)
+		return nil, nil
+	})
+}
+
+// parseVariables from lines of name=value, skipping empty lines.
+func parseVariables(s string) (model.Variables, error) {
+	vars := model.Variables{}
+	for line := range strings.Lines(s) {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, errors.Newf("variable must be name=value, got %q", line)
+		}
+		vars[name] = strings.TrimSpace(value)
+	}
+	return vars, nil
 }
@@ -0,0 +1,161 @@
+package http_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	gluehttp "maragu.dev/glue/http"
+	"maragu.dev/glue/jobs"
+	"maragu.dev/is"
+
+	apphttp "app/http"
+	appjobs "app/jobs"
+	"app/llm"
+	"app/model"
+	"app/sqlite"
+	"app/sqlitetest"
+)
+
+func TestConversations(t *testing.T) {
+	t.Run("should create a conversation and generate a reply with a fake speaker", func(t *testing.T) {
+		s, db := newServer(t)
+		parrot := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+		me, err := db.GetSpeaker(t.Context(), model.GetSpeakerFilter{Name: "Me"})
+		is.NotError(t, err)
+
+		res := post(t, s, "/conversations", url.Values{"topic": {"Birds"}})
+		is.Equal(t, http.StatusFound, res.StatusCode)
+		location := res.Header.Get("Location")
+		is.True(t, strings.HasPrefix(location, "/conversations?id="))
+		id := strings.TrimPrefix(location, "/conversations?id=")
+
+		res = post(t, s, "/conversations/turns", url.Values{
+			"id":               {id},
+			"speaker_id":       {me.ID.String()},
+			"content":          {"Polly want a cracker?"},
+			"reply_speaker_id": {parrot.ID.String()},
+		})
+		is.Equal(t, http.StatusFound, res.StatusCode)
+		is.Equal(t, location, res.Header.Get("Location"))
+
+		var body string
+		for range 100 {
+			_, body = get(t, s, location)
+			if strings.Contains(body, "Echo: Polly want a cracker?") {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		is.True(t, strings.Contains(body, "Birds"))
+		is.True(t, strings.Contains(body, "Echo: Polly want a cracker?"))
+	})
+
+	t.Run("should not let a brain speaker reply", func(t *testing.T) {
+		s, db := newServer(t)
+		c := sqlitetest.NewConversation(t, db, "Birds")
+		me, err := db.GetSpeaker(t.Context(), model.GetSpeakerFilter{Name: "Me"})
+		is.NotError(t, err)
+
+		res := post(t, s, "/conversations/turns", url.Values{
+			"id":               {c.ID.String()},
+			"speaker_id":       {me.ID.String()},
+			"content":          {"Hello?"},
+			"reply_speaker_id": {me.ID.String()},
+		})
+		is.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+}
+
+func TestConversations_turns(t *testing.T) {
+	t.Run("should redirect to the conversation of the turn after an action", func(t *testing.T) {
+		s, db := newServer(t)
+		c := sqlitetest.NewConversation(t, db, "Birds")
+		me, err := db.GetSpeaker(t.Context(), model.GetSpeakerFilter{Name: "Me"})
+		is.NotError(t, err)
+		turn, err := db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: me.ID, Content: "Hello?"})
+		is.NotError(t, err)
+
+		res := post(t, s, "/conversations/turns/pin", url.Values{"id": {turn.ID.String()}, "pinned": {"true"}})
+		is.Equal(t, http.StatusFound, res.StatusCode)
+		is.Equal(t, "/conversations?id="+c.ID.String(), res.Header.Get("Location"))
+
+		turn, err = db.GetTurn(t.Context(), turn.ID)
+		is.NotError(t, err)
+		is.True(t, turn.Pinned)
+	})
+
+	t.Run("should respond with not found for a turn that doesn't exist", func(t *testing.T) {
+		s, _ := newServer(t)
+
+		res := post(t, s, "/conversations/turns/pin", url.Values{"id": {"t_123"}, "pinned": {"true"}})
+		is.Equal(t, http.StatusNotFound, res.StatusCode)
+	})
+}
+
+// newServer with the app routes on a new database, and a job runner with the fake provider,
+// which runs until the test ends.
+func newServer(t *testing.T) (*httptest.Server, *sqlite.Database) {
+	t.Helper()
+
+	db := sqlitetest.NewDatabase(t)
+	llmClient := llm.NewClient(llm.NewClientOptions{})
+
+	runner := jobs.NewRunner(jobs.NewRunnerOpts{Queue: db.H.JobsQ, PollInterval: 10 * time.Millisecond})
+	appjobs.Register(runner, appjobs.RegisterOpts{DB: db, LLM: llmClient})
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan struct{})
+	go func() {
+		runner.Start(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	r := gluehttp.NewRouter(gluehttp.NewRouterOpts{})
+	rm := appjobs.NewRunnerMonitor(appjobs.NewRunnerMonitorOpts{DB: db})
+	apphttp.InjectHTTPRouter(slog.New(slog.DiscardHandler), db, llmClient, rm, nil)(r)
+
+	s := httptest.NewServer(r.Mux)
+	t.Cleanup(s.Close)
+
+	return s, db
+}
+
+// get the path from the server, returning the status code and body.
+func get(t *testing.T, s *httptest.Server, path string) (int, string) {
+	t.Helper()
+
+	res, err := s.Client().Get(s.URL + path)
+	is.NotError(t, err)
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	b, err := io.ReadAll(res.Body)
+	is.NotError(t, err)
+	return res.StatusCode, string(b)
+}
+
+// post the form to the path on the server, without following redirects.
+func post(t *testing.T, s *httptest.Server, path string, form url.Values) *http.Response {
+	t.Helper()
+
+	c := *s.Client()
+	c.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	res, err := c.PostForm(s.URL+path, form)
+	is.NotError(t, err)
+	_ = res.Body.Close()
+	return res
+}
@@ -0,0 +1,77 @@
+package http
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"maragu.dev/errors"
+	. "maragu.dev/gomponents"
+	"maragu.dev/httph"
+
+	"app/html"
+	"app/model"
+)
+
+type credentialsDB interface {
+	DeleteCredential(ctx context.Context, name string) error
+	GetCredentials(ctx context.Context) ([]model.Credential, error)
+	SaveCredential(ctx context.Context, name string, value model.Secret) error
+}
+
+// Credentials lets the user manage the credentials stored in the database.
+// Values are never rendered or logged.
+func Credentials(r *Router, log *slog.Logger, db credentialsDB) {
+	r.Get("/credentials", func(props html.PageProps) (Node, error) {
+		credentials, err := db.GetCredentials(props.Ctx)
+		if err != nil {
+			log.Info("Error getting credentials", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		return html.CredentialsPage(props, credentials), nil
+	})
+
+	r.Post("/credentials", func(props html.PageProps) (Node, error) {
+		name := strings.TrimSpace(props.R.FormValue("name"))
+		value := model.Secret(strings.TrimSpace(props.R.FormValue("value")))
+
+		if name == "" || value == "" {
+			http.Error(props.W, "name and value are required", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		if err := db.SaveCredential(props.Ctx, name, value); err != nil {
+			if errors.Is(err, model.ErrorCredentialNameInvalid) || errors.Is(err, model.ErrorCredentialsKeyMissing) {
+				http.Error(props.W, err.Error(), http.StatusBadRequest)
+				return nil, nil
+			}
+			log.Info("Error saving credential", "name", name, "error", err)
+			return html.ErrorPage(), err
+		}
+
+		http.Redirect(props.W, props.R, "/credentials", http.StatusFound)
+		return nil, nil
+	})
+
+	r.Post("/credentials/delete", func(props html.PageProps) (Node, error) {
+		name := props.R.FormValue("name")
+
+		if name == "" {
+			http.Error(props.W, "name is required", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		if err := db.DeleteCredential(props.Ctx, name); err != nil {
+			if errors.Is(err, model.ErrorCredentialNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error deleting credential", "name", name, "error", err)
+			return html.ErrorPage(), err
+		}
+
+		http.Redirect(props.W, props.R, "/credentials", http.StatusFound)
+		return nil, nil
+	})
+}
@@ -0,0 +1,67 @@
+package http
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"maragu.dev/errors"
+	. "maragu.dev/gomponents"
+	"maragu.dev/httph"
+
+	"app/html"
+	"app/model"
+)
+
+type foldersDB interface {
+	DeleteFolder(ctx context.Context, id model.FolderID) error
+	SaveFolder(ctx context.Context, f model.Folder) (model.Folder, error)
+}
+
+func Folders(r *Router, log *slog.Logger, db foldersDB) {
+	r.Post("/folders", func(props html.PageProps) (Node, error) {
+		f := model.Folder{Name: strings.TrimSpace(props.R.FormValue("name"))}
+
+		if f.Name == "" {
+			http.Error(props.W, "name is required", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		if parentID := model.FolderID(props.R.FormValue("parent_id")); parentID != "" {
+			f.ParentID = &parentID
+		}
+
+		f, err := db.SaveFolder(props.Ctx, f)
+		if err != nil {
+			if errors.Is(err, model.ErrorFolderNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error saving folder", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		http.Redirect(props.W, props.R, "/?folder="+f.ID.String(), http.StatusFound)
+		return nil, nil
+	})
+
+	r.Post("/folders/delete", func(props html.PageProps) (Node, error) {
+		id := model.FolderID(props.R.FormValue("id"))
+
+		if id == "" {
+			http.Error(props.W, "id is required", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		if err := db.DeleteFolder(props.Ctx, id); err != nil {
+			if errors.Is(err, model.ErrorFolderNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error deleting folder", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		http.Redirect(props.W, props.R, "/", http.StatusFound)
+		return nil, nil
+	})
+}
@@ -0,0 +1,107 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"app/model"
+)
+
+type healthDB interface {
+	CheckMigrations(ctx context.Context) error
+	GetModels(ctx context.Context) ([]model.Model, error)
+	Ping(ctx context.Context) error
+}
+
+type runnerChecker interface {
+	Check(ctx context.Context) error
+}
+
+type prober interface {
+	Probe(ctx context.Context, m model.Model) error
+}
+
+// readinessTimeout is the longest all readiness checks together can take.
+const readinessTimeout = 5 * time.Second
+
+// Health has /healthz for liveness, which only says that the app is serving requests,
+// and /readyz for readiness, which checks the database, migrations, and job runner.
+// Models of the probeProviders are probed as well, for example a local llama.cpp server.
+// Providers that don't have a URL to probe are left out, see [model.Provider.HasURL].
+// Both respond with plain text, with one line per check for /readyz, and 503 Service Unavailable if any check fails.
+func Health(r *Router, log *slog.Logger, db healthDB, rc runnerChecker, p prober, probeProviders []model.Provider) {
+	probeProviders = slices.DeleteFunc(slices.Clone(probeProviders), func(p model.Provider) bool {
+		if !p.HasURL() {
+			log.Info("Not probing provider for readiness, since it doesn't have a URL", "provider", p)
+			return true
+		}
+		return false
+	})
+
+	r.Mux.Get("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte("ok\n"))
+	})
+
+	r.Mux.Get("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+
+		type check struct {
+			name string
+			err  error
+		}
+		checks := []check{
+			{"database", db.Ping(ctx)},
+			{"migrations", db.CheckMigrations(ctx)},
+			{"jobs", rc.Check(ctx)},
+		}
+
+		if len(probeProviders) > 0 {
+			models, err := db.GetModels(ctx)
+			if err != nil {
+				checks = append(checks, check{"providers", err})
+			}
+
+			// Probe each address once, since many models can be served from the same place
+			probed := map[string]bool{}
+			for _, m := range models {
+				if !slices.Contains(probeProviders, m.Provider) {
+					continue
+				}
+				u, err := m.URL()
+				if err != nil {
+					checks = append(checks, check{fmt.Sprintf("provider %v (%v)", m.Provider, m.Name), err})
+					continue
+				}
+				key := string(m.Provider) + " " + u
+				if probed[key] {
+					continue
+				}
+				probed[key] = true
+				checks = append(checks, check{fmt.Sprintf("provider %v (%v)", m.Provider, m.Name), p.Probe(ctx, m)})
+			}
+		}
+
+		status := http.StatusOK
+		var b strings.Builder
+		for _, c := range checks {
+			if c.err != nil {
+				status = http.StatusServiceUnavailable
+				log.Info("Readiness check failed", "check", c.name, "error", c.err)
+				fmt.Fprintf(&b, "%v: %v\n", c.name, c.err)
+				continue
+			}
+			fmt.Fprintf(&b, "%v: ok\n", c.name)
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(b.String()))
+	})
+}
@@ -0,0 +1,39 @@
+package http_test
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gluehttp "maragu.dev/glue/http"
+	"maragu.dev/is"
+
+	apphttp "app/http"
+	appjobs "app/jobs"
+	"app/llm"
+	"app/model"
+	"app/sqlitetest"
+)
+
+func TestHealth(t *testing.T) {
+	t.Run("should leave out providers without a URL, and fail the check of models with a malformed config", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		_, err := db.SaveModel(t.Context(), model.Model{Provider: model.ProviderLlamaCPP, Name: "broken", Config: "[]"})
+		is.NotError(t, err)
+
+		r := gluehttp.NewRouter(gluehttp.NewRouterOpts{})
+		rm := appjobs.NewRunnerMonitor(appjobs.NewRunnerMonitorOpts{DB: db})
+		apphttp.Health(r, slog.New(slog.DiscardHandler), db, rm, llm.NewClient(llm.NewClientOptions{}),
+			[]model.Provider{model.ProviderBrain, model.ProviderLlamaCPP})
+		s := httptest.NewServer(r.Mux)
+		t.Cleanup(s.Close)
+
+		code, body := get(t, s, "/readyz")
+		is.Equal(t, http.StatusServiceUnavailable, code)
+		is.True(t, strings.Contains(body, "provider llamacpp (broken): error parsing config"))
+		is.True(t, !strings.Contains(body, "provider brain"))
+		is.True(t, strings.Contains(body, "database: ok"))
+	})
+}
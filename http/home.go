@@ -3,25 +3,101 @@ package http
 import (
 	"context"
 	"log/slog"
+	"net/http"
+	"time"
 
 	. "maragu.dev/gomponents"
+	hx "maragu.dev/gomponents-htmx/http"
 
 	"app/html"
 	"app/model"
 )
 
-type conversationsGetter interface {
-	GetConversations(ctx context.Context) ([]model.Conversation, error)
+type homeDB interface {
+	GetConversations(ctx context.Context, f model.GetConversationsFilter) ([]model.Conversation, error)
+	GetFolders(ctx context.Context) ([]model.Folder, error)
+	GetSpeakers(ctx context.Context) ([]model.Speaker, error)
+	GetTags(ctx context.Context) ([]model.Tag, error)
 }
 
-func Home(r *Router, log *slog.Logger, db conversationsGetter) {
+// conversationsPageSize is how many conversations are loaded at a time, when scrolling down the list.
+const conversationsPageSize = 50
+
+func Home(r *Router, log *slog.Logger, db homeDB) {
+	// htmx requests load the next page of conversations before the one given, for infinite scroll
 	r.Get("/", func(props html.PageProps) (Node, error) {
-		cs, err := db.GetConversations(props.Ctx)
+		q := props.R.URL.Query()
+
+		f := model.GetConversationsFilter{
+			Before:    model.ConversationID(q.Get("before")),
+			FolderID:  model.FolderID(q.Get("folder")),
+			Limit:     conversationsPageSize,
+			Pinned:    q.Get("pinned") == "true",
+			SpeakerID: model.SpeakerID(q.Get("speaker")),
+			TagID:     model.TagID(q.Get("tag")),
+		}
+
+		// Dates are whole days, and the to date is included
+		if v := q.Get("from"); v != "" {
+			from, err := time.Parse(time.DateOnly, v)
+			if err != nil {
+				http.Error(props.W, "from must be a date", http.StatusBadRequest)
+				return nil, nil
+			}
+			f.From = model.Time{T: from}
+		}
+		if v := q.Get("to"); v != "" {
+			to, err := time.Parse(time.DateOnly, v)
+			if err != nil {
+				http.Error(props.W, "to must be a date", http.StatusBadRequest)
+				return nil, nil
+			}
+			f.To = model.Time{T: to.AddDate(0, 0, 1)}
+		}
+
+		cs, err := db.GetConversations(props.Ctx, f)
 		if err != nil {
 			log.Info("Error getting conversations", "error", err)
 			return html.ErrorPage(), err
 		}
 
-		return html.HomePage(html.HomePageProps{PageProps: props}, cs), nil
+		// A full page means there might be more, which are loaded from the same URL with the cursor set
+		var moreURL string
+		if len(cs) == conversationsPageSize {
+			q.Set("before", cs[len(cs)-1].ID.String())
+			moreURL = "/?" + q.Encode()
+		}
+
+		if hx.IsRequest(props.R.Header) {
+			return html.ConversationsPartial(cs, moreURL), nil
+		}
+
+		folders, err := db.GetFolders(props.Ctx)
+		if err != nil {
+			log.Info("Error getting folders", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		speakers, err := db.GetSpeakers(props.Ctx)
+		if err != nil {
+			log.Info("Error getting speakers", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		tags, err := db.GetTags(props.Ctx)
+		if err != nil {
+			log.Info("Error getting tags", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		return html.HomePage(html.HomePageProps{
+			PageProps:     props,
+			Conversations: cs,
+			Filter:        f,
+			Folders:       folders,
+			MoreURL:       moreURL,
+			Speakers:      speakers,
+			Tags:          tags,
+		}), nil
 	})
 }
@@ -0,0 +1,103 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "app_http_requests_total",
+		Help: "Number of HTTP requests, by method, route, and status code.",
+	}, []string{"method", "route", "code"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "app_http_request_duration_seconds",
+		Help:    "Duration of HTTP requests, by method and route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
+
+// MetricsServer exposes the Prometheus metrics of the app on /metrics.
+// It listens on its own address instead of the app server's, so metrics aren't public,
+// and the address can be kept on an internal network.
+type MetricsServer struct {
+	log    *slog.Logger
+	server *http.Server
+}
+
+type NewMetricsServerOptions struct {
+	Address string
+	Log     *slog.Logger
+}
+
+func NewMetricsServer(opts NewMetricsServerOptions) *MetricsServer {
+	if opts.Log == nil {
+		opts.Log = slog.New(slog.DiscardHandler)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	return &MetricsServer{
+		log: opts.Log,
+		server: &http.Server{
+			Addr:              opts.Address,
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+		},
+	}
+}
+
+// Start the metrics server, which blocks until it's stopped with [MetricsServer.Stop].
+func (s *MetricsServer) Start() error {
+	s.log.Info("Starting metrics server", "address", s.server.Addr)
+	if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Stop the metrics server.
+func (s *MetricsServer) Stop(ctx context.Context) error {
+	s.log.Info("Stopping metrics server")
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	return s.server.Shutdown(ctx)
+}
+
+// RequestMetrics records the count and duration of requests.
+// Requests are labelled by the route pattern instead of the path, so IDs in paths don't create new series.
+func RequestMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		route := "unknown"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		code := ww.Status()
+		if code == 0 {
+			code = http.StatusOK
+		}
+
+		httpRequests.WithLabelValues(r.Method, route, strconv.Itoa(code)).Inc()
+		httpRequestDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,19 @@
+package http_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"maragu.dev/is"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Run("should not expose metrics on the app server", func(t *testing.T) {
+		s, _ := newServer(t)
+
+		code, body := get(t, s, "/metrics")
+		is.Equal(t, http.StatusNotFound, code)
+		is.True(t, !strings.Contains(body, "app_http_requests_total"))
+	})
+}
@@ -5,14 +5,26 @@ import (
 
 	"maragu.dev/glue/http"
 
+	"app/jobs"
+	"app/llm"
+	"app/model"
 	"app/sqlite"
 )
 
-func InjectHTTPRouter(log *slog.Logger, db *sqlite.Database) func(*Router) {
+func InjectHTTPRouter(log *slog.Logger, db *sqlite.Database, llm *llm.Client, rm *jobs.RunnerMonitor, probeProviders []model.Provider) func(*Router) {
 	return func(r *Router) {
+		Health(r, log, db, rm, llm, probeProviders)
+
 		r.Group(func(r *http.Router) {
+			r.Use(RequestMetrics)
+
 			Home(r, log, db)
-			Conversations(r, log, db)
+			Folders(r, log, db)
+			Conversations(r, log, db, llm)
+			Credentials(r, log, db)
+			Shares(r, log, db)
+			Speakers(r, log, db)
+			Trash(r, log, db)
 		})
 	}
 }
@@ -0,0 +1,99 @@
+package http
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"maragu.dev/errors"
+	. "maragu.dev/gomponents"
+	"maragu.dev/httph"
+
+	"app/html"
+	"app/model"
+)
+
+type sharesDB interface {
+	CreateShare(ctx context.Context, id model.ConversationID, expires time.Time) (model.Share, error)
+	GetSharedConversationDocument(ctx context.Context, token string) (model.ConversationDocument, error)
+	RevokeShare(ctx context.Context, id model.ShareID) error
+}
+
+func Shares(r *Router, log *slog.Logger, db sharesDB) {
+	// The shared page is public, so it shouldn't leak the token to linked sites, or be indexed
+	r.Get("/share", func(props html.PageProps) (Node, error) {
+		token := props.R.URL.Query().Get("token")
+
+		if token == "" {
+			http.Error(props.W, "token is required", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		props.W.Header().Set("Referrer-Policy", "no-referrer")
+		props.W.Header().Set("X-Robots-Tag", "noindex")
+
+		cd, err := db.GetSharedConversationDocument(props.Ctx, token)
+		if err != nil {
+			if errors.Is(err, model.ErrorShareNotFound) || errors.Is(err, model.ErrorConversationNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error getting shared conversation document", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		return html.SharePage(props, cd), nil
+	})
+
+	r.Post("/conversations/shares", func(props html.PageProps) (Node, error) {
+		id := model.ConversationID(props.R.FormValue("id"))
+
+		if id == "" {
+			http.Error(props.W, "id is required", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		var expires time.Time
+		if v := props.R.FormValue("days"); v != "" {
+			days, err := strconv.Atoi(v)
+			if err != nil || days <= 0 {
+				http.Error(props.W, "days must be a positive number", http.StatusBadRequest)
+				return nil, nil
+			}
+			expires = time.Now().AddDate(0, 0, days)
+		}
+
+		if _, err := db.CreateShare(props.Ctx, id, expires); err != nil {
+			if errors.Is(err, model.ErrorConversationNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error creating share", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		http.Redirect(props.W, props.R, "/conversations?id="+id.String(), http.StatusFound)
+		return nil, nil
+	})
+
+	r.Post("/conversations/shares/revoke", func(props html.PageProps) (Node, error) {
+		id := model.ConversationID(props.R.FormValue("id"))
+		shareID := model.ShareID(props.R.FormValue("share_id"))
+
+		if id == "" || shareID == "" {
+			http.Error(props.W, "id and share_id are required", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		if err := db.RevokeShare(props.Ctx, shareID); err != nil {
+			if errors.Is(err, model.ErrorShareNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error revoking share", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		http.Redirect(props.W, props.R, "/conversations?id="+id.String(), http.StatusFound)
+		return nil, nil
+	})
+}
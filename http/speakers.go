@@ -0,0 +1,536 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"maragu.dev/errors"
+	. "maragu.dev/gomponents"
+	"maragu.dev/httph"
+
+	"app/html"
+	"app/llm"
+	"app/model"
+)
+
+type speakersDB interface {
+	DeleteMemory(ctx context.Context, id model.MemoryID) error
+	DeleteSpeaker(ctx context.Context, id model.SpeakerID) error
+	ExportSpeaker(ctx context.Context, id model.SpeakerID) (model.Persona, error)
+	GetMemories(ctx context.Context, id model.SpeakerID) ([]model.Memory, error)
+	GetModels(ctx context.Context) ([]model.Model, error)
+	GetSpeakerFallbackModels(ctx context.Context, id model.SpeakerID) ([]model.ModelID, error)
+	GetSpeakers(ctx context.Context) ([]model.Speaker, error)
+	GetSpeaker(ctx context.Context, f model.GetSpeakerFilter) (model.Speaker, error)
+	GetSpeakerRevisions(ctx context.Context, id model.SpeakerID) ([]model.SpeakerRevision, error)
+	ImportPersona(ctx context.Context, p model.Persona, replace bool) (model.Speaker, model.Change, error)
+	RollbackSpeaker(ctx context.Context, id model.SpeakerID, revisionID model.SpeakerRevisionID) (model.Speaker, error)
+	SaveMemory(ctx context.Context, m model.Memory) (model.Memory, error)
+	SaveSpeaker(ctx context.Context, s model.Speaker) (model.Speaker, error)
+	SaveSpeakerFallbackModels(ctx context.Context, id model.SpeakerID, modelIDs []model.ModelID) error
+}
+
+func Speakers(r *Router, log *slog.Logger, db speakersDB) {
+	r.Get("/speakers", func(props html.PageProps) (Node, error) {
+		speakers, err := db.GetSpeakers(props.Ctx)
+		if err != nil {
+			log.Info("Error getting speakers", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		return html.SpeakersPage(props, speakers), nil
+	})
+
+	r.Get("/speakers/edit", func(props html.PageProps) (Node, error) {
+		id := model.SpeakerID(props.R.URL.Query().Get("id"))
+
+		var s model.Speaker
+		if id != "" {
+			var err error
+			s, err = db.GetSpeaker(props.Ctx, model.GetSpeakerFilter{ID: id})
+			if err != nil {
+				if errors.Is(err, model.ErrorSpeakerNotFound) {
+					return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+				}
+				log.Info("Error getting speaker", "error", err)
+				return html.ErrorPage(), err
+			}
+		}
+
+		models, err := db.GetModels(props.Ctx)
+		if err != nil {
+			log.Info("Error getting models", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		data, err := examplePromptData(props.Ctx, db, s.Name)
+		if err != nil {
+			log.Info("Error getting example prompt data", "error", err)
+			return html.ErrorPage(), err
+		}
+		system, err := llm.RenderSystem(s.System, data)
+
+		return html.SpeakerPage(html.SpeakerPageProps{
+			PageProps: props,
+			Speaker:   s,
+			Models:    models,
+			Preview:   html.SpeakerPromptPreviewPartial(system, err),
+		}), nil
+	})
+
+	r.Post("/speakers/preview", func(props html.PageProps) (Node, error) {
+		data, err := examplePromptData(props.Ctx, db, props.R.FormValue("name"))
+		if err != nil {
+			log.Info("Error getting example prompt data", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		system, err := llm.RenderSystem(props.R.FormValue("system"), data)
+		return html.SpeakerPromptPreviewPartial(system, err), nil
+	})
+
+	r.Post("/speakers/edit", func(props html.PageProps) (Node, error) {
+		s := model.Speaker{
+			ID:      model.SpeakerID(props.R.FormValue("id")),
+			ModelID: model.ModelID(props.R.FormValue("model_id")),
+			Name:    strings.TrimSpace(props.R.FormValue("name")),
+			System:  strings.TrimSpace(props.R.FormValue("system")),
+			Config:  model.JSON(strings.TrimSpace(props.R.FormValue("config"))),
+		}
+		if s.Config == "" {
+			s.Config = "{}"
+		}
+
+		if s.Name == "" || s.ModelID == "" {
+			http.Error(props.W, "name and model_id are required", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		if !json.Valid([]byte(s.Config)) {
+			http.Error(props.W, "config must be JSON", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		if outputSchema := strings.TrimSpace(props.R.FormValue("output_schema")); outputSchema != "" {
+			if err := llm.ValidateSchema([]byte(outputSchema)); err != nil {
+				http.Error(props.W, "error in output schema: "+err.Error(), http.StatusBadRequest)
+				return nil, nil
+			}
+
+			var config map[string]json.RawMessage
+			if err := json.Unmarshal([]byte(s.Config), &config); err != nil || config == nil {
+				http.Error(props.W, "config must be a JSON object to have an output schema", http.StatusBadRequest)
+				return nil, nil
+			}
+			config["outputSchema"] = json.RawMessage(outputSchema)
+			b, err := json.Marshal(config)
+			if err != nil {
+				log.Info("Error marshalling speaker config", "error", err)
+				return html.ErrorPage(), err
+			}
+			s.Config = model.JSON(b)
+		}
+
+		data, err := examplePromptData(props.Ctx, db, s.Name)
+		if err != nil {
+			log.Info("Error getting example prompt data", "error", err)
+			return html.ErrorPage(), err
+		}
+		if _, err := llm.RenderSystem(s.System, data); err != nil {
+			http.Error(props.W, "error in system prompt: "+err.Error(), http.StatusBadRequest)
+			return nil, nil
+		}
+
+		existing, err := db.GetSpeaker(props.Ctx, model.GetSpeakerFilter{Name: s.Name})
+		if err != nil && !errors.Is(err, model.ErrorSpeakerNotFound) {
+			log.Info("Error getting speaker", "error", err)
+			return html.ErrorPage(), err
+		}
+		// Speakers in the trash give up their names when saving, so they're not a conflict
+		if err == nil && existing.ID != s.ID && existing.Deleted.T.IsZero() {
+			http.Error(props.W, "a speaker with that name already exists", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		if _, err := db.SaveSpeaker(props.Ctx, s); err != nil {
+			if errors.Is(err, model.ErrorModelNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error saving speaker", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		http.Redirect(props.W, props.R, "/speakers", http.StatusFound)
+		return nil, nil
+	})
+
+	// Export the speaker as a persona file, in YAML by default or JSON with format=json
+	r.Get("/speakers/export", func(props html.PageProps) (Node, error) {
+		id := model.SpeakerID(props.R.URL.Query().Get("id"))
+
+		if id == "" {
+			http.Error(props.W, "id is required", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		format := model.PersonaFormatYAML
+		if props.R.URL.Query().Get("format") == "json" {
+			format = model.PersonaFormatJSON
+		}
+
+		p, err := db.ExportSpeaker(props.Ctx, id)
+		if err != nil {
+			if errors.Is(err, model.ErrorSpeakerNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error exporting speaker", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		b, err := model.MarshalPersona(p, format)
+		if err != nil {
+			log.Info("Error marshalling persona", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		contentType := "application/yaml"
+		if format == model.PersonaFormatJSON {
+			contentType = "application/json"
+		}
+		props.W.Header().Set("Content-Type", contentType)
+		props.W.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": p.Name + "." + string(format)}))
+		_, _ = props.W.Write(b)
+		return nil, nil
+	})
+
+	r.Post("/speakers/import", func(props html.PageProps) (Node, error) {
+		props.R.Body = http.MaxBytesReader(props.W, props.R.Body, maxPersonaImportSize)
+		if err := props.R.ParseMultipartForm(maxPersonaImportSize); err != nil {
+			http.Error(props.W, "error parsing form, or files too large", http.StatusBadRequest)
+			return nil, nil
+		}
+		replace := props.R.FormValue("replace") == "true"
+
+		var imported []html.ImportedPersona
+		for _, fh := range props.R.MultipartForm.File["files"] {
+			i := html.ImportedPersona{File: fh.Filename}
+
+			p, err := readPersona(fh)
+			if err != nil {
+				i.Error = err.Error()
+				imported = append(imported, i)
+				continue
+			}
+			i.Name = p.Name
+
+			if err := llm.ValidateSystem(p.System); err != nil {
+				i.Error = "error in system prompt: " + err.Error()
+				imported = append(imported, i)
+				continue
+			}
+
+			_, i.Change, err = db.ImportPersona(props.Ctx, p, replace)
+			if err != nil {
+				var domainErr model.Error
+				if !errors.As(err, &domainErr) {
+					log.Info("Error importing persona", "error", err)
+					return html.ErrorPage(), err
+				}
+				i.Error = domainErr.Error()
+			}
+			imported = append(imported, i)
+		}
+
+		return html.SpeakerImportPage(props, imported), nil
+	})
+
+	r.Post("/speakers/delete", func(props html.PageProps) (Node, error) {
+		id := model.SpeakerID(props.R.FormValue("id"))
+
+		if id == "" {
+			http.Error(props.W, "id is required", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		if err := db.DeleteSpeaker(props.Ctx, id); err != nil {
+			if errors.Is(err, model.ErrorSpeakerNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error deleting speaker", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		http.Redirect(props.W, props.R, "/speakers", http.StatusFound)
+		return nil, nil
+	})
+
+	r.Get("/speakers/revisions", func(props html.PageProps) (Node, error) {
+		id := model.SpeakerID(props.R.URL.Query().Get("id"))
+
+		if id == "" {
+			http.Error(props.W, "id is required", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		s, err := db.GetSpeaker(props.Ctx, model.GetSpeakerFilter{ID: id})
+		if err != nil {
+			if errors.Is(err, model.ErrorSpeakerNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error getting speaker", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		revisions, err := db.GetSpeakerRevisions(props.Ctx, id)
+		if err != nil {
+			log.Info("Error getting speaker revisions", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		// By default, compare the latest revision with the one before it
+		to := revisions[0]
+		from := to
+		if len(revisions) > 1 {
+			from = revisions[1]
+		}
+		for _, sr := range revisions {
+			if strconv.Itoa(sr.Revision) == props.R.URL.Query().Get("from") {
+				from = sr
+			}
+			if strconv.Itoa(sr.Revision) == props.R.URL.Query().Get("to") {
+				to = sr
+			}
+		}
+
+		return html.SpeakerRevisionsPage(html.SpeakerRevisionsPageProps{
+			PageProps: props,
+			Speaker:   s,
+			Revisions: revisions,
+			From:      from,
+			To:        to,
+		}), nil
+	})
+
+	r.Post("/speakers/rollback", func(props html.PageProps) (Node, error) {
+		id := model.SpeakerID(props.R.FormValue("id"))
+		revisionID := model.SpeakerRevisionID(props.R.FormValue("revision_id"))
+
+		if id == "" || revisionID == "" {
+			http.Error(props.W, "id and revision_id are required", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		if _, err := db.RollbackSpeaker(props.Ctx, id, revisionID); err != nil {
+			if errors.Is(err, model.ErrorSpeakerRevisionNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error rolling back speaker", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		http.Redirect(props.W, props.R, "/speakers/revisions?id="+id.String(), http.StatusFound)
+		return nil, nil
+	})
+
+	r.Get("/speakers/fallbacks", func(props html.PageProps) (Node, error) {
+		id := model.SpeakerID(props.R.URL.Query().Get("id"))
+
+		if id == "" {
+			http.Error(props.W, "id is required", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		s, err := db.GetSpeaker(props.Ctx, model.GetSpeakerFilter{ID: id})
+		if err != nil {
+			if errors.Is(err, model.ErrorSpeakerNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error getting speaker", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		models, err := db.GetModels(props.Ctx)
+		if err != nil {
+			log.Info("Error getting models", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		fallbackModelIDs, err := db.GetSpeakerFallbackModels(props.Ctx, id)
+		if err != nil {
+			log.Info("Error getting speaker fallback models", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		return html.SpeakerFallbackModelsPage(html.SpeakerFallbackModelsPageProps{
+			PageProps:        props,
+			Speaker:          s,
+			Models:           models,
+			FallbackModelIDs: fallbackModelIDs,
+		}), nil
+	})
+
+	r.Post("/speakers/fallbacks", func(props html.PageProps) (Node, error) {
+		if err := props.R.ParseForm(); err != nil {
+			http.Error(props.W, "error parsing form", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		id := model.SpeakerID(props.R.Form.Get("id"))
+
+		if id == "" {
+			http.Error(props.W, "id is required", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		// Choices left empty are skipped, so the order of the remaining ones is kept
+		var modelIDs []model.ModelID
+		for _, modelID := range props.R.Form["model_id"] {
+			if modelID != "" {
+				modelIDs = append(modelIDs, model.ModelID(modelID))
+			}
+		}
+
+		if err := db.SaveSpeakerFallbackModels(props.Ctx, id, modelIDs); err != nil {
+			if errors.Is(err, model.ErrorSpeakerNotFound) || errors.Is(err, model.ErrorModelNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error saving speaker fallback models", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		http.Redirect(props.W, props.R, "/speakers/fallbacks?id="+id.String(), http.StatusFound)
+		return nil, nil
+	})
+
+	r.Get("/speakers/memories", func(props html.PageProps) (Node, error) {
+		id := model.SpeakerID(props.R.URL.Query().Get("id"))
+
+		if id == "" {
+			http.Error(props.W, "id is required", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		s, err := db.GetSpeaker(props.Ctx, model.GetSpeakerFilter{ID: id})
+		if err != nil {
+			if errors.Is(err, model.ErrorSpeakerNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error getting speaker", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		memories, err := db.GetMemories(props.Ctx, id)
+		if err != nil {
+			log.Info("Error getting memories", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		return html.SpeakerMemoriesPage(props, s, memories), nil
+	})
+
+	// Save a new memory for the speaker, or change an existing one if memory_id is given
+	r.Post("/speakers/memories", func(props html.PageProps) (Node, error) {
+		m := model.Memory{
+			ID:        model.MemoryID(props.R.FormValue("memory_id")),
+			SpeakerID: model.SpeakerID(props.R.FormValue("id")),
+			Content:   strings.TrimSpace(props.R.FormValue("content")),
+		}
+
+		if m.SpeakerID == "" || m.Content == "" {
+			http.Error(props.W, "id and content are required", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		if _, err := db.SaveMemory(props.Ctx, m); err != nil {
+			if errors.Is(err, model.ErrorSpeakerNotFound) || errors.Is(err, model.ErrorMemoryNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error saving memory", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		http.Redirect(props.W, props.R, "/speakers/memories?id="+m.SpeakerID.String(), http.StatusFound)
+		return nil, nil
+	})
+
+	r.Post("/speakers/memories/delete", func(props html.PageProps) (Node, error) {
+		id := model.SpeakerID(props.R.FormValue("id"))
+		memoryID := model.MemoryID(props.R.FormValue("memory_id"))
+
+		if id == "" || memoryID == "" {
+			http.Error(props.W, "id and memory_id are required", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		if err := db.DeleteMemory(props.Ctx, memoryID); err != nil {
+			if errors.Is(err, model.ErrorMemoryNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error deleting memory", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		http.Redirect(props.W, props.R, "/speakers/memories?id="+id.String(), http.StatusFound)
+		return nil, nil
+	})
+}
+
+// maxPersonaImportSize is the most bytes of persona files imported at once.
+const maxPersonaImportSize = 10 << 20
+
+// readPersona from an uploaded file.
+func readPersona(fh *multipart.FileHeader) (model.Persona, error) {
+	f, err := fh.Open()
+	if err != nil {
+		return model.Persona{}, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return model.Persona{}, err
+	}
+	return model.ParsePersona(b)
+}
+
+// examplePromptData to preview and check the system prompt of the speaker with the given name,
+// as if it were in a conversation with the user.
+func examplePromptData(ctx context.Context, db speakersDB, name string) (llm.PromptData, error) {
+	speakers, err := db.GetSpeakers(ctx)
+	if err != nil {
+		return llm.PromptData{}, err
+	}
+
+	models, err := db.GetModels(ctx)
+	if err != nil {
+		return llm.PromptData{}, err
+	}
+	providers := map[model.ModelID]model.Provider{}
+	for _, m := range models {
+		providers[m.ID] = m.Provider
+	}
+
+	data := llm.PromptData{
+		Now:     time.Now(),
+		Speaker: name,
+		Topic:   "Example topic",
+	}
+	for _, s := range speakers {
+		if providers[s.ModelID] == model.ProviderBrain && s.Name != name {
+			data.User = s.Name
+			data.Participants = []string{s.Name}
+			break
+		}
+	}
+	return data, nil
+}
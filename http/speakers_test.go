@@ -0,0 +1,85 @@
+package http_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"maragu.dev/is"
+
+	"app/model"
+	"app/sqlitetest"
+)
+
+func TestSpeakers_edit(t *testing.T) {
+	t.Run("should save the output schema into the speaker config", func(t *testing.T) {
+		s, db := newServer(t)
+		parrot := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+
+		res := post(t, s, "/speakers/edit", url.Values{
+			"id":            {parrot.ID.String()},
+			"name":          {"Parrot"},
+			"model_id":      {parrot.ModelID.String()},
+			"config":        {`{"temperature": 0.5}`},
+			"output_schema": {`{"type": "object", "properties": {"word": {"type": "string"}}}`},
+		})
+		is.Equal(t, http.StatusFound, res.StatusCode)
+
+		parrot, err := db.GetSpeaker(t.Context(), model.GetSpeakerFilter{ID: parrot.ID})
+		is.NotError(t, err)
+		var config struct {
+			Temperature  float64
+			OutputSchema map[string]any
+		}
+		is.NotError(t, json.Unmarshal([]byte(parrot.Config), &config))
+		is.Equal(t, 0.5, config.Temperature)
+		is.Equal(t, "object", config.OutputSchema["type"])
+
+		_, body := get(t, s, "/speakers/edit?id="+parrot.ID.String())
+		is.True(t, strings.Contains(body, "word"))
+		is.True(t, !strings.Contains(body, "outputSchema"))
+	})
+
+	t.Run("should not save an output schema that isn't a JSON object", func(t *testing.T) {
+		s, db := newServer(t)
+		parrot := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+
+		res := post(t, s, "/speakers/edit", url.Values{
+			"id":            {parrot.ID.String()},
+			"name":          {"Parrot"},
+			"model_id":      {parrot.ModelID.String()},
+			"output_schema": {`"object"`},
+		})
+		is.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+}
+
+func TestSpeakers_import(t *testing.T) {
+	t.Run("should not import a persona with a system prompt that isn't a valid template", func(t *testing.T) {
+		s, db := newServer(t)
+
+		var b bytes.Buffer
+		w := multipart.NewWriter(&b)
+		fw, err := w.CreateFormFile("files", "pirate.yaml")
+		is.NotError(t, err)
+		_, err = io.WriteString(fw, "name: Pirate\nmodel:\n  provider: fake\n  name: echo\nsystem: Say {{ arr.\n")
+		is.NotError(t, err)
+		is.NotError(t, w.Close())
+
+		res, err := s.Client().Post(s.URL+"/speakers/import", w.FormDataContentType(), &b)
+		is.NotError(t, err)
+		body, err := io.ReadAll(res.Body)
+		is.NotError(t, err)
+		_ = res.Body.Close()
+		is.Equal(t, http.StatusOK, res.StatusCode)
+		is.True(t, strings.Contains(string(body), "error in system prompt"))
+
+		_, err = db.GetSpeaker(t.Context(), model.GetSpeakerFilter{Name: "Pirate"})
+		is.Error(t, model.ErrorSpeakerNotFound, err)
+	})
+}
@@ -0,0 +1,68 @@
+package http
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"maragu.dev/errors"
+	. "maragu.dev/gomponents"
+	"maragu.dev/httph"
+
+	"app/html"
+	"app/model"
+)
+
+type trashDB interface {
+	GetTrash(ctx context.Context) (model.Trash, error)
+	RestoreConversation(ctx context.Context, id model.ConversationID) error
+	RestoreSpeaker(ctx context.Context, id model.SpeakerID) error
+	RestoreTurn(ctx context.Context, id model.TurnID) error
+}
+
+func Trash(r *Router, log *slog.Logger, db trashDB) {
+	r.Get("/trash", func(props html.PageProps) (Node, error) {
+		trash, err := db.GetTrash(props.Ctx)
+		if err != nil {
+			log.Info("Error getting trash", "error", err)
+			return html.ErrorPage(), err
+		}
+
+		return html.TrashPage(props, trash), nil
+	})
+
+	// Restore a conversation, turn, or speaker from the trash, depending on the type
+	r.Post("/trash/restore", func(props html.PageProps) (Node, error) {
+		typ := props.R.FormValue("type")
+		id := props.R.FormValue("id")
+
+		if id == "" {
+			http.Error(props.W, "id is required", http.StatusBadRequest)
+			return nil, nil
+		}
+
+		var err error
+		switch typ {
+		case "conversation":
+			err = db.RestoreConversation(props.Ctx, model.ConversationID(id))
+		case "turn":
+			err = db.RestoreTurn(props.Ctx, model.TurnID(id))
+		case "speaker":
+			err = db.RestoreSpeaker(props.Ctx, model.SpeakerID(id))
+		default:
+			http.Error(props.W, "type must be conversation, turn, or speaker", http.StatusBadRequest)
+			return nil, nil
+		}
+		if err != nil {
+			if errors.Is(err, model.ErrorConversationNotFound) || errors.Is(err, model.ErrorTurnNotFound) ||
+				errors.Is(err, model.ErrorSpeakerNotFound) {
+				return html.NotFoundPage(), httph.HTTPError{Code: http.StatusNotFound}
+			}
+			log.Info("Error restoring from trash", "type", typ, "error", err)
+			return html.ErrorPage(), err
+		}
+
+		http.Redirect(props.W, props.R, "/trash", http.StatusFound)
+		return nil, nil
+	})
+}
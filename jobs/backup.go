@@ -0,0 +1,118 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"maragu.dev/errors"
+	"maragu.dev/glue/jobs"
+
+	"app/model"
+	"app/sqlite"
+)
+
+type backupper interface {
+	Backup(ctx context.Context, path string) error
+	ScheduleJob(ctx context.Context, name string, delay time.Duration) error
+}
+
+type BackupOpts struct {
+	// Dir to write backups to. Empty means backups are off.
+	Dir string
+	// Interval between backups. Defaults to a day.
+	Interval time.Duration
+	// Keep this many of the newest backups, deleting the rest. Zero means keeping all of them.
+	Keep int
+}
+
+// backupPrefix and backupSuffix are around the time in the backup file names, so they sort by time.
+const (
+	backupPrefix = "app-"
+	backupSuffix = ".db"
+)
+
+// Backup the database into a new file in the backup directory, check the integrity of the backup,
+// and delete old backups beyond what should be kept.
+// The next backup is scheduled before this one is taken, replacing this one in the queue,
+// so a failing backup isn't retried but doesn't stop the schedule either.
+func Backup(r *jobs.Runner, log *slog.Logger, db backupper, opts BackupOpts) {
+	if opts.Interval <= 0 {
+		opts.Interval = 24 * time.Hour
+	}
+
+	register(r, model.JobBackup, func(ctx context.Context, m []byte) error {
+		if opts.Dir == "" {
+			log.Info("Backups are off, skipping backup")
+			return nil
+		}
+
+		if err := db.ScheduleJob(ctx, model.JobBackup, opts.Interval); err != nil {
+			return errors.Wrap(err, "error scheduling next backup")
+		}
+
+		if err := os.MkdirAll(opts.Dir, 0o700); err != nil {
+			return errors.Wrap(err, "error creating backup directory")
+		}
+
+		path := filepath.Join(opts.Dir, backupPrefix+time.Now().UTC().Format("20060102T150405.000Z")+backupSuffix)
+		if err := db.Backup(ctx, path); err != nil {
+			return errors.Wrap(err, "error backing up database")
+		}
+
+		if err := sqlite.CheckIntegrity(ctx, path); err != nil {
+			// Keep the broken backup out of the retention count, but around for inspection
+			if renameErr := os.Rename(path, path+".broken"); renameErr != nil {
+				log.Info("Error renaming broken backup", "path", path, "error", renameErr)
+			}
+			return errors.Wrap(err, "error checking backup integrity")
+		}
+
+		log.Info("Backed up database", "path", path)
+
+		deleted, err := pruneBackups(opts.Dir, opts.Keep)
+		if err != nil {
+			return errors.Wrap(err, "error pruning backups")
+		}
+		if len(deleted) > 0 {
+			log.Info("Deleted old backups", "paths", deleted)
+		}
+
+		return nil
+	})
+}
+
+// pruneBackups in dir beyond the keep newest ones, returning the paths of the deleted backups.
+func pruneBackups(dir string, keep int) ([]string, error) {
+	if keep <= 0 {
+		return nil, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), backupPrefix) && strings.HasSuffix(e.Name(), backupSuffix) {
+			names = append(names, e.Name())
+		}
+	}
+	slices.Sort(names)
+
+	var deleted []string
+	for len(names) > keep {
+		path := filepath.Join(dir, names[0])
+		if err := os.Remove(path); err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, path)
+		names = names[1:]
+	}
+	return deleted, nil
+}
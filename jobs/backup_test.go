@@ -0,0 +1,92 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"maragu.dev/glue/jobs"
+	"maragu.dev/is"
+
+	appjobs "app/jobs"
+	"app/model"
+	"app/sqlite"
+	"app/sqlitetest"
+)
+
+func TestBackup(t *testing.T) {
+	t.Run("should back up the database, schedule the next backup, and keep only the newest backups", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		dir := t.TempDir()
+
+		for _, name := range []string{"app-20250101T000000.000Z.db", "app-20250102T000000.000Z.db", "other.txt"} {
+			err := os.WriteFile(filepath.Join(dir, name), nil, 0o600)
+			is.NotError(t, err)
+		}
+
+		r := jobs.NewRunner(jobs.NewRunnerOpts{Queue: db.H.JobsQ, PollInterval: 10 * time.Millisecond})
+		appjobs.Backup(r, slog.New(slog.DiscardHandler), db, appjobs.BackupOpts{Dir: dir, Interval: time.Hour, Keep: 2})
+		startRunner(t, r)
+
+		err := db.EnsureJobScheduled(t.Context(), model.JobBackup, 0)
+		is.NotError(t, err)
+
+		var names []string
+		for range 100 {
+			names, err = filepath.Glob(filepath.Join(dir, "app-*.db"))
+			is.NotError(t, err)
+			if len(names) == 2 && filepath.Base(names[0]) == "app-20250102T000000.000Z.db" {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		is.Equal(t, 2, len(names))
+		is.Equal(t, "app-20250102T000000.000Z.db", filepath.Base(names[0]))
+		is.NotError(t, sqlite.CheckIntegrity(t.Context(), names[1]))
+
+		_, err = os.Stat(filepath.Join(dir, "other.txt"))
+		is.NotError(t, err)
+
+		depths, err := db.GetJobQueueDepths(t.Context())
+		is.NotError(t, err)
+		is.Equal(t, 1, depths["jobs"])
+	})
+	t.Run("should leave exactly one run scheduled when the backup fails", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		failing := &failingBackupper{Database: db, called: make(chan struct{})}
+
+		r := jobs.NewRunner(jobs.NewRunnerOpts{Queue: db.H.JobsQ, PollInterval: 10 * time.Millisecond})
+		appjobs.Backup(r, slog.New(slog.DiscardHandler), failing, appjobs.BackupOpts{Dir: t.TempDir(), Interval: time.Hour})
+		startRunner(t, r)
+
+		err := db.EnsureJobScheduled(t.Context(), model.JobBackup, 0)
+		is.NotError(t, err)
+
+		select {
+		case <-failing.called:
+		case <-time.After(time.Second):
+			t.Fatal("backup not called")
+		}
+
+		depths, err := db.GetJobQueueDepths(t.Context())
+		is.NotError(t, err)
+		is.Equal(t, 1, depths["jobs"])
+	})
+}
+
+// failingBackupper fails every backup, and closes called on the first one.
+type failingBackupper struct {
+	*sqlite.Database
+	called chan struct{}
+	once   sync.Once
+}
+
+func (f *failingBackupper) Backup(ctx context.Context, path string) error {
+	f.once.Do(func() { close(f.called) })
+	return errors.New("disk full")
+}
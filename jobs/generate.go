@@ -0,0 +1,311 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+	"maragu.dev/errors"
+	"maragu.dev/glue/jobs"
+
+	"app/llm"
+	"app/model"
+)
+
+type turnGenerator interface {
+	CancelTurn(ctx context.Context, id model.TurnID) error
+	CreateGenerateTurnJob(ctx context.Context, id model.TurnID, attempt int, delay time.Duration) error
+	GetConversationDocument(ctx context.Context, id model.ConversationID) (model.ConversationDocument, error)
+	GetMemories(ctx context.Context, id model.SpeakerID) ([]model.Memory, error)
+	GetModel(ctx context.Context, id model.ModelID) (model.Model, error)
+	GetSpeakerFallbackModels(ctx context.Context, id model.SpeakerID) ([]model.ModelID, error)
+	GetTurn(ctx context.Context, id model.TurnID) (model.Turn, error)
+	StartGeneration(ctx context.Context, id model.TurnID) (context.Context, func())
+	UpdateTurnGeneration(ctx context.Context, t model.Turn) error
+}
+
+type completer interface {
+	Complete(ctx context.Context, req llm.Request, onDelta func(llm.Delta) error) (llm.Response, error)
+}
+
+// saveInterval is the minimum time between saving the content of a turn while it's being generated.
+const saveInterval = 250 * time.Millisecond
+
+// maxUnavailableAttempts is how many times generation is tried while all models are unavailable,
+// before the turn is failed.
+const maxUnavailableAttempts = 10
+
+// memoriesInPrompt is the maximum number of the speaker's memories added to the prompt.
+const memoriesInPrompt = 10
+
+// GenerateTurn content with the model of the turn's speaker revision, saving the content as it streams in.
+// The speaker's most relevant memories are added to the system prompt.
+// If the model is unavailable, the speaker's fallback models are tried in order.
+// If they're all unavailable, generation is tried again later in a new job, instead of failing,
+// up to maxUnavailableAttempts times.
+// If the turn is cancelled or its conversation paused, generation stops and the content so far is kept.
+// If generation fails for other reasons, the turn is failed with the error, and can be retried by the user.
+// If the turn would be more than maxConsecutiveAITurns generated turns in a row, it's cancelled instead,
+// so AI speakers can't keep replying to each other. Zero means no limit.
+func GenerateTurn(r *jobs.Runner, log *slog.Logger, db turnGenerator, c completer, maxConsecutiveAITurns int) {
+	register(r, model.JobGenerateTurn, func(ctx context.Context, m []byte) (err error) {
+		var jm model.GenerateTurnJobMessage
+		if err := json.Unmarshal(m, &jm); err != nil {
+			return errors.Wrap(err, "error unmarshalling job message")
+		}
+
+		// Continue the trace of whatever created the job, so the whole turn shows up in one trace
+		ctx = propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier(jm.Trace))
+		ctx, span := otel.Tracer("app/jobs").Start(ctx, "generate turn",
+			trace.WithAttributes(attribute.String("app.turn.id", jm.TurnID.String())))
+		defer func() {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, "job failed")
+			}
+			span.End()
+		}()
+
+		t, err := db.GetTurn(ctx, jm.TurnID)
+		if err != nil {
+			if errors.Is(err, model.ErrorTurnNotFound) {
+				log.Info("Turn not found, skipping generation", "id", jm.TurnID)
+				return nil
+			}
+			return errors.Wrap(err, "error getting turn")
+		}
+
+		span.SetAttributes(semconv.GenAIConversationID(t.ConversationID.String()))
+
+		if !t.Status.Generating() {
+			log.Info("Turn not generating, skipping generation", "id", t.ID, "status", t.Status)
+			return nil
+		}
+
+		cd, err := db.GetConversationDocument(ctx, t.ConversationID)
+		if err != nil {
+			if errors.Is(err, model.ErrorConversationNotFound) {
+				log.Info("Conversation not found, skipping generation", "id", t.ID)
+				return nil
+			}
+			return errors.Wrap(err, "error getting conversation document")
+		}
+
+		if n := consecutiveAITurns(cd, t); maxConsecutiveAITurns > 0 && n >= maxConsecutiveAITurns {
+			log.Info("Too many consecutive AI turns, cancelling generation", "id", t.ID, "turns", n)
+			if err := db.CancelTurn(ctx, t.ID); err != nil && !errors.Is(err, model.ErrorTurnNotFound) {
+				return errors.Wrap(err, "error cancelling turn")
+			}
+			return nil
+		}
+
+		fallbackModelIDs, err := db.GetSpeakerFallbackModels(ctx, t.SpeakerID)
+		if err != nil {
+			return errors.Wrap(err, "error getting speaker fallback models")
+		}
+		modelIDs := append([]model.ModelID{cd.SpeakerRevisions[t.SpeakerRevisionID].ModelID}, fallbackModelIDs...)
+
+		memories, err := db.GetMemories(ctx, t.SpeakerID)
+		if err != nil {
+			return errors.Wrap(err, "error getting memories")
+		}
+		memories = llm.RelevantMemories(memories, cd, t, memoriesInPrompt)
+		speaker := cd.Speakers[t.SpeakerID].Name
+
+		t.Content = ""
+		t.Error = ""
+		t.Output = ""
+		t.Reasoning = nil
+		t.Status = model.TurnStatusStreaming
+		if err := db.UpdateTurnGeneration(ctx, t); err != nil {
+			if errors.Is(err, model.ErrorTurnCancelled) {
+				log.Info("Turn cancelled, skipping generation", "id", t.ID)
+				return nil
+			}
+			return errors.Wrap(err, "error starting turn")
+		}
+
+		var retryAfter time.Duration
+		for i, modelID := range modelIDs {
+			mo, err := db.GetModel(ctx, modelID)
+			if err != nil {
+				return errors.Wrap(err, "error getting model")
+			}
+
+			t.ModelID = &mo.ID
+			req, err := llm.NewRequest(cd, mo, t)
+			if err != nil {
+				log.Info("Error creating request", "id", t.ID, "error", err)
+				t.Status = model.TurnStatusFailed
+				t.Error = err.Error()
+				if err := db.UpdateTurnGeneration(ctx, t); err != nil && !errors.Is(err, model.ErrorTurnCancelled) {
+					return errors.Wrap(err, "error saving failed turn")
+				}
+				return nil
+			}
+			req = llm.WithMemories(req, memories)
+			start := time.Now()
+			tc := &timedCompleter{completer: c}
+			res, err := generate(ctx, db, tc, req, &t)
+			if err == nil && len(req.Schema) > 0 {
+				res, err = structure(ctx, log, db, tc, req, res, &t)
+			}
+			if err == nil {
+				t.Status = model.TurnStatusComplete
+				err = db.UpdateTurnGeneration(ctx, t)
+			}
+			if err == nil {
+				observeGeneration(mo, speaker, start, tc.firstDelta, res)
+				log.Info("Generated turn", "id", t.ID, "provider", mo.Provider, "model", mo.Name, "fallback", i > 0,
+					"finishReason", res.FinishReason, "inputTokens", res.Usage.InputTokens, "outputTokens", res.Usage.OutputTokens)
+				return nil
+			}
+
+			if errors.Is(err, model.ErrorTurnCancelled) {
+				log.Info("Turn cancelled, stopped generation", "id", t.ID)
+				return nil
+			}
+
+			var unavailableErr llm.UnavailableError
+			if !errors.As(err, &unavailableErr) {
+				log.Info("Error generating turn", "id", t.ID, "provider", mo.Provider, "model", mo.Name, "error", err)
+				generationErrors.WithLabelValues(string(mo.Provider), mo.Name, speaker, "failed").Inc()
+				t.Status = model.TurnStatusFailed
+				t.Error = err.Error()
+				if err := db.UpdateTurnGeneration(ctx, t); err != nil && !errors.Is(err, model.ErrorTurnCancelled) {
+					return errors.Wrap(err, "error saving failed turn")
+				}
+				return nil
+			}
+
+			generationErrors.WithLabelValues(string(mo.Provider), mo.Name, speaker, "unavailable").Inc()
+			log.Info("Model unavailable", "id", t.ID, "provider", mo.Provider, "model", mo.Name, "retryAfter", unavailableErr.RetryAfter, "error", err)
+
+			if i == 0 || unavailableErr.RetryAfter < retryAfter {
+				retryAfter = unavailableErr.RetryAfter
+			}
+		}
+
+		if jm.Attempt+1 >= maxUnavailableAttempts {
+			log.Info("All models unavailable, giving up", "id", t.ID, "attempts", jm.Attempt+1)
+			t.Status = model.TurnStatusFailed
+			t.Error = fmt.Sprintf("All models were unavailable after %v attempts.", jm.Attempt+1)
+			if err := db.UpdateTurnGeneration(ctx, t); err != nil && !errors.Is(err, model.ErrorTurnCancelled) {
+				return errors.Wrap(err, "error saving failed turn")
+			}
+			return nil
+		}
+
+		log.Info("All models unavailable, trying again later", "id", t.ID, "retryAfter", retryAfter, "attempt", jm.Attempt+1)
+		t.Status = model.TurnStatusPending
+		t.Error = fmt.Sprintf("All models are unavailable, trying again in %v.", retryAfter.Round(time.Second))
+		if err := db.UpdateTurnGeneration(ctx, t); err != nil {
+			if errors.Is(err, model.ErrorTurnCancelled) {
+				return nil
+			}
+			return errors.Wrap(err, "error saving pending turn")
+		}
+		if err := db.CreateGenerateTurnJob(ctx, t.ID, jm.Attempt+1, retryAfter); err != nil {
+			return errors.Wrap(err, "error creating generate turn job")
+		}
+		return nil
+	})
+}
+
+// generate the turn content for the request, saving it as it streams in.
+// The content of t is updated as it streams in, so it can be saved if generation fails.
+// If the turn is cancelled, generation stops right away, the content so far is saved,
+// and [model.ErrorTurnCancelled] is returned.
+// When it's done, saving the result is left to the caller.
+func generate(ctx context.Context, db turnGenerator, c completer, req llm.Request, t *model.Turn) (llm.Response, error) {
+	generationCtx, done := db.StartGeneration(ctx, t.ID)
+	defer done()
+
+	var content, reasoning strings.Builder
+	var lastSave time.Time
+	update := func() {
+		t.Content = content.String()
+		// Until generation is done, the reasoning is shown as one block
+		t.Reasoning = nil
+		if reasoning.Len() > 0 {
+			t.Reasoning = model.Reasoning{{Type: model.ReasoningBlockTypeThinking, Text: reasoning.String()}}
+		}
+	}
+	res, err := c.Complete(generationCtx, req, func(d llm.Delta) error {
+		content.WriteString(d.Content)
+		reasoning.WriteString(d.Reasoning)
+		if time.Since(lastSave) < saveInterval {
+			return nil
+		}
+		lastSave = time.Now()
+		update()
+		return db.UpdateTurnGeneration(ctx, *t)
+	})
+	if err != nil {
+		update()
+		if errors.Is(context.Cause(generationCtx), model.ErrorTurnCancelled) {
+			if err := db.UpdateTurnGeneration(ctx, *t); err != nil && !errors.Is(err, model.ErrorTurnCancelled) {
+				return res, errors.Wrap(err, "error saving cancelled turn")
+			}
+			return res, model.ErrorTurnCancelled
+		}
+		return res, err
+	}
+
+	t.Content = res.Content
+	t.Reasoning = res.Reasoning
+
+	return res, nil
+}
+
+// structure the content of t as output that matches the request schema.
+// If it doesn't match, the model is asked once to repair it, after which an error is returned if it still doesn't.
+func structure(ctx context.Context, log *slog.Logger, db turnGenerator, c completer, req llm.Request, res llm.Response, t *model.Turn) (llm.Response, error) {
+	output, err := llm.ParseOutput(res.Content, req.Schema)
+	if err != nil {
+		log.Info("Output doesn't match schema, repairing", "id", t.ID, "error", err)
+
+		res, err = generate(ctx, db, c, llm.NewRepairRequest(req, res.Content, err), t)
+		if err != nil {
+			return res, err
+		}
+
+		output, err = llm.ParseOutput(res.Content, req.Schema)
+		if err != nil {
+			return res, errors.Wrap(err, "error matching output to schema after repair")
+		}
+	}
+
+	t.Output = model.JSON(output)
+	return res, nil
+}
+
+// consecutiveAITurns right before turn t in the conversation thread, which are the turns generated by a model.
+func consecutiveAITurns(cd model.ConversationDocument, t model.Turn) int {
+	var n int
+	for _, other := range cd.Turns {
+		if other.ID == t.ID {
+			break
+		}
+
+		if other.Candidate {
+			continue
+		}
+
+		if other.ModelID != nil {
+			n++
+		} else {
+			n = 0
+		}
+	}
+	return n
+}
@@ -0,0 +1,428 @@
+package jobs_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+	"maragu.dev/glue/jobs"
+	"maragu.dev/is"
+
+	appjobs "app/jobs"
+	"app/llm"
+	"app/model"
+	"app/sqlite"
+	"app/sqlitetest"
+)
+
+func TestGenerateTurn(t *testing.T) {
+	t.Run("should generate the reply with the speaker's model", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		runJobs(t, db, 0)
+
+		me, err := db.GetSpeaker(t.Context(), model.GetSpeakerFilter{Name: "Me"})
+		is.NotError(t, err)
+		parrot := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+		c := sqlitetest.NewConversation(t, db, "Birds")
+
+		_, replies, err := db.SaveTurnWithReplies(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: me.ID, Content: "Polly want a cracker?"},
+			[]model.SpeakerID{parrot.ID})
+		is.NotError(t, err)
+
+		reply := waitForStatus(t, db, replies[0].ID)
+		is.Equal(t, model.TurnStatusComplete, reply.Status)
+		is.Equal(t, "Echo: Polly want a cracker?", reply.Content)
+		is.Equal(t, parrot.ModelID, *reply.ModelID)
+		is.True(t, !reply.Started.T.IsZero() && !reply.Finished.T.Before(reply.Started.T))
+	})
+
+	t.Run("should save the reasoning separately from the content", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		runJobs(t, db, 0)
+
+		me, err := db.GetSpeaker(t.Context(), model.GetSpeakerFilter{Name: "Me"})
+		is.NotError(t, err)
+		parrot := sqlitetest.NewFakeSpeaker(t, db, "Parrot", `{"reasoning":"A cracker would be nice.","responses":["Squawk!"]}`)
+		c := sqlitetest.NewConversation(t, db, "Birds")
+
+		_, replies, err := db.SaveTurnWithReplies(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: me.ID, Content: "Hello?"},
+			[]model.SpeakerID{parrot.ID})
+		is.NotError(t, err)
+
+		reply := waitForStatus(t, db, replies[0].ID)
+		is.Equal(t, "Squawk!", reply.Content)
+		is.EqualSlice(t, model.Reasoning{{Type: model.ReasoningBlockTypeThinking, Text: "A cracker would be nice."}}, reply.Reasoning)
+	})
+
+	t.Run("should save output that matches the speaker's schema, repairing it once if it doesn't", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		runJobs(t, db, 0)
+
+		me, err := db.GetSpeaker(t.Context(), model.GetSpeakerFilter{Name: "Me"})
+		is.NotError(t, err)
+		classifier := sqlitetest.NewFakeSpeaker(t, db, "Classifier", `{"responses":["It's spam!", "{\"label\": \"spam\"}"]}`)
+		classifier.Config = `{"outputSchema":{"type":"object","properties":{"label":{"type":"string"}},"required":["label"]}}`
+		_, err = db.SaveSpeaker(t.Context(), classifier)
+		is.NotError(t, err)
+		c := sqlitetest.NewConversation(t, db, "Email")
+
+		_, replies, err := db.SaveTurnWithReplies(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: me.ID, Content: "Buy now!"},
+			[]model.SpeakerID{classifier.ID})
+		is.NotError(t, err)
+
+		reply := waitForStatus(t, db, replies[0].ID)
+		is.Equal(t, model.TurnStatusComplete, reply.Status)
+		is.Equal(t, `{"label":"spam"}`, string(reply.Output))
+	})
+
+	t.Run("should fail the turn when the output still doesn't match the schema after repair", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		runJobs(t, db, 0)
+
+		me, err := db.GetSpeaker(t.Context(), model.GetSpeakerFilter{Name: "Me"})
+		is.NotError(t, err)
+		classifier := sqlitetest.NewFakeSpeaker(t, db, "Classifier", `{"responses":["It's spam!"]}`)
+		classifier.Config = `{"outputSchema":{"type":"object"}}`
+		_, err = db.SaveSpeaker(t.Context(), classifier)
+		is.NotError(t, err)
+		c := sqlitetest.NewConversation(t, db, "Email")
+
+		_, replies, err := db.SaveTurnWithReplies(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: me.ID, Content: "Buy now!"},
+			[]model.SpeakerID{classifier.ID})
+		is.NotError(t, err)
+
+		reply := waitForStatus(t, db, replies[0].ID)
+		is.Equal(t, model.TurnStatusFailed, reply.Status)
+		is.Equal(t, "", string(reply.Output))
+		is.True(t, strings.HasPrefix(reply.Error, "error matching output to schema after repair"))
+	})
+
+	t.Run("should fail the turn with the error when generation fails", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		runJobs(t, db, 0)
+
+		me, err := db.GetSpeaker(t.Context(), model.GetSpeakerFilter{Name: "Me"})
+		is.NotError(t, err)
+		parrot := sqlitetest.NewFakeSpeaker(t, db, "Parrot", `{"error":{"statusCode":400}}`)
+		c := sqlitetest.NewConversation(t, db, "Birds")
+
+		_, replies, err := db.SaveTurnWithReplies(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: me.ID, Content: "Hello?"},
+			[]model.SpeakerID{parrot.ID})
+		is.NotError(t, err)
+
+		reply := waitForStatus(t, db, replies[0].ID)
+		is.Equal(t, model.TurnStatusFailed, reply.Status)
+		is.Equal(t, "unexpected status code 400: Bad Request", reply.Error)
+		is.True(t, !reply.Finished.T.IsZero())
+	})
+
+	t.Run("should fail the turn when the system prompt template can't be rendered", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		runJobs(t, db, 0)
+
+		me, err := db.GetSpeaker(t.Context(), model.GetSpeakerFilter{Name: "Me"})
+		is.NotError(t, err)
+		parrot := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+		parrot.System = "You talk to {{.Nobody}}."
+		_, err = db.SaveSpeaker(t.Context(), parrot)
+		is.NotError(t, err)
+		c := sqlitetest.NewConversation(t, db, "Birds")
+
+		_, replies, err := db.SaveTurnWithReplies(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: me.ID, Content: "Hello?"},
+			[]model.SpeakerID{parrot.ID})
+		is.NotError(t, err)
+
+		reply := waitForStatus(t, db, replies[0].ID)
+		is.Equal(t, model.TurnStatusFailed, reply.Status)
+		is.True(t, strings.Contains(reply.Error, "error rendering system prompt"))
+	})
+
+	t.Run("should fall back to the next model when the speaker's model is unavailable", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		runJobs(t, db, 0)
+
+		me, err := db.GetSpeaker(t.Context(), model.GetSpeakerFilter{Name: "Me"})
+		is.NotError(t, err)
+		parrot := sqlitetest.NewFakeSpeaker(t, db, "Parrot", `{"error":{"statusCode":503}}`)
+		backup := sqlitetest.NewFakeSpeaker(t, db, "Backup", `{"responses":["Squawk!"]}`)
+		err = db.SaveSpeakerFallbackModels(t.Context(), parrot.ID, []model.ModelID{backup.ModelID})
+		is.NotError(t, err)
+		c := sqlitetest.NewConversation(t, db, "Birds")
+
+		_, replies, err := db.SaveTurnWithReplies(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: me.ID, Content: "Hello?"},
+			[]model.SpeakerID{parrot.ID})
+		is.NotError(t, err)
+
+		reply := waitForContent(t, db, replies[0].ID)
+		is.Equal(t, "Squawk!", reply.Content)
+		is.Equal(t, backup.ModelID, *reply.ModelID)
+	})
+
+	t.Run("should fail the turn when all models stay unavailable", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		runJobs(t, db, 0)
+
+		me, err := db.GetSpeaker(t.Context(), model.GetSpeakerFilter{Name: "Me"})
+		is.NotError(t, err)
+		parrot := sqlitetest.NewFakeSpeaker(t, db, "Parrot", `{"error":{"statusCode":503,"retryAfter":"1ms"}}`)
+		c := sqlitetest.NewConversation(t, db, "Birds")
+
+		_, replies, err := db.SaveTurnWithReplies(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: me.ID, Content: "Hello?"},
+			[]model.SpeakerID{parrot.ID})
+		is.NotError(t, err)
+
+		reply := waitForStatus(t, db, replies[0].ID)
+		is.Equal(t, model.TurnStatusFailed, reply.Status)
+		is.Equal(t, "All models were unavailable after 10 attempts.", reply.Error)
+	})
+}
+
+func TestGenerateTurn_metrics(t *testing.T) {
+	t.Run("should record the generation metrics with the provider, model, and speaker", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		runJobs(t, db, 0)
+
+		me, err := db.GetSpeaker(t.Context(), model.GetSpeakerFilter{Name: "Me"})
+		is.NotError(t, err)
+		metered := sqlitetest.NewFakeSpeaker(t, db, "Metered", `{"responses":["Squawk!"],"latency":"10ms"}`)
+		broken := sqlitetest.NewFakeSpeaker(t, db, "Broken", `{"error":{"statusCode":400}}`)
+		c := sqlitetest.NewConversation(t, db, "Birds")
+
+		_, replies, err := db.SaveTurnWithReplies(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: me.ID, Content: "Hello?"},
+			[]model.SpeakerID{metered.ID, broken.ID})
+		is.NotError(t, err)
+		waitForStatus(t, db, replies[0].ID)
+		waitForStatus(t, db, replies[1].ID)
+
+		is.Equal(t, 1, int(waitForMetric(t, "app_generation_duration_seconds", "Metered")))
+		is.Equal(t, 1, int(waitForMetric(t, "app_generation_time_to_first_token_seconds", "Metered")))
+		is.Equal(t, 1, int(waitForMetric(t, "app_generation_tokens_per_second", "Metered")))
+		is.Equal(t, 1, int(waitForMetric(t, "app_generation_errors_total", "Broken")))
+	})
+}
+
+func TestGenerateTurn_tracing(t *testing.T) {
+	t.Run("should continue the trace that created the job, with a span for the generation", func(t *testing.T) {
+		spans := tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+		t.Cleanup(func() {
+			otel.SetTracerProvider(noop.NewTracerProvider())
+		})
+
+		db := sqlitetest.NewDatabase(t)
+		runJobs(t, db, 0)
+
+		me, err := db.GetSpeaker(t.Context(), model.GetSpeakerFilter{Name: "Me"})
+		is.NotError(t, err)
+		parrot := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+		c := sqlitetest.NewConversation(t, db, "Birds")
+
+		// Stands in for the HTTP request span
+		ctx, span := otel.Tracer("test").Start(t.Context(), "request")
+		_, replies, err := db.SaveTurnWithReplies(ctx, model.Turn{ConversationID: c.ID, SpeakerID: me.ID, Content: "Hello?"},
+			[]model.SpeakerID{parrot.ID})
+		is.NotError(t, err)
+		span.End()
+
+		waitForStatus(t, db, replies[0].ID)
+
+		var names []string
+		for range 100 {
+			names = nil
+			for _, s := range spans.Ended() {
+				// Database queries are traced too, so only spans from the app's own tracers are checked
+				if s.SpanContext().TraceID() == span.SpanContext().TraceID() && strings.HasPrefix(s.InstrumentationScope().Name, "app/") {
+					names = append(names, s.Name())
+				}
+			}
+			if len(names) == 2 {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		is.EqualSlice(t, []string{"chat " + parrot.Name, "generate turn"}, names)
+	})
+}
+
+func TestGenerateTurn_cancel(t *testing.T) {
+	t.Run("should stop generating and keep the content so far when the turn is cancelled", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		runJobs(t, db, 0)
+
+		me, err := db.GetSpeaker(t.Context(), model.GetSpeakerFilter{Name: "Me"})
+		is.NotError(t, err)
+		parrot := sqlitetest.NewFakeSpeaker(t, db, "Parrot", `{"responses":["Squawk squawk squawk!"],"chunkSize":1,"chunkDelay":"100ms"}`)
+		c := sqlitetest.NewConversation(t, db, "Birds")
+
+		_, replies, err := db.SaveTurnWithReplies(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: me.ID, Content: "Hello?"},
+			[]model.SpeakerID{parrot.ID})
+		is.NotError(t, err)
+
+		waitForContent(t, db, replies[0].ID)
+		err = db.CancelTurn(t.Context(), replies[0].ID)
+		is.NotError(t, err)
+
+		// Wait for the job to save the content so far
+		time.Sleep(100 * time.Millisecond)
+		reply, err := db.GetTurn(t.Context(), replies[0].ID)
+		is.NotError(t, err)
+		is.Equal(t, model.TurnStatusCancelled, reply.Status)
+		is.True(t, reply.Content != "" && reply.Content != "Squawk squawk squawk!")
+	})
+
+	t.Run("should stop waiting for the model right away when the turn is cancelled", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		runJobs(t, db, 0)
+
+		me, err := db.GetSpeaker(t.Context(), model.GetSpeakerFilter{Name: "Me"})
+		is.NotError(t, err)
+		parrot := sqlitetest.NewFakeSpeaker(t, db, "Parrot", `{"latency":"1m"}`)
+		c := sqlitetest.NewConversation(t, db, "Birds")
+
+		_, replies, err := db.SaveTurnWithReplies(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: me.ID, Content: "Hello?"},
+			[]model.SpeakerID{parrot.ID})
+		is.NotError(t, err)
+
+		for range 100 {
+			reply, err := db.GetTurn(t.Context(), replies[0].ID)
+			is.NotError(t, err)
+			if reply.Status == model.TurnStatusStreaming {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		err = db.CancelTurn(t.Context(), replies[0].ID)
+		is.NotError(t, err)
+
+		// The job is done when its message is deleted from the queue
+		var jobCount int
+		for range 100 {
+			err = db.H.Get(t.Context(), &jobCount, `select count(*) from goqite where queue = 'jobs'`)
+			is.NotError(t, err)
+			if jobCount == 0 {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		is.Equal(t, 0, jobCount)
+	})
+
+	t.Run("should cancel the turn when there are too many consecutive AI turns", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		runJobs(t, db, 1)
+
+		parrot := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+		echo := sqlitetest.NewFakeSpeaker(t, db, "Echo", "")
+		c := sqlitetest.NewConversation(t, db, "Birds")
+
+		_, err := db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: parrot.ID, Content: "Squawk!", ModelID: &parrot.ModelID})
+		is.NotError(t, err)
+
+		turn, err := db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: echo.ID, Status: model.TurnStatusPending})
+		is.NotError(t, err)
+		err = db.CreateGenerateTurnJob(t.Context(), turn.ID, 0, 0)
+		is.NotError(t, err)
+
+		turn = waitForStatus(t, db, turn.ID)
+		is.Equal(t, model.TurnStatusCancelled, turn.Status)
+		is.Equal(t, "", turn.Content)
+	})
+}
+
+// runJobs registered with a fake-capable LLM client in the background until the test ends.
+func runJobs(t *testing.T, db *sqlite.Database, maxConsecutiveAITurns int) {
+	t.Helper()
+
+	r := jobs.NewRunner(jobs.NewRunnerOpts{Queue: db.H.JobsQ, PollInterval: 10 * time.Millisecond})
+	appjobs.Register(r, appjobs.RegisterOpts{
+		DB:                    db,
+		LLM:                   llm.NewClient(llm.NewClientOptions{}),
+		MaxConsecutiveAITurns: maxConsecutiveAITurns,
+	})
+	startRunner(t, r)
+}
+
+// startRunner in the background until the test ends.
+func startRunner(t *testing.T, r *jobs.Runner) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan struct{})
+	go func() {
+		r.Start(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// waitForContent of the turn to be generated, failing the test after a while.
+func waitForContent(t *testing.T, db *sqlite.Database, id model.TurnID) model.Turn {
+	t.Helper()
+
+	for range 100 {
+		turn, err := db.GetTurn(t.Context(), id)
+		is.NotError(t, err)
+		if turn.Content != "" && turn.ModelID != nil {
+			return turn
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("timed out waiting for turn content")
+	return model.Turn{}
+}
+
+// waitForMetric with the speaker label to be recorded, returning its value, or sample count for histograms.
+// It fails the test after a while.
+func waitForMetric(t *testing.T, name, speaker string) float64 {
+	t.Helper()
+
+	for range 100 {
+		mfs, err := prometheus.DefaultGatherer.Gather()
+		is.NotError(t, err)
+		for _, mf := range mfs {
+			if mf.GetName() != name {
+				continue
+			}
+			for _, m := range mf.GetMetric() {
+				for _, l := range m.GetLabel() {
+					if l.GetName() != "speaker" || l.GetValue() != speaker {
+						continue
+					}
+					if h := m.GetHistogram(); h != nil {
+						return float64(h.GetSampleCount())
+					}
+					return m.GetCounter().GetValue()
+				}
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("timed out waiting for metric " + name)
+	return 0
+}
+
+// waitForStatus of the turn to not be generating anymore, failing the test after a while.
+func waitForStatus(t *testing.T, db *sqlite.Database, id model.TurnID) model.Turn {
+	t.Helper()
+
+	for range 100 {
+		turn, err := db.GetTurn(t.Context(), id)
+		is.NotError(t, err)
+		if !turn.Status.Generating() {
+			return turn
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("timed out waiting for turn status")
+	return model.Turn{}
+}
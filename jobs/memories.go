@@ -0,0 +1,147 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"maragu.dev/errors"
+	"maragu.dev/glue/jobs"
+
+	"app/llm"
+	"app/model"
+)
+
+type memoryExtractor interface {
+	GetConversationDocument(ctx context.Context, id model.ConversationID) (model.ConversationDocument, error)
+	GetConversationsForMemoryExtraction(ctx context.Context, before time.Time) ([]model.ConversationID, error)
+	GetMemories(ctx context.Context, id model.SpeakerID) ([]model.Memory, error)
+	GetMemoriesExtractedUntil(ctx context.Context, id model.ConversationID) (time.Time, error)
+	GetModel(ctx context.Context, id model.ModelID) (model.Model, error)
+	SaveExtractedMemories(ctx context.Context, id model.ConversationID, until time.Time, ms []model.Memory) error
+	ScheduleJob(ctx context.Context, name string, delay time.Duration) error
+}
+
+type ExtractMemoriesOpts struct {
+	// Idle is how long a conversation has had no new turns before memories are extracted from it.
+	// Defaults to ten minutes.
+	Idle time.Duration
+	// Interval between extracting memories. Zero means extraction is off.
+	Interval time.Duration
+}
+
+// ExtractMemories from conversations that have gone idle since memories were last extracted from them,
+// for each AI speaker that took part, with the speaker's own model.
+// Only the turns since memories were last extracted from a conversation are sent.
+// If extracting from a conversation fails, it's logged and tried again in the next run.
+// The next run is scheduled before this one starts, like with [Backup].
+func ExtractMemories(r *jobs.Runner, log *slog.Logger, db memoryExtractor, c completer, opts ExtractMemoriesOpts) {
+	if opts.Idle <= 0 {
+		opts.Idle = 10 * time.Minute
+	}
+
+	register(r, model.JobExtractMemories, func(ctx context.Context, m []byte) error {
+		if opts.Interval <= 0 {
+			log.Info("Memory extraction is off, skipping")
+			return nil
+		}
+
+		if err := db.ScheduleJob(ctx, model.JobExtractMemories, opts.Interval); err != nil {
+			return errors.Wrap(err, "error scheduling next memory extraction")
+		}
+
+		ids, err := db.GetConversationsForMemoryExtraction(ctx, time.Now().Add(-opts.Idle))
+		if err != nil {
+			return errors.Wrap(err, "error getting conversations for memory extraction")
+		}
+
+		var conversations, memories int
+		for _, id := range ids {
+			n, err := extractMemories(ctx, db, c, id)
+			if err != nil {
+				log.Info("Error extracting memories", "id", id, "error", err)
+				continue
+			}
+			conversations++
+			memories += n
+		}
+
+		log.Info("Extracted memories", "conversations", conversations, "failed", len(ids)-conversations, "memories", memories)
+
+		return nil
+	})
+}
+
+// extractMemories from the conversation with the given ID, returning how many were extracted.
+func extractMemories(ctx context.Context, db memoryExtractor, c completer, id model.ConversationID) (int, error) {
+	cd, err := db.GetConversationDocument(ctx, id)
+	if err != nil {
+		if errors.Is(err, model.ErrorConversationNotFound) {
+			return 0, nil
+		}
+		return 0, errors.Wrap(err, "error getting conversation document")
+	}
+
+	since, err := db.GetMemoriesExtractedUntil(ctx, id)
+	if err != nil {
+		return 0, errors.Wrap(err, "error getting when memories were last extracted")
+	}
+
+	// AI speakers are the ones with turns generated by a model, anywhere in the conversation
+	var until time.Time
+	var speakerIDs []model.SpeakerID
+	var turns []model.Turn
+	seen := map[model.SpeakerID]bool{}
+	for _, t := range cd.Turns {
+		if t.Created.T.After(until) {
+			until = t.Created.T
+		}
+		if t.ModelID != nil && !seen[t.SpeakerID] {
+			speakerIDs = append(speakerIDs, t.SpeakerID)
+			seen[t.SpeakerID] = true
+		}
+		if t.Created.T.After(since) {
+			turns = append(turns, t)
+		}
+	}
+
+	// The document can be cached, so the new turns are set on a copy
+	cd.Turns = turns
+
+	var ms []model.Memory
+	for _, speakerID := range speakerIDs {
+		s := cd.Speakers[speakerID]
+		if !s.Deleted.T.IsZero() {
+			continue
+		}
+
+		mo, err := db.GetModel(ctx, s.ModelID)
+		if err != nil {
+			return 0, errors.Wrap(err, "error getting model")
+		}
+
+		existing, err := db.GetMemories(ctx, speakerID)
+		if err != nil {
+			return 0, errors.Wrap(err, "error getting memories")
+		}
+
+		res, err := c.Complete(ctx, llm.NewMemoryRequest(cd, mo, speakerID, existing), func(llm.Delta) error { return nil })
+		if err != nil {
+			return 0, errors.Wrap(err, "error completing memory request")
+		}
+
+		contents, err := llm.ParseMemories(res.Content)
+		if err != nil {
+			return 0, errors.Wrap(err, "error parsing memories")
+		}
+
+		for _, content := range contents {
+			ms = append(ms, model.Memory{SpeakerID: speakerID, Content: content})
+		}
+	}
+
+	if err := db.SaveExtractedMemories(ctx, id, until, ms); err != nil {
+		return 0, errors.Wrap(err, "error saving extracted memories")
+	}
+	return len(ms), nil
+}
@@ -0,0 +1,117 @@
+package jobs_test
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"maragu.dev/glue/jobs"
+	"maragu.dev/is"
+
+	appjobs "app/jobs"
+	"app/llm"
+	"app/model"
+	"app/sqlitetest"
+)
+
+func TestExtractMemories(t *testing.T) {
+	t.Run("should extract memories for the AI speakers in idle conversations", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		me, err := db.GetSpeaker(t.Context(), model.GetSpeakerFilter{Name: "Me"})
+		is.NotError(t, err)
+		parrot := sqlitetest.NewFakeSpeaker(t, db, "Parrot", `{"responses":["[\"Me likes crackers.\"]"]}`)
+
+		c := sqlitetest.NewConversation(t, db, "Birds")
+		_, err = db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: me.ID, Content: "I like crackers."})
+		is.NotError(t, err)
+		_, err = db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: parrot.ID, ModelID: &parrot.ModelID, Content: "Squawk!"})
+		is.NotError(t, err)
+		_, err = db.H.DB.ExecContext(t.Context(), `update turns set created = '2020-01-01T00:00:00.000Z' where conversation_id = ?`, c.ID)
+		is.NotError(t, err)
+
+		// A conversation that's still going is left for later
+		active := sqlitetest.NewConversation(t, db, "Active")
+		_, err = db.SaveTurn(t.Context(), model.Turn{ConversationID: active.ID, SpeakerID: parrot.ID, ModelID: &parrot.ModelID, Content: "Squawk?"})
+		is.NotError(t, err)
+
+		runScheduledJob(t, db, model.JobExtractMemories, func(r *jobs.Runner) {
+			appjobs.ExtractMemories(r, slog.New(slog.DiscardHandler), db, llm.NewClient(llm.NewClientOptions{}),
+				appjobs.ExtractMemoriesOpts{Interval: time.Hour})
+		})
+
+		memories, err := db.GetMemories(t.Context(), parrot.ID)
+		is.NotError(t, err)
+		is.Equal(t, 1, len(memories))
+		is.Equal(t, "Me likes crackers.", memories[0].Content)
+		is.Equal(t, c.ID, *memories[0].ConversationID)
+
+		memories, err = db.GetMemories(t.Context(), me.ID)
+		is.NotError(t, err)
+		is.Equal(t, 0, len(memories))
+
+		ids, err := db.GetConversationsForMemoryExtraction(t.Context(), time.Now())
+		is.NotError(t, err)
+		is.Equal(t, 1, len(ids))
+		is.Equal(t, active.ID, ids[0])
+	})
+	t.Run("should only send the turns since memories were last extracted", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		me, err := db.GetSpeaker(t.Context(), model.GetSpeakerFilter{Name: "Me"})
+		is.NotError(t, err)
+		parrot := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+
+		c := sqlitetest.NewConversation(t, db, "Birds")
+		_, err = db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: me.ID, Content: "I like crackers."})
+		is.NotError(t, err)
+		_, err = db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: parrot.ID, ModelID: &parrot.ModelID, Content: "Squawk!"})
+		is.NotError(t, err)
+		_, err = db.H.DB.ExecContext(t.Context(), `update turns set created = '2020-01-01T00:00:00.000Z' where conversation_id = ?`, c.ID)
+		is.NotError(t, err)
+		err = db.SaveExtractedMemories(t.Context(), c.ID, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), nil)
+		is.NotError(t, err)
+
+		_, err = db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: me.ID, Content: "I live in a cage."})
+		is.NotError(t, err)
+		_, err = db.H.DB.ExecContext(t.Context(), `update turns set created = '2020-01-02T00:00:00.000Z' where content = 'I live in a cage.'`)
+		is.NotError(t, err)
+
+		completer := &recordingCompleter{content: `["Me lives in a cage."]`}
+		runScheduledJob(t, db, model.JobExtractMemories, func(r *jobs.Runner) {
+			appjobs.ExtractMemories(r, slog.New(slog.DiscardHandler), db, completer, appjobs.ExtractMemoriesOpts{Interval: time.Hour})
+		})
+
+		reqs := completer.requests()
+		is.Equal(t, 1, len(reqs))
+		is.True(t, strings.Contains(reqs[0].Messages[0].Content, "Me: I live in a cage."))
+		is.True(t, !strings.Contains(reqs[0].Messages[0].Content, "I like crackers."))
+		is.True(t, !strings.Contains(reqs[0].Messages[0].Content, "Squawk!"))
+
+		memories, err := db.GetMemories(t.Context(), parrot.ID)
+		is.NotError(t, err)
+		is.Equal(t, 1, len(memories))
+		is.Equal(t, "Me lives in a cage.", memories[0].Content)
+	})
+}
+
+// recordingCompleter replies to every request with content, and records the requests.
+type recordingCompleter struct {
+	content string
+	lock    sync.Mutex
+	reqs    []llm.Request
+}
+
+func (r *recordingCompleter) Complete(ctx context.Context, req llm.Request, onDelta func(llm.Delta) error) (llm.Response, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.reqs = append(r.reqs, req)
+	return llm.Response{Content: r.content}, nil
+}
+
+func (r *recordingCompleter) requests() []llm.Request {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]llm.Request(nil), r.reqs...)
+}
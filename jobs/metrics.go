@@ -0,0 +1,143 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"maragu.dev/glue/jobs"
+
+	"app/llm"
+	"app/model"
+)
+
+var (
+	jobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "app_job_duration_seconds",
+		Help:    "Duration of job runs, by job name and result.",
+		Buckets: []float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 120},
+	}, []string{"name", "result"})
+
+	generationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "app_generation_duration_seconds",
+		Help:    "Duration of successful generations, by provider, model, and speaker.",
+		Buckets: []float64{.1, .5, 1, 2, 5, 10, 20, 30, 60, 120},
+	}, []string{"provider", "model", "speaker"})
+
+	generationTimeToFirstToken = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "app_generation_time_to_first_token_seconds",
+		Help:    "Time from starting a generation until the first content or reasoning is streamed, by provider, model, and speaker.",
+		Buckets: []float64{.05, .1, .25, .5, 1, 2, 5, 10, 30},
+	}, []string{"provider", "model", "speaker"})
+
+	generationTokensPerSecond = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "app_generation_tokens_per_second",
+		Help:    "Output tokens per second after the first token of successful generations, by provider, model, and speaker.",
+		Buckets: []float64{1, 5, 10, 25, 50, 100, 200, 500, 1000},
+	}, []string{"provider", "model", "speaker"})
+
+	generationErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "app_generation_errors_total",
+		Help: "Number of failed generations, by provider, model, speaker, and reason, which is either unavailable or failed.",
+	}, []string{"provider", "model", "speaker", "reason"})
+)
+
+// register the job function under name, recording the duration of each run.
+func register(r *jobs.Runner, name string, fn jobs.Func) {
+	r.Register(name, func(ctx context.Context, m []byte) error {
+		start := time.Now()
+		err := fn(ctx, m)
+
+		result := "success"
+		if err != nil {
+			result = "error"
+		}
+		jobDuration.WithLabelValues(name, result).Observe(time.Since(start).Seconds())
+
+		return err
+	})
+}
+
+type queueDepthGetter interface {
+	GetJobQueueDepths(ctx context.Context) (map[string]int, error)
+}
+
+// queueDepthCollector reports the number of jobs in each queue when metrics are collected,
+// so the depth is always current instead of tracked as jobs come and go.
+type queueDepthCollector struct {
+	db   queueDepthGetter
+	desc *prometheus.Desc
+	log  *slog.Logger
+}
+
+// NewQueueDepthCollector for registering with Prometheus.
+func NewQueueDepthCollector(log *slog.Logger, db queueDepthGetter) prometheus.Collector {
+	if log == nil {
+		log = slog.New(slog.DiscardHandler)
+	}
+	return &queueDepthCollector{
+		db:   db,
+		desc: prometheus.NewDesc("app_job_queue_depth", "Number of jobs waiting or running, by queue.", []string{"queue"}, nil),
+		log:  log,
+	}
+}
+
+func (c *queueDepthCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *queueDepthCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	depths, err := c.db.GetJobQueueDepths(ctx)
+	if err != nil {
+		c.log.Info("Error getting job queue depths", "error", err)
+		return
+	}
+
+	// Empty queues have no rows, but should still be reported
+	for _, queue := range []string{"jobs", "jobs-cpu"} {
+		if _, ok := depths[queue]; !ok {
+			depths[queue] = 0
+		}
+	}
+
+	for queue, depth := range depths {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(depth), queue)
+	}
+}
+
+// timedCompleter records when the first delta is streamed, for the time to first token.
+type timedCompleter struct {
+	completer
+	firstDelta time.Time
+}
+
+func (c *timedCompleter) Complete(ctx context.Context, req llm.Request, onDelta func(llm.Delta) error) (llm.Response, error) {
+	return c.completer.Complete(ctx, req, func(d llm.Delta) error {
+		if c.firstDelta.IsZero() {
+			c.firstDelta = time.Now()
+		}
+		return onDelta(d)
+	})
+}
+
+// observeGeneration records the metrics of a successful generation, which started at start.
+func observeGeneration(mo model.Model, speaker string, start, firstDelta time.Time, res llm.Response) {
+	labels := []string{string(mo.Provider), mo.Name, speaker}
+	finished := time.Now()
+
+	generationDuration.WithLabelValues(labels...).Observe(finished.Sub(start).Seconds())
+
+	if firstDelta.IsZero() {
+		return
+	}
+	generationTimeToFirstToken.WithLabelValues(labels...).Observe(firstDelta.Sub(start).Seconds())
+
+	if streaming := finished.Sub(firstDelta).Seconds(); streaming > 0 && res.Usage.OutputTokens > 0 {
+		generationTokensPerSecond.WithLabelValues(labels...).Observe(float64(res.Usage.OutputTokens) / streaming)
+	}
+}
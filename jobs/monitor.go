@@ -0,0 +1,69 @@
+package jobs
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"maragu.dev/errors"
+	"maragu.dev/glue/jobs"
+)
+
+type readyJobAgeGetter interface {
+	GetOldestReadyJobAge(ctx context.Context, queue string) (time.Duration, error)
+}
+
+// RunnerMonitor keeps track of whether a [jobs.Runner] is alive, for readiness checks.
+type RunnerMonitor struct {
+	db      readyJobAgeGetter
+	maxWait time.Duration
+	queue   string
+	running atomic.Bool
+}
+
+type NewRunnerMonitorOpts struct {
+	DB readyJobAgeGetter
+	// MaxWait is the longest a job can be ready to run without being picked up, before the runner is considered stuck.
+	// Defaults to one minute.
+	MaxWait time.Duration
+	// Queue that the runner polls. Defaults to "jobs".
+	Queue string
+}
+
+func NewRunnerMonitor(opts NewRunnerMonitorOpts) *RunnerMonitor {
+	if opts.MaxWait == 0 {
+		opts.MaxWait = time.Minute
+	}
+	if opts.Queue == "" {
+		opts.Queue = "jobs"
+	}
+	return &RunnerMonitor{
+		db:      opts.DB,
+		maxWait: opts.MaxWait,
+		queue:   opts.Queue,
+	}
+}
+
+// Start the runner, blocking until the context is done, like [jobs.Runner.Start].
+func (m *RunnerMonitor) Start(ctx context.Context, r *jobs.Runner) {
+	m.running.Store(true)
+	defer m.running.Store(false)
+
+	r.Start(ctx)
+}
+
+// Check that the runner is started and picking up jobs, returning an error if not.
+func (m *RunnerMonitor) Check(ctx context.Context) error {
+	if !m.running.Load() {
+		return errors.New("job runner not running")
+	}
+
+	age, err := m.db.GetOldestReadyJobAge(ctx, m.queue)
+	if err != nil {
+		return errors.Wrap(err, "error getting oldest ready job age")
+	}
+	if age > m.maxWait {
+		return errors.Newf("oldest ready job has waited %v, job runner is stuck", age.Round(time.Second))
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package jobs_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"maragu.dev/glue/jobs"
+	"maragu.dev/is"
+
+	appjobs "app/jobs"
+	"app/sqlitetest"
+)
+
+func TestRunnerMonitor_Check(t *testing.T) {
+	t.Run("should fail when the runner isn't started, and pass while it runs", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		m := appjobs.NewRunnerMonitor(appjobs.NewRunnerMonitorOpts{DB: db})
+
+		err := m.Check(t.Context())
+		is.True(t, err != nil)
+
+		r := jobs.NewRunner(jobs.NewRunnerOpts{Queue: db.H.JobsQ, PollInterval: 10 * time.Millisecond})
+		ctx, cancel := context.WithCancel(t.Context())
+		done := make(chan struct{})
+		go func() {
+			m.Start(ctx, r)
+			close(done)
+		}()
+
+		// Wait for the goroutine to start the runner
+		for range 100 {
+			if m.Check(t.Context()) == nil {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		err = m.Check(t.Context())
+		is.NotError(t, err)
+
+		cancel()
+		<-done
+		err = m.Check(t.Context())
+		is.True(t, err != nil)
+	})
+
+	t.Run("should fail when a ready job has waited too long", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		m := appjobs.NewRunnerMonitor(appjobs.NewRunnerMonitorOpts{DB: db, MaxWait: time.Minute})
+
+		// The runner polls another queue, so it never picks up the job
+		r := jobs.NewRunner(jobs.NewRunnerOpts{Queue: db.H.JobsQCPU})
+		ctx, cancel := context.WithCancel(t.Context())
+		done := make(chan struct{})
+		go func() {
+			m.Start(ctx, r)
+			close(done)
+		}()
+		t.Cleanup(func() {
+			cancel()
+			<-done
+		})
+
+		err := db.CreateGenerateTurnJob(t.Context(), "t_123", 0, 0)
+		is.NotError(t, err)
+		_, err = db.H.DB.ExecContext(t.Context(), `update goqite set timeout = strftime('%Y-%m-%dT%H:%M:%fZ', 'now', '-2 minutes')`)
+		is.NotError(t, err)
+
+		for range 100 {
+			if err = m.Check(t.Context()); err != nil {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		is.True(t, err != nil)
+	})
+}
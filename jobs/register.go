@@ -4,10 +4,21 @@ import (
 	"log/slog"
 
 	"maragu.dev/glue/jobs"
+
+	"app/llm"
+	"app/sqlite"
 )
 
 type RegisterOpts struct {
-	Log *slog.Logger
+	Backup          BackupOpts
+	DB              *sqlite.Database
+	ExtractMemories ExtractMemoriesOpts
+	LLM             *llm.Client
+	Log             *slog.Logger
+	// MaxConsecutiveAITurns in a conversation before generation is cancelled. Zero means no limit.
+	MaxConsecutiveAITurns int
+	PurgeTrash            PurgeTrashOpts
+	Retention             RetentionOpts
 }
 
 // Register all available jobs with the given dependencies.
@@ -15,4 +26,10 @@ func Register(r *jobs.Runner, opts RegisterOpts) {
 	if opts.Log == nil {
 		opts.Log = slog.New(slog.DiscardHandler)
 	}
+
+	Backup(r, opts.Log, opts.DB, opts.Backup)
+	ExtractMemories(r, opts.Log, opts.DB, opts.LLM, opts.ExtractMemories)
+	GenerateTurn(r, opts.Log, opts.DB, opts.LLM, opts.MaxConsecutiveAITurns)
+	PurgeTrash(r, opts.Log, opts.DB, opts.PurgeTrash)
+	Retention(r, opts.Log, opts.DB, opts.Retention)
 }
@@ -0,0 +1,95 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"maragu.dev/errors"
+	"maragu.dev/glue/jobs"
+
+	"app/model"
+)
+
+type retentionDB interface {
+	AnonymizeExpiredConversation(ctx context.Context, id model.ConversationID) error
+	DeleteExpiredConversation(ctx context.Context, id model.ConversationID) error
+	GetExpiredConversations(ctx context.Context, before time.Time) ([]model.ExpiredConversation, error)
+	ScheduleJob(ctx context.Context, name string, delay time.Duration) error
+}
+
+type RetentionOpts struct {
+	// Anonymize conversations past retention instead of deleting them.
+	Anonymize bool
+	// Days without activity before a conversation is past retention. Zero means retention is off.
+	Days int
+	// DryRun only logs what would be deleted or anonymized.
+	DryRun bool
+	// Interval between applying retention. Defaults to an hour.
+	Interval time.Duration
+}
+
+// Retention deletes or anonymizes conversations that have had no activity for the configured number of days,
+// unless they're pinned, logging each conversation it purges.
+// The next run is scheduled before this one starts, like with [Backup].
+func Retention(r *jobs.Runner, log *slog.Logger, db retentionDB, opts RetentionOpts) {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Hour
+	}
+
+	register(r, model.JobRetention, func(ctx context.Context, m []byte) error {
+		if opts.Days <= 0 {
+			log.Info("Retention is off, skipping")
+			return nil
+		}
+
+		if err := db.ScheduleJob(ctx, model.JobRetention, opts.Interval); err != nil {
+			return errors.Wrap(err, "error scheduling next retention")
+		}
+
+		before := time.Now().AddDate(0, 0, -opts.Days)
+		cs, err := db.GetExpiredConversations(ctx, before)
+		if err != nil {
+			return errors.Wrap(err, "error getting expired conversations")
+		}
+
+		action := "delete"
+		if opts.Anonymize {
+			action = "anonymize"
+		}
+
+		var purged int
+		for _, c := range cs {
+			if opts.Anonymize && !c.Anonymized.T.IsZero() {
+				continue
+			}
+
+			attrs := []any{"id", c.ID, "topic", c.Topic, "lastActivity", c.LastActivity, "turns", c.Turns}
+
+			if opts.DryRun {
+				log.Info("Conversation past retention, dry run", append(attrs, "action", action)...)
+				purged++
+				continue
+			}
+
+			if opts.Anonymize {
+				err = db.AnonymizeExpiredConversation(ctx, c.ID)
+			} else {
+				err = db.DeleteExpiredConversation(ctx, c.ID)
+			}
+			if errors.Is(err, model.ErrorConversationNotFound) {
+				continue
+			}
+			if err != nil {
+				return errors.Wrap(err, "error applying retention to conversation")
+			}
+
+			log.Info("Conversation past retention, purged", append(attrs, "action", action)...)
+			purged++
+		}
+
+		log.Info("Applied retention", "action", action, "days", opts.Days, "conversations", purged, "dryRun", opts.DryRun)
+
+		return nil
+	})
+}
@@ -0,0 +1,122 @@
+package jobs_test
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+
+	"maragu.dev/glue/jobs"
+	"maragu.dev/is"
+
+	appjobs "app/jobs"
+	"app/model"
+	"app/sqlite"
+	"app/sqlitetest"
+)
+
+func TestRetention(t *testing.T) {
+	t.Run("should only report expired conversations in dry-run mode", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		c := newExpiredConversation(t, db, "Parrot")
+
+		runRetention(t, db, appjobs.RetentionOpts{Days: 30, DryRun: true})
+
+		_, err := db.GetConversationDocument(t.Context(), c.ID)
+		is.NotError(t, err)
+	})
+
+	t.Run("should delete expired conversations", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		c := newExpiredConversation(t, db, "Parrot")
+		pinned := newExpiredConversation(t, db, "Pinned")
+		err := db.PinConversation(t.Context(), pinned.ID, true)
+		is.NotError(t, err)
+
+		runRetention(t, db, appjobs.RetentionOpts{Days: 30})
+
+		_, err = db.GetConversationDocument(t.Context(), c.ID)
+		is.Error(t, model.ErrorConversationNotFound, err)
+		_, err = db.GetConversationDocument(t.Context(), pinned.ID)
+		is.NotError(t, err)
+	})
+
+	t.Run("should anonymize expired conversations", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		c := newExpiredConversation(t, db, "Parrot")
+
+		runRetention(t, db, appjobs.RetentionOpts{Days: 30, Anonymize: true})
+
+		cd, err := db.GetConversationDocument(t.Context(), c.ID)
+		is.NotError(t, err)
+		is.Equal(t, "", cd.Conversation.Topic)
+	})
+}
+
+// newExpiredConversation with a turn by a new speaker, with everything in it created long ago.
+func newExpiredConversation(t *testing.T, db *sqlite.Database, speakerName string) model.Conversation {
+	t.Helper()
+
+	speaker := sqlitetest.NewFakeSpeaker(t, db, speakerName, "")
+	c := sqlitetest.NewConversation(t, db, "Birds")
+	_, err := db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: speaker.ID, Content: "Squawk!"})
+	is.NotError(t, err)
+
+	_, err = db.H.DB.ExecContext(t.Context(), `update conversations set created = '2020-01-01T00:00:00.000Z' where id = ?`, c.ID)
+	is.NotError(t, err)
+	_, err = db.H.DB.ExecContext(t.Context(), `update turns set created = '2020-01-01T00:00:00.000Z' where conversation_id = ?`, c.ID)
+	is.NotError(t, err)
+
+	return c
+}
+
+// runRetention once, waiting for the job to finish.
+func runRetention(t *testing.T, db *sqlite.Database, opts appjobs.RetentionOpts) {
+	t.Helper()
+
+	runScheduledJob(t, db, model.JobRetention, func(r *jobs.Runner) {
+		appjobs.Retention(r, slog.New(slog.DiscardHandler), db, opts)
+	})
+}
+
+// runScheduledJob with the given name once, waiting for it to finish. The job is registered with register.
+// Scheduled jobs replace their own queue message when scheduling the next run,
+// so the runner log is used to know when the job has finished.
+func runScheduledJob(t *testing.T, db *sqlite.Database, name string, register func(r *jobs.Runner)) {
+	t.Helper()
+
+	log := &runnerLog{done: make(chan string, 10)}
+	r := jobs.NewRunner(jobs.NewRunnerOpts{Log: log, Queue: db.H.JobsQ, PollInterval: 10 * time.Millisecond})
+	register(r)
+	startRunner(t, r)
+
+	err := db.EnsureJobScheduled(t.Context(), name, 0)
+	is.NotError(t, err)
+
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case done := <-log.done:
+			if done == name {
+				return
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for job", name)
+		}
+	}
+}
+
+// runnerLog sends the names of the jobs the runner has run, successfully or not, on done.
+type runnerLog struct {
+	done chan string
+}
+
+func (l *runnerLog) Info(msg string, args ...any) {
+	if msg != "Ran job" && msg != "Error running job" {
+		return
+	}
+	for i := 0; i+1 < len(args); i += 2 {
+		if args[i] == "name" {
+			l.done <- args[i+1].(string)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"maragu.dev/errors"
+	"maragu.dev/glue/jobs"
+
+	"app/model"
+)
+
+type trashPurger interface {
+	PurgeTrash(ctx context.Context, before time.Time) (model.PurgedTrash, error)
+	ScheduleJob(ctx context.Context, name string, delay time.Duration) error
+}
+
+type PurgeTrashOpts struct {
+	// Days in the trash before conversations, turns, and speakers are permanently deleted.
+	// Zero means the trash is never emptied.
+	Days int
+	// Interval between purges. Defaults to an hour.
+	Interval time.Duration
+}
+
+// PurgeTrash permanently deletes what's been in the trash for the configured number of days.
+// The next run is scheduled before this one starts, like with [Backup].
+func PurgeTrash(r *jobs.Runner, log *slog.Logger, db trashPurger, opts PurgeTrashOpts) {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Hour
+	}
+
+	register(r, model.JobPurgeTrash, func(ctx context.Context, m []byte) error {
+		if opts.Days <= 0 {
+			log.Info("Purging trash is off, skipping")
+			return nil
+		}
+
+		if err := db.ScheduleJob(ctx, model.JobPurgeTrash, opts.Interval); err != nil {
+			return errors.Wrap(err, "error scheduling next trash purge")
+		}
+
+		purged, err := db.PurgeTrash(ctx, time.Now().AddDate(0, 0, -opts.Days))
+		if err != nil {
+			return errors.Wrap(err, "error purging trash")
+		}
+
+		log.Info("Purged trash", "days", opts.Days, "conversations", purged.Conversations, "turns", purged.Turns,
+			"speakers", purged.Speakers)
+
+		return nil
+	})
+}
@@ -0,0 +1,35 @@
+package jobs_test
+
+import (
+	"log/slog"
+	"testing"
+
+	"maragu.dev/glue/jobs"
+	"maragu.dev/is"
+
+	appjobs "app/jobs"
+	"app/model"
+	"app/sqlitetest"
+)
+
+func TestPurgeTrash(t *testing.T) {
+	t.Run("should permanently delete conversations that have been in the trash long enough", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		old := sqlitetest.NewConversation(t, db, "Old")
+		recent := sqlitetest.NewConversation(t, db, "Recent")
+
+		is.NotError(t, db.DeleteConversation(t.Context(), old.ID))
+		is.NotError(t, db.DeleteConversation(t.Context(), recent.ID))
+		_, err := db.H.DB.ExecContext(t.Context(), `update conversations set deleted = '2020-01-01T00:00:00.000Z' where id = ?`, old.ID)
+		is.NotError(t, err)
+
+		runScheduledJob(t, db, model.JobPurgeTrash, func(r *jobs.Runner) {
+			appjobs.PurgeTrash(r, slog.New(slog.DiscardHandler), db, appjobs.PurgeTrashOpts{Days: 30})
+		})
+
+		trash, err := db.GetTrash(t.Context())
+		is.NotError(t, err)
+		is.Equal(t, 1, len(trash.Conversations))
+		is.Equal(t, recent.ID, trash.Conversations[0].ID)
+	})
+}
@@ -0,0 +1,297 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"maragu.dev/errors"
+
+	"app/model"
+)
+
+// anthropicClient talks to the Anthropic messages API, which is needed instead of the OpenAI-compatible one
+// to get thinking blocks, and to send them back with their signatures.
+type anthropicClient struct {
+	baseURL string
+	c       *http.Client
+	key     string
+}
+
+// anthropicDefaultMaxTokens is used when the model config doesn't set maxTokens, since the API requires it.
+const anthropicDefaultMaxTokens = 8192
+
+type anthropicContentBlock struct {
+	Type      string `json:"type"`
+	Text      string `json:"text,omitempty"`
+	Thinking  string `json:"thinking,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Data      string `json:"data,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string                  `json:"role"`
+	Content []anthropicContentBlock `json:"content"`
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type anthropicRequest struct {
+	Model      string             `json:"model"`
+	MaxTokens  int                `json:"max_tokens"`
+	System     string             `json:"system,omitempty"`
+	Messages   []anthropicMessage `json:"messages"`
+	Stream     bool               `json:"stream"`
+	Thinking   json.RawMessage    `json:"thinking,omitempty"`
+	Tools      []anthropicTool    `json:"tools,omitempty"`
+	ToolChoice map[string]any     `json:"tool_choice,omitempty"`
+}
+
+// anthropicOutputTool is the name of the tool that structured output is given to, see [Request.Schema].
+const anthropicOutputTool = "output"
+
+type anthropicEvent struct {
+	Type         string                `json:"type"`
+	Index        int                   `json:"index"`
+	ContentBlock anthropicContentBlock `json:"content_block"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		Thinking    string `json:"thinking"`
+		Signature   string `json:"signature"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Message struct {
+		Usage struct {
+			InputTokens int `json:"input_tokens"`
+		} `json:"usage"`
+	} `json:"message"`
+	Usage struct {
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (c *anthropicClient) complete(ctx context.Context, req Request, onDelta func(Delta) error) (Response, error) {
+	// Thinking is passed on as it is, for example {"type": "enabled", "budget_tokens": 4096}
+	var config struct {
+		MaxTokens int             `json:"maxTokens"`
+		Thinking  json.RawMessage `json:"thinking"`
+	}
+	if req.Model.Config != "" {
+		if err := json.Unmarshal([]byte(req.Model.Config), &config); err != nil {
+			return Response{}, errors.Wrap(err, "error unmarshalling model config")
+		}
+	}
+	if config.MaxTokens == 0 {
+		config.MaxTokens = anthropicDefaultMaxTokens
+	}
+
+	body := anthropicRequest{
+		Model:     req.Model.Name,
+		MaxTokens: config.MaxTokens,
+		System:    req.System,
+		Stream:    true,
+		Thinking:  config.Thinking,
+	}
+
+	// The API has no native structured output, so the output is the input of a tool with the schema.
+	// The tool can only be forced without thinking, so with thinking, the model is instructed to use it.
+	// Tool input must be an object, so other schemas are only instructed.
+	if len(req.Schema) > 0 {
+		var s struct {
+			Type any `json:"type"`
+		}
+		_ = json.Unmarshal(req.Schema, &s)
+
+		var thinking struct {
+			Type string `json:"type"`
+		}
+		_ = json.Unmarshal(config.Thinking, &thinking)
+
+		switch {
+		case s.Type == "object" && thinking.Type != "enabled":
+			body.Tools = []anthropicTool{{Name: anthropicOutputTool, Description: "Give your reply.", InputSchema: req.Schema}}
+			body.ToolChoice = map[string]any{"type": "tool", "name": anthropicOutputTool}
+		case s.Type == "object":
+			body.Tools = []anthropicTool{{Name: anthropicOutputTool, Description: "Give your reply.", InputSchema: req.Schema}}
+			body.System = strings.TrimSpace(body.System + "\n\nGive your reply with the " + anthropicOutputTool + " tool.")
+		default:
+			body.System = strings.TrimSpace(body.System + "\n\nReply with only JSON that matches this JSON Schema:\n" + string(req.Schema))
+		}
+	}
+
+	for _, m := range req.Messages {
+		var blocks []anthropicContentBlock
+
+		// Only signed and redacted thinking can be sent back, which excludes reasoning from other providers
+		for _, b := range m.Reasoning {
+			switch {
+			case b.Type == model.ReasoningBlockTypeThinking && b.Signature != "":
+				blocks = append(blocks, anthropicContentBlock{Type: "thinking", Thinking: b.Text, Signature: b.Signature})
+			case b.Type == model.ReasoningBlockTypeRedacted:
+				blocks = append(blocks, anthropicContentBlock{Type: "redacted_thinking", Data: b.Data})
+			}
+		}
+
+		// The API doesn't allow empty text blocks
+		if m.Content != "" {
+			blocks = append(blocks, anthropicContentBlock{Type: "text", Text: m.Content})
+		}
+
+		if len(blocks) == 0 {
+			continue
+		}
+
+		body.Messages = append(body.Messages, anthropicMessage{Role: string(m.Role), Content: blocks})
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return Response{}, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/messages", bytes.NewReader(b))
+	if err != nil {
+		return Response{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Anthropic-Version", "2023-06-01")
+	if key := keyOr(req.key, c.key); key != "" {
+		httpReq.Header.Set("X-Api-Key", key)
+	}
+
+	res, err := c.c.Do(httpReq)
+	if err != nil {
+		return Response{}, err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		resBody, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+		return Response{}, StatusError{
+			StatusCode: res.StatusCode,
+			Body:       string(resBody),
+			RetryAfter: parseRetryAfter(res.Header.Get("Retry-After")),
+		}
+	}
+
+	var r Response
+	var content, toolInput strings.Builder
+	var usedTool bool
+
+	// The response is a stream of server-sent events, with content blocks that are started, streamed, and stopped
+	blocks := map[int]*model.ReasoningBlock{}
+	scanner := bufio.NewScanner(res.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+
+		var event anthropicEvent
+		if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &event); err != nil {
+			return Response{}, errors.Wrap(err, "error unmarshalling event")
+		}
+
+		switch event.Type {
+		case "message_start":
+			r.Usage.InputTokens = event.Message.Usage.InputTokens
+
+		case "content_block_start":
+			switch event.ContentBlock.Type {
+			case "thinking":
+				blocks[event.Index] = &model.ReasoningBlock{Type: model.ReasoningBlockTypeThinking}
+			case "redacted_thinking":
+				blocks[event.Index] = &model.ReasoningBlock{Type: model.ReasoningBlockTypeRedacted, Data: event.ContentBlock.Data}
+			case "tool_use":
+				usedTool = true
+			}
+
+		case "content_block_delta":
+			var d Delta
+			switch event.Delta.Type {
+			case "text_delta":
+				d.Content = event.Delta.Text
+				content.WriteString(d.Content)
+			case "input_json_delta":
+				d.Content = event.Delta.PartialJSON
+				toolInput.WriteString(d.Content)
+			case "thinking_delta":
+				d.Reasoning = event.Delta.Thinking
+				if b, ok := blocks[event.Index]; ok {
+					b.Text += d.Reasoning
+				}
+			case "signature_delta":
+				if b, ok := blocks[event.Index]; ok {
+					b.Signature += event.Delta.Signature
+				}
+			}
+			if d.Content == "" && d.Reasoning == "" {
+				continue
+			}
+			if err := onDelta(d); err != nil {
+				return Response{}, err
+			}
+
+		case "content_block_stop":
+			if b, ok := blocks[event.Index]; ok {
+				r.Reasoning = append(r.Reasoning, *b)
+				delete(blocks, event.Index)
+			}
+
+		case "message_delta":
+			if event.Delta.StopReason != "" {
+				r.FinishReason = event.Delta.StopReason
+			}
+			r.Usage.OutputTokens = event.Usage.OutputTokens
+
+		case "error":
+			// Errors after the response has started, such as when the API is overloaded
+			statusCode := http.StatusInternalServerError
+			if event.Error.Type == "overloaded_error" {
+				statusCode = 529
+			}
+			return Response{}, StatusError{StatusCode: statusCode, Body: event.Error.Message}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Response{}, errors.Wrap(err, "error reading stream")
+	}
+
+	// The output tool input is the content, instead of any text around the tool use
+	r.Content = content.String()
+	if usedTool {
+		r.Content = toolInput.String()
+	}
+
+	return r, nil
+}
+
+func (c *anthropicClient) probe(ctx context.Context, _ model.Model, key model.Secret) error {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/models", nil)
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Anthropic-Version", "2023-06-01")
+	if key := keyOr(key, c.key); key != "" {
+		httpReq.Header.Set("X-Api-Key", key)
+	}
+
+	return doProbe(c.c, httpReq)
+}
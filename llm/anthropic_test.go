@@ -0,0 +1,148 @@
+package llm_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"maragu.dev/is"
+
+	"app/llm"
+	"app/model"
+)
+
+func TestClient_Complete_anthropic(t *testing.T) {
+	t.Run("should stream thinking and content, and send signed and redacted thinking back", func(t *testing.T) {
+		var body map[string]any
+		s := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+			is.Equal(t, "/v1/messages", r.URL.Path)
+			is.Equal(t, "secret", r.Header.Get("X-Api-Key"))
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, event := range []string{
+				`{"type":"message_start","message":{"usage":{"input_tokens":10}}}`,
+				`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}`,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"Let me "}}`,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"think."}}`,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"sig"}}`,
+				`{"type":"content_block_stop","index":0}`,
+				`{"type":"content_block_start","index":1,"content_block":{"type":"redacted_thinking","data":"secret stuff"}}`,
+				`{"type":"content_block_stop","index":1}`,
+				`{"type":"content_block_start","index":2,"content_block":{"type":"text","text":""}}`,
+				`{"type":"content_block_delta","index":2,"delta":{"type":"text_delta","text":"Hello!"}}`,
+				`{"type":"content_block_stop","index":2}`,
+				`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":5}}`,
+				`{"type":"message_stop"}`,
+			} {
+				_, _ = fmt.Fprintf(w, "event: x\ndata: %v\n\n", event)
+			}
+		})
+
+		// Send requests for the Anthropic API to the test server instead
+		u, err := url.Parse(s.URL)
+		is.NotError(t, err)
+		c := llm.NewClient(llm.NewClientOptions{
+			AnthropicKey: "secret",
+			HTTPClient: &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				r.URL.Scheme = u.Scheme
+				r.URL.Host = u.Host
+				return http.DefaultTransport.RoundTrip(r)
+			})},
+		})
+
+		var deltas []llm.Delta
+		res, err := c.Complete(t.Context(), llm.Request{
+			Model:  model.Model{Provider: model.ProviderAnthropic, Name: "claude", Config: `{"thinking":{"type":"enabled","budget_tokens":1024}}`},
+			System: "Be nice.",
+			Messages: []llm.Message{
+				{Role: llm.RoleUser, Content: "Hi"},
+				{Role: llm.RoleAssistant, Content: "Hello", Reasoning: model.Reasoning{
+					{Type: model.ReasoningBlockTypeThinking, Text: "Greet.", Signature: "oldsig"},
+					{Type: model.ReasoningBlockTypeThinking, Text: "Unsigned, from another provider."},
+					{Type: model.ReasoningBlockTypeRedacted, Data: "old secret"},
+				}},
+				{Role: llm.RoleUser, Content: "How are you?"},
+			},
+		}, func(d llm.Delta) error {
+			deltas = append(deltas, d)
+			return nil
+		})
+		is.NotError(t, err)
+		is.Equal(t, "Hello!", res.Content)
+		is.Equal(t, "end_turn", res.FinishReason)
+		is.Equal(t, 10, res.Usage.InputTokens)
+		is.Equal(t, 5, res.Usage.OutputTokens)
+		is.EqualSlice(t, model.Reasoning{
+			{Type: model.ReasoningBlockTypeThinking, Text: "Let me think.", Signature: "sig"},
+			{Type: model.ReasoningBlockTypeRedacted, Data: "secret stuff"},
+		}, res.Reasoning)
+		is.EqualSlice(t, []llm.Delta{{Reasoning: "Let me "}, {Reasoning: "think."}, {Content: "Hello!"}}, deltas)
+
+		is.Equal(t, "Be nice.", body["system"].(string))
+		is.Equal(t, float64(8192), body["max_tokens"].(float64))
+		is.Equal(t, float64(1024), body["thinking"].(map[string]any)["budget_tokens"].(float64))
+		assistant := body["messages"].([]any)[1].(map[string]any)
+		b, err := json.Marshal(assistant["content"])
+		is.NotError(t, err)
+		is.Equal(t, `[{"signature":"oldsig","thinking":"Greet.","type":"thinking"},{"data":"old secret","type":"redacted_thinking"},{"text":"Hello","type":"text"}]`, string(b))
+	})
+
+	t.Run("should force structured output through a tool with the schema", func(t *testing.T) {
+		var body map[string]any
+		s := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, event := range []string{
+				`{"type":"message_start","message":{"usage":{"input_tokens":10}}}`,
+				`{"type":"content_block_start","index":0,"content_block":{"type":"tool_use","id":"toolu_1","name":"output","input":{}}}`,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":"{\"label\":"}}`,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":"\"spam\"}"}}`,
+				`{"type":"content_block_stop","index":0}`,
+				`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":5}}`,
+				`{"type":"message_stop"}`,
+			} {
+				_, _ = fmt.Fprintf(w, "event: x\ndata: %v\n\n", event)
+			}
+		})
+
+		u, err := url.Parse(s.URL)
+		is.NotError(t, err)
+		c := llm.NewClient(llm.NewClientOptions{
+			HTTPClient: &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				r.URL.Scheme = u.Scheme
+				r.URL.Host = u.Host
+				return http.DefaultTransport.RoundTrip(r)
+			})},
+		})
+
+		res, err := c.Complete(t.Context(), llm.Request{
+			Model:    model.Model{Provider: model.ProviderAnthropic, Name: "claude"},
+			Messages: []llm.Message{{Role: llm.RoleUser, Content: "Spam or ham?"}},
+			Schema:   json.RawMessage(`{"type":"object","properties":{"label":{"type":"string"}}}`),
+		}, func(llm.Delta) error { return nil })
+		is.NotError(t, err)
+		is.Equal(t, `{"label":"spam"}`, res.Content)
+
+		tools := body["tools"].([]any)
+		is.Equal(t, 1, len(tools))
+		is.Equal(t, "output", tools[0].(map[string]any)["name"])
+		is.Equal(t, "object", tools[0].(map[string]any)["input_schema"].(map[string]any)["type"])
+		is.Equal(t, "tool", body["tool_choice"].(map[string]any)["type"])
+		_, ok := body["system"]
+		is.True(t, !ok)
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
@@ -0,0 +1,77 @@
+package llm
+
+import (
+	"sync"
+	"time"
+)
+
+type CircuitBreakerOptions struct {
+	// Threshold of consecutive failures before the circuit opens. Zero disables the circuit breaker.
+	Threshold int
+	// Cooldown while the circuit is open, after which a request is let through to probe the provider.
+	Cooldown time.Duration
+}
+
+// breaker is a circuit breaker for a provider.
+// After [CircuitBreakerOptions.Threshold] consecutive failures, the circuit opens and requests fail fast
+// for the cooldown period. After that, a single request is let through to probe the provider,
+// while other requests keep failing fast for another cooldown period.
+// If the probe succeeds, the circuit closes, and if it fails, the circuit stays open.
+type breaker struct {
+	cooldown  time.Duration
+	failures  int
+	lock      sync.Mutex
+	openUntil time.Time
+	threshold int
+}
+
+func newBreaker(opts CircuitBreakerOptions) *breaker {
+	return &breaker{
+		cooldown:  opts.Cooldown,
+		threshold: opts.Threshold,
+	}
+}
+
+// allow returns zero if a request is allowed, and otherwise how long until the circuit lets a request through again.
+func (b *breaker) allow() time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.openUntil.IsZero() {
+		return 0
+	}
+
+	if wait := time.Until(b.openUntil); wait > 0 {
+		return wait
+	}
+
+	// Let this request through as the probe, and keep the circuit open for everything else.
+	// If the probe never reports back, another one is let through after the cooldown.
+	b.openUntil = time.Now().Add(b.cooldown)
+	return 0
+}
+
+func (b *breaker) success() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.failures = 0
+	b.openUntil = time.Time{}
+}
+
+func (b *breaker) failure() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.failures++
+	if b.threshold > 0 && b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+func (b *breaker) status() (failures int, openUntil time.Time) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.failures, b.openUntil
+}
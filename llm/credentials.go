@@ -0,0 +1,70 @@
+package llm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"maragu.dev/errors"
+
+	"app/model"
+)
+
+type credentialStore interface {
+	GetCredential(ctx context.Context, name string) (model.Secret, error)
+}
+
+// Credentials resolves credentials by name, from an environment variable, a file in a directory, or a store, in that order.
+// The environment variable for a credential named openai-org-b is CREDENTIAL_OPENAI_ORG_B,
+// and the file is openai-org-b in the directory, like Docker secrets in /run/secrets.
+type Credentials struct {
+	dir   string
+	store credentialStore
+}
+
+// NewCredentials from the given directory and store, which are skipped if empty or nil.
+func NewCredentials(dir string, store credentialStore) *Credentials {
+	return &Credentials{dir: dir, store: store}
+}
+
+// Resolve the credential with the given name.
+// If it's not found anywhere, [model.ErrorCredentialNotFound] is returned.
+func (c *Credentials) Resolve(ctx context.Context, name string) (model.Secret, error) {
+	if !model.ValidCredentialName(name) {
+		return "", model.ErrorCredentialNameInvalid
+	}
+
+	if v := os.Getenv(credentialEnvName(name)); v != "" {
+		return model.Secret(v), nil
+	}
+
+	if c.dir != "" {
+		b, err := os.ReadFile(filepath.Join(c.dir, name))
+		if err == nil {
+			return model.Secret(strings.TrimSpace(string(b))), nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", errors.Wrap(err, "error reading credential file")
+		}
+	}
+
+	if c.store != nil {
+		return c.store.GetCredential(ctx, name)
+	}
+
+	return "", model.ErrorCredentialNotFound
+}
+
+// credentialEnvName is the environment variable of the credential with the given name.
+func credentialEnvName(name string) string {
+	return "CREDENTIAL_" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name)
+}
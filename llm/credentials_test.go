@@ -0,0 +1,150 @@
+package llm_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"maragu.dev/is"
+
+	"app/llm"
+	"app/model"
+)
+
+type credentialStoreMock struct {
+	credentials map[string]model.Secret
+}
+
+func (m *credentialStoreMock) GetCredential(_ context.Context, name string) (model.Secret, error) {
+	v, ok := m.credentials[name]
+	if !ok {
+		return "", model.ErrorCredentialNotFound
+	}
+	return v, nil
+}
+
+func TestCredentials_Resolve(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "from-file"), []byte("sk-file\n"), 0600)
+	is.NotError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "everywhere"), []byte("sk-file"), 0600)
+	is.NotError(t, err)
+	t.Setenv("CREDENTIAL_FROM_ENV", "sk-env")
+	t.Setenv("CREDENTIAL_EVERYWHERE", "sk-env")
+
+	c := llm.NewCredentials(dir, &credentialStoreMock{credentials: map[string]model.Secret{
+		"from-store": "sk-store",
+		"everywhere": "sk-store",
+	}})
+
+	tests := []struct {
+		name     string
+		expected model.Secret
+	}{
+		{"from-env", "sk-env"},
+		{"from-file", "sk-file"},
+		{"from-store", "sk-store"},
+		{"everywhere", "sk-env"},
+	}
+	for _, test := range tests {
+		t.Run("should resolve "+test.name, func(t *testing.T) {
+			v, err := c.Resolve(t.Context(), test.name)
+			is.NotError(t, err)
+			is.Equal(t, test.expected, v)
+		})
+	}
+
+	t.Run("should return ErrorCredentialNotFound when the credential is nowhere", func(t *testing.T) {
+		_, err := c.Resolve(t.Context(), "nowhere")
+		is.Error(t, model.ErrorCredentialNotFound, err)
+	})
+
+	t.Run("should return ErrorCredentialNameInvalid for names that aren't safe file names", func(t *testing.T) {
+		_, err := c.Resolve(t.Context(), "../from-file")
+		is.Error(t, model.ErrorCredentialNameInvalid, err)
+	})
+}
+
+func TestClient_Complete_credentials(t *testing.T) {
+	t.Run("should use the credential the model references, then the provider's, then the key option", func(t *testing.T) {
+		var authorization string
+		s := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+			authorization = r.Header.Get("Authorization")
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Hi\"},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n")
+		})
+
+		store := &credentialStoreMock{credentials: map[string]model.Secret{"org-b": "sk-b"}}
+		c := llm.NewClient(llm.NewClientOptions{Credentials: llm.NewCredentials("", store)})
+		address := strings.TrimPrefix(s.URL, "http://")
+
+		req := newRequest(s)
+		req.Model.Config = model.JSON(`{"address": "` + address + `", "credential": "org-b"}`)
+		_, err := c.Complete(t.Context(), req, func(llm.Delta) error { return nil })
+		is.NotError(t, err)
+		is.Equal(t, "Bearer sk-b", authorization)
+
+		store.credentials["llamacpp"] = "sk-provider"
+		_, err = c.Complete(t.Context(), newRequest(s), func(llm.Delta) error { return nil })
+		is.NotError(t, err)
+		is.Equal(t, "Bearer sk-provider", authorization)
+
+		delete(store.credentials, "llamacpp")
+		_, err = c.Complete(t.Context(), newRequest(s), func(llm.Delta) error { return nil })
+		is.NotError(t, err)
+		is.Equal(t, "", authorization)
+	})
+
+	t.Run("should error when the credential the model references doesn't exist", func(t *testing.T) {
+		s := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+			t.Fatal("should not be called")
+		})
+
+		c := llm.NewClient(llm.NewClientOptions{})
+
+		req := newRequest(s)
+		req.Model.Config = model.JSON(`{"address": "localhost", "credential": "nope"}`)
+		_, err := c.Complete(t.Context(), req, func(llm.Delta) error { return nil })
+		is.Error(t, model.ErrorCredentialNotFound, err)
+	})
+
+	t.Run("should error instead of falling back when the model config is malformed", func(t *testing.T) {
+		s := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+			t.Fatal("should not be called")
+		})
+
+		store := &credentialStoreMock{credentials: map[string]model.Secret{"llamacpp": "sk-provider"}}
+		c := llm.NewClient(llm.NewClientOptions{Credentials: llm.NewCredentials("", store)})
+
+		for _, config := range []string{`[]`, `"x"`, `{"credential": 5}`} {
+			req := newRequest(s)
+			req.Model.Config = model.JSON(config)
+			_, err := c.Complete(t.Context(), req, func(llm.Delta) error { return nil })
+			is.True(t, err != nil)
+
+			err = c.Probe(t.Context(), req.Model)
+			is.True(t, err != nil)
+		}
+	})
+}
+
+func TestSecret(t *testing.T) {
+	t.Run("should be redacted when formatted and marshalled", func(t *testing.T) {
+		s := model.Secret("sk-secret")
+
+		is.Equal(t, "[redacted]", fmt.Sprint(s))
+		is.Equal(t, "{Key:[redacted]}", fmt.Sprintf("%+v", struct{ Key model.Secret }{s}))
+		is.Equal(t, "[redacted]", s.LogValue().String())
+
+		b, err := json.Marshal(map[string]model.Secret{"key": s})
+		is.NotError(t, err)
+		is.Equal(t, `{"key":"[redacted]"}`, string(b))
+
+		is.Equal(t, "sk-secret", string(s))
+	})
+}
@@ -0,0 +1,169 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"maragu.dev/errors"
+
+	"app/model"
+)
+
+// fakeConfig is the config of models with the fake provider. All fields are optional.
+//
+// Without responses, the fake echoes the last message back, prefixed with "Echo: ".
+// With responses, it replies with them in order, by the number of assistant messages in the request,
+// starting over when they run out. With reasoning, it's streamed as a thinking block before the response.
+//
+// Example:
+//
+//	{
+//	  "responses": ["Hello!", "How can I help?"],
+//	  "reasoning": "The user greeted me.",
+//	  "latency": "500ms",
+//	  "chunkSize": 4,
+//	  "chunkDelay": "20ms",
+//	  "error": {"statusCode": 503, "retryAfter": "2s", "times": 2}
+//	}
+type fakeConfig struct {
+	Responses []string `json:"responses"`
+	Reasoning string   `json:"reasoning"`
+	// Latency before the first chunk.
+	Latency duration `json:"latency"`
+	// ChunkSize in runes that the response is streamed in. Zero streams the whole response as one chunk.
+	ChunkSize int `json:"chunkSize"`
+	// ChunkDelay between chunks.
+	ChunkDelay duration `json:"chunkDelay"`
+	Error      *struct {
+		StatusCode int      `json:"statusCode"`
+		RetryAfter duration `json:"retryAfter"`
+		// Times the error is returned before succeeding. Zero means always.
+		Times int `json:"times"`
+	} `json:"error"`
+}
+
+// duration is a [time.Duration] that is unmarshalled from strings like "500ms".
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+// fakeClient is a deterministic provider for tests and local development.
+// See [fakeConfig] for how to configure it.
+type fakeClient struct {
+	// errors counts the injected errors returned per model, so they can stop after some times
+	errors     map[model.ModelID]int
+	errorsLock sync.Mutex
+}
+
+func (c *fakeClient) complete(ctx context.Context, req Request, onDelta func(Delta) error) (Response, error) {
+	var config fakeConfig
+	if req.Model.Config != "" {
+		if err := json.Unmarshal([]byte(req.Model.Config), &config); err != nil {
+			return Response{}, errors.Wrap(err, "error unmarshalling fake model config")
+		}
+	}
+
+	if err := sleep(ctx, time.Duration(config.Latency)); err != nil {
+		return Response{}, err
+	}
+
+	if e := config.Error; e != nil {
+		c.errorsLock.Lock()
+		times := c.errors[req.Model.ID]
+		if e.Times == 0 || times < e.Times {
+			c.errors[req.Model.ID]++
+			c.errorsLock.Unlock()
+			return Response{}, StatusError{
+				StatusCode: e.StatusCode,
+				Body:       http.StatusText(e.StatusCode),
+				RetryAfter: time.Duration(e.RetryAfter),
+			}
+		}
+		c.errorsLock.Unlock()
+	}
+
+	var content string
+	switch {
+	case len(config.Responses) > 0:
+		var assistantMessages int
+		for _, m := range req.Messages {
+			if m.Role == RoleAssistant {
+				assistantMessages++
+			}
+		}
+		content = config.Responses[assistantMessages%len(config.Responses)]
+
+	case len(req.Messages) > 0:
+		content = "Echo: " + req.Messages[len(req.Messages)-1].Content
+
+	default:
+		content = "Echo: "
+	}
+
+	var deltas []Delta
+	for _, chunk := range chunk(config.Reasoning, config.ChunkSize) {
+		deltas = append(deltas, Delta{Reasoning: chunk})
+	}
+	for _, chunk := range chunk(content, config.ChunkSize) {
+		deltas = append(deltas, Delta{Content: chunk})
+	}
+
+	for i, d := range deltas {
+		if i > 0 {
+			if err := sleep(ctx, time.Duration(config.ChunkDelay)); err != nil {
+				return Response{}, err
+			}
+		}
+		if err := onDelta(d); err != nil {
+			return Response{}, err
+		}
+	}
+
+	var reasoning model.Reasoning
+	if config.Reasoning != "" {
+		reasoning = model.Reasoning{{Type: model.ReasoningBlockTypeThinking, Text: config.Reasoning}}
+	}
+
+	var inputTokens int
+	for _, m := range req.Messages {
+		inputTokens += len(m.Content)
+	}
+
+	return Response{
+		Content:      content,
+		FinishReason: "stop",
+		Reasoning:    reasoning,
+		Usage:        Usage{InputTokens: inputTokens, OutputTokens: len(content)},
+	}, nil
+}
+
+// chunk s into parts of size runes. Zero size gives the whole string as one part.
+func chunk(s string, size int) []string {
+	if s == "" {
+		return nil
+	}
+	if size <= 0 {
+		return []string{s}
+	}
+
+	var chunks []string
+	runes := []rune(s)
+	for i := 0; i < len(runes); i += size {
+		chunks = append(chunks, string(runes[i:min(i+size, len(runes))]))
+	}
+	return chunks
+}
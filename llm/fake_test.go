@@ -0,0 +1,64 @@
+package llm_test
+
+import (
+	"testing"
+
+	"maragu.dev/errors"
+	"maragu.dev/is"
+
+	"app/llm"
+	"app/model"
+)
+
+func TestClient_Complete_fake(t *testing.T) {
+	t.Run("should echo the last message back", func(t *testing.T) {
+		c := llm.NewClient(llm.NewClientOptions{})
+
+		res, err := c.Complete(t.Context(), newFakeRequest("", "Hi", "Hello", "How are you?"), func(llm.Delta) error { return nil })
+		is.NotError(t, err)
+		is.Equal(t, "Echo: How are you?", res.Content)
+	})
+
+	t.Run("should reply with scripted responses by the number of assistant messages, in chunks", func(t *testing.T) {
+		c := llm.NewClient(llm.NewClientOptions{})
+
+		var deltas []string
+		res, err := c.Complete(t.Context(), newFakeRequest(`{"responses":["One","Two, three"],"chunkSize":4,"chunkDelay":"1ms"}`, "Hi", "One", "Go on"),
+			func(d llm.Delta) error {
+				deltas = append(deltas, d.Content)
+				return nil
+			})
+		is.NotError(t, err)
+		is.Equal(t, "Two, three", res.Content)
+		is.EqualSlice(t, []string{"Two,", " thr", "ee"}, deltas)
+	})
+
+	t.Run("should return injected errors the given number of times", func(t *testing.T) {
+		c := llm.NewClient(llm.NewClientOptions{})
+		req := newFakeRequest(`{"error":{"statusCode":400,"times":1}}`, "Hi")
+
+		_, err := c.Complete(t.Context(), req, func(llm.Delta) error { return nil })
+		var statusErr llm.StatusError
+		is.True(t, errors.As(err, &statusErr))
+		is.Equal(t, 400, statusErr.StatusCode)
+
+		res, err := c.Complete(t.Context(), req, func(llm.Delta) error { return nil })
+		is.NotError(t, err)
+		is.Equal(t, "Echo: Hi", res.Content)
+	})
+}
+
+// newFakeRequest with alternating user and assistant messages, starting with the user.
+func newFakeRequest(config string, messages ...string) llm.Request {
+	req := llm.Request{
+		Model: model.Model{ID: "mo_fake", Provider: model.ProviderFake, Config: model.JSON(config)},
+	}
+	for i, m := range messages {
+		role := llm.RoleUser
+		if i%2 == 1 {
+			role = llm.RoleAssistant
+		}
+		req.Messages = append(req.Messages, llm.Message{Role: role, Content: m})
+	}
+	return req
+}
@@ -0,0 +1,123 @@
+package llm
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Limits on requests to a provider or model. Zero values mean no limit.
+type Limits struct {
+	Concurrency       int
+	RequestsPerMinute int
+}
+
+// limiter enforces [Limits] by holding a slot for each concurrent request,
+// and by spacing requests evenly over time.
+// Times reserved by requests that are cancelled while waiting are given back, so they don't push back later requests.
+type limiter struct {
+	freed    []time.Time
+	interval time.Duration
+	lock     sync.Mutex
+	next     time.Time
+	slots    chan struct{}
+}
+
+func newLimiter(l Limits) *limiter {
+	var li limiter
+	if l.Concurrency > 0 {
+		li.slots = make(chan struct{}, l.Concurrency)
+	}
+	if l.RequestsPerMinute > 0 {
+		li.interval = time.Minute / time.Duration(l.RequestsPerMinute)
+	}
+	return &li
+}
+
+// acquire waits until a request is allowed, or the context is done.
+// The returned function must be called when the request is done.
+func (l *limiter) acquire(ctx context.Context) (func(), error) {
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	release := func() {
+		if l.slots != nil {
+			<-l.slots
+		}
+	}
+
+	if l.interval > 0 {
+		at := l.reserve()
+
+		if err := sleep(ctx, time.Until(at)); err != nil {
+			l.giveBack(at)
+			release()
+			return nil, err
+		}
+	}
+
+	return release, nil
+}
+
+// reserve the earliest time a request is allowed at, which is a time given back if there's one still ahead.
+func (l *limiter) reserve() time.Time {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := time.Now()
+	l.freed = slices.DeleteFunc(l.freed, func(t time.Time) bool { return t.Before(now) })
+	if len(l.freed) > 0 {
+		i := 0
+		for j, t := range l.freed {
+			if t.Before(l.freed[i]) {
+				i = j
+			}
+		}
+		at := l.freed[i]
+		l.freed = slices.Delete(l.freed, i, i+1)
+		return at
+	}
+
+	at := now
+	if l.next.After(at) {
+		at = l.next
+	}
+	l.next = at.Add(l.interval)
+	return at
+}
+
+// giveBack a reserved time that wasn't used.
+// If it's the latest reservation, the next request can have it, otherwise it's kept for [limiter.reserve].
+func (l *limiter) giveBack(at time.Time) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.next.Equal(at.Add(l.interval)) {
+		l.next = at
+		return
+	}
+	l.freed = append(l.freed, at)
+}
+
+// sleep for the given duration, or until the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,390 @@
+// Package llm provides a [Client] for generating text with large language models from the supported providers.
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"maragu.dev/errors"
+
+	"app/model"
+)
+
+type Role string
+
+const (
+	RoleAssistant = Role("assistant")
+	RoleUser      = Role("user")
+)
+
+type Message struct {
+	Role    Role
+	Content string
+	// Reasoning the model did before the content, for assistant messages.
+	// Providers that sign or redact reasoning need it sent back unchanged.
+	Reasoning model.Reasoning
+}
+
+// Request to generate the next assistant message in a conversation.
+type Request struct {
+	Model    model.Model
+	System   string
+	Messages []Message
+	// Schema is a JSON Schema that the content must match, if set.
+	// Providers with native structured output enforce it, others are instructed to follow it.
+	// Either way, validate the content with [ParseOutput].
+	Schema json.RawMessage
+	// key is the credential resolved for the model by [Client.Complete], if any.
+	key model.Secret
+}
+
+// Delta is a chunk of a [Response] while it's being streamed.
+// Reasoning is streamed before the content.
+type Delta struct {
+	Content   string
+	Reasoning string
+}
+
+type Usage struct {
+	InputTokens  int
+	OutputTokens int
+}
+
+type Response struct {
+	Content      string
+	FinishReason string
+	Reasoning    model.Reasoning
+	Usage        Usage
+}
+
+// StatusError is returned when a provider responds with an unsuccessful HTTP status code.
+type StatusError struct {
+	StatusCode int
+	Body       string
+	// RetryAfter is from the Retry-After response header, if any.
+	RetryAfter time.Duration
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %v: %v", e.StatusCode, e.Body)
+}
+
+// ErrorCircuitOpen is wrapped in an [UnavailableError] when a provider has failed too many times in a row.
+var ErrorCircuitOpen = errors.New("circuit open")
+
+// UnavailableError is returned when a provider can't be used right now, because it's rate limited,
+// failing, or its circuit is open. Trying again after RetryAfter may succeed.
+type UnavailableError struct {
+	Provider   model.Provider
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e UnavailableError) Error() string {
+	return fmt.Sprintf("provider %v unavailable, retry after %v: %v", e.Provider, e.RetryAfter, e.Err)
+}
+
+func (e UnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// ProviderStatus is the health of a provider, as seen by its circuit breaker.
+type ProviderStatus struct {
+	Provider  model.Provider
+	Failures  int
+	OpenUntil time.Time
+}
+
+// Healthy if the circuit isn't open.
+func (s ProviderStatus) Healthy() bool {
+	return !time.Now().Before(s.OpenUntil)
+}
+
+// completer is implemented by each supported provider API.
+type completer interface {
+	complete(ctx context.Context, req Request, onDelta func(Delta) error) (Response, error)
+}
+
+// prober is implemented by completers that can check whether the provider is reachable, without generating anything.
+type prober interface {
+	probe(ctx context.Context, m model.Model, key model.Secret) error
+}
+
+type Client struct {
+	breakers          map[model.Provider]*breaker
+	completers        map[model.Provider]completer
+	credentials       *Credentials
+	log               *slog.Logger
+	maxRetries        int
+	maxRetryWait      time.Duration
+	modelLimits       Limits
+	modelLimiters     map[model.ModelID]*limiter
+	modelLimitersLock sync.Mutex
+	providerLimiters  map[model.Provider]*limiter
+	retryBackoff      time.Duration
+}
+
+type NewClientOptions struct {
+	AnthropicKey   string
+	CircuitBreaker CircuitBreakerOptions
+	// Credentials for models that reference one by name in their config with "credential".
+	// Models without a reference use the credential named after their provider, like openai, if there is one,
+	// and otherwise the provider's key option.
+	Credentials  *Credentials
+	FireworksKey string
+	GoogleKey    string
+	HTTPClient   *http.Client
+	Log          *slog.Logger
+	// MaxRetries for requests that are rate limited or fail on the provider side, before any content is streamed.
+	MaxRetries int
+	// MaxRetryWait is the longest the client waits before retrying. If a provider asks for a longer wait,
+	// an [UnavailableError] is returned instead, so the caller can try again later.
+	MaxRetryWait time.Duration
+	// ModelLimits apply to each model separately.
+	ModelLimits    Limits
+	OpenAIKey      string
+	ProviderLimits map[model.Provider]Limits
+	// RetryBackoff is the wait before the first retry when the provider doesn't send Retry-After.
+	// It doubles for each retry. Defaults to one second.
+	RetryBackoff time.Duration
+}
+
+// NewClient with the given options.
+// If no logger is provided, logs are discarded.
+// If no HTTP client is provided, [http.DefaultClient] is used.
+// Retries are off and there are no limits, unless set in the options.
+func NewClient(opts NewClientOptions) *Client {
+	if opts.Log == nil {
+		opts.Log = slog.New(slog.DiscardHandler)
+	}
+
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+
+	if opts.RetryBackoff == 0 {
+		opts.RetryBackoff = time.Second
+	}
+
+	if opts.Credentials == nil {
+		opts.Credentials = NewCredentials("", nil)
+	}
+
+	c := &Client{
+		breakers: map[model.Provider]*breaker{},
+		completers: map[model.Provider]completer{
+			model.ProviderAnthropic: &anthropicClient{baseURL: "https://api.anthropic.com/v1", c: opts.HTTPClient, key: opts.AnthropicKey},
+			model.ProviderFake:      &fakeClient{errors: map[model.ModelID]int{}},
+			model.ProviderFireworks: &openAIClient{c: opts.HTTPClient, key: opts.FireworksKey},
+			model.ProviderGoogle:    &openAIClient{baseURL: "https://generativelanguage.googleapis.com/v1beta/openai", c: opts.HTTPClient, key: opts.GoogleKey},
+			model.ProviderLlamaCPP:  &openAIClient{c: opts.HTTPClient},
+			model.ProviderOpenAI:    &openAIResponsesClient{openAIClient{baseURL: "https://api.openai.com/v1", c: opts.HTTPClient, key: opts.OpenAIKey}},
+		},
+		credentials:      opts.Credentials,
+		log:              opts.Log,
+		maxRetries:       opts.MaxRetries,
+		maxRetryWait:     opts.MaxRetryWait,
+		modelLimits:      opts.ModelLimits,
+		modelLimiters:    map[model.ModelID]*limiter{},
+		providerLimiters: map[model.Provider]*limiter{},
+		retryBackoff:     opts.RetryBackoff,
+	}
+
+	for p := range c.completers {
+		c.breakers[p] = newBreaker(opts.CircuitBreaker)
+		c.providerLimiters[p] = newLimiter(opts.ProviderLimits[p])
+	}
+
+	return c
+}
+
+// Complete the conversation in the request, calling onDelta for each chunk of the response as it's streamed.
+// If onDelta returns an error, generation stops and the error is returned.
+// Requests wait for the provider and model [Limits]. Requests that are rate limited or fail on the provider side
+// are retried with backoff, honoring Retry-After, as long as nothing has been streamed yet.
+// If the provider is still unavailable after that, or its circuit is open, an [UnavailableError] is returned.
+func (c *Client) Complete(ctx context.Context, req Request, onDelta func(Delta) error) (Response, error) {
+	p := req.Model.Provider
+	cp, ok := c.completers[p]
+	if !ok {
+		return Response{}, errors.Newf("unsupported provider %v", p)
+	}
+
+	key, err := c.resolveKey(ctx, req.Model)
+	if err != nil {
+		return Response{}, err
+	}
+	req.key = key
+
+	b := c.breakers[p]
+
+	for attempt := 0; ; attempt++ {
+		if wait := b.allow(); wait > 0 {
+			return Response{}, UnavailableError{Provider: p, RetryAfter: wait, Err: ErrorCircuitOpen}
+		}
+
+		c.log.Debug("Completing", "provider", p, "model", req.Model.Name, "messages", len(req.Messages), "attempt", attempt)
+
+		var streamed bool
+		res, err := c.completeWithLimits(ctx, cp, req, func(d Delta) error {
+			streamed = true
+			return onDelta(d)
+		})
+		if err == nil {
+			b.success()
+			return res, nil
+		}
+
+		if ctx.Err() != nil {
+			return Response{}, err
+		}
+
+		var statusErr StatusError
+		isStatusErr := errors.As(err, &statusErr)
+		var urlErr *url.Error
+		isConnectionErr := errors.As(err, &urlErr)
+
+		// Server errors and connection errors count against the provider's health, rate limiting doesn't
+		isRateLimited := isStatusErr && statusErr.StatusCode == http.StatusTooManyRequests
+		isServerErr := (isStatusErr && statusErr.StatusCode >= http.StatusInternalServerError) || isConnectionErr
+		if isServerErr {
+			b.failure()
+		}
+
+		if streamed || (!isRateLimited && !isServerErr) {
+			return Response{}, err
+		}
+
+		wait := statusErr.RetryAfter
+		if wait == 0 {
+			wait = c.retryBackoff << attempt
+		}
+
+		if attempt >= c.maxRetries || wait > c.maxRetryWait {
+			return Response{}, UnavailableError{Provider: p, RetryAfter: wait, Err: err}
+		}
+
+		c.log.Info("Retrying after error", "provider", p, "model", req.Model.Name, "attempt", attempt, "wait", wait, "error", err)
+
+		if err := sleep(ctx, wait); err != nil {
+			return Response{}, err
+		}
+	}
+}
+
+func (c *Client) completeWithLimits(ctx context.Context, cp completer, req Request, onDelta func(Delta) error) (Response, error) {
+	releaseProvider, err := c.providerLimiters[req.Model.Provider].acquire(ctx)
+	if err != nil {
+		return Response{}, err
+	}
+	defer releaseProvider()
+
+	c.modelLimitersLock.Lock()
+	l, ok := c.modelLimiters[req.Model.ID]
+	if !ok {
+		l = newLimiter(c.modelLimits)
+		c.modelLimiters[req.Model.ID] = l
+	}
+	c.modelLimitersLock.Unlock()
+
+	releaseModel, err := l.acquire(ctx)
+	if err != nil {
+		return Response{}, err
+	}
+	defer releaseModel()
+
+	return completeWithTracing(ctx, cp, req, onDelta)
+}
+
+// Probe whether the provider of the model is reachable and accepts the credentials, by listing its models.
+// Providers that can't be probed are assumed reachable.
+func (c *Client) Probe(ctx context.Context, m model.Model) error {
+	cp, ok := c.completers[m.Provider]
+	if !ok {
+		return errors.Newf("unsupported provider %v", m.Provider)
+	}
+
+	p, ok := cp.(prober)
+	if !ok {
+		return nil
+	}
+
+	key, err := c.resolveKey(ctx, m)
+	if err != nil {
+		return err
+	}
+	return p.probe(ctx, m, key)
+}
+
+// resolveKey for the model, from the credential its config references, or the credential named after its provider.
+// An empty key means the provider's key option is used. A model config that can't be parsed is an error,
+// so a malformed credential reference never falls back to another key.
+func (c *Client) resolveKey(ctx context.Context, m model.Model) (model.Secret, error) {
+	name, err := m.Credential()
+	if err != nil {
+		return "", err
+	}
+	if name != "" {
+		key, err := c.credentials.Resolve(ctx, name)
+		if err != nil {
+			return "", errors.Wrap(err, "error resolving credential %v", name)
+		}
+		return key, nil
+	}
+
+	key, err := c.credentials.Resolve(ctx, string(m.Provider))
+	if errors.Is(err, model.ErrorCredentialNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "error resolving credential %v", m.Provider)
+	}
+	return key, nil
+}
+
+// keyOr the resolved key if there is one, or otherwise the fallback key.
+func keyOr(key model.Secret, fallback string) string {
+	if key != "" {
+		return string(key)
+	}
+	return fallback
+}
+
+// doProbe request, returning a [StatusError] if the response isn't successful.
+func doProbe(c *http.Client, req *http.Request) error {
+	res, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+		return StatusError{StatusCode: res.StatusCode, Body: string(body)}
+	}
+	return nil
+}
+
+// ProviderStatuses of all supported providers, by provider name.
+func (c *Client) ProviderStatuses() []ProviderStatus {
+	var statuses []ProviderStatus
+	for p, b := range c.breakers {
+		failures, openUntil := b.status()
+		statuses = append(statuses, ProviderStatus{Provider: p, Failures: failures, OpenUntil: openUntil})
+	}
+	slices.SortFunc(statuses, func(a, b ProviderStatus) int {
+		return strings.Compare(string(a.Provider), string(b.Provider))
+	})
+	return statuses
+}
@@ -0,0 +1,503 @@
+package llm_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"maragu.dev/errors"
+	"maragu.dev/is"
+
+	"app/llm"
+	"app/model"
+)
+
+func TestClient_Complete(t *testing.T) {
+	t.Run("should stream content from an OpenAI-compatible API", func(t *testing.T) {
+		var body map[string]any
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			is.Equal(t, "/v1/chat/completions", r.URL.Path)
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, chunk := range []string{
+				`{"choices":[{"delta":{"content":"Hel"}}]}`,
+				`{"choices":[{"delta":{"content":"lo!"},"finish_reason":"stop"}]}`,
+				`{"choices":[],"usage":{"prompt_tokens":10,"completion_tokens":2}}`,
+			} {
+				_, _ = fmt.Fprintf(w, "data: %v\n\n", chunk)
+			}
+			_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+		}))
+		defer s.Close()
+
+		c := llm.NewClient(llm.NewClientOptions{})
+
+		var deltas []string
+		res, err := c.Complete(t.Context(), llm.Request{
+			Model: model.Model{
+				Provider: model.ProviderLlamaCPP,
+				Name:     "local",
+				Config:   model.JSON(`{"address": "` + strings.TrimPrefix(s.URL, "http://") + `"}`),
+			},
+			System:   "You are a test.",
+			Messages: []llm.Message{{Role: llm.RoleUser, Content: "Hi"}},
+		}, func(d llm.Delta) error {
+			deltas = append(deltas, d.Content)
+			return nil
+		})
+		is.NotError(t, err)
+		is.Equal(t, "Hello!", res.Content)
+		is.Equal(t, "stop", res.FinishReason)
+		is.Equal(t, 10, res.Usage.InputTokens)
+		is.Equal(t, 2, res.Usage.OutputTokens)
+		is.EqualSlice(t, []string{"Hel", "lo!"}, deltas)
+
+		is.Equal(t, "local", body["model"])
+		messages := body["messages"].([]any)
+		is.Equal(t, 2, len(messages))
+		is.Equal(t, "system", messages[0].(map[string]any)["role"])
+	})
+
+	t.Run("should capture reasoning separately from the content", func(t *testing.T) {
+		s := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, chunk := range []string{
+				`{"choices":[{"delta":{"reasoning_content":"Hmm, "}}]}`,
+				`{"choices":[{"delta":{"reasoning_content":"a greeting."}}]}`,
+				`{"choices":[{"delta":{"content":"Hello!"},"finish_reason":"stop"}]}`,
+			} {
+				_, _ = fmt.Fprintf(w, "data: %v\n\n", chunk)
+			}
+			_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+		})
+
+		c := llm.NewClient(llm.NewClientOptions{})
+
+		var reasoning string
+		res, err := c.Complete(t.Context(), newRequest(s), func(d llm.Delta) error {
+			reasoning += d.Reasoning
+			return nil
+		})
+		is.NotError(t, err)
+		is.Equal(t, "Hello!", res.Content)
+		is.Equal(t, "Hmm, a greeting.", reasoning)
+		is.EqualSlice(t, model.Reasoning{{Type: model.ReasoningBlockTypeThinking, Text: "Hmm, a greeting."}}, res.Reasoning)
+	})
+
+	t.Run("should ask for structured output with the request schema", func(t *testing.T) {
+		var body map[string]any
+		s := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+		})
+
+		c := llm.NewClient(llm.NewClientOptions{})
+
+		req := newRequest(s)
+		req.Schema = []byte(`{"type":"object"}`)
+		_, err := c.Complete(t.Context(), req, func(d llm.Delta) error { return nil })
+		is.NotError(t, err)
+
+		responseFormat := body["response_format"].(map[string]any)
+		is.Equal(t, "json_schema", responseFormat["type"].(string))
+		is.Equal(t, "object", responseFormat["json_schema"].(map[string]any)["schema"].(map[string]any)["type"].(string))
+	})
+
+	t.Run("should return a StatusError on unsuccessful responses", func(t *testing.T) {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+		}))
+		defer s.Close()
+
+		c := llm.NewClient(llm.NewClientOptions{})
+
+		_, err := c.Complete(t.Context(), llm.Request{
+			Model: model.Model{
+				Provider: model.ProviderLlamaCPP,
+				Config:   model.JSON(`{"address": "` + strings.TrimPrefix(s.URL, "http://") + `"}`),
+			},
+		}, func(d llm.Delta) error { return nil })
+
+		var statusErr llm.StatusError
+		is.True(t, errors.As(err, &statusErr))
+		is.Equal(t, http.StatusServiceUnavailable, statusErr.StatusCode)
+	})
+}
+
+func TestClient_Complete_retries(t *testing.T) {
+	t.Run("should retry when rate limited, honoring Retry-After", func(t *testing.T) {
+		var requests int
+		s := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if requests == 1 {
+				http.Error(w, "slow down", http.StatusTooManyRequests)
+				return
+			}
+			_, _ = fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Hi\"}}]}\n\ndata: [DONE]\n\n")
+		})
+
+		c := llm.NewClient(llm.NewClientOptions{MaxRetries: 1, MaxRetryWait: time.Second, RetryBackoff: time.Millisecond})
+
+		res, err := c.Complete(t.Context(), newRequest(s), func(d llm.Delta) error { return nil })
+		is.NotError(t, err)
+		is.Equal(t, "Hi", res.Content)
+		is.Equal(t, 2, requests)
+	})
+
+	t.Run("should return an UnavailableError when retries are exhausted", func(t *testing.T) {
+		var requests int
+		s := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			http.Error(w, "oops", http.StatusInternalServerError)
+		})
+
+		c := llm.NewClient(llm.NewClientOptions{MaxRetries: 2, MaxRetryWait: time.Second, RetryBackoff: time.Millisecond})
+
+		_, err := c.Complete(t.Context(), newRequest(s), func(d llm.Delta) error { return nil })
+		var unavailableErr llm.UnavailableError
+		is.True(t, errors.As(err, &unavailableErr))
+		is.Equal(t, model.ProviderLlamaCPP, unavailableErr.Provider)
+		is.Equal(t, 3, requests)
+	})
+
+	t.Run("should return an UnavailableError without waiting when Retry-After is too long", func(t *testing.T) {
+		var requests int
+		s := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Header().Set("Retry-After", "120")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+		})
+
+		c := llm.NewClient(llm.NewClientOptions{MaxRetries: 3, MaxRetryWait: time.Second, RetryBackoff: time.Millisecond})
+
+		_, err := c.Complete(t.Context(), newRequest(s), func(d llm.Delta) error { return nil })
+		var unavailableErr llm.UnavailableError
+		is.True(t, errors.As(err, &unavailableErr))
+		is.Equal(t, 2*time.Minute, unavailableErr.RetryAfter)
+		is.Equal(t, 1, requests)
+	})
+
+	t.Run("should not retry client errors", func(t *testing.T) {
+		var requests int
+		s := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			http.Error(w, "bad request", http.StatusBadRequest)
+		})
+
+		c := llm.NewClient(llm.NewClientOptions{MaxRetries: 3, MaxRetryWait: time.Second, RetryBackoff: time.Millisecond})
+
+		_, err := c.Complete(t.Context(), newRequest(s), func(d llm.Delta) error { return nil })
+		var unavailableErr llm.UnavailableError
+		is.True(t, !errors.As(err, &unavailableErr))
+		is.Equal(t, 1, requests)
+	})
+
+	t.Run("should open the circuit after too many failures, and fail fast", func(t *testing.T) {
+		var requests int
+		s := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			http.Error(w, "oops", http.StatusBadGateway)
+		})
+
+		c := llm.NewClient(llm.NewClientOptions{
+			CircuitBreaker: llm.CircuitBreakerOptions{Threshold: 2, Cooldown: time.Minute},
+		})
+
+		for range 2 {
+			_, err := c.Complete(t.Context(), newRequest(s), func(d llm.Delta) error { return nil })
+			is.True(t, err != nil)
+		}
+		is.Equal(t, 2, requests)
+
+		_, err := c.Complete(t.Context(), newRequest(s), func(d llm.Delta) error { return nil })
+		is.Error(t, llm.ErrorCircuitOpen, err)
+		is.Equal(t, 2, requests)
+
+		for _, status := range c.ProviderStatuses() {
+			if status.Provider == model.ProviderLlamaCPP {
+				is.True(t, !status.Healthy())
+				is.Equal(t, 2, status.Failures)
+			} else {
+				is.True(t, status.Healthy())
+			}
+		}
+	})
+
+	t.Run("should let a single request probe the provider after the cooldown", func(t *testing.T) {
+		var requests int
+		probing := make(chan struct{})
+		done := make(chan struct{})
+		s := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if requests == 1 {
+				http.Error(w, "oops", http.StatusBadGateway)
+				return
+			}
+			if requests == 2 {
+				close(probing)
+				<-done
+			}
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Hi\"},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n")
+		})
+
+		c := llm.NewClient(llm.NewClientOptions{
+			CircuitBreaker: llm.CircuitBreakerOptions{Threshold: 1, Cooldown: 10 * time.Millisecond},
+		})
+
+		_, err := c.Complete(t.Context(), newRequest(s), func(d llm.Delta) error { return nil })
+		is.True(t, err != nil)
+		time.Sleep(20 * time.Millisecond)
+
+		probeErr := make(chan error)
+		go func() {
+			_, err := c.Complete(t.Context(), newRequest(s), func(d llm.Delta) error { return nil })
+			probeErr <- err
+		}()
+		<-probing
+
+		_, err = c.Complete(t.Context(), newRequest(s), func(d llm.Delta) error { return nil })
+		is.Error(t, llm.ErrorCircuitOpen, err)
+
+		close(done)
+		is.NotError(t, <-probeErr)
+		is.Equal(t, 2, requests)
+
+		_, err = c.Complete(t.Context(), newRequest(s), func(d llm.Delta) error { return nil })
+		is.NotError(t, err)
+	})
+}
+
+func TestClient_Complete_limits(t *testing.T) {
+	t.Run("should give back the time reserved by a request that's cancelled while waiting", func(t *testing.T) {
+		s := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Hi\"}}]}\n\ndata: [DONE]\n\n")
+		})
+
+		// One request every 200ms
+		c := llm.NewClient(llm.NewClientOptions{ProviderLimits: map[model.Provider]llm.Limits{
+			model.ProviderLlamaCPP: {RequestsPerMinute: 300},
+		}})
+
+		start := time.Now()
+		_, err := c.Complete(t.Context(), newRequest(s), func(d llm.Delta) error { return nil })
+		is.NotError(t, err)
+
+		ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+		defer cancel()
+		_, err = c.Complete(ctx, newRequest(s), func(d llm.Delta) error { return nil })
+		is.Error(t, context.DeadlineExceeded, err)
+
+		_, err = c.Complete(t.Context(), newRequest(s), func(d llm.Delta) error { return nil })
+		is.NotError(t, err)
+		is.True(t, time.Since(start) < 300*time.Millisecond)
+	})
+}
+
+func TestClient_Probe(t *testing.T) {
+	t.Run("should list the models of an OpenAI-compatible API", func(t *testing.T) {
+		s := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+			is.Equal(t, "/v1/models", r.URL.Path)
+			_, _ = fmt.Fprint(w, `{"data":[]}`)
+		})
+		c := llm.NewClient(llm.NewClientOptions{})
+
+		err := c.Probe(t.Context(), newRequest(s).Model)
+		is.NotError(t, err)
+	})
+
+	t.Run("should return a status error when the API responds with an error", func(t *testing.T) {
+		s := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		})
+		c := llm.NewClient(llm.NewClientOptions{})
+
+		err := c.Probe(t.Context(), newRequest(s).Model)
+		var statusErr llm.StatusError
+		is.True(t, errors.As(err, &statusErr))
+		is.Equal(t, http.StatusServiceUnavailable, statusErr.StatusCode)
+	})
+}
+
+func TestNewRequest(t *testing.T) {
+	t.Run("should build messages from the thread before the turn, skipping other candidates", func(t *testing.T) {
+		human := model.Turn{ID: "tu_1", SpeakerID: "sp_human", Content: "Hi"}
+		reply := model.Turn{ID: "tu_2", SpeakerID: "sp_ai", SpeakerRevisionID: "sr_ai", Content: "Hello",
+			Reasoning: model.Reasoning{{Type: model.ReasoningBlockTypeThinking, Text: "Greet back.", Signature: "sig"}}}
+		question := model.Turn{ID: "tu_3", SpeakerID: "sp_human", Content: "How are you?"}
+		otherCandidate := model.Turn{ID: "tu_4", SpeakerID: "sp_other", Candidate: true, Content: "Fine"}
+		candidate := model.Turn{ID: "tu_5", SpeakerID: "sp_ai", SpeakerRevisionID: "sr_ai", Candidate: true}
+
+		cd := model.ConversationDocument{
+			SpeakerRevisions: map[model.SpeakerRevisionID]model.SpeakerRevision{
+				"sr_ai": {System: "Be nice."},
+			},
+			Turns: []model.Turn{human, reply, question, otherCandidate, candidate},
+		}
+
+		req, err := llm.NewRequest(cd, model.Model{Name: "test"}, candidate)
+		is.NotError(t, err)
+		is.Equal(t, "Be nice.", req.System)
+		is.Equal(t, "test", req.Model.Name)
+		is.Equal(t, 3, len(req.Messages))
+		for i, m := range []llm.Message{
+			{Role: llm.RoleUser, Content: "Hi"},
+			{Role: llm.RoleAssistant, Content: "Hello"},
+			{Role: llm.RoleUser, Content: "How are you?"},
+		} {
+			is.Equal(t, m.Role, req.Messages[i].Role)
+			is.Equal(t, m.Content, req.Messages[i].Content)
+		}
+		is.EqualSlice(t, reply.Reasoning, req.Messages[1].Reasoning)
+	})
+
+	t.Run("should leave out the oldest turns that aren't pinned to fit the context window", func(t *testing.T) {
+		long := strings.Repeat("a", 400) // About 100 tokens
+		first := model.Turn{ID: "tu_1", SpeakerID: "sp_human", Content: "Remember this: " + long, Pinned: true}
+		second := model.Turn{ID: "tu_2", SpeakerID: "sp_ai", SpeakerRevisionID: "sr_ai", Content: "Old " + long}
+		third := model.Turn{ID: "tu_3", SpeakerID: "sp_human", Content: "Older " + long}
+		fourth := model.Turn{ID: "tu_4", SpeakerID: "sp_ai", SpeakerRevisionID: "sr_ai", Content: "Recent"}
+		fifth := model.Turn{ID: "tu_5", SpeakerID: "sp_human", Content: "Latest " + long}
+		turn := model.Turn{ID: "tu_6", SpeakerID: "sp_ai", SpeakerRevisionID: "sr_ai"}
+
+		cd := model.ConversationDocument{
+			SpeakerRevisions: map[model.SpeakerRevisionID]model.SpeakerRevision{"sr_ai": {}},
+			Turns:            []model.Turn{first, second, third, fourth, fifth, turn},
+		}
+
+		req, err := llm.NewRequest(cd, model.Model{Name: "test", Config: `{"contextWindow": 250}`}, turn)
+		is.NotError(t, err)
+		is.Equal(t, 3, len(req.Messages))
+		is.Equal(t, first.Content, req.Messages[0].Content)
+		is.Equal(t, "Recent", req.Messages[1].Content)
+		is.Equal(t, fifth.Content, req.Messages[2].Content)
+
+		// Without a context window, nothing is left out
+		req, err = llm.NewRequest(cd, model.Model{Name: "test"}, turn)
+		is.NotError(t, err)
+		is.Equal(t, 5, len(req.Messages))
+
+		// Pinned and latest turns are kept even if they don't fit
+		req, err = llm.NewRequest(cd, model.Model{Name: "test", Config: `{"contextWindow": 10}`}, turn)
+		is.NotError(t, err)
+		is.Equal(t, 2, len(req.Messages))
+		is.Equal(t, first.Content, req.Messages[0].Content)
+		is.Equal(t, fifth.Content, req.Messages[1].Content)
+	})
+
+	t.Run("should not start a trimmed thread with an assistant message that isn't pinned", func(t *testing.T) {
+		long := strings.Repeat("a", 400) // About 100 tokens
+		first := model.Turn{ID: "tu_1", SpeakerID: "sp_human", Content: "Old " + long}
+		second := model.Turn{ID: "tu_2", SpeakerID: "sp_ai", SpeakerRevisionID: "sr_ai", Content: "Reply " + long}
+		third := model.Turn{ID: "tu_3", SpeakerID: "sp_human", Content: "Latest"}
+		turn := model.Turn{ID: "tu_4", SpeakerID: "sp_ai", SpeakerRevisionID: "sr_ai"}
+
+		cd := model.ConversationDocument{
+			SpeakerRevisions: map[model.SpeakerRevisionID]model.SpeakerRevision{"sr_ai": {}},
+			Turns:            []model.Turn{first, second, third, turn},
+		}
+
+		req, err := llm.NewRequest(cd, model.Model{Name: "test", Config: `{"contextWindow": 150}`}, turn)
+		is.NotError(t, err)
+		is.Equal(t, 1, len(req.Messages))
+		is.Equal(t, llm.RoleUser, req.Messages[0].Role)
+		is.Equal(t, "Latest", req.Messages[0].Content)
+
+		// A pinned assistant message is kept at the start
+		second.Pinned = true
+		cd.Turns = []model.Turn{first, second, third, turn}
+		req, err = llm.NewRequest(cd, model.Model{Name: "test", Config: `{"contextWindow": 150}`}, turn)
+		is.NotError(t, err)
+		is.Equal(t, 2, len(req.Messages))
+		is.Equal(t, llm.RoleAssistant, req.Messages[0].Role)
+	})
+
+	t.Run("should add the conversation system context to the speaker system prompt", func(t *testing.T) {
+		turn := model.Turn{ID: "tu_1", SpeakerID: "sp_ai", SpeakerRevisionID: "sr_ai"}
+
+		cd := model.ConversationDocument{
+			Conversation: model.Conversation{System: "We're planning a garden."},
+			SpeakerRevisions: map[model.SpeakerRevisionID]model.SpeakerRevision{
+				"sr_ai": {System: "Be nice."},
+			},
+			Turns: []model.Turn{turn},
+		}
+
+		req, err := llm.NewRequest(cd, model.Model{Name: "test"}, turn)
+		is.NotError(t, err)
+		is.Equal(t, "Be nice.\n\nWe're planning a garden.", req.System)
+
+		cd.SpeakerRevisions["sr_ai"] = model.SpeakerRevision{}
+		req, err = llm.NewRequest(cd, model.Model{Name: "test"}, turn)
+		is.NotError(t, err)
+		is.Equal(t, "We're planning a garden.", req.System)
+	})
+
+	t.Run("should render the speaker system prompt as a template", func(t *testing.T) {
+		modelID := model.ModelID("m_1")
+		human := model.Turn{ID: "tu_1", SpeakerID: "sp_human", Content: "Hi"}
+		other := model.Turn{ID: "tu_2", SpeakerID: "sp_other", ModelID: &modelID, Content: "Hello"}
+		turn := model.Turn{ID: "tu_3", SpeakerID: "sp_ai", SpeakerRevisionID: "sr_ai",
+			Created: model.Time{T: time.Date(2025, 9, 22, 12, 0, 0, 0, time.UTC)}}
+
+		cd := model.ConversationDocument{
+			Conversation: model.Conversation{Topic: "Gardening", Variables: model.Variables{"plant": "tomatoes"}},
+			Speakers: map[model.SpeakerID]model.Speaker{
+				"sp_human": {Name: "Sam"},
+				"sp_other": {Name: "Bot"},
+				"sp_ai":    {Name: "Ada"},
+			},
+			SpeakerRevisions: map[model.SpeakerRevisionID]model.SpeakerRevision{
+				"sr_ai": {System: `{{.Speaker}} talks to {{.User}} about {{.Topic}} and {{.Vars.plant}}{{.Vars.missing}} ` +
+					`on {{.Date}}, a {{.Now.Format "Monday"}}, with {{join .Participants ", "}}.`},
+			},
+			Turns: []model.Turn{human, other, turn},
+		}
+
+		req, err := llm.NewRequest(cd, model.Model{Name: "test"}, turn)
+		is.NotError(t, err)
+		is.Equal(t, "Ada talks to Sam about Gardening and tomatoes on 2025-09-22, a Monday, with Sam, Bot.", req.System)
+	})
+
+	t.Run("should error on an invalid template", func(t *testing.T) {
+		turn := model.Turn{ID: "tu_1", SpeakerID: "sp_ai", SpeakerRevisionID: "sr_ai"}
+
+		cd := model.ConversationDocument{
+			SpeakerRevisions: map[model.SpeakerRevisionID]model.SpeakerRevision{
+				"sr_ai": {System: "Hi {{.Nope}}"},
+			},
+			Turns: []model.Turn{turn},
+		}
+
+		_, err := llm.NewRequest(cd, model.Model{Name: "test"}, turn)
+		is.True(t, err != nil)
+	})
+}
+
+func newServer(t *testing.T, h http.HandlerFunc) *httptest.Server {
+	t.Helper()
+
+	s := httptest.NewServer(h)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func newRequest(s *httptest.Server) llm.Request {
+	return llm.Request{
+		Model: model.Model{
+			Provider: model.ProviderLlamaCPP,
+			Config:   model.JSON(`{"address": "` + strings.TrimPrefix(s.URL, "http://") + `"}`),
+		},
+	}
+}
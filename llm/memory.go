@@ -0,0 +1,158 @@
+package llm
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"app/model"
+)
+
+// memorySchema is the schema of the reply to a [NewMemoryRequest], which is a list of facts.
+const memorySchema = `{"type": "array", "items": {"type": "string", "minLength": 1}, "maxItems": 20}`
+
+// NewMemoryRequest to extract memories from the conversation document for the speaker with the given ID, with model m.
+// The turns of the document are sent as one transcript, together with the speaker's existing memories,
+// so only new memories are extracted. The reply is parsed with [ParseMemories].
+func NewMemoryRequest(cd model.ConversationDocument, m model.Model, id model.SpeakerID, memories []model.Memory) Request {
+	name := cd.Speakers[id].Name
+
+	system := fmt.Sprintf("You are the long-term memory of %v. Below are the new turns of a conversation that %v took part in. "+
+		"Extract facts that %v should remember in later conversations, such as facts about the other speakers, their preferences, and what was agreed. "+
+		"Leave out what only matters in this conversation, and what's already remembered. "+
+		"Write each fact as a short sentence that makes sense on its own. "+
+		"Reply with only a JSON array of strings, or [] if there's nothing new to remember.", name, name, name)
+
+	var b strings.Builder
+	if len(memories) > 0 {
+		b.WriteString("Already remembered:\n")
+		for _, m := range memories {
+			b.WriteString("- " + m.Content + "\n")
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("Conversation:\n")
+	for _, t := range cd.Turns {
+		if t.Candidate || t.Content == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "%v: %v\n", cd.Speakers[t.SpeakerID].Name, t.Content)
+	}
+
+	return Request{
+		Model:    m,
+		System:   system,
+		Messages: []Message{{Role: RoleUser, Content: b.String()}},
+		Schema:   json.RawMessage(memorySchema),
+	}
+}
+
+// ParseMemories in the content of the reply to a [NewMemoryRequest].
+func ParseMemories(content string) ([]string, error) {
+	output, err := ParseOutput(content, []byte(memorySchema))
+	if err != nil {
+		return nil, err
+	}
+
+	var memories []string
+	if err := json.Unmarshal(output, &memories); err != nil {
+		return nil, err
+	}
+
+	var trimmed []string
+	for _, m := range memories {
+		if m = strings.TrimSpace(m); m != "" {
+			trimmed = append(trimmed, m)
+		}
+	}
+	return trimmed, nil
+}
+
+// relevanceTurns is how many turns before the turn being generated that memories are matched against.
+const relevanceTurns = 3
+
+// RelevantMemories for generating turn t in the conversation document, at most limit of them.
+// Memories are ranked by how many words they share with the last few turns in the thread before t,
+// and then by how recent they are, so the newest memories fill up the rest when few are relevant.
+func RelevantMemories(memories []model.Memory, cd model.ConversationDocument, t model.Turn, limit int) []model.Memory {
+	var recent []string
+	for _, other := range cd.Turns {
+		if other.ID == t.ID {
+			break
+		}
+		if other.Candidate {
+			continue
+		}
+		recent = append(recent, other.Content)
+	}
+	query := words(strings.Join(recent[max(0, len(recent)-relevanceTurns):], " "))
+
+	type scored struct {
+		memory model.Memory
+		score  int
+	}
+	var ms []scored
+	for _, m := range memories {
+		var score int
+		for w := range words(m.Content) {
+			if query[w] {
+				score++
+			}
+		}
+		ms = append(ms, scored{memory: m, score: score})
+	}
+
+	slices.SortStableFunc(ms, func(a, b scored) int {
+		if c := cmp.Compare(b.score, a.score); c != 0 {
+			return c
+		}
+		return b.memory.Created.T.Compare(a.memory.Created.T)
+	})
+
+	var relevant []model.Memory
+	for _, m := range ms[:min(limit, len(ms))] {
+		relevant = append(relevant, m.memory)
+	}
+	return relevant
+}
+
+// stopWords are too common to tell whether a memory is relevant.
+var stopWords = map[string]bool{
+	"about": true, "all": true, "and": true, "are": true, "but": true, "can": true, "for": true, "from": true,
+	"has": true, "have": true, "how": true, "not": true, "that": true, "the": true, "their": true, "there": true,
+	"they": true, "this": true, "was": true, "what": true, "when": true, "who": true, "will": true, "with": true,
+	"would": true, "you": true, "your": true,
+}
+
+// words in s, lowercased, without stop words and words shorter than three letters.
+func words(s string) map[string]bool {
+	ws := map[string]bool{}
+	for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(w)) >= 3 && !stopWords[w] {
+			ws[w] = true
+		}
+	}
+	return ws
+}
+
+// WithMemories added to the system prompt of the request.
+func WithMemories(req Request, memories []model.Memory) Request {
+	if len(memories) == 0 {
+		return req
+	}
+
+	var b strings.Builder
+	b.WriteString("You remember this from earlier conversations:")
+	for _, m := range memories {
+		b.WriteString("\n- " + m.Content)
+	}
+
+	req.System = strings.TrimSpace(req.System + "\n\n" + b.String())
+	return req
+}
@@ -0,0 +1,55 @@
+package llm_test
+
+import (
+	"testing"
+	"time"
+
+	"maragu.dev/is"
+
+	"app/llm"
+	"app/model"
+)
+
+func TestRelevantMemories(t *testing.T) {
+	t.Run("should rank memories by words shared with the latest turns, and then by recency", func(t *testing.T) {
+		now := time.Now()
+		garden := model.Memory{ID: "me_1", Content: "The user is planting tomatoes in the garden.", Created: model.Time{T: now.Add(-3 * time.Hour)}}
+		name := model.Memory{ID: "me_2", Content: "The user's name is Polly.", Created: model.Time{T: now.Add(-2 * time.Hour)}}
+		recent := model.Memory{ID: "me_3", Content: "The user has a cat.", Created: model.Time{T: now.Add(-time.Hour)}}
+
+		turn := model.Turn{ID: "tu_3"}
+		cd := model.ConversationDocument{
+			Turns: []model.Turn{
+				{ID: "tu_1", Content: "Hi!"},
+				{ID: "tu_2", Content: "How are my tomatoes doing?"},
+				turn,
+			},
+		}
+
+		memories := llm.RelevantMemories([]model.Memory{garden, name, recent}, cd, turn, 2)
+		is.Equal(t, 2, len(memories))
+		is.Equal(t, garden.ID, memories[0].ID)
+		is.Equal(t, recent.ID, memories[1].ID)
+	})
+}
+
+func TestWithMemories(t *testing.T) {
+	t.Run("should add memories to the system prompt", func(t *testing.T) {
+		req := llm.WithMemories(llm.Request{System: "Be nice."}, []model.Memory{{Content: "The user's name is Polly."}})
+		is.Equal(t, "Be nice.\n\nYou remember this from earlier conversations:\n- The user's name is Polly.", req.System)
+
+		req = llm.WithMemories(llm.Request{System: "Be nice."}, nil)
+		is.Equal(t, "Be nice.", req.System)
+	})
+}
+
+func TestParseMemories(t *testing.T) {
+	t.Run("should parse a JSON array of memories", func(t *testing.T) {
+		memories, err := llm.ParseMemories("```json\n[\"Likes crackers.\", \" \"]\n```")
+		is.NotError(t, err)
+		is.EqualSlice(t, []string{"Likes crackers."}, memories)
+
+		_, err = llm.ParseMemories("Nothing to remember.")
+		is.True(t, err != nil)
+	})
+}
@@ -0,0 +1,257 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"maragu.dev/errors"
+
+	"app/model"
+)
+
+// openAIClient talks to the OpenAI chat completions API, which most providers have a compatible endpoint for.
+type openAIClient struct {
+	// baseURL for the API. If empty, [model.Model.URL] is used.
+	baseURL string
+	c       *http.Client
+	key     string
+}
+
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIRequest struct {
+	Model           string          `json:"model"`
+	Messages        []openAIMessage `json:"messages"`
+	ReasoningEffort string          `json:"reasoning_effort,omitempty"`
+	Stream          bool            `json:"stream"`
+	StreamOptions   map[string]any  `json:"stream_options,omitempty"`
+	// ExtraBody is for provider-specific options, such as Gemini's thinking config.
+	ExtraBody      map[string]any `json:"extra_body,omitempty"`
+	ResponseFormat map[string]any `json:"response_format,omitempty"`
+}
+
+type openAIChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+			// Reasoning is sent as reasoning_content by llama.cpp and others, and as reasoning by some providers
+			Reasoning        string `json:"reasoning"`
+			ReasoningContent string `json:"reasoning_content"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+func (c *openAIClient) complete(ctx context.Context, req Request, onDelta func(Delta) error) (Response, error) {
+	baseURL := c.baseURL
+	if baseURL == "" {
+		var err error
+		if baseURL, err = req.Model.URL(); err != nil {
+			return Response{}, err
+		}
+	}
+
+	body := openAIRequest{
+		Model:         req.Model.Name,
+		Stream:        true,
+		StreamOptions: map[string]any{"include_usage": true},
+	}
+
+	// The Gemini API names models with a prefix that the OpenAI-compatible endpoint doesn't want
+	if req.Model.Provider == model.ProviderGoogle {
+		body.Model = strings.TrimPrefix(body.Model, "models/")
+	}
+
+	var config struct {
+		Reasoning struct {
+			Effort string `json:"effort"`
+		} `json:"reasoning"`
+		Thinking struct {
+			IncludeThoughts bool `json:"includeThoughts"`
+		} `json:"thinking"`
+	}
+	if req.Model.Config != "" {
+		if err := json.Unmarshal([]byte(req.Model.Config), &config); err != nil {
+			return Response{}, errors.Wrap(err, "error unmarshalling model config")
+		}
+	}
+	body.ReasoningEffort = config.Reasoning.Effort
+
+	// Gemini only sends thoughts when asked to, and then inside the content, between thought tags
+	if req.Model.Provider == model.ProviderGoogle && config.Thinking.IncludeThoughts {
+		body.ExtraBody = map[string]any{"google": map[string]any{"thinking_config": map[string]any{"include_thoughts": true}}}
+	}
+
+	if len(req.Schema) > 0 {
+		body.ResponseFormat = map[string]any{
+			"type":        "json_schema",
+			"json_schema": map[string]any{"name": "output", "schema": req.Schema},
+		}
+	}
+
+	if req.System != "" {
+		body.Messages = append(body.Messages, openAIMessage{Role: "system", Content: req.System})
+	}
+	for _, m := range req.Messages {
+		body.Messages = append(body.Messages, openAIMessage{Role: string(m.Role), Content: m.Content})
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return Response{}, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/chat/completions", bytes.NewReader(b))
+	if err != nil {
+		return Response{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if key := keyOr(req.key, c.key); key != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+key)
+	}
+
+	res, err := c.c.Do(httpReq)
+	if err != nil {
+		return Response{}, err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		resBody, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+		return Response{}, StatusError{
+			StatusCode: res.StatusCode,
+			Body:       string(resBody),
+			RetryAfter: parseRetryAfter(res.Header.Get("Retry-After")),
+		}
+	}
+
+	var r Response
+	var content, reasoning strings.Builder
+	var inThought bool
+
+	// The response is a stream of server-sent events, each with a JSON chunk, ending with [DONE]
+	scanner := bufio.NewScanner(res.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk openAIChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return Response{}, errors.Wrap(err, "error unmarshalling chunk")
+		}
+
+		if chunk.Usage != nil {
+			r.Usage = Usage{InputTokens: chunk.Usage.PromptTokens, OutputTokens: chunk.Usage.CompletionTokens}
+		}
+
+		for _, choice := range chunk.Choices {
+			if choice.FinishReason != "" {
+				r.FinishReason = choice.FinishReason
+			}
+
+			d := Delta{Content: choice.Delta.Content, Reasoning: choice.Delta.ReasoningContent + choice.Delta.Reasoning}
+			if req.Model.Provider == model.ProviderGoogle {
+				d.Content, d.Reasoning, inThought = splitThoughts(d.Content, d.Reasoning, inThought)
+			}
+			if d.Content == "" && d.Reasoning == "" {
+				continue
+			}
+			content.WriteString(d.Content)
+			reasoning.WriteString(d.Reasoning)
+			if err := onDelta(d); err != nil {
+				return Response{}, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Response{}, errors.Wrap(err, "error reading stream")
+	}
+
+	r.Content = content.String()
+	if reasoning.Len() > 0 {
+		r.Reasoning = model.Reasoning{{Type: model.ReasoningBlockTypeThinking, Text: reasoning.String()}}
+	}
+
+	return r, nil
+}
+
+// splitThoughts between <thought> and </thought> tags out of the content, and add them to the reasoning.
+// inThought is whether the previous content ended inside a thought, and the returned inThought
+// is whether this content does.
+func splitThoughts(content, reasoning string, inThought bool) (string, string, bool) {
+	var c strings.Builder
+	for content != "" {
+		tag := "<thought>"
+		if inThought {
+			tag = "</thought>"
+		}
+
+		before, after, found := strings.Cut(content, tag)
+		if inThought {
+			reasoning += before
+		} else {
+			c.WriteString(before)
+		}
+		if !found {
+			break
+		}
+		content = after
+		inThought = !inThought
+	}
+	return c.String(), reasoning, inThought
+}
+
+// parseRetryAfter header value, which is either a number of seconds or an HTTP date.
+// Returns zero if the value is empty or invalid.
+func parseRetryAfter(v string) time.Duration {
+	if seconds, err := strconv.Atoi(v); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(0, time.Until(t))
+	}
+	return 0
+}
+
+func (c *openAIClient) probe(ctx context.Context, m model.Model, key model.Secret) error {
+	baseURL := c.baseURL
+	if baseURL == "" {
+		var err error
+		if baseURL, err = m.URL(); err != nil {
+			return err
+		}
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/models", nil)
+	if err != nil {
+		return err
+	}
+	if key := keyOr(key, c.key); key != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+key)
+	}
+
+	return doProbe(c.c, httpReq)
+}
@@ -0,0 +1,144 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"maragu.dev/errors"
+
+	"app/model"
+)
+
+// NewRequest to generate the content of turn t in the conversation document, with model m.
+// The system prompt comes from the speaker revision the turn references, rendered with [RenderSystem] and [NewPromptData],
+// followed by the conversation's system context.
+// The messages are the conversation thread up to t, where turns by t's speaker are from the assistant,
+// and turns by everyone else are from the user. Candidate turns other than t are not part of the thread.
+// If the model config has a contextWindow in tokens, the oldest turns are left out until the prompt fits, see [trimMessages].
+// Pinned turns are always kept.
+// The reasoning of t's speaker is included, so it can be sent back to providers that require it.
+// If the speaker revision config has an outputSchema, it's the schema of the request.
+func NewRequest(cd model.ConversationDocument, m model.Model, t model.Turn) (Request, error) {
+	sr := cd.SpeakerRevisions[t.SpeakerRevisionID]
+
+	system, err := RenderSystem(sr.System, NewPromptData(cd, t))
+	if err != nil {
+		return Request{}, errors.Wrap(err, "error rendering system prompt")
+	}
+
+	req := Request{
+		Model:  m,
+		System: strings.TrimSpace(system + "\n\n" + cd.Conversation.System),
+	}
+
+	var config struct {
+		OutputSchema json.RawMessage `json:"outputSchema"`
+	}
+	if sr.Config != "" {
+		// The config is validated as JSON by the database
+		_ = json.Unmarshal([]byte(sr.Config), &config)
+	}
+	req.Schema = config.OutputSchema
+
+	var pinned []bool
+	for _, other := range cd.Turns {
+		if other.ID == t.ID {
+			break
+		}
+
+		if other.Candidate {
+			continue
+		}
+
+		pinned = append(pinned, other.Pinned)
+
+		if other.SpeakerID == t.SpeakerID {
+			req.Messages = append(req.Messages, Message{Role: RoleAssistant, Content: other.Content, Reasoning: other.Reasoning})
+			continue
+		}
+
+		req.Messages = append(req.Messages, Message{Role: RoleUser, Content: other.Content})
+	}
+
+	var modelConfig struct {
+		ContextWindow int `json:"contextWindow"`
+	}
+	if m.Config != "" {
+		_ = json.Unmarshal([]byte(m.Config), &modelConfig)
+	}
+	if modelConfig.ContextWindow > 0 {
+		req.Messages = trimMessages(req.Messages, pinned, modelConfig.ContextWindow-estimateTokens(req.System))
+	}
+
+	return req, nil
+}
+
+// trimMessages by leaving out the oldest messages that aren't pinned, until the rest fit in the given number of tokens.
+// The last message is always kept, since it's what's being replied to, as are pinned messages,
+// so the result can be larger than the limit.
+// If anything is left out, assistant messages that aren't pinned are left out from the start as well,
+// since some providers require the thread to start with a user message.
+func trimMessages(messages []Message, pinned []bool, limit int) []Message {
+	total := 0
+	for _, m := range messages {
+		total += estimateMessageTokens(m)
+	}
+
+	keep := make([]bool, len(messages))
+	var trimmed bool
+	for i, m := range messages {
+		keep[i] = true
+		if total <= limit || pinned[i] || i == len(messages)-1 {
+			continue
+		}
+		keep[i] = false
+		trimmed = true
+		total -= estimateMessageTokens(m)
+	}
+
+	for i, m := range messages {
+		if !trimmed || i == len(messages)-1 {
+			break
+		}
+		if !keep[i] {
+			continue
+		}
+		if m.Role != RoleAssistant || pinned[i] {
+			break
+		}
+		keep[i] = false
+	}
+
+	var kept []Message
+	for i, m := range messages {
+		if keep[i] {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
+
+// estimateMessageTokens of the message content and reasoning, see [estimateTokens].
+func estimateMessageTokens(m Message) int {
+	tokens := estimateTokens(m.Content)
+	for _, b := range m.Reasoning {
+		tokens += estimateTokens(b.Text)
+	}
+	return tokens
+}
+
+// estimateTokens in s, at about four characters per token, which is close enough for English and most tokenizers.
+func estimateTokens(s string) int {
+	return (utf8.RuneCountInString(s) + 3) / 4
+}
+
+// NewRepairRequest from the request, asking the model to try again because its content didn't match the schema.
+func NewRepairRequest(req Request, content string, err error) Request {
+	req.Messages = append(req.Messages[:len(req.Messages):len(req.Messages)],
+		Message{Role: RoleAssistant, Content: content},
+		Message{Role: RoleUser, Content: fmt.Sprintf("Your reply doesn't match the JSON Schema: %v. Reply again with only the corrected JSON.", err)},
+	)
+	return req
+}
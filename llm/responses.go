@@ -0,0 +1,203 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"maragu.dev/errors"
+
+	"app/model"
+)
+
+// openAIResponsesClient talks to the OpenAI responses API, which is needed instead of chat completions
+// to get summaries of the reasoning of reasoning models. Probing is the same as for chat completions.
+type openAIResponsesClient struct {
+	openAIClient
+}
+
+type openAIResponsesMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIResponsesReasoning struct {
+	Effort  string `json:"effort,omitempty"`
+	Summary string `json:"summary,omitempty"`
+}
+
+type openAIResponsesRequest struct {
+	Model        string                    `json:"model"`
+	Instructions string                    `json:"instructions,omitempty"`
+	Input        []openAIResponsesMessage  `json:"input"`
+	Reasoning    *openAIResponsesReasoning `json:"reasoning,omitempty"`
+	Store        bool                      `json:"store"`
+	Stream       bool                      `json:"stream"`
+	Text         map[string]any            `json:"text,omitempty"`
+}
+
+type openAIResponsesEvent struct {
+	Type         string `json:"type"`
+	Delta        string `json:"delta"`
+	SummaryIndex int    `json:"summary_index"`
+	Item         struct {
+		Type    string `json:"type"`
+		Summary []struct {
+			Text string `json:"text"`
+		} `json:"summary"`
+	} `json:"item"`
+	Response struct {
+		Status            string `json:"status"`
+		IncompleteDetails struct {
+			Reason string `json:"reason"`
+		} `json:"incomplete_details"`
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+		Usage struct {
+			InputTokens  int `json:"input_tokens"`
+			OutputTokens int `json:"output_tokens"`
+		} `json:"usage"`
+	} `json:"response"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (c *openAIResponsesClient) complete(ctx context.Context, req Request, onDelta func(Delta) error) (Response, error) {
+	// Reasoning is only requested when the model config sets it, since models that don't reason reject it.
+	// The summary defaults to auto, and can be set to concise or detailed.
+	var config struct {
+		Reasoning *openAIResponsesReasoning `json:"reasoning"`
+	}
+	if req.Model.Config != "" {
+		if err := json.Unmarshal([]byte(req.Model.Config), &config); err != nil {
+			return Response{}, errors.Wrap(err, "error unmarshalling model config")
+		}
+	}
+	if config.Reasoning != nil && config.Reasoning.Summary == "" {
+		config.Reasoning.Summary = "auto"
+	}
+
+	body := openAIResponsesRequest{
+		Model:        req.Model.Name,
+		Instructions: req.System,
+		Reasoning:    config.Reasoning,
+		Stream:       true,
+	}
+
+	if len(req.Schema) > 0 {
+		body.Text = map[string]any{
+			"format": map[string]any{"type": "json_schema", "name": "output", "schema": req.Schema},
+		}
+	}
+
+	// Reasoning from earlier turns isn't sent back, since the API only needs it within a turn
+	for _, m := range req.Messages {
+		body.Input = append(body.Input, openAIResponsesMessage{Role: string(m.Role), Content: m.Content})
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return Response{}, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/responses", bytes.NewReader(b))
+	if err != nil {
+		return Response{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if key := keyOr(req.key, c.key); key != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+key)
+	}
+
+	res, err := c.c.Do(httpReq)
+	if err != nil {
+		return Response{}, err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		resBody, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+		return Response{}, StatusError{
+			StatusCode: res.StatusCode,
+			Body:       string(resBody),
+			RetryAfter: parseRetryAfter(res.Header.Get("Retry-After")),
+		}
+	}
+
+	var r Response
+	var content strings.Builder
+
+	// The response is a stream of server-sent events, with output items such as reasoning and messages
+	scanner := bufio.NewScanner(res.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+
+		var event openAIResponsesEvent
+		if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &event); err != nil {
+			return Response{}, errors.Wrap(err, "error unmarshalling event")
+		}
+
+		var d Delta
+		switch event.Type {
+		case "response.output_text.delta":
+			d.Content = event.Delta
+			content.WriteString(d.Content)
+
+		case "response.reasoning_summary_part.added":
+			// Separate the summary parts while they're streamed, like they're shown when done
+			if event.SummaryIndex > 0 {
+				d.Reasoning = "\n\n"
+			}
+
+		case "response.reasoning_summary_text.delta":
+			d.Reasoning = event.Delta
+
+		case "response.output_item.done":
+			if event.Item.Type == "reasoning" {
+				for _, s := range event.Item.Summary {
+					r.Reasoning = append(r.Reasoning, model.ReasoningBlock{Type: model.ReasoningBlockTypeSummary, Text: s.Text})
+				}
+			}
+
+		case "response.completed", "response.incomplete":
+			r.FinishReason = event.Response.Status
+			if event.Response.IncompleteDetails.Reason != "" {
+				r.FinishReason = event.Response.IncompleteDetails.Reason
+			}
+			r.Usage = Usage{InputTokens: event.Response.Usage.InputTokens, OutputTokens: event.Response.Usage.OutputTokens}
+
+		case "response.failed":
+			// Errors after the response has started, such as when the server has a problem
+			return Response{}, StatusError{StatusCode: http.StatusInternalServerError, Body: event.Response.Error.Message}
+
+		case "error":
+			return Response{}, StatusError{StatusCode: http.StatusInternalServerError, Body: event.Message}
+		}
+
+		if d.Content == "" && d.Reasoning == "" {
+			continue
+		}
+		if err := onDelta(d); err != nil {
+			return Response{}, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Response{}, errors.Wrap(err, "error reading stream")
+	}
+
+	r.Content = content.String()
+
+	return r, nil
+}
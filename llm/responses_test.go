@@ -0,0 +1,129 @@
+package llm_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"maragu.dev/is"
+
+	"app/llm"
+	"app/model"
+)
+
+func TestClient_Complete_openAIResponses(t *testing.T) {
+	t.Run("should stream reasoning summaries and content from the OpenAI responses API", func(t *testing.T) {
+		var body map[string]any
+		s := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+			is.Equal(t, "/v1/responses", r.URL.Path)
+			is.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, event := range []string{
+				`{"type":"response.created","response":{"status":"in_progress"}}`,
+				`{"type":"response.output_item.added","item":{"type":"reasoning","summary":[]}}`,
+				`{"type":"response.reasoning_summary_part.added","summary_index":0}`,
+				`{"type":"response.reasoning_summary_text.delta","summary_index":0,"delta":"**Greeting** "}`,
+				`{"type":"response.reasoning_summary_text.delta","summary_index":0,"delta":"back."}`,
+				`{"type":"response.reasoning_summary_part.added","summary_index":1}`,
+				`{"type":"response.reasoning_summary_text.delta","summary_index":1,"delta":"Be nice."}`,
+				`{"type":"response.output_item.done","item":{"type":"reasoning","summary":[{"type":"summary_text","text":"**Greeting** back."},{"type":"summary_text","text":"Be nice."}]}}`,
+				`{"type":"response.output_item.added","item":{"type":"message"}}`,
+				`{"type":"response.output_text.delta","delta":"Hello"}`,
+				`{"type":"response.output_text.delta","delta":"!"}`,
+				`{"type":"response.output_item.done","item":{"type":"message"}}`,
+				`{"type":"response.completed","response":{"status":"completed","usage":{"input_tokens":10,"output_tokens":5}}}`,
+			} {
+				var e struct{ Type string }
+				_ = json.Unmarshal([]byte(event), &e)
+				_, _ = fmt.Fprintf(w, "event: %v\ndata: %v\n\n", e.Type, event)
+			}
+		})
+
+		// Send requests for the OpenAI API to the test server instead
+		u, err := url.Parse(s.URL)
+		is.NotError(t, err)
+		c := llm.NewClient(llm.NewClientOptions{
+			OpenAIKey: "secret",
+			HTTPClient: &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				r.URL.Scheme = u.Scheme
+				r.URL.Host = u.Host
+				return http.DefaultTransport.RoundTrip(r)
+			})},
+		})
+
+		var deltas []llm.Delta
+		res, err := c.Complete(t.Context(), llm.Request{
+			Model:  model.Model{Provider: model.ProviderOpenAI, Name: "gpt-5", Config: `{"reasoning":{"effort":"high"}}`},
+			System: "Be nice.",
+			Messages: []llm.Message{
+				{Role: llm.RoleUser, Content: "Hi"},
+				{Role: llm.RoleAssistant, Content: "Hello", Reasoning: model.Reasoning{{Type: model.ReasoningBlockTypeSummary, Text: "Greet."}}},
+				{Role: llm.RoleUser, Content: "Hi again"},
+			},
+		}, func(d llm.Delta) error {
+			deltas = append(deltas, d)
+			return nil
+		})
+		is.NotError(t, err)
+		is.Equal(t, "Hello!", res.Content)
+		is.Equal(t, "completed", res.FinishReason)
+		is.Equal(t, 10, res.Usage.InputTokens)
+		is.Equal(t, 5, res.Usage.OutputTokens)
+		is.EqualSlice(t, model.Reasoning{
+			{Type: model.ReasoningBlockTypeSummary, Text: "**Greeting** back."},
+			{Type: model.ReasoningBlockTypeSummary, Text: "Be nice."},
+		}, res.Reasoning)
+		is.EqualSlice(t, []llm.Delta{
+			{Reasoning: "**Greeting** "}, {Reasoning: "back."}, {Reasoning: "\n\n"}, {Reasoning: "Be nice."},
+			{Content: "Hello"}, {Content: "!"},
+		}, deltas)
+
+		is.Equal(t, "gpt-5", body["model"])
+		is.Equal(t, "Be nice.", body["instructions"])
+		is.Equal(t, false, body["store"])
+		reasoning := body["reasoning"].(map[string]any)
+		is.Equal(t, "high", reasoning["effort"])
+		is.Equal(t, "auto", reasoning["summary"])
+		input := body["input"].([]any)
+		is.Equal(t, 3, len(input))
+		is.Equal(t, "assistant", input[1].(map[string]any)["role"])
+		is.Equal(t, "Hello", input[1].(map[string]any)["content"])
+	})
+
+	t.Run("should not ask for reasoning when the model config doesn't", func(t *testing.T) {
+		var body map[string]any
+		s := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = fmt.Fprint(w, "data: {\"type\":\"response.output_text.delta\",\"delta\":\"Hi\"}\n\n")
+			_, _ = fmt.Fprint(w, "data: {\"type\":\"response.completed\",\"response\":{\"status\":\"completed\"}}\n\n")
+		})
+
+		u, err := url.Parse(s.URL)
+		is.NotError(t, err)
+		c := llm.NewClient(llm.NewClientOptions{
+			HTTPClient: &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				r.URL.Scheme = u.Scheme
+				r.URL.Host = u.Host
+				return http.DefaultTransport.RoundTrip(r)
+			})},
+		})
+
+		res, err := c.Complete(t.Context(), llm.Request{
+			Model:    model.Model{Provider: model.ProviderOpenAI, Name: "gpt-4.1"},
+			Messages: []llm.Message{{Role: llm.RoleUser, Content: "Hi"}},
+		}, func(llm.Delta) error { return nil })
+		is.NotError(t, err)
+		is.Equal(t, "Hi", res.Content)
+		_, ok := body["reasoning"]
+		is.True(t, !ok)
+	})
+}
@@ -0,0 +1,178 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"maragu.dev/errors"
+)
+
+// schema is the subset of JSON Schema that output is validated against.
+// Keywords not listed here are ignored, so they can still be used for the providers' native structured output.
+type schema struct {
+	Type                 schemaType         `json:"type"`
+	Properties           map[string]*schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Items                *schema            `json:"items"`
+	Enum                 []any              `json:"enum"`
+	MinItems             *int               `json:"minItems"`
+	MaxItems             *int               `json:"maxItems"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+}
+
+// schemaType is either a single type or a list of types.
+type schemaType []string
+
+func (t *schemaType) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*t = schemaType{s}
+		return nil
+	}
+	var ss []string
+	if err := json.Unmarshal(b, &ss); err != nil {
+		return err
+	}
+	*t = ss
+	return nil
+}
+
+// ValidateSchema is a JSON Schema object that output can be validated against with [ParseOutput].
+func ValidateSchema(jsonSchema []byte) error {
+	var s *schema
+	if err := json.Unmarshal(jsonSchema, &s); err != nil {
+		return errors.Wrap(err, "error unmarshalling schema")
+	}
+	if s == nil {
+		return errors.New("schema must be an object")
+	}
+	return nil
+}
+
+// ParseOutput in content as JSON and validate it against the JSON Schema.
+// Markdown code fences around the JSON are removed, since models often add them.
+// The returned JSON is compacted.
+func ParseOutput(content string, jsonSchema []byte) ([]byte, error) {
+	content = strings.TrimSpace(content)
+	if after, ok := strings.CutPrefix(content, "```"); ok {
+		// Skip the language tag, if any
+		if _, after, ok = strings.Cut(after, "\n"); ok {
+			content = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(after), "```"))
+		}
+	}
+
+	var s schema
+	if err := json.Unmarshal(jsonSchema, &s); err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling schema")
+	}
+
+	var v any
+	if err := json.Unmarshal([]byte(content), &v); err != nil {
+		return nil, fmt.Errorf("output is not valid JSON: %w", err)
+	}
+
+	if err := s.validate("$", v); err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	if err := json.Compact(&b, []byte(content)); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (s *schema) validate(path string, v any) error {
+	if len(s.Type) > 0 && !slices.ContainsFunc(s.Type, func(t string) bool { return isType(v, t) }) {
+		return fmt.Errorf("%v should be of type %v", path, strings.Join(s.Type, " or "))
+	}
+
+	// Both are decoded from JSON, so they're equal if they're deeply equal, which also compares their types
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(e any) bool { return reflect.DeepEqual(e, v) }) {
+		return fmt.Errorf("%v should be one of %v", path, s.Enum)
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				return fmt.Errorf("%v is missing required property %v", path, name)
+			}
+		}
+		for name, value := range v {
+			ps, ok := s.Properties[name]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return fmt.Errorf("%v has unexpected property %v", path, name)
+				}
+				continue
+			}
+			if err := ps.validate(path+"."+name, value); err != nil {
+				return err
+			}
+		}
+
+	case []any:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			return fmt.Errorf("%v should have at least %d items", path, *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			return fmt.Errorf("%v should have at most %d items", path, *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				if err := s.Items.validate(fmt.Sprintf("%v[%d]", path, i), item); err != nil {
+					return err
+				}
+			}
+		}
+
+	case string:
+		length := utf8.RuneCountInString(v)
+		if s.MinLength != nil && length < *s.MinLength {
+			return fmt.Errorf("%v should be at least %d characters", path, *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			return fmt.Errorf("%v should be at most %d characters", path, *s.MaxLength)
+		}
+
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			return fmt.Errorf("%v should be at least %v", path, *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			return fmt.Errorf("%v should be at most %v", path, *s.Maximum)
+		}
+	}
+
+	return nil
+}
+
+func isType(v any, t string) bool {
+	switch v := v.(type) {
+	case nil:
+		return t == "null"
+	case bool:
+		return t == "boolean"
+	case float64:
+		return t == "number" || (t == "integer" && v == math.Trunc(v))
+	case string:
+		return t == "string"
+	case []any:
+		return t == "array"
+	case map[string]any:
+		return t == "object"
+	default:
+		return false
+	}
+}
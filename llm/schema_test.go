@@ -0,0 +1,56 @@
+package llm_test
+
+import (
+	"testing"
+
+	"maragu.dev/is"
+
+	"app/llm"
+)
+
+func TestParseOutput(t *testing.T) {
+	schema := []byte(`{
+		"type": "object",
+		"properties": {
+			"label": {"type": "string", "enum": ["spam", "ham"]},
+			"confidence": {"type": "number", "minimum": 0, "maximum": 1},
+			"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 2},
+			"level": {"enum": [1, 2]}
+		},
+		"required": ["label"],
+		"additionalProperties": false
+	}`)
+
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+		err      string
+	}{
+		{"valid", `{"label": "spam", "confidence": 0.9}`, `{"label":"spam","confidence":0.9}`, ""},
+		{"valid in a code fence", "```json\n{\"label\": \"ham\"}\n```", `{"label":"ham"}`, ""},
+		{"not JSON", `Sure! Here's the JSON.`, "", "output is not valid JSON: invalid character 'S' looking for beginning of value"},
+		{"missing required", `{}`, "", "$ is missing required property label"},
+		{"wrong type", `{"label": 1}`, "", "$.label should be of type string"},
+		{"not in enum", `{"label": "eggs"}`, "", "$.label should be one of [spam ham]"},
+		{"in enum with another type", `{"label": "spam", "level": 1}`, `{"label":"spam","level":1}`, ""},
+		{"not in enum with another type", `{"label": "spam", "level": "1"}`, "", "$.level should be one of [1 2]"},
+		{"above maximum", `{"label": "spam", "confidence": 2}`, "", "$.confidence should be at most 1"},
+		{"too many items", `{"label": "spam", "tags": ["a", "b", "c"]}`, "", "$.tags should have at most 2 items"},
+		{"wrong item type", `{"label": "spam", "tags": [1]}`, "", "$.tags[0] should be of type string"},
+		{"additional property", `{"label": "spam", "extra": true}`, "", "$ has unexpected property extra"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output, err := llm.ParseOutput(test.content, schema)
+			if test.err != "" {
+				is.True(t, err != nil)
+				is.Equal(t, test.err, err.Error())
+				return
+			}
+			is.NotError(t, err)
+			is.Equal(t, test.expected, string(output))
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package llm
+
+import (
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"app/model"
+)
+
+// PromptData is what's available to the template of a speaker's system prompt,
+// such as {{.Date}}, {{.User}}, {{join .Participants ", "}}, or {{.Vars.project}}.
+type PromptData struct {
+	// Now is when the turn was created, for other formats like {{.Now.Format "Monday"}}.
+	Now time.Time
+	// Speaker is the name of the speaker the prompt is for.
+	Speaker string
+	// User is the name of the human in the conversation, or empty if there's none yet.
+	User  string
+	Topic string
+	// Participants are the names of the other speakers in the conversation, in the order they first spoke.
+	Participants []string
+	// Vars are the custom variables of the conversation. Missing variables are empty.
+	Vars model.Variables
+}
+
+// Date of Now, like 2025-09-22.
+func (d PromptData) Date() string {
+	return d.Now.Format(time.DateOnly)
+}
+
+// NewPromptData for generating turn t in the conversation document.
+// The user is the first speaker in the conversation with no generated turns.
+func NewPromptData(cd model.ConversationDocument, t model.Turn) PromptData {
+	generated := map[model.SpeakerID]bool{}
+	for _, other := range cd.Turns {
+		if other.ModelID != nil {
+			generated[other.SpeakerID] = true
+		}
+	}
+	generated[t.SpeakerID] = true
+
+	d := PromptData{
+		Now:     t.Created.T,
+		Speaker: cd.Speakers[t.SpeakerID].Name,
+		Topic:   cd.Conversation.Topic,
+		Vars:    cd.Conversation.Variables,
+	}
+	for _, other := range cd.Turns {
+		name := cd.Speakers[other.SpeakerID].Name
+		if other.SpeakerID == t.SpeakerID || slices.Contains(d.Participants, name) {
+			continue
+		}
+		d.Participants = append(d.Participants, name)
+		if d.User == "" && !generated[other.SpeakerID] {
+			d.User = name
+		}
+	}
+	return d
+}
+
+var templateFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+// RenderSystem prompt as a [text/template] with the given data.
+func RenderSystem(system string, data PromptData) (string, error) {
+	t, err := template.New("system").Funcs(templateFuncs).Option("missingkey=zero").Parse(system)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// ValidateSystem prompt by rendering it with example data, see [RenderSystem].
+// System prompts are otherwise only rendered when generating a turn, so this catches errors before that.
+func ValidateSystem(system string) error {
+	_, err := RenderSystem(system, PromptData{
+		Now:          time.Now(),
+		Speaker:      "Example speaker",
+		User:         "Example user",
+		Topic:        "Example topic",
+		Participants: []string{"Example user"},
+	})
+	return err
+}
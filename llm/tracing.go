@@ -0,0 +1,71 @@
+package llm
+
+import (
+	"context"
+	"strconv"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+	"maragu.dev/errors"
+
+	"app/model"
+)
+
+// completeWithTracing wraps the request to the provider in a span that follows the OpenTelemetry GenAI semantic conventions.
+// See https://opentelemetry.io/docs/specs/semconv/gen-ai/gen-ai-spans/
+func completeWithTracing(ctx context.Context, cp completer, req Request, onDelta func(Delta) error) (Response, error) {
+	ctx, span := otel.Tracer("app/llm").Start(ctx, "chat "+req.Model.Name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.GenAIOperationNameChat,
+			genAISystem(req.Model.Provider),
+			semconv.GenAIRequestModel(req.Model.Name),
+		),
+	)
+	defer span.End()
+
+	res, err := cp.complete(ctx, req, onDelta)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "completion failed")
+		span.SetAttributes(semconv.ErrorTypeKey.String(errorType(err)))
+		return res, err
+	}
+
+	span.SetAttributes(
+		semconv.GenAIResponseModel(req.Model.Name),
+		semconv.GenAIUsageInputTokens(res.Usage.InputTokens),
+		semconv.GenAIUsageOutputTokens(res.Usage.OutputTokens),
+	)
+	if res.FinishReason != "" {
+		span.SetAttributes(semconv.GenAIResponseFinishReasons(res.FinishReason))
+	}
+
+	return res, nil
+}
+
+// genAISystem maps the provider to the well-known gen_ai.system values, using the provider name for the rest.
+func genAISystem(p model.Provider) attribute.KeyValue {
+	switch p {
+	case model.ProviderAnthropic:
+		return semconv.GenAISystemAnthropic
+	case model.ProviderGoogle:
+		return semconv.GenAISystemGemini
+	case model.ProviderOpenAI:
+		return semconv.GenAISystemOpenAI
+	default:
+		return semconv.GenAISystemKey.String(string(p))
+	}
+}
+
+// errorType for the error.type attribute, which is the status code for status errors.
+func errorType(err error) string {
+	var statusErr StatusError
+	if errors.As(err, &statusErr) {
+		return strconv.Itoa(statusErr.StatusCode)
+	}
+	return "_OTHER"
+}
@@ -0,0 +1,72 @@
+package llm_test
+
+import (
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+	"maragu.dev/errors"
+	"maragu.dev/is"
+
+	"app/llm"
+)
+
+func TestClient_Complete_tracing(t *testing.T) {
+	t.Run("should record a span with the GenAI attributes for each completion", func(t *testing.T) {
+		spans := recordSpans(t)
+		c := llm.NewClient(llm.NewClientOptions{})
+
+		req := newFakeRequest(`{"responses":["Hello!"]}`, "Hi")
+		req.Model.Name = "echo"
+		_, err := c.Complete(t.Context(), req, func(llm.Delta) error { return nil })
+		is.NotError(t, err)
+
+		ended := spans.Ended()
+		is.Equal(t, 1, len(ended))
+		is.Equal(t, "chat echo", ended[0].Name())
+
+		attrs := map[attribute.Key]attribute.Value{}
+		for _, a := range ended[0].Attributes() {
+			attrs[a.Key] = a.Value
+		}
+		is.Equal(t, "chat", attrs["gen_ai.operation.name"].AsString())
+		is.Equal(t, "fake", attrs["gen_ai.system"].AsString())
+		is.Equal(t, "echo", attrs["gen_ai.request.model"].AsString())
+		is.Equal(t, int64(2), attrs["gen_ai.usage.input_tokens"].AsInt64())
+		is.Equal(t, int64(6), attrs["gen_ai.usage.output_tokens"].AsInt64())
+		is.EqualSlice(t, []string{"stop"}, attrs["gen_ai.response.finish_reasons"].AsStringSlice())
+	})
+
+	t.Run("should record the error type when the completion fails", func(t *testing.T) {
+		spans := recordSpans(t)
+		c := llm.NewClient(llm.NewClientOptions{})
+
+		_, err := c.Complete(t.Context(), newFakeRequest(`{"error":{"statusCode":400}}`, "Hi"), func(llm.Delta) error { return nil })
+		is.True(t, errors.As(err, &llm.StatusError{}))
+
+		ended := spans.Ended()
+		is.Equal(t, 1, len(ended))
+		for _, a := range ended[0].Attributes() {
+			if a.Key == "error.type" {
+				is.Equal(t, "400", a.Value.AsString())
+				return
+			}
+		}
+		t.Fatal("no error.type attribute")
+	})
+}
+
+// recordSpans with the global tracer provider until the test ends.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	spans := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	t.Cleanup(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+	})
+	return spans
+}
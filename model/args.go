@@ -4,3 +4,31 @@ type GetSpeakerFilter struct {
 	ID   SpeakerID
 	Name string
 }
+
+// GetConversationsFilter narrows down conversations. Fields left at their zero value don't filter.
+type GetConversationsFilter struct {
+	// FolderID includes conversations in the folder and all folders nested inside it.
+	FolderID FolderID
+	// From and To limit when conversations were created, from inclusive and to exclusive.
+	From, To Time
+	Pinned   bool
+	// SpeakerID includes conversations where the speaker has taken a turn.
+	SpeakerID SpeakerID
+	TagID     TagID
+
+	// Before the conversation with this ID, in keyset pagination on when conversations were created.
+	Before ConversationID
+	// Limit to at most this many conversations. Zero means no limit.
+	Limit int
+}
+
+// GetTurnsFilter selects a page of turns, in keyset pagination on when they were created.
+// Fields left at their zero value don't filter.
+type GetTurnsFilter struct {
+	// Before the turn with this ID, for loading earlier turns.
+	Before TurnID
+	// Limit to at most this many of the latest turns.
+	Limit int
+	// Since the turn with this ID, including it, for polling the turns that have been loaded.
+	Since TurnID
+}
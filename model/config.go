@@ -0,0 +1,103 @@
+package model
+
+import (
+	"encoding/json"
+
+	"go.yaml.in/yaml/v3"
+	"maragu.dev/errors"
+)
+
+// Config declares providers, models, and speakers, which are reconciled into the database.
+// What's in the database but not in the config is left alone.
+type Config struct {
+	Providers []Provider    `yaml:"providers"`
+	Models    []ConfigModel `yaml:"models"`
+	Speakers  []Persona     `yaml:"speakers"`
+}
+
+// ConfigModel is a model in a [Config], identified by its provider and name.
+type ConfigModel struct {
+	Provider Provider       `yaml:"provider"`
+	Name     string         `yaml:"name"`
+	Config   map[string]any `yaml:"config,omitempty"`
+}
+
+// JSONConfig of the model as it's stored in [Model.Config].
+func (m ConfigModel) JSONConfig() (JSON, error) {
+	if len(m.Config) == 0 {
+		return "{}", nil
+	}
+	b, err := json.Marshal(m.Config)
+	return JSON(b), err
+}
+
+// ParseConfig from YAML, checking that providers are supported, that everything has a name,
+// and that nothing is declared more than once. Models are identified by their provider and name.
+func ParseConfig(b []byte) (Config, error) {
+	var c Config
+	if err := yaml.Unmarshal(b, &c); err != nil {
+		return c, err
+	}
+
+	providers := map[Provider]bool{}
+	for _, p := range c.Providers {
+		if !p.Supported() {
+			return c, errors.Newf("unsupported provider %q", p)
+		}
+		if providers[p] {
+			return c, errors.Newf("provider %q is declared more than once", p)
+		}
+		providers[p] = true
+	}
+
+	models := map[PersonaModel]bool{}
+	for _, m := range c.Models {
+		if !m.Provider.Supported() || m.Name == "" {
+			return c, errors.Newf("model %q must have a name and a supported provider", m.Name)
+		}
+		key := PersonaModel{Provider: m.Provider, Name: m.Name}
+		if models[key] {
+			return c, errors.Newf("model %q of provider %q is declared more than once", m.Name, m.Provider)
+		}
+		models[key] = true
+	}
+
+	names := map[string]bool{}
+	for _, s := range c.Speakers {
+		if s.Name == "" || s.Model.Name == "" || !s.Model.Provider.Supported() {
+			return c, errors.Newf("speaker %q must have a name, and a model with a name and a supported provider", s.Name)
+		}
+		if names[s.Name] {
+			return c, errors.Newf("speaker %q is declared more than once", s.Name)
+		}
+		names[s.Name] = true
+	}
+
+	return c, nil
+}
+
+// ConfigReport is what reconciling a [Config] did, in the order of the config.
+type ConfigReport struct {
+	Providers []Reconciled
+	Models    []Reconciled
+	Speakers  []Reconciled
+}
+
+// Reconciled is what reconciling something in a [Config] did to it.
+type Reconciled struct {
+	Name   string
+	Change Change
+}
+
+// Count the things in the report with the given change.
+func (r ConfigReport) Count(c Change) int {
+	var n int
+	for _, rs := range [][]Reconciled{r.Providers, r.Models, r.Speakers} {
+		for _, re := range rs {
+			if re.Change == c {
+				n++
+			}
+		}
+	}
+	return n
+}
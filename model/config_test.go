@@ -0,0 +1,32 @@
+package model_test
+
+import (
+	"testing"
+
+	"maragu.dev/is"
+
+	"app/model"
+)
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{"providers", "providers: [fake, fake]"},
+		{"models", "models:\n  - {provider: fake, name: echo}\n  - {provider: fake, name: echo}"},
+		{"speakers", "speakers:\n  - {name: Parrot, model: {provider: fake, name: echo}}\n  - {name: Parrot, model: {provider: fake, name: echo}}"},
+	}
+	for _, test := range tests {
+		t.Run("should reject duplicate "+test.name, func(t *testing.T) {
+			_, err := model.ParseConfig([]byte(test.config))
+			is.True(t, err != nil)
+		})
+	}
+
+	t.Run("should accept models with the same name from different providers", func(t *testing.T) {
+		c, err := model.ParseConfig([]byte("models:\n  - {provider: fake, name: echo}\n  - {provider: openai, name: echo}"))
+		is.NotError(t, err)
+		is.Equal(t, 2, len(c.Models))
+	})
+}
@@ -0,0 +1,50 @@
+package model
+
+import (
+	"encoding/json"
+	"log/slog"
+	"regexp"
+)
+
+// Secret is the value of a credential, like an API key.
+// It's redacted when formatted, logged, or marshalled, so it doesn't leak by accident. Use string(s) to get the value.
+type Secret string
+
+const redacted = "[redacted]"
+
+// String satisfies [fmt.Stringer].
+func (s Secret) String() string {
+	return redacted
+}
+
+// GoString satisfies [fmt.GoStringer].
+func (s Secret) GoString() string {
+	return redacted
+}
+
+// LogValue satisfies [slog.LogValuer].
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(redacted)
+}
+
+// MarshalJSON satisfies [json.Marshaler].
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(redacted)
+}
+
+var _ slog.LogValuer = Secret("")
+var _ json.Marshaler = Secret("")
+
+// Credential is a secret stored in the database, without its value.
+type Credential struct {
+	Name    string
+	Created Time
+	Updated Time
+}
+
+var credentialNameMatcher = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+// ValidCredentialName if it's lowercase letters, digits, dots, dashes, and underscores, so it's safe as a file name.
+func ValidCredentialName(name string) bool {
+	return credentialNameMatcher.MatchString(name)
+}
@@ -4,9 +4,25 @@ package model
 type Error string
 
 const (
-	ErrorConversationNotFound = Error("conversation not found")
-	ErrorModelNotFound        = Error("model not found")
-	ErrorSpeakerNotFound      = Error("speaker not found")
+	ErrorConversationNotFound    = Error("conversation not found")
+	ErrorCredentialNameInvalid   = Error("credential name must be lowercase letters, digits, dots, dashes, and underscores")
+	ErrorCredentialNotFound      = Error("credential not found")
+	ErrorCredentialsKeyMissing   = Error("no key to encrypt credentials with")
+	ErrorConversationPaused      = Error("conversation paused")
+	ErrorFolderCycle             = Error("folder can't be inside itself")
+	ErrorFolderNotFound          = Error("folder not found")
+	ErrorMemoryNotFound          = Error("memory not found")
+	ErrorModelNotFound           = Error("model not found")
+	ErrorPersonaInvalid          = Error("persona must have a name, and a model with a provider and name")
+	ErrorProviderNotFound        = Error("provider not found")
+	ErrorShareNotFound           = Error("share not found")
+	ErrorSpeakerCannotReply      = Error("speaker can't reply, only AI speakers can")
+	ErrorSpeakerNameConflict     = Error("speaker name already taken")
+	ErrorSpeakerNotFound         = Error("speaker not found")
+	ErrorSpeakerRevisionNotFound = Error("speaker revision not found")
+	ErrorTagNotFound             = Error("tag not found")
+	ErrorTurnCancelled           = Error("turn cancelled")
+	ErrorTurnNotFound            = Error("turn not found")
 )
 
 func (e Error) Error() string {
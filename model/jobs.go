@@ -0,0 +1,26 @@
+package model
+
+const JobGenerateTurn = "generate-turn"
+
+// GenerateTurnJobMessage is the message for the [JobGenerateTurn] job,
+// which generates the content of an existing, empty turn with the turn's speaker.
+type GenerateTurnJobMessage struct {
+	TurnID TurnID
+	// Attempt is how many times generation was tried before, because all models were unavailable.
+	Attempt int `json:",omitempty"`
+	// Trace is the W3C trace context of whatever created the job, such as an HTTP request,
+	// so generation shows up in the same trace.
+	Trace map[string]string `json:",omitempty"`
+}
+
+// JobBackup backs up the database, and runs on a schedule.
+const JobBackup = "backup"
+
+// JobRetention deletes or anonymizes conversations past retention, and runs on a schedule.
+const JobRetention = "retention"
+
+// JobExtractMemories extracts memories for speakers from conversations, and runs on a schedule.
+const JobExtractMemories = "extract-memories"
+
+// JobPurgeTrash permanently deletes what's been in the trash for long enough, and runs on a schedule.
+const JobPurgeTrash = "purge-trash"
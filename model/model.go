@@ -1,8 +1,13 @@
 package model
 
 import (
+	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
 	"fmt"
+	"time"
+
+	"maragu.dev/errors"
 )
 
 type JSON string
@@ -12,12 +17,23 @@ type Provider string
 const (
 	ProviderAnthropic = Provider("anthropic")
 	ProviderBrain     = Provider("brain")
+	ProviderFake      = Provider("fake")
 	ProviderFireworks = Provider("fireworks")
 	ProviderGoogle    = Provider("google")
 	ProviderLlamaCPP  = Provider("llamacpp")
 	ProviderOpenAI    = Provider("openai")
 )
 
+// Supported if the app can talk to models of the provider.
+func (p Provider) Supported() bool {
+	switch p {
+	case ProviderAnthropic, ProviderBrain, ProviderFake, ProviderFireworks, ProviderGoogle, ProviderLlamaCPP, ProviderOpenAI:
+		return true
+	default:
+		return false
+	}
+}
+
 type ModelID ID
 
 func (i ModelID) String() string {
@@ -35,19 +51,50 @@ type Model struct {
 	Config   JSON
 }
 
-func (m Model) URL() string {
-	config := unmarshalConfig(m.Config)
+// HasURL if models of the provider are served from a URL, which is the provider's own API if [Model.URL] is empty.
+func (p Provider) HasURL() bool {
+	switch p {
+	case ProviderAnthropic, ProviderFake, ProviderFireworks, ProviderGoogle, ProviderLlamaCPP, ProviderOpenAI:
+		return true
+	default:
+		return false
+	}
+}
 
+// URL the model is served from, or empty for the provider's own API.
+// If the provider doesn't have a URL, see [Provider.HasURL], or the config can't be parsed, an error is returned.
+func (m Model) URL() (string, error) {
 	switch m.Provider {
-	case ProviderAnthropic, ProviderGoogle, ProviderOpenAI:
-		return ""
+	case ProviderAnthropic, ProviderFake, ProviderGoogle, ProviderOpenAI:
+		return "", nil
 	case ProviderFireworks:
-		return "https://api.fireworks.ai/inference/v1"
+		return "https://api.fireworks.ai/inference/v1", nil
 	case ProviderLlamaCPP:
-		return fmt.Sprintf("http://%v/v1", config["address"])
+		var config struct {
+			Address string `json:"address"`
+		}
+		if err := json.Unmarshal([]byte(m.Config), &config); err != nil {
+			return "", errors.Wrap(err, "error parsing config of model %v", m.ID)
+		}
+		return fmt.Sprintf("http://%v/v1", config.Address), nil
 	default:
-		panic("unsupported model type")
+		return "", errors.Newf("provider %v doesn't have a URL", m.Provider)
+	}
+}
+
+// Credential is the name of the credential the model config references, or empty if it doesn't reference one.
+// If the config isn't a JSON object, or the credential isn't a string, an error is returned.
+func (m Model) Credential() (string, error) {
+	if m.Config == "" {
+		return "", nil
+	}
+	var config struct {
+		Credential string `json:"credential"`
+	}
+	if err := json.Unmarshal([]byte(m.Config), &config); err != nil {
+		return "", errors.Wrap(err, "error parsing config of model %v", m.ID)
 	}
+	return config.Credential, nil
 }
 
 type SpeakerID ID
@@ -66,6 +113,29 @@ type Speaker struct {
 	Name    string
 	System  string
 	Config  JSON
+	// Deleted is when the speaker was moved to the trash, or zero if it wasn't.
+	Deleted Time
+}
+
+type SpeakerRevisionID ID
+
+func (i SpeakerRevisionID) String() string {
+	return string(i)
+}
+
+var _ fmt.Stringer = SpeakerRevisionID("")
+
+// SpeakerRevision is an immutable snapshot of a [Speaker].
+// A new revision is recorded every time a speaker is created or changed.
+type SpeakerRevision struct {
+	ID        SpeakerRevisionID
+	Created   Time
+	SpeakerID SpeakerID `db:"speaker_id"`
+	Revision  int
+	ModelID   ModelID `db:"model_id"`
+	Name      string
+	System    string
+	Config    JSON
 }
 
 type ConversationID ID
@@ -81,6 +151,155 @@ type Conversation struct {
 	Created Time
 	Updated Time
 	Topic   string
+	Paused  bool
+	// Pinned conversations are kept regardless of retention.
+	Pinned bool
+	// Anonymized is when retention removed the content of the conversation, or zero if it hasn't.
+	Anonymized Time
+	// Deleted is when the conversation was moved to the trash, or zero if it wasn't.
+	Deleted Time
+	// FolderID is the folder the conversation is in, or nil if it's not in a folder.
+	FolderID *FolderID `db:"folder_id"`
+	// System is context for every speaker in the conversation, added to their own system prompts.
+	System string
+	// Variables are custom variables for the system prompt templates of speakers in the conversation.
+	Variables Variables
+}
+
+// Variables by name, stored as a JSON object.
+type Variables map[string]string
+
+// Value satisfies [driver.Valuer].
+func (v Variables) Value() (driver.Value, error) {
+	if v == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+var _ driver.Valuer = Variables{}
+
+// Scan satisfies [sql.Scanner].
+func (v *Variables) Scan(src any) error {
+	s, ok := src.(string)
+	if !ok {
+		return fmt.Errorf("error scanning variables, got %+v", src)
+	}
+	return json.Unmarshal([]byte(s), v)
+}
+
+var _ sql.Scanner = &Variables{}
+
+type FolderID ID
+
+func (i FolderID) String() string {
+	return string(i)
+}
+
+var _ fmt.Stringer = FolderID("")
+
+// Folder of conversations, which can be nested inside another folder.
+type Folder struct {
+	ID       FolderID
+	Created  Time
+	Updated  Time
+	ParentID *FolderID `db:"parent_id"`
+	Name     string
+}
+
+type TagID ID
+
+func (i TagID) String() string {
+	return string(i)
+}
+
+var _ fmt.Stringer = TagID("")
+
+// Tag labels conversations. A conversation can have many tags, and a tag many conversations.
+type Tag struct {
+	ID      TagID
+	Created Time
+	Name    string
+}
+
+// ExpiredConversation is a conversation past retention, with what's needed to report on it.
+type ExpiredConversation struct {
+	Conversation
+	// LastActivity is when the conversation or its latest turn was created, whichever is later.
+	LastActivity Time `db:"last_activity"`
+	Turns        int
+}
+
+// Trash has everything that's been deleted and can still be restored, most recently deleted first.
+type Trash struct {
+	Conversations []Conversation
+	Speakers      []Speaker
+	// Turns in conversations that aren't in the trash themselves.
+	Turns []TrashedTurn
+}
+
+// TrashedTurn is a turn in the trash, with what's needed to recognize it.
+type TrashedTurn struct {
+	Turn
+	Topic       string
+	SpeakerName string `db:"speaker_name"`
+}
+
+// PurgedTrash counts what was permanently deleted from the trash.
+type PurgedTrash struct {
+	Conversations int
+	Speakers      int
+	Turns         int
+}
+
+type MemoryID ID
+
+func (i MemoryID) String() string {
+	return string(i)
+}
+
+var _ fmt.Stringer = MemoryID("")
+
+// Memory is something a speaker remembers across conversations, such as a fact about the user.
+// Memories are extracted from conversations in the background, remembered from turns, or written by hand.
+type Memory struct {
+	ID        MemoryID
+	Created   Time
+	Updated   Time
+	SpeakerID SpeakerID `db:"speaker_id"`
+	Content   string
+	// ConversationID is the conversation the memory is from, or nil if it's not from a conversation.
+	ConversationID *ConversationID `db:"conversation_id"`
+	// TurnID is the turn the memory was explicitly remembered from, or nil if it wasn't.
+	TurnID *TurnID `db:"turn_id"`
+}
+
+type ShareID ID
+
+func (i ShareID) String() string {
+	return string(i)
+}
+
+var _ fmt.Stringer = ShareID("")
+
+// Share is a public read-only link to a conversation, by its unguessable token.
+// The link shows the conversation as it was when the share was created.
+type Share struct {
+	ID             ShareID
+	Created        Time
+	Updated        Time
+	ConversationID ConversationID `db:"conversation_id"`
+	Token          string
+	// Expires is when the link stops working, or zero if it doesn't expire.
+	Expires Time
+	// Revoked is when the link was revoked, or zero if it wasn't.
+	Revoked Time
+}
+
+// Active if the share isn't revoked and hasn't expired at the given time.
+func (s Share) Active(now time.Time) bool {
+	return s.Revoked.T.IsZero() && (s.Expires.T.IsZero() || now.Before(s.Expires.T))
 }
 
 type TurnID ID
@@ -91,25 +310,104 @@ func (i TurnID) String() string {
 
 var _ fmt.Stringer = TurnID("")
 
+// TurnStatus is the lifecycle of generating a turn.
+// Generated turns start out pending, are streaming while generating, and then end up complete, failed, or cancelled.
+// Turns that aren't generated are always complete.
+type TurnStatus string
+
+const (
+	TurnStatusCancelled = TurnStatus("cancelled")
+	TurnStatusComplete  = TurnStatus("complete")
+	TurnStatusFailed    = TurnStatus("failed")
+	TurnStatusPending   = TurnStatus("pending")
+	TurnStatusStreaming = TurnStatus("streaming")
+)
+
+// Generating if the turn is pending or streaming.
+func (s TurnStatus) Generating() bool {
+	return s == TurnStatusPending || s == TurnStatusStreaming
+}
+
 type Turn struct {
-	ID             TurnID
-	Created        Time
-	Updated        Time
-	ConversationID ConversationID `db:"conversation_id"`
-	SpeakerID      SpeakerID      `db:"speaker_id"`
-	Content        string
+	ID                TurnID
+	Created           Time
+	Updated           Time
+	ConversationID    ConversationID    `db:"conversation_id"`
+	SpeakerID         SpeakerID         `db:"speaker_id"`
+	SpeakerRevisionID SpeakerRevisionID `db:"speaker_revision_id"`
+	Content           string
+	ReplyToID         *TurnID `db:"reply_to_id"`
+	Candidate         bool
+	ModelID           *ModelID `db:"model_id"`
+	Status            TurnStatus
+	Error             string
+	Started           Time
+	Finished          Time
+	Reasoning         Reasoning
+	// Output is the content as JSON, if the speaker has an output schema that the content matches.
+	Output JSON
+	// Pinned turns are always included in prompts.
+	Pinned bool
+	// Deleted is when the turn was moved to the trash, or zero if it wasn't.
+	Deleted Time
 }
 
-type ConversationDocument struct {
-	Conversation Conversation
-	Speakers     map[SpeakerID]Speaker
-	Turns        []Turn
+type ReasoningBlockType string
+
+const (
+	// ReasoningBlockTypeRedacted is thinking that the provider has encrypted, which is only useful to send back.
+	ReasoningBlockTypeRedacted = ReasoningBlockType("redacted")
+	// ReasoningBlockTypeSummary is a summary of the model's reasoning, when the provider doesn't show the full reasoning,
+	// like the OpenAI responses API.
+	ReasoningBlockTypeSummary = ReasoningBlockType("summary")
+	// ReasoningBlockTypeThinking is the model's reasoning as it was generated.
+	ReasoningBlockTypeThinking = ReasoningBlockType("thinking")
+)
+
+// ReasoningBlock is a part of a model's reasoning before its reply.
+// Some providers sign thinking blocks, or send them redacted as opaque data,
+// and require them to be sent back unchanged in follow-up requests.
+type ReasoningBlock struct {
+	Type      ReasoningBlockType `json:"type"`
+	Text      string             `json:"text,omitempty"`
+	Signature string             `json:"signature,omitempty"`
+	Data      string             `json:"data,omitempty"`
+}
+
+// Reasoning blocks of a turn, stored as JSON.
+type Reasoning []ReasoningBlock
+
+// Value satisfies [driver.Valuer].
+func (r Reasoning) Value() (driver.Value, error) {
+	if r == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(r)
+	return string(b), err
 }
 
-func unmarshalConfig(s JSON) map[string]any {
-	config := map[string]any{}
-	if err := json.Unmarshal([]byte(s), &config); err != nil {
-		panic(err)
+var _ driver.Valuer = Reasoning{}
+
+// Scan satisfies [sql.Scanner].
+func (r *Reasoning) Scan(src any) error {
+	s, ok := src.(string)
+	if !ok {
+		return fmt.Errorf("error scanning reasoning, got %+v", src)
 	}
-	return config
+	return json.Unmarshal([]byte(s), r)
+}
+
+var _ sql.Scanner = &Reasoning{}
+
+type ConversationDocument struct {
+	Conversation     Conversation
+	Models           map[ModelID]Model
+	Speakers         map[SpeakerID]Speaker
+	SpeakerRevisions map[SpeakerRevisionID]SpeakerRevision
+	Tags             []Tag
+	Turns            []Turn
+	// RememberedTurns are the turns that speakers remember, by ID.
+	RememberedTurns map[TurnID]bool
+	// EarlierTurns is whether there are turns before the first of Turns, when only a page of turns is loaded.
+	EarlierTurns bool
 }
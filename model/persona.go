@@ -0,0 +1,79 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Persona is a speaker in a portable file, for sharing speakers between instances.
+// The model is referenced by provider and name instead of by ID, since IDs differ between instances.
+type Persona struct {
+	Name   string         `json:"name" yaml:"name"`
+	Model  PersonaModel   `json:"model" yaml:"model"`
+	System string         `json:"system,omitempty" yaml:"system,omitempty"`
+	Config map[string]any `json:"config,omitempty" yaml:"config,omitempty"`
+}
+
+// PersonaModel references a model by provider and name.
+type PersonaModel struct {
+	Provider Provider `json:"provider" yaml:"provider"`
+	Name     string   `json:"name" yaml:"name"`
+}
+
+// PersonaFormat is the file format of a [Persona].
+type PersonaFormat string
+
+const (
+	PersonaFormatJSON = PersonaFormat("json")
+	PersonaFormatYAML = PersonaFormat("yaml")
+)
+
+// ParsePersona from YAML or JSON, which is also YAML.
+func ParsePersona(b []byte) (Persona, error) {
+	var p Persona
+	if err := yaml.Unmarshal(b, &p); err != nil {
+		return p, err
+	}
+	if p.Name == "" || p.Model.Provider == "" || p.Model.Name == "" {
+		return p, ErrorPersonaInvalid
+	}
+	return p, nil
+}
+
+// MarshalPersona in the given format.
+func MarshalPersona(p Persona, f PersonaFormat) ([]byte, error) {
+	if f == PersonaFormatJSON {
+		return json.MarshalIndent(p, "", "  ")
+	}
+
+	var b bytes.Buffer
+	e := yaml.NewEncoder(&b)
+	e.SetIndent(2)
+	if err := e.Encode(p); err != nil {
+		return nil, err
+	}
+	if err := e.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// PersonaConfig as it's stored in [Speaker.Config].
+func PersonaConfig(p Persona) (JSON, error) {
+	if len(p.Config) == 0 {
+		return "{}", nil
+	}
+	b, err := json.Marshal(p.Config)
+	return JSON(b), err
+}
+
+// Change is what an import or a reconciliation did to something, such as a speaker.
+type Change string
+
+const (
+	ChangeCreated   = Change("created")
+	ChangeUnchanged = Change("unchanged")
+	ChangeUpdated   = Change("updated")
+)
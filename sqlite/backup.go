@@ -0,0 +1,122 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"maragu.dev/errors"
+)
+
+// Backup the database to a new file at path, with VACUUM INTO.
+// The backup is a consistent snapshot, taken while the app keeps running, and the path must not exist already.
+func (d *Database) Backup(ctx context.Context, path string) error {
+	if err := d.H.Exec(ctx, `vacuum into ?`, path); err != nil {
+		return errors.Wrap(err, "error vacuuming into backup")
+	}
+	return nil
+}
+
+// CheckIntegrity of the database file at path, returning an error with the problems found, if any.
+// The file is opened read-only, so this works on backups as well as databases not in use.
+func CheckIntegrity(ctx context.Context, path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return errors.Wrap(err, "error opening database")
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	rows, err := db.QueryContext(ctx, `pragma integrity_check`)
+	if err != nil {
+		return errors.Wrap(err, "error checking integrity")
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var problems []string
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return err
+		}
+		if result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("integrity check failed: %v", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Restore the backup at backupPath to the database at path, which must not be in use.
+// The backup is checked for integrity first. The current database, if any, is kept next to it
+// with a .before-restore-<time> suffix, together with its WAL and shared memory files.
+func Restore(ctx context.Context, backupPath, path string) error {
+	if err := CheckIntegrity(ctx, backupPath); err != nil {
+		return errors.Wrap(err, "error checking backup integrity")
+	}
+
+	// Copy to a temporary file first, so a failed copy leaves the current database untouched
+	restoring := path + ".restoring"
+	if err := os.Remove(restoring); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "error removing earlier restore")
+	}
+	if err := copyFile(backupPath, restoring); err != nil {
+		_ = os.Remove(restoring)
+		return errors.Wrap(err, "error copying backup")
+	}
+
+	suffix := ".before-restore-" + time.Now().UTC().Format("20060102T150405Z")
+	for _, ext := range []string{"", "-wal", "-shm"} {
+		if err := os.Rename(path+ext, path+ext+suffix); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "error moving current database aside")
+		}
+	}
+
+	if err := os.Rename(restoring, path); err != nil {
+		return errors.Wrap(err, "error moving restored database into place")
+	}
+
+	return nil
+}
+
+func copyFile(src, dst string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	return out.Sync()
+}
@@ -0,0 +1,88 @@
+package sqlite_test
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"maragu.dev/is"
+
+	"app/sqlite"
+	"app/sqlitetest"
+)
+
+func TestDatabase_Backup(t *testing.T) {
+	t.Run("should back up to a file that passes the integrity check and can be restored", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		c := sqlitetest.NewConversation(t, db, "Birds")
+
+		dir := t.TempDir()
+		backupPath := filepath.Join(dir, "backup.db")
+		err := db.Backup(t.Context(), backupPath)
+		is.NotError(t, err)
+
+		err = sqlite.CheckIntegrity(t.Context(), backupPath)
+		is.NotError(t, err)
+
+		path := filepath.Join(dir, "app.db")
+		err = os.WriteFile(path, []byte("current"), 0o600)
+		is.NotError(t, err)
+
+		err = sqlite.Restore(t.Context(), backupPath, path)
+		is.NotError(t, err)
+
+		matches, err := filepath.Glob(path + ".before-restore-*")
+		is.NotError(t, err)
+		is.Equal(t, 1, len(matches))
+
+		restored, err := sql.Open("sqlite3", path)
+		is.NotError(t, err)
+		t.Cleanup(func() {
+			_ = restored.Close()
+		})
+		var topic string
+		err = restored.QueryRowContext(t.Context(), `select topic from conversations where id = ?`, c.ID).Scan(&topic)
+		is.NotError(t, err)
+		is.Equal(t, "Birds", topic)
+	})
+
+	t.Run("should leave the current database in place when the restore fails", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		dir := t.TempDir()
+		backupPath := filepath.Join(dir, "backup.db")
+		err := db.Backup(t.Context(), backupPath)
+		is.NotError(t, err)
+
+		path := filepath.Join(dir, "app.db")
+		err = os.WriteFile(path, []byte("current"), 0o600)
+		is.NotError(t, err)
+
+		// A directory that's in the way of the copy makes the restore fail
+		err = os.MkdirAll(filepath.Join(path+".restoring", "in-the-way"), 0o700)
+		is.NotError(t, err)
+
+		err = sqlite.Restore(t.Context(), backupPath, path)
+		is.True(t, err != nil)
+
+		b, err := os.ReadFile(path)
+		is.NotError(t, err)
+		is.Equal(t, "current", string(b))
+
+		matches, err := filepath.Glob(path + ".before-restore-*")
+		is.NotError(t, err)
+		is.Equal(t, 0, len(matches))
+	})
+}
+
+func TestCheckIntegrity(t *testing.T) {
+	t.Run("should fail for a file that isn't a database", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "broken.db")
+		err := os.WriteFile(path, []byte("not a database"), 0o600)
+		is.NotError(t, err)
+
+		err = sqlite.CheckIntegrity(t.Context(), path)
+		is.True(t, err != nil)
+	})
+}
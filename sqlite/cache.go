@@ -0,0 +1,114 @@
+package sqlite
+
+import (
+	"sync"
+
+	"app/model"
+)
+
+// documentCache of conversation documents, so polling conversations that haven't changed doesn't hit the database.
+// Everything that changes a document must invalidate it, after the change is committed.
+// A nil cache caches nothing.
+type documentCache struct {
+	docs map[model.ConversationID]map[model.GetTurnsFilter]model.ConversationDocument
+	// generations are increased on every invalidation of a conversation, so documents read while the conversation
+	// changed aren't cached. Changes to other conversations, such as one that's streaming, don't stop caching.
+	generations map[model.ConversationID]uint64
+	// generation is increased when everything is invalidated, which also resets generations.
+	generation uint64
+	mutex      sync.Mutex
+	size       int
+	// maxSize is how many documents are cached at most.
+	maxSize int
+}
+
+// documentGeneration is what get returns to pass to put, to tell whether the document changed in between.
+type documentGeneration struct {
+	all, conversation uint64
+}
+
+func newDocumentCache(maxSize int) *documentCache {
+	if maxSize <= 0 {
+		return nil
+	}
+	return &documentCache{
+		docs:        map[model.ConversationID]map[model.GetTurnsFilter]model.ConversationDocument{},
+		generations: map[model.ConversationID]uint64{},
+		maxSize:     maxSize,
+	}
+}
+
+// get the cached document, if any, and the current generation to pass to put.
+func (c *documentCache) get(id model.ConversationID, f model.GetTurnsFilter) (model.ConversationDocument, bool, documentGeneration) {
+	if c == nil {
+		return model.ConversationDocument{}, false, documentGeneration{}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	cd, ok := c.docs[id][f]
+	return cd, ok, documentGeneration{all: c.generation, conversation: c.generations[id]}
+}
+
+// put the document in the cache, unless the conversation was invalidated since the given generation.
+// If the cache is full, all documents of some conversation are evicted first.
+func (c *documentCache) put(id model.ConversationID, f model.GetTurnsFilter, cd model.ConversationDocument, g documentGeneration) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if g.all != c.generation || g.conversation != c.generations[id] {
+		return
+	}
+
+	if c.size >= c.maxSize {
+		for evictID := range c.docs {
+			c.size -= len(c.docs[evictID])
+			delete(c.docs, evictID)
+			break
+		}
+	}
+
+	if c.docs[id] == nil {
+		c.docs[id] = map[model.GetTurnsFilter]model.ConversationDocument{}
+	}
+	if _, ok := c.docs[id][f]; !ok {
+		c.size++
+	}
+	c.docs[id][f] = cd
+}
+
+// invalidate the documents of the conversations with the given IDs.
+func (c *documentCache) invalidate(ids ...model.ConversationID) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, id := range ids {
+		c.generations[id]++
+		c.size -= len(c.docs[id])
+		delete(c.docs, id)
+	}
+}
+
+// invalidateAll documents, for changes that can be in any conversation, such as to speakers.
+func (c *documentCache) invalidateAll() {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.generation++
+	c.generations = map[model.ConversationID]uint64{}
+	c.docs = map[model.ConversationID]map[model.GetTurnsFilter]model.ConversationDocument{}
+	c.size = 0
+}
@@ -0,0 +1,49 @@
+package sqlite
+
+import (
+	"testing"
+
+	"maragu.dev/is"
+
+	"app/model"
+)
+
+func TestDocumentCache(t *testing.T) {
+	t.Run("should cache a document read while another conversation changed", func(t *testing.T) {
+		c := newDocumentCache(10)
+
+		_, ok, g := c.get("co_1", model.GetTurnsFilter{})
+		is.True(t, !ok)
+
+		c.invalidate("co_2")
+		c.put("co_1", model.GetTurnsFilter{}, model.ConversationDocument{Conversation: model.Conversation{Topic: "Birds"}}, g)
+
+		cd, ok, _ := c.get("co_1", model.GetTurnsFilter{})
+		is.True(t, ok)
+		is.Equal(t, "Birds", cd.Conversation.Topic)
+	})
+
+	t.Run("should not cache a document read while its conversation changed", func(t *testing.T) {
+		c := newDocumentCache(10)
+
+		_, _, g := c.get("co_1", model.GetTurnsFilter{})
+		c.invalidate("co_1")
+		c.put("co_1", model.GetTurnsFilter{}, model.ConversationDocument{}, g)
+
+		_, ok, _ := c.get("co_1", model.GetTurnsFilter{})
+		is.True(t, !ok)
+	})
+
+	t.Run("should not cache a document read while everything was invalidated", func(t *testing.T) {
+		c := newDocumentCache(10)
+
+		c.invalidate("co_1")
+		_, _, g := c.get("co_1", model.GetTurnsFilter{})
+		c.invalidateAll()
+		c.invalidate("co_1")
+		c.put("co_1", model.GetTurnsFilter{}, model.ConversationDocument{}, g)
+
+		_, ok, _ := c.get("co_1", model.GetTurnsFilter{})
+		is.True(t, !ok)
+	})
+}
@@ -0,0 +1,87 @@
+package sqlite_test
+
+import (
+	"testing"
+
+	"maragu.dev/is"
+
+	"app/model"
+	"app/sqlite"
+	"app/sqlitetest"
+)
+
+func TestDatabase_GetConversationDocument_cached(t *testing.T) {
+	newCachedDatabase := func(t *testing.T) *sqlite.Database {
+		t.Helper()
+		db := sqlitetest.NewDatabase(t)
+		return sqlite.NewDatabase(sqlite.NewDatabaseOptions{H: db.H, DocumentCacheSize: 10})
+	}
+
+	t.Run("should return saved and generated turns", func(t *testing.T) {
+		db := newCachedDatabase(t)
+		speaker := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+		c := sqlitetest.NewConversation(t, db, "Birds")
+
+		cd, err := db.GetConversationDocument(t.Context(), c.ID)
+		is.NotError(t, err)
+		is.Equal(t, 0, len(cd.Turns))
+
+		turn, err := db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: speaker.ID, Status: model.TurnStatusPending})
+		is.NotError(t, err)
+
+		cd, err = db.GetConversationDocument(t.Context(), c.ID)
+		is.NotError(t, err)
+		is.Equal(t, 1, len(cd.Turns))
+		is.Equal(t, "", cd.Turns[0].Content)
+
+		turn.Content = "Squawk!"
+		turn.Status = model.TurnStatusStreaming
+		err = db.UpdateTurnGeneration(t.Context(), turn)
+		is.NotError(t, err)
+
+		cd, err = db.GetConversationDocument(t.Context(), c.ID)
+		is.NotError(t, err)
+		is.Equal(t, "Squawk!", cd.Turns[0].Content)
+
+		err = db.CancelTurn(t.Context(), turn.ID)
+		is.NotError(t, err)
+
+		cd, err = db.GetConversationDocument(t.Context(), c.ID)
+		is.NotError(t, err)
+		is.Equal(t, model.TurnStatusCancelled, cd.Turns[0].Status)
+	})
+
+	t.Run("should return changed speakers", func(t *testing.T) {
+		db := newCachedDatabase(t)
+		speaker := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+		c := sqlitetest.NewConversation(t, db, "Birds")
+		_, err := db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: speaker.ID, Content: "Squawk!"})
+		is.NotError(t, err)
+
+		cd, err := db.GetConversationDocument(t.Context(), c.ID)
+		is.NotError(t, err)
+		is.Equal(t, "Parrot", cd.Speakers[speaker.ID].Name)
+
+		speaker.Name = "Polly"
+		_, err = db.SaveSpeaker(t.Context(), speaker)
+		is.NotError(t, err)
+
+		cd, err = db.GetConversationDocument(t.Context(), c.ID)
+		is.NotError(t, err)
+		is.Equal(t, "Polly", cd.Speakers[speaker.ID].Name)
+	})
+
+	t.Run("should not return deleted conversations", func(t *testing.T) {
+		db := newCachedDatabase(t)
+		c := sqlitetest.NewConversation(t, db, "Birds")
+
+		_, err := db.GetConversationDocument(t.Context(), c.ID)
+		is.NotError(t, err)
+
+		err = db.DeleteConversation(t.Context(), c.ID)
+		is.NotError(t, err)
+
+		_, err = db.GetConversationDocument(t.Context(), c.ID)
+		is.Error(t, model.ErrorConversationNotFound, err)
+	})
+}
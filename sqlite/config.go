@@ -0,0 +1,87 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+
+	"maragu.dev/errors"
+
+	"app/model"
+)
+
+// ReconcileConfig into the database in one transaction, so it's all or nothing.
+// Providers that are missing are added. Models are matched by provider and name, and speakers by name,
+// and are created if missing, or updated if they differ from the config.
+// Running it again with the same config leaves everything unchanged.
+// Speakers in the trash with the names of speakers in the config give up their names, like with [Database.ImportPersona].
+func (d *Database) ReconcileConfig(ctx context.Context, c model.Config) (model.ConfigReport, error) {
+	var r model.ConfigReport
+	err := d.H.InTx(ctx, func(ctx context.Context, tx *Tx) error {
+		for _, p := range c.Providers {
+			var added bool
+			if err := tx.Get(ctx, &added, `insert into providers (name) values (?) on conflict do nothing returning true`, p); err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return errors.Wrap(err, "error adding provider %v", p)
+			}
+			change := model.ChangeUnchanged
+			if added {
+				change = model.ChangeCreated
+			}
+			r.Providers = append(r.Providers, model.Reconciled{Name: string(p), Change: change})
+		}
+
+		for _, m := range c.Models {
+			change, err := reconcileModel(ctx, tx, m)
+			if err != nil {
+				return errors.Wrap(err, "error reconciling model %v", m.Name)
+			}
+			r.Models = append(r.Models, model.Reconciled{Name: string(m.Provider) + " " + m.Name, Change: change})
+		}
+
+		for _, p := range c.Speakers {
+			_, change, err := importPersona(ctx, tx, p, true)
+			if err != nil {
+				return errors.Wrap(err, "error reconciling speaker %v", p.Name)
+			}
+			r.Speakers = append(r.Speakers, model.Reconciled{Name: p.Name, Change: change})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return model.ConfigReport{}, err
+	}
+
+	if r.Count(model.ChangeCreated)+r.Count(model.ChangeUpdated) > 0 {
+		d.docs.invalidateAll()
+	}
+	return r, nil
+}
+
+// reconcileModel in the transaction, by the first model with the same provider and name.
+func reconcileModel(ctx context.Context, tx *Tx, m model.ConfigModel) (model.Change, error) {
+	config, err := m.JSONConfig()
+	if err != nil {
+		return "", err
+	}
+
+	var existing model.Model
+	err = tx.Get(ctx, &existing, `select * from models where provider = ? and name = ? order by created limit 1`, m.Provider, m.Name)
+	if errors.Is(err, sql.ErrNoRows) {
+		if err := tx.Exec(ctx, `insert into models (provider, name, config) values (?, ?, ?)`, m.Provider, m.Name, config); err != nil {
+			return "", err
+		}
+		return model.ChangeCreated, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if equalJSON(existing.Config, config) {
+		return model.ChangeUnchanged, nil
+	}
+
+	if err := tx.Exec(ctx, `update models set config = ? where id = ?`, config, existing.ID); err != nil {
+		return "", err
+	}
+	return model.ChangeUpdated, nil
+}
@@ -0,0 +1,78 @@
+package sqlite_test
+
+import (
+	"os"
+	"testing"
+
+	"maragu.dev/is"
+
+	"app/model"
+	"app/sqlitetest"
+)
+
+func TestDatabase_ReconcileConfig(t *testing.T) {
+	t.Run("should leave everything unchanged with the config file of the seeded providers, models, and speakers", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		b, err := os.ReadFile("../config.yaml")
+		is.NotError(t, err)
+		c, err := model.ParseConfig(b)
+		is.NotError(t, err)
+
+		r, err := db.ReconcileConfig(t.Context(), c)
+		is.NotError(t, err)
+		is.Equal(t, 7, len(r.Providers))
+		is.Equal(t, 7, len(r.Models))
+		is.Equal(t, 2, len(r.Speakers))
+		is.Equal(t, 16, r.Count(model.ChangeUnchanged))
+	})
+
+	t.Run("should create what's missing, update what differs, and be idempotent", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		c := model.Config{
+			Models: []model.ConfigModel{
+				{Provider: model.ProviderOpenAI, Name: "gpt-5", Config: map[string]any{"reasoning": map[string]any{"effort": "low"}}},
+				{Provider: model.ProviderFake, Name: "parrot"},
+			},
+			Speakers: []model.Persona{
+				{Name: "Me", Model: model.PersonaModel{Provider: model.ProviderBrain, Name: "human"}, System: "You do you."},
+				{Name: "Parrot", Model: model.PersonaModel{Provider: model.ProviderFake, Name: "parrot"}, System: "Squawk."},
+			},
+		}
+
+		r, err := db.ReconcileConfig(t.Context(), c)
+		is.NotError(t, err)
+		is.EqualSlice(t, []model.Reconciled{
+			{Name: "openai gpt-5", Change: model.ChangeUpdated},
+			{Name: "fake parrot", Change: model.ChangeCreated},
+		}, r.Models)
+		is.EqualSlice(t, []model.Reconciled{
+			{Name: "Me", Change: model.ChangeUnchanged},
+			{Name: "Parrot", Change: model.ChangeCreated},
+		}, r.Speakers)
+
+		parrot, err := db.GetSpeaker(t.Context(), model.GetSpeakerFilter{Name: "Parrot"})
+		is.NotError(t, err)
+		is.Equal(t, "Squawk.", parrot.System)
+
+		r, err = db.ReconcileConfig(t.Context(), c)
+		is.NotError(t, err)
+		is.Equal(t, 4, r.Count(model.ChangeUnchanged))
+	})
+
+	t.Run("should change nothing if anything fails", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		_, err := db.ReconcileConfig(t.Context(), model.Config{
+			Speakers: []model.Persona{
+				{Name: "Pirate", Model: model.PersonaModel{Provider: model.ProviderFake, Name: "Parrot"}},
+				{Name: "Parrot", Model: model.PersonaModel{Provider: "nope", Name: "Parrot"}},
+			},
+		})
+		is.Error(t, model.ErrorProviderNotFound, err)
+
+		_, err = db.GetSpeaker(t.Context(), model.GetSpeakerFilter{Name: "Pirate"})
+		is.Error(t, model.ErrorSpeakerNotFound, err)
+	})
+}
@@ -3,108 +3,688 @@ package sqlite
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"maps"
+	"slices"
+	"time"
 
+	"go.opentelemetry.io/otel/propagation"
 	"maragu.dev/errors"
+	"maragu.dev/glue/jobs"
 
 	"app/model"
 )
 
 func (d *Database) GetLatestConversation(ctx context.Context) (model.Conversation, error) {
 	var c model.Conversation
-	err := d.H.Get(ctx, &c, "select * from conversations order by created desc limit 1")
+	err := d.H.Get(ctx, &c, "select * from conversations where deleted is null order by created desc limit 1")
 	if err != nil && errors.Is(err, sql.ErrNoRows) {
 		return c, model.ErrorConversationNotFound
 	}
 	return c, err
 }
 
+// GetConversationDocument with everything needed to show and continue the conversation.
+// Conversations in the trash aren't found. Turns in the trash are left out, as are replies to them.
+// Speakers in the trash are still included if they have turns in the conversation.
 func (d *Database) GetConversationDocument(ctx context.Context, id model.ConversationID) (model.ConversationDocument, error) {
-	var cd model.ConversationDocument
+	return d.GetConversationDocumentPage(ctx, id, model.GetTurnsFilter{})
+}
+
+// GetConversationDocumentPage is like [Database.GetConversationDocument], but with only the turns matching the filter,
+// and only the models and speakers of those turns.
+// Candidates at the start of a page are left for the page before it, so they're on the same page as the turn they reply to.
+// Documents can be cached, see [NewDatabaseOptions], so they must not be changed by the caller.
+func (d *Database) GetConversationDocumentPage(ctx context.Context, id model.ConversationID, f model.GetTurnsFilter) (model.ConversationDocument, error) {
+	cd, ok, generation := d.docs.get(id, f)
+	if ok {
+		return cd, nil
+	}
+
+	cd.Models = map[model.ModelID]model.Model{}
 	cd.Speakers = map[model.SpeakerID]model.Speaker{}
+	cd.SpeakerRevisions = map[model.SpeakerRevisionID]model.SpeakerRevision{}
+	cd.RememberedTurns = map[model.TurnID]bool{}
 
 	err := d.H.InTx(ctx, func(ctx context.Context, tx *Tx) error {
-		if err := tx.Get(ctx, &cd.Conversation, `select * from conversations where id = ?`, id); err != nil {
+		if err := d.stmts.get(ctx, tx, &cd.Conversation, `select * from conversations where id = ? and deleted is null`, id); err != nil {
 			if errors.Is(err, sql.ErrNoRows) {
 				return model.ErrorConversationNotFound
 			}
 			return err
 		}
-		if err := tx.Select(ctx, &cd.Turns, `select * from turns where conversation_id = ? order by created`, id); err != nil {
+
+		if err := getTurns(ctx, tx, d.stmts, &cd, f); err != nil {
 			return err
 		}
-		for _, t := range cd.Turns {
-			s, ok := cd.Speakers[t.SpeakerID]
-			if ok {
-				continue
-			}
 
-			if err := tx.Get(ctx, &s, `select * from speakers where id = ?`, t.SpeakerID); err != nil {
-				return err
-			}
-			cd.Speakers[s.ID] = s
+		const tagsQuery = `
+			select t.*
+			from tags t
+			join conversation_tags ct on ct.tag_id = t.id
+			where ct.conversation_id = ?
+			order by t.name`
+		if err := d.stmts.selekt(ctx, tx, &cd.Tags, tagsQuery, id); err != nil {
+			return err
 		}
 
-		return nil
+		var rememberedTurnIDs []model.TurnID
+		const memoriesQuery = `
+			select distinct m.turn_id
+			from memories m
+			join turns t on t.id = m.turn_id
+			where t.conversation_id = ?`
+		if err := d.stmts.selekt(ctx, tx, &rememberedTurnIDs, memoriesQuery, id); err != nil {
+			return err
+		}
+		for _, turnID := range rememberedTurnIDs {
+			cd.RememberedTurns[turnID] = true
+		}
+
+		return getTurnRelations(ctx, tx, d.stmts, &cd)
 	})
+	if err != nil {
+		return cd, err
+	}
+
+	d.docs.put(id, f, cd, generation)
+	return cd, nil
+}
+
+// getTurnRelations of the turns in the conversation document, which are the models, speaker revisions, and speakers,
+// with one query for each, no matter how many turns there are.
+func getTurnRelations(ctx context.Context, tx *Tx, s *statements, cd *model.ConversationDocument) error {
+	modelIDs := map[model.ModelID]bool{}
+	speakerRevisionIDs := map[model.SpeakerRevisionID]bool{}
+	speakerIDs := map[model.SpeakerID]bool{}
+	for _, t := range cd.Turns {
+		if t.ModelID != nil {
+			modelIDs[*t.ModelID] = true
+		}
+		speakerRevisionIDs[t.SpeakerRevisionID] = true
+		speakerIDs[t.SpeakerID] = true
+	}
+
+	var models []model.Model
+	if err := selectByIDs(ctx, tx, s, &models, "models", slices.Collect(maps.Keys(modelIDs))); err != nil {
+		return err
+	}
+	for _, m := range models {
+		cd.Models[m.ID] = m
+	}
+
+	var speakerRevisions []model.SpeakerRevision
+	if err := selectByIDs(ctx, tx, s, &speakerRevisions, "speaker_revisions", slices.Collect(maps.Keys(speakerRevisionIDs))); err != nil {
+		return err
+	}
+	for _, sr := range speakerRevisions {
+		cd.SpeakerRevisions[sr.ID] = sr
+	}
+
+	var speakers []model.Speaker
+	if err := selectByIDs(ctx, tx, s, &speakers, "speakers", slices.Collect(maps.Keys(speakerIDs))); err != nil {
+		return err
+	}
+	for _, s := range speakers {
+		cd.Speakers[s.ID] = s
+	}
+
+	return nil
+}
+
+// selectByIDs from the table into dest, with the IDs passed as a JSON array so there's just one query parameter.
+func selectByIDs[T ~string](ctx context.Context, tx *Tx, s *statements, dest any, table string, ids []T) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+	return s.selekt(ctx, tx, dest, `select * from `+table+` where id in (select value from json_each(?))`, string(b))
+}
+
+// getTurns of the conversation document matching the filter, ordered by when they were created.
+// Turns created in the same millisecond, such as replies saved together with the turn they reply to,
+// are ordered by insertion through the rowid, which the cursors in the filter are compared on as well.
+func getTurns(ctx context.Context, tx *Tx, s *statements, cd *model.ConversationDocument, f model.GetTurnsFilter) error {
+	query := `
+		select t.*
+		from turns t
+		left join turns r on r.id = t.reply_to_id
+		where t.conversation_id = ? and t.deleted is null and r.deleted is null`
+	args := []any{cd.Conversation.ID}
+
+	if f.Before != "" {
+		query += ` and (t.created, t.rowid) < (select created, rowid from turns where id = ?)`
+		args = append(args, f.Before)
+	}
+	if f.Since != "" {
+		query += ` and (t.created, t.rowid) >= (select created, rowid from turns where id = ?)`
+		args = append(args, f.Since)
+	}
+
+	if f.Limit <= 0 {
+		query += ` order by t.created, t.rowid`
+		return s.selekt(ctx, tx, &cd.Turns, query, args...)
+	}
+
+	// Get the latest turns, with one more to know whether there are earlier turns
+	query += ` order by t.created desc, t.rowid desc limit ?`
+	args = append(args, f.Limit+1)
+	if err := s.selekt(ctx, tx, &cd.Turns, query, args...); err != nil {
+		return err
+	}
+	if len(cd.Turns) > f.Limit {
+		cd.Turns = cd.Turns[:f.Limit]
+		cd.EarlierTurns = true
+	}
+	slices.Reverse(cd.Turns)
+
+	if !cd.EarlierTurns {
+		return nil
+	}
+
+	// Candidates are shown after the turn they reply to, so leave them for the page with that turn
+	ids := map[model.TurnID]bool{}
+	for _, t := range cd.Turns {
+		ids[t.ID] = true
+	}
+	i := 0
+	for i < len(cd.Turns)-1 && cd.Turns[i].Candidate && cd.Turns[i].ReplyToID != nil && !ids[*cd.Turns[i].ReplyToID] {
+		i++
+	}
+	cd.Turns = cd.Turns[i:]
 
-	return cd, err
+	return nil
 }
 
-func (d *Database) GetConversations(ctx context.Context) ([]model.Conversation, error) {
+// GetConversations that aren't in the trash and match the filter, newest first.
+func (d *Database) GetConversations(ctx context.Context, f model.GetConversationsFilter) ([]model.Conversation, error) {
+	query := `select * from conversations c where deleted is null`
+	var args []any
+
+	if f.FolderID != "" {
+		query += `
+			and folder_id in (
+				with recursive subfolders (id) as (
+					select ?
+					union
+					select folders.id from folders join subfolders on folders.parent_id = subfolders.id
+				)
+				select id from subfolders
+			)`
+		args = append(args, f.FolderID)
+	}
+	if !f.From.T.IsZero() {
+		query += ` and created >= ?`
+		args = append(args, f.From)
+	}
+	if !f.To.T.IsZero() {
+		query += ` and created < ?`
+		args = append(args, f.To)
+	}
+	if f.Pinned {
+		query += ` and pinned`
+	}
+	if f.SpeakerID != "" {
+		query += ` and exists (select 1 from turns t where t.conversation_id = c.id and t.speaker_id = ? and t.deleted is null)`
+		args = append(args, f.SpeakerID)
+	}
+	if f.TagID != "" {
+		query += ` and exists (select 1 from conversation_tags ct where ct.conversation_id = c.id and ct.tag_id = ?)`
+		args = append(args, f.TagID)
+	}
+	if f.Before != "" {
+		query += ` and (created, id) < (select created, id from conversations where id = ?)`
+		args = append(args, f.Before)
+	}
+
+	query += ` order by created desc, id desc`
+
+	if f.Limit > 0 {
+		query += ` limit ?`
+		args = append(args, f.Limit)
+	}
+
 	var cs []model.Conversation
-	err := d.H.Select(ctx, &cs, "select * from conversations order by created desc")
+	err := d.H.Select(ctx, &cs, query, args...)
 	return cs, err
 }
 
+// SaveConversation via upsert.
+// If the conversation's ID is empty, a new conversation is created.
+// Otherwise, the existing conversation is updated.
+func (d *Database) SaveConversation(ctx context.Context, c model.Conversation) (model.Conversation, error) {
+	if c.ID == "" {
+		err := d.H.Get(ctx, &c, `insert into conversations (topic) values (?) returning *`, c.Topic)
+		return c, err
+	}
+
+	defer d.docs.invalidate(c.ID)
+
+	const query = `
+		insert into conversations (id, topic)
+		values (?, ?)
+		on conflict (id) do update set
+			topic = excluded.topic
+		returning *`
+	err := d.H.Get(ctx, &c, query, c.ID, c.Topic)
+	return c, err
+}
+
+// GetTurn by ID.
+func (d *Database) GetTurn(ctx context.Context, id model.TurnID) (model.Turn, error) {
+	var t model.Turn
+	err := d.H.Get(ctx, &t, "select * from turns where id = ?", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return t, model.ErrorTurnNotFound
+	}
+	return t, err
+}
+
 // SaveTurn via upsert.
 // If the turn's ID is empty, a new turn is created.
 // Otherwise, the existing turn is updated.
-// The conversation and speaker referenced by the turn must exist.
+// The conversation and speaker referenced by the turn must exist, and not be in the trash.
+// If the turn's speaker revision ID is empty, the turn keeps its existing revision,
+// or references the speaker's latest revision if it's new or the speaker changed.
+// If the turn's status is empty, it's complete.
 func (d *Database) SaveTurn(ctx context.Context, t model.Turn) (model.Turn, error) {
 	err := d.H.InTx(ctx, func(ctx context.Context, tx *Tx) error {
-		var conversationExists bool
-		if err := tx.Get(ctx, &conversationExists, `select exists (select 1 from conversations where id = ?)`, t.ConversationID); err != nil {
+		var err error
+		t, err = saveTurn(ctx, tx, t)
+		return err
+	})
+	if err == nil {
+		d.docs.invalidate(t.ConversationID)
+	}
+
+	return t, err
+}
+
+// UpdateTurnGeneration saves the result of generating the turn so far, which is the content, the reasoning, the output,
+// the model used, the status, and the error, if any. An empty status is left as it is.
+// The rest of the turn is left as it is, so it can be changed while the turn is being generated.
+// The turn is started when it's first streaming, and finished when it's complete, failed, or cancelled.
+// If the turn has been cancelled, or its conversation paused, the content is still saved,
+// but the turn stays cancelled and [model.ErrorTurnCancelled] is returned, so generation can stop.
+func (d *Database) UpdateTurnGeneration(ctx context.Context, t model.Turn) error {
+	var cancelled bool
+	var conversationID model.ConversationID
+	err := d.H.InTx(ctx, func(ctx context.Context, tx *Tx) error {
+		var current struct {
+			ConversationID model.ConversationID `db:"conversation_id"`
+			Status         model.TurnStatus
+			Paused         bool
+		}
+		const query = `
+			select t.conversation_id, t.status, c.paused
+			from turns t
+			join conversations c on c.id = t.conversation_id
+			where t.id = ?`
+		if err := tx.Get(ctx, &current, query, t.ID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return model.ErrorTurnNotFound
+			}
 			return err
 		}
-		if !conversationExists {
-			return model.ErrorConversationNotFound
+		conversationID = current.ConversationID
+
+		status := t.Status
+		switch {
+		case current.Status == model.TurnStatusCancelled || current.Paused:
+			status = model.TurnStatusCancelled
+			cancelled = true
+		case status == "":
+			status = current.Status
 		}
 
-		var speakerExists bool
-		if err := tx.Get(ctx, &speakerExists, `select exists (select 1 from speakers where id = ?)`, t.SpeakerID); err != nil {
+		return tx.Exec(ctx, `
+			update turns set
+				content = ?,
+				reasoning = ?,
+				output = ?,
+				model_id = ?,
+				status = ?,
+				error = ?,
+				started = case
+					when ? = 'pending' then null
+					when ? = 'streaming' then coalesce(started, strftime('%Y-%m-%dT%H:%M:%fZ'))
+					else started
+				end,
+				finished = case
+					when ? in ('complete', 'failed', 'cancelled') then coalesce(finished, strftime('%Y-%m-%dT%H:%M:%fZ'))
+					else null
+				end
+			where id = ?`,
+			t.Content, t.Reasoning, t.Output, t.ModelID, status, t.Error, status, status, status, t.ID)
+	})
+	if err != nil {
+		return err
+	}
+	d.docs.invalidate(conversationID)
+	if cancelled {
+		return model.ErrorTurnCancelled
+	}
+	return nil
+}
+
+// CancelTurn that is generating. The content generated so far is kept.
+// If the turn is being generated, the generation is stopped, see [Database.StartGeneration].
+// If the turn isn't generating, [model.ErrorTurnNotFound] is returned.
+func (d *Database) CancelTurn(ctx context.Context, id model.TurnID) error {
+	const query = `
+		update turns set status = 'cancelled', finished = strftime('%Y-%m-%dT%H:%M:%fZ')
+		where id = ? and status in ('pending', 'streaming')
+		returning conversation_id`
+	var conversationID model.ConversationID
+	if err := d.H.Get(ctx, &conversationID, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.ErrorTurnNotFound
+		}
+		return err
+	}
+	d.docs.invalidate(conversationID)
+	d.generations.cancel(id)
+	return nil
+}
+
+// RetryTurn that failed or was cancelled, by resetting it to pending and creating a job to generate it again.
+// If the turn didn't fail and wasn't cancelled, [model.ErrorTurnNotFound] is returned.
+// If the conversation is paused, [model.ErrorConversationPaused] is returned.
+func (d *Database) RetryTurn(ctx context.Context, id model.TurnID) error {
+	var conversationID model.ConversationID
+	err := d.H.InTx(ctx, func(ctx context.Context, tx *Tx) error {
+		var current struct {
+			ConversationID model.ConversationID `db:"conversation_id"`
+			Paused         bool
+		}
+		const query = `
+			select t.conversation_id, c.paused
+			from turns t
+			join conversations c on c.id = t.conversation_id
+			where t.id = ? and t.status in ('failed', 'cancelled')`
+		if err := tx.Get(ctx, &current, query, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return model.ErrorTurnNotFound
+			}
 			return err
 		}
-		if !speakerExists {
-			return model.ErrorSpeakerNotFound
+		if current.Paused {
+			return model.ErrorConversationPaused
 		}
+		conversationID = current.ConversationID
 
-		if t.ID == "" {
-			const query = `
-				insert into turns (conversation_id, speaker_id, content)
-				values (?, ?, ?)
-				returning *`
-			if err := tx.Get(ctx, &t, query, t.ConversationID, t.SpeakerID, t.Content); err != nil {
-				return err
+		const update = `
+			update turns set content = '', reasoning = '[]', output = '', model_id = null, status = 'pending', error = '', started = null, finished = null
+			where id = ?`
+		if err := tx.Exec(ctx, update, id); err != nil {
+			return err
+		}
+
+		return d.createGenerateTurnJob(ctx, tx, id, 0, 0)
+	})
+	if err != nil {
+		return err
+	}
+	d.docs.invalidate(conversationID)
+	return nil
+}
+
+// PauseConversation so AI speakers don't reply, or resume it.
+// Pausing cancels the turns that are generating in the conversation.
+func (d *Database) PauseConversation(ctx context.Context, id model.ConversationID, paused bool) error {
+	defer d.docs.invalidate(id)
+
+	var cancelled []model.TurnID
+	err := d.H.InTx(ctx, func(ctx context.Context, tx *Tx) error {
+		var exists bool
+		if err := tx.Get(ctx, &exists, `update conversations set paused = ? where id = ? returning true`, paused, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return model.ErrorConversationNotFound
 			}
+			return err
+		}
 
+		if !paused {
 			return nil
 		}
 
 		const query = `
-			insert into turns (id, conversation_id, speaker_id, content)
-			values (?, ?, ?, ?)
-			on conflict (id) do update set
-				conversation_id = excluded.conversation_id,
-				speaker_id = excluded.speaker_id,
-				content = excluded.content
-			returning *`
+			update turns set status = 'cancelled', finished = strftime('%Y-%m-%dT%H:%M:%fZ')
+			where conversation_id = ? and status in ('pending', 'streaming')
+			returning id`
+		return tx.Select(ctx, &cancelled, query, id)
+	})
+	if err == nil {
+		d.generations.cancel(cancelled...)
+	}
+	return err
+}
+
+// UpdateConversationSystem sets the system context that's added to the system prompt of every speaker in the conversation.
+func (d *Database) UpdateConversationSystem(ctx context.Context, id model.ConversationID, system string) error {
+	defer d.docs.invalidate(id)
+
+	var exists bool
+	if err := d.H.Get(ctx, &exists, `update conversations set system = ? where id = ? returning true`, system, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.ErrorConversationNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// UpdateConversationVariables sets the custom variables for the system prompt templates of speakers in the conversation.
+func (d *Database) UpdateConversationVariables(ctx context.Context, id model.ConversationID, vars model.Variables) error {
+	defer d.docs.invalidate(id)
+
+	var exists bool
+	if err := d.H.Get(ctx, &exists, `update conversations set variables = ? where id = ? returning true`, vars, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.ErrorConversationNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// PinTurn so it's always included in prompts, or unpin it.
+func (d *Database) PinTurn(ctx context.Context, id model.TurnID, pinned bool) error {
+	var conversationID model.ConversationID
+	if err := d.H.Get(ctx, &conversationID, `update turns set pinned = ? where id = ? returning conversation_id`, pinned, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.ErrorTurnNotFound
+		}
+		return err
+	}
+	d.docs.invalidate(conversationID)
+	return nil
+}
+
+// PinConversation so it's kept regardless of retention, or unpin it.
+func (d *Database) PinConversation(ctx context.Context, id model.ConversationID, pinned bool) error {
+	defer d.docs.invalidate(id)
+
+	var exists bool
+	if err := d.H.Get(ctx, &exists, `update conversations set pinned = ? where id = ? returning true`, pinned, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.ErrorConversationNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// SaveTurnWithReplies saves the turn like [Database.SaveTurn], and then an empty reply turn by each of the given speakers.
+// A job to generate the content of each reply is created in the same transaction.
+// If there's more than one speaker, the replies are candidates, one of which can be picked with [Database.PickCandidate].
+// If the conversation is paused, nothing is saved and [model.ErrorConversationPaused] is returned.
+// If one of the speakers is a brain speaker, nothing is saved and [model.ErrorSpeakerCannotReply] is returned.
+func (d *Database) SaveTurnWithReplies(ctx context.Context, t model.Turn, speakerIDs []model.SpeakerID) (model.Turn, []model.Turn, error) {
+	var replies []model.Turn
+	err := d.H.InTx(ctx, func(ctx context.Context, tx *Tx) error {
+		var err error
+		t, err = saveTurn(ctx, tx, t)
+		if err != nil {
+			return err
+		}
+
+		if len(speakerIDs) > 0 {
+			var paused bool
+			if err := tx.Get(ctx, &paused, `select paused from conversations where id = ?`, t.ConversationID); err != nil {
+				return err
+			}
+			if paused {
+				return model.ErrorConversationPaused
+			}
+		}
+
+		for _, speakerID := range speakerIDs {
+			// Brain speakers are people, so they can't generate a reply
+			var provider model.Provider
+			err := tx.Get(ctx, &provider, `
+				select m.provider from speakers s join models m on m.id = s.model_id
+				where s.id = ? and s.deleted is null`, speakerID)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					return model.ErrorSpeakerNotFound
+				}
+				return err
+			}
+			if provider == model.ProviderBrain {
+				return model.ErrorSpeakerCannotReply
+			}
+
+			reply, err := saveTurn(ctx, tx, model.Turn{
+				ConversationID: t.ConversationID,
+				SpeakerID:      speakerID,
+				ReplyToID:      &t.ID,
+				Candidate:      len(speakerIDs) > 1,
+				Status:         model.TurnStatusPending,
+			})
+			if err != nil {
+				return err
+			}
+			replies = append(replies, reply)
+
+			if err := d.createGenerateTurnJob(ctx, tx, reply.ID, 0, 0); err != nil {
+				return err
+			}
+		}
 
-		if err := tx.Get(ctx, &t, query, t.ID, t.ConversationID, t.SpeakerID, t.Content); err != nil {
+		return nil
+	})
+	if err == nil {
+		d.docs.invalidate(t.ConversationID)
+	}
+
+	return t, replies, err
+}
+
+// CreateGenerateTurnJob for the turn with the given ID, to be run after the given delay.
+// The attempt is how many times generation was tried before, see [model.GenerateTurnJobMessage].
+func (d *Database) CreateGenerateTurnJob(ctx context.Context, id model.TurnID, attempt int, delay time.Duration) error {
+	return d.H.InTx(ctx, func(ctx context.Context, tx *Tx) error {
+		return d.createGenerateTurnJob(ctx, tx, id, attempt, delay)
+	})
+}
+
+func (d *Database) createGenerateTurnJob(ctx context.Context, tx *Tx, id model.TurnID, attempt int, delay time.Duration) error {
+	m := model.GenerateTurnJobMessage{TurnID: id, Attempt: attempt, Trace: map[string]string{}}
+	propagation.TraceContext{}.Inject(ctx, propagation.MapCarrier(m.Trace))
+	body, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if err := jobs.CreateTx(ctx, tx.Tx.Tx, d.H.JobsQ, model.JobGenerateTurn, jobs.Message{Body: body, Delay: delay}); err != nil {
+		return errors.Wrap(err, "error creating generate turn job")
+	}
+	return nil
+}
+
+// PickCandidate turn, which makes it part of the conversation thread.
+// The other candidates replying to the same turn are left as they are, so they can still be compared.
+func (d *Database) PickCandidate(ctx context.Context, id model.TurnID) error {
+	var conversationID model.ConversationID
+	err := d.H.InTx(ctx, func(ctx context.Context, tx *Tx) error {
+		var t model.Turn
+		if err := tx.Get(ctx, &t, `select * from turns where id = ? and candidate = 1`, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return model.ErrorTurnNotFound
+			}
 			return err
 		}
 
+		if err := tx.Exec(ctx, `update turns set candidate = 0 where id = ?`, id); err != nil {
+			return err
+		}
+		conversationID = t.ConversationID
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+	d.docs.invalidate(conversationID)
+	return nil
+}
+
+func saveTurn(ctx context.Context, tx *Tx, t model.Turn) (model.Turn, error) {
+	var conversationExists bool
+	if err := tx.Get(ctx, &conversationExists, `select exists (select 1 from conversations where id = ? and deleted is null)`, t.ConversationID); err != nil {
+		return t, err
+	}
+	if !conversationExists {
+		return t, model.ErrorConversationNotFound
+	}
+
+	var speakerExists bool
+	if err := tx.Get(ctx, &speakerExists, `select exists (select 1 from speakers where id = ? and deleted is null)`, t.SpeakerID); err != nil {
+		return t, err
+	}
+	if !speakerExists {
+		return t, model.ErrorSpeakerNotFound
+	}
+
+	if t.SpeakerRevisionID == "" {
+		const query = `
+			select coalesce(
+				(select speaker_revision_id from turns where id = ? and speaker_id = ?),
+				(select id from speaker_revisions where speaker_id = ? order by revision desc limit 1)
+			)`
+		if err := tx.Get(ctx, &t.SpeakerRevisionID, query, t.ID, t.SpeakerID, t.SpeakerID); err != nil {
+			return t, err
+		}
+	}
+
+	if t.Status == "" {
+		t.Status = model.TurnStatusComplete
+	}
+
+	if t.ID == "" {
+		const query = `
+			insert into turns (conversation_id, speaker_id, speaker_revision_id, content, reply_to_id, candidate, model_id, status)
+			values (?, ?, ?, ?, ?, ?, ?, ?)
+			returning *`
+		err := tx.Get(ctx, &t, query, t.ConversationID, t.SpeakerID, t.SpeakerRevisionID, t.Content, t.ReplyToID, t.Candidate, t.ModelID, t.Status)
+		return t, err
+	}
 
+	const query = `
+		insert into turns (id, conversation_id, speaker_id, speaker_revision_id, content, reply_to_id, candidate, model_id, status)
+		values (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		on conflict (id) do update set
+			conversation_id = excluded.conversation_id,
+			speaker_id = excluded.speaker_id,
+			speaker_revision_id = excluded.speaker_revision_id,
+			content = excluded.content,
+			reply_to_id = excluded.reply_to_id,
+			candidate = excluded.candidate,
+			model_id = excluded.model_id,
+			status = excluded.status
+		returning *`
+	err := tx.Get(ctx, &t, query, t.ID, t.ConversationID, t.SpeakerID, t.SpeakerRevisionID, t.Content, t.ReplyToID, t.Candidate, t.ModelID, t.Status)
 	return t, err
 }
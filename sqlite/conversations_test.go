@@ -1,11 +1,15 @@
 package sqlite_test
 
 import (
+	"fmt"
+	"slices"
 	"testing"
+	"time"
 
 	"maragu.dev/is"
 
 	"app/model"
+	"app/sqlite"
 	"app/sqlitetest"
 )
 
@@ -40,6 +44,49 @@ func TestDatabase_SaveTurn(t *testing.T) {
 		is.True(t, !savedTurn.Updated.T.IsZero())
 	})
 
+	t.Run("should reference the speaker revision the turn was created with", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		var conversationID model.ConversationID
+		err := db.H.Get(t.Context(), &conversationID, `
+			insert into conversations (topic) values ('Test topic')
+			returning id`)
+		is.NotError(t, err)
+
+		s, err := db.SaveSpeaker(t.Context(), model.Speaker{
+			ModelID: modelGPT5,
+			Name:    "Test Speaker",
+			System:  "First system prompt",
+			Config:  `{}`,
+		})
+		is.NotError(t, err)
+
+		savedTurn, err := db.SaveTurn(t.Context(), model.Turn{
+			ConversationID: conversationID,
+			SpeakerID:      s.ID,
+			Content:        "Hello, world!",
+		})
+		is.NotError(t, err)
+
+		revisions, err := db.GetSpeakerRevisions(t.Context(), s.ID)
+		is.NotError(t, err)
+		is.Equal(t, revisions[0].ID, savedTurn.SpeakerRevisionID)
+
+		s.System = "Second system prompt"
+		_, err = db.SaveSpeaker(t.Context(), s)
+		is.NotError(t, err)
+
+		savedTurn.SpeakerRevisionID = ""
+		savedTurn.Content = "Hello again, world!"
+		updatedTurn, err := db.SaveTurn(t.Context(), savedTurn)
+		is.NotError(t, err)
+		is.Equal(t, revisions[0].ID, updatedTurn.SpeakerRevisionID)
+
+		cd, err := db.GetConversationDocument(t.Context(), conversationID)
+		is.NotError(t, err)
+		is.Equal(t, "First system prompt", cd.SpeakerRevisions[updatedTurn.SpeakerRevisionID].System)
+	})
+
 	t.Run("should upsert an existing turn successfully", func(t *testing.T) {
 		db := sqlitetest.NewDatabase(t)
 
@@ -116,3 +163,598 @@ func TestDatabase_SaveTurn(t *testing.T) {
 		is.Error(t, model.ErrorSpeakerNotFound, err)
 	})
 }
+
+func TestDatabase_SaveTurnWithReplies(t *testing.T) {
+	t.Run("should save the turn, a reply per speaker, and a job per reply", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		c, err := db.SaveConversation(t.Context(), model.Conversation{Topic: "Test topic"})
+		is.NotError(t, err)
+
+		me, err := db.GetSpeaker(t.Context(), model.GetSpeakerFilter{Name: "Me"})
+		is.NotError(t, err)
+		caretaker, err := db.GetSpeaker(t.Context(), model.GetSpeakerFilter{Name: "The Caretaker"})
+		is.NotError(t, err)
+
+		turn, replies, err := db.SaveTurnWithReplies(t.Context(), model.Turn{
+			ConversationID: c.ID,
+			SpeakerID:      me.ID,
+			Content:        "Hello!",
+		}, []model.SpeakerID{caretaker.ID})
+		is.NotError(t, err)
+		is.Equal(t, "Hello!", turn.Content)
+		is.Equal(t, 1, len(replies))
+		is.Equal(t, caretaker.ID, replies[0].SpeakerID)
+		is.Equal(t, turn.ID, *replies[0].ReplyToID)
+		is.Equal(t, "", replies[0].Content)
+		is.True(t, !replies[0].Candidate)
+
+		var jobCount int
+		err = db.H.Get(t.Context(), &jobCount, `select count(*) from goqite where queue = 'jobs'`)
+		is.NotError(t, err)
+		is.Equal(t, 1, jobCount)
+
+		cd, err := db.GetConversationDocument(t.Context(), c.ID)
+		is.NotError(t, err)
+		is.Equal(t, 2, len(cd.Turns))
+		is.Equal(t, turn.ID, cd.Turns[0].ID)
+		is.Equal(t, replies[0].ID, cd.Turns[1].ID)
+	})
+
+	t.Run("should not save anything when a reply speaker is a brain speaker", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		c, err := db.SaveConversation(t.Context(), model.Conversation{})
+		is.NotError(t, err)
+
+		me, err := db.GetSpeaker(t.Context(), model.GetSpeakerFilter{Name: "Me"})
+		is.NotError(t, err)
+
+		_, _, err = db.SaveTurnWithReplies(t.Context(), model.Turn{
+			ConversationID: c.ID,
+			SpeakerID:      me.ID,
+			Content:        "Hello!",
+		}, []model.SpeakerID{me.ID})
+		is.Error(t, model.ErrorSpeakerCannotReply, err)
+
+		cd, err := db.GetConversationDocument(t.Context(), c.ID)
+		is.NotError(t, err)
+		is.Equal(t, 0, len(cd.Turns))
+	})
+
+	t.Run("should save replies as candidates when there is more than one speaker", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		c, err := db.SaveConversation(t.Context(), model.Conversation{})
+		is.NotError(t, err)
+
+		me, err := db.GetSpeaker(t.Context(), model.GetSpeakerFilter{Name: "Me"})
+		is.NotError(t, err)
+		caretaker, err := db.GetSpeaker(t.Context(), model.GetSpeakerFilter{Name: "The Caretaker"})
+		is.NotError(t, err)
+		other, err := db.SaveSpeaker(t.Context(), model.Speaker{ModelID: modelGPT5, Name: "Other", Config: `{}`})
+		is.NotError(t, err)
+
+		_, replies, err := db.SaveTurnWithReplies(t.Context(), model.Turn{
+			ConversationID: c.ID,
+			SpeakerID:      me.ID,
+			Content:        "Hello!",
+		}, []model.SpeakerID{caretaker.ID, other.ID})
+		is.NotError(t, err)
+		is.Equal(t, 2, len(replies))
+		is.True(t, replies[0].Candidate)
+		is.True(t, replies[1].Candidate)
+
+		err = db.PickCandidate(t.Context(), replies[1].ID)
+		is.NotError(t, err)
+
+		picked, err := db.GetTurn(t.Context(), replies[1].ID)
+		is.NotError(t, err)
+		is.True(t, !picked.Candidate)
+
+		notPicked, err := db.GetTurn(t.Context(), replies[0].ID)
+		is.NotError(t, err)
+		is.True(t, notPicked.Candidate)
+
+		err = db.PickCandidate(t.Context(), replies[1].ID)
+		is.Error(t, model.ErrorTurnNotFound, err)
+	})
+
+	t.Run("should not save anything when a speaker does not exist", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		c, err := db.SaveConversation(t.Context(), model.Conversation{})
+		is.NotError(t, err)
+
+		me, err := db.GetSpeaker(t.Context(), model.GetSpeakerFilter{Name: "Me"})
+		is.NotError(t, err)
+
+		_, _, err = db.SaveTurnWithReplies(t.Context(), model.Turn{
+			ConversationID: c.ID,
+			SpeakerID:      me.ID,
+			Content:        "Hello!",
+		}, []model.SpeakerID{"sp_nonexistent"})
+		is.Error(t, model.ErrorSpeakerNotFound, err)
+
+		cd, err := db.GetConversationDocument(t.Context(), c.ID)
+		is.NotError(t, err)
+		is.Equal(t, 0, len(cd.Turns))
+	})
+}
+
+func TestDatabase_UpdateTurnGeneration(t *testing.T) {
+	t.Run("should update only the content and model", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		c, err := db.SaveConversation(t.Context(), model.Conversation{})
+		is.NotError(t, err)
+
+		me, err := db.GetSpeaker(t.Context(), model.GetSpeakerFilter{Name: "Me"})
+		is.NotError(t, err)
+
+		turn, err := db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: me.ID, Content: "Hel", Candidate: true})
+		is.NotError(t, err)
+
+		modelID := modelGemini
+		err = db.UpdateTurnGeneration(t.Context(), model.Turn{ID: turn.ID, Content: "Hello!", ModelID: &modelID})
+		is.NotError(t, err)
+
+		updatedTurn, err := db.GetTurn(t.Context(), turn.ID)
+		is.NotError(t, err)
+		is.Equal(t, "Hello!", updatedTurn.Content)
+		is.Equal(t, modelGemini, *updatedTurn.ModelID)
+		is.Equal(t, turn.SpeakerRevisionID, updatedTurn.SpeakerRevisionID)
+		is.True(t, updatedTurn.Candidate)
+
+		cd, err := db.GetConversationDocument(t.Context(), c.ID)
+		is.NotError(t, err)
+		is.Equal(t, "models/gemini-2.5-pro", cd.Models[modelGemini].Name)
+	})
+
+	t.Run("should save the content but return ErrorTurnCancelled when the turn is cancelled", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		c := sqlitetest.NewConversation(t, db, "")
+		parrot := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+
+		turn, err := db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: parrot.ID, Status: model.TurnStatusPending})
+		is.NotError(t, err)
+
+		err = db.CancelTurn(t.Context(), turn.ID)
+		is.NotError(t, err)
+
+		turn.Content = "Squ"
+		turn.Status = model.TurnStatusComplete
+		err = db.UpdateTurnGeneration(t.Context(), turn)
+		is.Error(t, model.ErrorTurnCancelled, err)
+
+		turn, err = db.GetTurn(t.Context(), turn.ID)
+		is.NotError(t, err)
+		is.Equal(t, "Squ", turn.Content)
+		is.Equal(t, model.TurnStatusCancelled, turn.Status)
+	})
+
+	t.Run("should return ErrorTurnNotFound when the turn does not exist", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		err := db.UpdateTurnGeneration(t.Context(), model.Turn{ID: "tu_nonexistent", Content: "Hello!"})
+		is.Error(t, model.ErrorTurnNotFound, err)
+	})
+}
+
+func TestDatabase_CancelTurn(t *testing.T) {
+	t.Run("should return ErrorTurnNotFound when the turn is not generating", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		c := sqlitetest.NewConversation(t, db, "")
+		me, err := db.GetSpeaker(t.Context(), model.GetSpeakerFilter{Name: "Me"})
+		is.NotError(t, err)
+
+		turn, err := db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: me.ID, Content: "Hi"})
+		is.NotError(t, err)
+		is.Equal(t, model.TurnStatusComplete, turn.Status)
+
+		err = db.CancelTurn(t.Context(), turn.ID)
+		is.Error(t, model.ErrorTurnNotFound, err)
+	})
+}
+
+func TestDatabase_RetryTurn(t *testing.T) {
+	t.Run("should reset a failed turn to pending and create a job to generate it", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		c := sqlitetest.NewConversation(t, db, "")
+		parrot := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+
+		turn, err := db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: parrot.ID, Status: model.TurnStatusPending})
+		is.NotError(t, err)
+
+		err = db.RetryTurn(t.Context(), turn.ID)
+		is.Error(t, model.ErrorTurnNotFound, err)
+
+		turn.Content = "Squ"
+		turn.Status = model.TurnStatusFailed
+		turn.Error = "oh no"
+		err = db.UpdateTurnGeneration(t.Context(), turn)
+		is.NotError(t, err)
+
+		err = db.RetryTurn(t.Context(), turn.ID)
+		is.NotError(t, err)
+
+		turn, err = db.GetTurn(t.Context(), turn.ID)
+		is.NotError(t, err)
+		is.Equal(t, model.TurnStatusPending, turn.Status)
+		is.Equal(t, "", turn.Content)
+		is.Equal(t, "", turn.Error)
+		is.True(t, turn.Finished.T.IsZero())
+
+		var jobCount int
+		err = db.H.Get(t.Context(), &jobCount, `select count(*) from goqite where queue = 'jobs'`)
+		is.NotError(t, err)
+		is.Equal(t, 1, jobCount)
+	})
+}
+
+func TestDatabase_PauseConversation(t *testing.T) {
+	t.Run("should cancel generating turns and refuse new replies until resumed", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		c := sqlitetest.NewConversation(t, db, "")
+		me, err := db.GetSpeaker(t.Context(), model.GetSpeakerFilter{Name: "Me"})
+		is.NotError(t, err)
+		parrot := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+
+		_, replies, err := db.SaveTurnWithReplies(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: me.ID, Content: "Hi"}, []model.SpeakerID{parrot.ID})
+		is.NotError(t, err)
+		is.Equal(t, model.TurnStatusPending, replies[0].Status)
+
+		err = db.PauseConversation(t.Context(), c.ID, true)
+		is.NotError(t, err)
+
+		reply, err := db.GetTurn(t.Context(), replies[0].ID)
+		is.NotError(t, err)
+		is.Equal(t, model.TurnStatusCancelled, reply.Status)
+
+		_, _, err = db.SaveTurnWithReplies(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: me.ID, Content: "Hello?"}, []model.SpeakerID{parrot.ID})
+		is.Error(t, model.ErrorConversationPaused, err)
+
+		err = db.PauseConversation(t.Context(), c.ID, false)
+		is.NotError(t, err)
+
+		_, _, err = db.SaveTurnWithReplies(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: me.ID, Content: "Hello?"}, []model.SpeakerID{parrot.ID})
+		is.NotError(t, err)
+	})
+
+	t.Run("should return ErrorConversationNotFound when the conversation does not exist", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		err := db.PauseConversation(t.Context(), "co_nonexistent", true)
+		is.Error(t, model.ErrorConversationNotFound, err)
+	})
+}
+
+func TestDatabase_UpdateConversationSystem(t *testing.T) {
+	t.Run("should set the system context of the conversation", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		c := sqlitetest.NewConversation(t, db, "Birds")
+
+		err := db.UpdateConversationSystem(t.Context(), c.ID, "We're all birds here.")
+		is.NotError(t, err)
+
+		cd, err := db.GetConversationDocument(t.Context(), c.ID)
+		is.NotError(t, err)
+		is.Equal(t, "We're all birds here.", cd.Conversation.System)
+		is.Equal(t, "Birds", cd.Conversation.Topic)
+	})
+
+	t.Run("should return ErrorConversationNotFound when the conversation does not exist", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		err := db.UpdateConversationSystem(t.Context(), "co_nonexistent", "")
+		is.Error(t, model.ErrorConversationNotFound, err)
+	})
+}
+
+func TestDatabase_UpdateConversationVariables(t *testing.T) {
+	t.Run("should set the variables of the conversation", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		c := sqlitetest.NewConversation(t, db, "Birds")
+
+		cd, err := db.GetConversationDocument(t.Context(), c.ID)
+		is.NotError(t, err)
+		is.Equal(t, 0, len(cd.Conversation.Variables))
+
+		err = db.UpdateConversationVariables(t.Context(), c.ID, model.Variables{"bird": "crow"})
+		is.NotError(t, err)
+
+		cd, err = db.GetConversationDocument(t.Context(), c.ID)
+		is.NotError(t, err)
+		is.Equal(t, "crow", cd.Conversation.Variables["bird"])
+
+		err = db.UpdateConversationVariables(t.Context(), c.ID, nil)
+		is.NotError(t, err)
+
+		cd, err = db.GetConversationDocument(t.Context(), c.ID)
+		is.NotError(t, err)
+		is.Equal(t, 0, len(cd.Conversation.Variables))
+	})
+
+	t.Run("should return ErrorConversationNotFound when the conversation does not exist", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		err := db.UpdateConversationVariables(t.Context(), "co_nonexistent", nil)
+		is.Error(t, model.ErrorConversationNotFound, err)
+	})
+}
+
+func TestDatabase_PinTurn(t *testing.T) {
+	t.Run("should pin and unpin the turn", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		speaker := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+		c := sqlitetest.NewConversation(t, db, "Birds")
+		turn, err := db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: speaker.ID, Content: "Squawk!"})
+		is.NotError(t, err)
+		is.True(t, !turn.Pinned)
+
+		err = db.PinTurn(t.Context(), turn.ID, true)
+		is.NotError(t, err)
+		turn, err = db.GetTurn(t.Context(), turn.ID)
+		is.NotError(t, err)
+		is.True(t, turn.Pinned)
+
+		err = db.PinTurn(t.Context(), turn.ID, false)
+		is.NotError(t, err)
+		turn, err = db.GetTurn(t.Context(), turn.ID)
+		is.NotError(t, err)
+		is.True(t, !turn.Pinned)
+	})
+
+	t.Run("should return ErrorTurnNotFound when the turn does not exist", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		err := db.PinTurn(t.Context(), "tu_nonexistent", true)
+		is.Error(t, model.ErrorTurnNotFound, err)
+	})
+}
+
+func TestDatabase_GetConversations(t *testing.T) {
+	t.Run("should filter conversations", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		parrot := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+
+		work, err := db.SaveFolder(t.Context(), model.Folder{Name: "Work"})
+		is.NotError(t, err)
+		project, err := db.SaveFolder(t.Context(), model.Folder{Name: "Project", ParentID: &work.ID})
+		is.NotError(t, err)
+
+		old := sqlitetest.NewConversation(t, db, "Old")
+		_, err = db.H.DB.ExecContext(t.Context(), `update conversations set created = '2020-01-01T00:00:00.000Z' where id = ?`, old.ID)
+		is.NotError(t, err)
+
+		nested := sqlitetest.NewConversation(t, db, "Nested")
+		is.NotError(t, db.MoveConversation(t.Context(), nested.ID, &project.ID))
+
+		pinned := sqlitetest.NewConversation(t, db, "Pinned")
+		is.NotError(t, db.PinConversation(t.Context(), pinned.ID, true))
+
+		tagged := sqlitetest.NewConversation(t, db, "Tagged")
+		tag, err := db.TagConversation(t.Context(), tagged.ID, "birds")
+		is.NotError(t, err)
+
+		spoken := sqlitetest.NewConversation(t, db, "Spoken")
+		_, err = db.SaveTurn(t.Context(), model.Turn{ConversationID: spoken.ID, SpeakerID: parrot.ID, Content: "Squawk!"})
+		is.NotError(t, err)
+
+		// Conversations created in the same millisecond are ordered by ID, so spread them out
+		for i, c := range []model.Conversation{nested, pinned, tagged, spoken} {
+			_, err = db.H.DB.ExecContext(t.Context(), `update conversations set created = ? where id = ?`,
+				fmt.Sprintf("2025-01-01T00:00:0%d.000Z", i), c.ID)
+			is.NotError(t, err)
+		}
+
+		tests := []struct {
+			name     string
+			filter   model.GetConversationsFilter
+			expected []model.ConversationID
+		}{
+			{"all, newest first", model.GetConversationsFilter{}, []model.ConversationID{spoken.ID, tagged.ID, pinned.ID, nested.ID, old.ID}},
+			{"folder including subfolders", model.GetConversationsFilter{FolderID: work.ID}, []model.ConversationID{nested.ID}},
+			{"date range", model.GetConversationsFilter{From: model.Time{T: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)},
+				To: model.Time{T: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}}, []model.ConversationID{old.ID}},
+			{"pinned", model.GetConversationsFilter{Pinned: true}, []model.ConversationID{pinned.ID}},
+			{"speaker", model.GetConversationsFilter{SpeakerID: parrot.ID}, []model.ConversationID{spoken.ID}},
+			{"tag", model.GetConversationsFilter{TagID: tag.ID}, []model.ConversationID{tagged.ID}},
+		}
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				cs, err := db.GetConversations(t.Context(), test.filter)
+				is.NotError(t, err)
+
+				var ids []model.ConversationID
+				for _, c := range cs {
+					ids = append(ids, c.ID)
+				}
+				is.EqualSlice(t, test.expected, ids)
+			})
+		}
+	})
+
+	t.Run("should page through conversations created in the same millisecond", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		var expected []model.ConversationID
+		for range 5 {
+			expected = append(expected, sqlitetest.NewConversation(t, db, "Birds").ID)
+		}
+		_, err := db.H.DB.ExecContext(t.Context(), `update conversations set created = '2025-01-01T00:00:00.000Z'`)
+		is.NotError(t, err)
+		slices.Sort(expected)
+		slices.Reverse(expected)
+
+		var ids []model.ConversationID
+		f := model.GetConversationsFilter{Limit: 2}
+		for {
+			cs, err := db.GetConversations(t.Context(), f)
+			is.NotError(t, err)
+			if len(cs) == 0 {
+				break
+			}
+			is.True(t, len(cs) <= 2)
+			for _, c := range cs {
+				ids = append(ids, c.ID)
+			}
+			f.Before = cs[len(cs)-1].ID
+		}
+		is.EqualSlice(t, expected, ids)
+	})
+}
+
+func TestDatabase_GetConversationDocumentPage(t *testing.T) {
+	t.Run("should page through turns from the latest", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		speaker := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+		c := sqlitetest.NewConversation(t, db, "Birds")
+
+		var turns []model.Turn
+		for i := range 5 {
+			turn, err := db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: speaker.ID, Content: fmt.Sprint(i)})
+			is.NotError(t, err)
+			turns = append(turns, turn)
+		}
+
+		cd, err := db.GetConversationDocumentPage(t.Context(), c.ID, model.GetTurnsFilter{Limit: 2})
+		is.NotError(t, err)
+		is.Equal(t, 2, len(cd.Turns))
+		is.Equal(t, "3", cd.Turns[0].Content)
+		is.Equal(t, "4", cd.Turns[1].Content)
+		is.True(t, cd.EarlierTurns)
+
+		cd, err = db.GetConversationDocumentPage(t.Context(), c.ID, model.GetTurnsFilter{Before: cd.Turns[0].ID, Limit: 2})
+		is.NotError(t, err)
+		is.Equal(t, 2, len(cd.Turns))
+		is.Equal(t, "1", cd.Turns[0].Content)
+		is.True(t, cd.EarlierTurns)
+
+		cd, err = db.GetConversationDocumentPage(t.Context(), c.ID, model.GetTurnsFilter{Before: cd.Turns[0].ID, Limit: 2})
+		is.NotError(t, err)
+		is.Equal(t, 1, len(cd.Turns))
+		is.Equal(t, "0", cd.Turns[0].Content)
+		is.True(t, !cd.EarlierTurns)
+
+		cd, err = db.GetConversationDocumentPage(t.Context(), c.ID, model.GetTurnsFilter{Since: turns[3].ID})
+		is.NotError(t, err)
+		is.Equal(t, 2, len(cd.Turns))
+		is.Equal(t, "3", cd.Turns[0].Content)
+	})
+
+	t.Run("should leave candidates for the page with the turn they reply to", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		me := sqlitetest.NewFakeSpeaker(t, db, "Human", "")
+		parrot := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+		crow := sqlitetest.NewFakeSpeaker(t, db, "Crow", "")
+		c := sqlitetest.NewConversation(t, db, "Birds")
+
+		_, err := db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: me.ID, Content: "Hi"})
+		is.NotError(t, err)
+		turn, replies, err := db.SaveTurnWithReplies(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: me.ID, Content: "Polly?"},
+			[]model.SpeakerID{parrot.ID, crow.ID})
+		is.NotError(t, err)
+		last, err := db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: me.ID, Content: "Well?"})
+		is.NotError(t, err)
+
+		cd, err := db.GetConversationDocumentPage(t.Context(), c.ID, model.GetTurnsFilter{Limit: 3})
+		is.NotError(t, err)
+		is.Equal(t, 1, len(cd.Turns))
+		is.Equal(t, last.ID, cd.Turns[0].ID)
+
+		cd, err = db.GetConversationDocumentPage(t.Context(), c.ID, model.GetTurnsFilter{Before: last.ID, Limit: 3})
+		is.NotError(t, err)
+		is.Equal(t, 3, len(cd.Turns))
+		is.Equal(t, turn.ID, cd.Turns[0].ID)
+		is.Equal(t, replies[0].ID, cd.Turns[1].ID)
+		is.Equal(t, replies[1].ID, cd.Turns[2].ID)
+		is.True(t, cd.EarlierTurns)
+	})
+}
+
+func BenchmarkDatabase_GetConversationDocument(b *testing.B) {
+	for _, turns := range []int{1000, 5000} {
+		b.Run(fmt.Sprintf("%d turns uncached", turns), func(b *testing.B) {
+			db := sqlitetest.NewDatabase(b)
+			c := newConversationWithTurns(b, db, turns, 20)
+
+			for b.Loop() {
+				_, err := db.GetConversationDocument(b.Context(), c.ID)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("%d turns cached", turns), func(b *testing.B) {
+			db := sqlitetest.NewDatabase(b)
+			c := newConversationWithTurns(b, db, turns, 20)
+			db = sqlite.NewDatabase(sqlite.NewDatabaseOptions{H: db.H, DocumentCacheSize: 10})
+
+			for b.Loop() {
+				_, err := db.GetConversationDocument(b.Context(), c.ID)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		// Like polling a conversation while a turn streams into another one, which shouldn't defeat the cache
+		b.Run(fmt.Sprintf("%d turns cached while another conversation streams", turns), func(b *testing.B) {
+			db := sqlitetest.NewDatabase(b)
+			c := newConversationWithTurns(b, db, turns, 20)
+			db = sqlite.NewDatabase(sqlite.NewDatabaseOptions{H: db.H, DocumentCacheSize: 10})
+
+			other := sqlitetest.NewConversation(b, db, "Bees")
+			speaker := sqlitetest.NewFakeSpeaker(b, db, "Bee", "")
+			turn, err := db.SaveTurn(b.Context(), model.Turn{ConversationID: other.ID, SpeakerID: speaker.ID, Status: model.TurnStatusStreaming})
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			for b.Loop() {
+				b.StopTimer()
+				turn.Content += "Buzz! "
+				if err := db.UpdateTurnGeneration(b.Context(), turn); err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+
+				if _, err := db.GetConversationDocument(b.Context(), c.ID); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// newConversationWithTurns by the given number of speakers taking turns, each with their own model.
+func newConversationWithTurns(tb testing.TB, db *sqlite.Database, turns, speakers int) model.Conversation {
+	tb.Helper()
+
+	c := sqlitetest.NewConversation(tb, db, "Birds")
+
+	var ss []model.Speaker
+	for i := range speakers {
+		ss = append(ss, sqlitetest.NewFakeSpeaker(tb, db, fmt.Sprintf("Bird %d", i), ""))
+	}
+
+	for i := range turns {
+		s := ss[i%len(ss)]
+		_, err := db.H.DB.ExecContext(tb.Context(), `
+			insert into turns (conversation_id, speaker_id, speaker_revision_id, model_id, content)
+			values (?, ?, (select id from speaker_revisions where speaker_id = ?), ?, 'Squawk!')`,
+			c.ID, s.ID, s.ID, s.ModelID)
+		if err != nil {
+			tb.Fatal(err)
+		}
+	}
+
+	return c
+}
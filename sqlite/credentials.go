@@ -0,0 +1,98 @@
+package sqlite
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+
+	"maragu.dev/errors"
+
+	"app/model"
+)
+
+// GetCredentials by name, without their values.
+func (d *Database) GetCredentials(ctx context.Context) ([]model.Credential, error) {
+	var cs []model.Credential
+	err := d.H.Select(ctx, &cs, `select name, created, updated from credentials order by name`)
+	return cs, err
+}
+
+// GetCredential value by name, decrypted.
+// If the credential doesn't exist, [model.ErrorCredentialNotFound] is returned.
+func (d *Database) GetCredential(ctx context.Context, name string) (model.Secret, error) {
+	var value []byte
+	if err := d.H.Get(ctx, &value, `select value from credentials where name = ?`, name); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", model.ErrorCredentialNotFound
+		}
+		return "", err
+	}
+
+	gcm, err := d.credentialsCipher()
+	if err != nil {
+		return "", err
+	}
+
+	if len(value) < gcm.NonceSize() {
+		return "", errors.New("credential value too short")
+	}
+	nonce, ciphertext := value[:gcm.NonceSize()], value[gcm.NonceSize():]
+	// The name is authenticated with the value, so values can't be swapped between credentials
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil {
+		return "", errors.Wrap(err, "error decrypting credential")
+	}
+	return model.Secret(plaintext), nil
+}
+
+// SaveCredential by name, encrypting the value, and replacing the value if the credential exists.
+// If the name isn't valid, [model.ErrorCredentialNameInvalid] is returned.
+// If there's no key to encrypt with, [model.ErrorCredentialsKeyMissing] is returned.
+func (d *Database) SaveCredential(ctx context.Context, name string, value model.Secret) error {
+	if !model.ValidCredentialName(name) {
+		return model.ErrorCredentialNameInvalid
+	}
+
+	gcm, err := d.credentialsCipher()
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, _ = rand.Read(nonce)
+	encrypted := gcm.Seal(nonce, nonce, []byte(value), []byte(name))
+
+	const query = `
+		insert into credentials (name, value) values (?, ?)
+		on conflict (name) do update set value = excluded.value`
+	return d.H.Exec(ctx, query, name, encrypted)
+}
+
+// DeleteCredential by name.
+// If the credential doesn't exist, [model.ErrorCredentialNotFound] is returned.
+func (d *Database) DeleteCredential(ctx context.Context, name string) error {
+	var exists bool
+	if err := d.H.Get(ctx, &exists, `delete from credentials where name = ? returning true`, name); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.ErrorCredentialNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// credentialsCipher is AES-GCM with the credentials key,
+// or [model.ErrorCredentialsKeyMissing] if there's no key.
+func (d *Database) credentialsCipher() (cipher.AEAD, error) {
+	if len(d.credentialsKey) == 0 {
+		return nil, model.ErrorCredentialsKeyMissing
+	}
+
+	block, err := aes.NewCipher(d.credentialsKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating credentials cipher")
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,91 @@
+package sqlite_test
+
+import (
+	"bytes"
+	"testing"
+
+	"maragu.dev/is"
+
+	"app/model"
+	"app/sqlite"
+	"app/sqlitetest"
+)
+
+func TestDatabase_SaveCredential(t *testing.T) {
+	t.Run("should save the credential encrypted, and get it decrypted", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		err := db.SaveCredential(t.Context(), "openai-org-b", "sk-secret")
+		is.NotError(t, err)
+
+		var stored []byte
+		err = db.H.Get(t.Context(), &stored, `select value from credentials where name = 'openai-org-b'`)
+		is.NotError(t, err)
+		is.True(t, !bytes.Contains(stored, []byte("sk-secret")))
+
+		value, err := db.GetCredential(t.Context(), "openai-org-b")
+		is.NotError(t, err)
+		is.Equal(t, "sk-secret", string(value))
+
+		err = db.SaveCredential(t.Context(), "openai-org-b", "sk-other")
+		is.NotError(t, err)
+		value, err = db.GetCredential(t.Context(), "openai-org-b")
+		is.NotError(t, err)
+		is.Equal(t, "sk-other", string(value))
+
+		cs, err := db.GetCredentials(t.Context())
+		is.NotError(t, err)
+		is.Equal(t, 1, len(cs))
+		is.Equal(t, "openai-org-b", cs[0].Name)
+	})
+
+	t.Run("should not decrypt a value moved to another credential", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		err := db.SaveCredential(t.Context(), "a", "sk-a")
+		is.NotError(t, err)
+		err = db.SaveCredential(t.Context(), "b", "sk-b")
+		is.NotError(t, err)
+		err = db.H.Exec(t.Context(), `update credentials set value = (select value from credentials where name = 'a') where name = 'b'`)
+		is.NotError(t, err)
+
+		_, err = db.GetCredential(t.Context(), "b")
+		is.True(t, err != nil)
+	})
+
+	t.Run("should return ErrorCredentialNameInvalid when the name isn't valid", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		err := db.SaveCredential(t.Context(), "../etc/passwd", "nope")
+		is.Error(t, model.ErrorCredentialNameInvalid, err)
+	})
+
+	t.Run("should return ErrorCredentialsKeyMissing when there's no key", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		db = sqlite.NewDatabase(sqlite.NewDatabaseOptions{H: db.H})
+
+		err := db.SaveCredential(t.Context(), "openai", "sk-secret")
+		is.Error(t, model.ErrorCredentialsKeyMissing, err)
+	})
+}
+
+func TestDatabase_DeleteCredential(t *testing.T) {
+	t.Run("should delete the credential", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		err := db.SaveCredential(t.Context(), "openai", "sk-secret")
+		is.NotError(t, err)
+
+		err = db.DeleteCredential(t.Context(), "openai")
+		is.NotError(t, err)
+
+		_, err = db.GetCredential(t.Context(), "openai")
+		is.Error(t, model.ErrorCredentialNotFound, err)
+	})
+
+	t.Run("should return ErrorCredentialNotFound when the credential does not exist", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		err := db.DeleteCredential(t.Context(), "nope")
+		is.Error(t, model.ErrorCredentialNotFound, err)
+	})
+}
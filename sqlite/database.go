@@ -4,20 +4,34 @@ package sqlite
 
 import (
 	"context"
+	"io/fs"
 	"log/slog"
+	"os"
+	"regexp"
 
 	_ "github.com/mattn/go-sqlite3"
+	"maragu.dev/errors"
 	"maragu.dev/glue/sql"
 )
 
 type Database struct {
-	H   *sql.Helper
-	log *slog.Logger
+	H              *sql.Helper
+	credentialsKey []byte
+	docs           *documentCache
+	generations    *generations
+	log            *slog.Logger
+	stmts          *statements
 }
 
 type NewDatabaseOptions struct {
-	H   *sql.Helper
-	Log *slog.Logger
+	// CredentialsKey encrypts credentials at rest, and must be 32 bytes for AES-256.
+	// Without it, credentials can't be stored in the database.
+	CredentialsKey []byte
+	// DocumentCacheSize is how many conversation documents are cached in memory. Zero means no caching.
+	// Only enable the cache if nothing else changes the database, since it's invalidated by the methods on [Database].
+	DocumentCacheSize int
+	H                 *sql.Helper
+	Log               *slog.Logger
 }
 
 // NewDatabase with the given options.
@@ -28,8 +42,12 @@ func NewDatabase(opts NewDatabaseOptions) *Database {
 	}
 
 	return &Database{
-		H:   opts.H,
-		log: opts.Log,
+		H:              opts.H,
+		credentialsKey: opts.CredentialsKey,
+		docs:           newDocumentCache(opts.DocumentCacheSize),
+		generations:    newGenerations(),
+		log:            opts.Log,
+		stmts:          newStatements(opts.H),
 	}
 }
 
@@ -37,4 +55,37 @@ func (d *Database) Ping(ctx context.Context) error {
 	return d.H.Ping(ctx)
 }
 
+// migrationsDirs are where the migrations are found at runtime, like [sql.Helper.MigrateUp] looks for them.
+var migrationsDirs = []string{"sqlite/migrations", "../sqlite/migrations"}
+
+var upMigrationMatcher = regexp.MustCompile(`^([\w-]+)\.up\.sql$`)
+
+// CheckMigrations are at the latest version, returning an error if not.
+func (d *Database) CheckMigrations(ctx context.Context) error {
+	var latest string
+	for _, dir := range migrationsDirs {
+		names, err := fs.Glob(os.DirFS(dir), "*.up.sql")
+		if err != nil || len(names) == 0 {
+			continue
+		}
+		for _, name := range names {
+			latest = max(latest, upMigrationMatcher.ReplaceAllString(name, "$1"))
+		}
+		break
+	}
+	if latest == "" {
+		return errors.New("no migrations found")
+	}
+
+	var current string
+	if err := d.H.Get(ctx, &current, `select version from migrations`); err != nil {
+		return errors.Wrap(err, "error getting migration version")
+	}
+
+	if current != latest {
+		return errors.Newf("migrations at version %v, latest is %v", current, latest)
+	}
+	return nil
+}
+
 type Tx = sql.Tx
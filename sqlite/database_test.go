@@ -0,0 +1,28 @@
+package sqlite_test
+
+import (
+	"testing"
+
+	"maragu.dev/is"
+
+	"app/sqlitetest"
+)
+
+func TestDatabase_CheckMigrations(t *testing.T) {
+	t.Run("should pass when migrations are at the latest version", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		err := db.CheckMigrations(t.Context())
+		is.NotError(t, err)
+	})
+
+	t.Run("should fail when migrations are behind", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		_, err := db.H.DB.ExecContext(t.Context(), `update migrations set version = '1757000000-old'`)
+		is.NotError(t, err)
+
+		err = db.CheckMigrations(t.Context())
+		is.True(t, err != nil)
+	})
+}
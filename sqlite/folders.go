@@ -0,0 +1,111 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+
+	"maragu.dev/errors"
+
+	"app/model"
+)
+
+// GetFolders by name. Nesting is given by each folder's parent ID.
+func (d *Database) GetFolders(ctx context.Context) ([]model.Folder, error) {
+	var fs []model.Folder
+	err := d.H.Select(ctx, &fs, `select * from folders order by name`)
+	return fs, err
+}
+
+// SaveFolder via upsert.
+// If the folder's ID is empty, a new folder is created.
+// Otherwise, the existing folder is updated, which moves it if the parent changed.
+// The parent, if any, must exist, or [model.ErrorFolderNotFound] is returned.
+// If the parent is the folder itself or nested inside it, [model.ErrorFolderCycle] is returned.
+func (d *Database) SaveFolder(ctx context.Context, f model.Folder) (model.Folder, error) {
+	err := d.H.InTx(ctx, func(ctx context.Context, tx *Tx) error {
+		if f.ParentID != nil {
+			var parentExists bool
+			if err := tx.Get(ctx, &parentExists, `select exists (select 1 from folders where id = ?)`, *f.ParentID); err != nil {
+				return err
+			}
+			if !parentExists {
+				return model.ErrorFolderNotFound
+			}
+		}
+
+		if f.ID == "" {
+			return tx.Get(ctx, &f, `insert into folders (parent_id, name) values (?, ?) returning *`, f.ParentID, f.Name)
+		}
+
+		if f.ParentID != nil {
+			const query = `
+				with recursive ancestors (id) as (
+					select ?
+					union
+					select folders.parent_id from folders join ancestors on folders.id = ancestors.id
+					where folders.parent_id is not null
+				)
+				select exists (select 1 from ancestors where id = ?)`
+			var cycle bool
+			if err := tx.Get(ctx, &cycle, query, *f.ParentID, f.ID); err != nil {
+				return err
+			}
+			if cycle {
+				return model.ErrorFolderCycle
+			}
+		}
+
+		const query = `
+			insert into folders (id, parent_id, name)
+			values (?, ?, ?)
+			on conflict (id) do update set
+				parent_id = excluded.parent_id,
+				name = excluded.name
+			returning *`
+		return tx.Get(ctx, &f, query, f.ID, f.ParentID, f.Name)
+	})
+	return f, err
+}
+
+// DeleteFolder by ID, together with the folders nested inside it.
+// Conversations in the deleted folders are kept, but aren't in a folder anymore.
+// If the folder doesn't exist, [model.ErrorFolderNotFound] is returned.
+func (d *Database) DeleteFolder(ctx context.Context, id model.FolderID) error {
+	defer d.docs.invalidateAll()
+
+	var exists bool
+	if err := d.H.Get(ctx, &exists, `delete from folders where id = ? returning true`, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.ErrorFolderNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// MoveConversation into the folder with the given ID, or out of any folder if the ID is nil.
+// If the folder doesn't exist, [model.ErrorFolderNotFound] is returned.
+func (d *Database) MoveConversation(ctx context.Context, id model.ConversationID, folderID *model.FolderID) error {
+	defer d.docs.invalidate(id)
+
+	return d.H.InTx(ctx, func(ctx context.Context, tx *Tx) error {
+		if folderID != nil {
+			var folderExists bool
+			if err := tx.Get(ctx, &folderExists, `select exists (select 1 from folders where id = ?)`, *folderID); err != nil {
+				return err
+			}
+			if !folderExists {
+				return model.ErrorFolderNotFound
+			}
+		}
+
+		var exists bool
+		if err := tx.Get(ctx, &exists, `update conversations set folder_id = ? where id = ? returning true`, folderID, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return model.ErrorConversationNotFound
+			}
+			return err
+		}
+		return nil
+	})
+}
@@ -0,0 +1,113 @@
+package sqlite_test
+
+import (
+	"testing"
+
+	"maragu.dev/is"
+
+	"app/model"
+	"app/sqlitetest"
+)
+
+func TestDatabase_SaveFolder(t *testing.T) {
+	t.Run("should save nested folders", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		work, err := db.SaveFolder(t.Context(), model.Folder{Name: "Work"})
+		is.NotError(t, err)
+		is.True(t, work.ID != "")
+
+		project, err := db.SaveFolder(t.Context(), model.Folder{Name: "Project", ParentID: &work.ID})
+		is.NotError(t, err)
+		is.Equal(t, work.ID, *project.ParentID)
+
+		fs, err := db.GetFolders(t.Context())
+		is.NotError(t, err)
+		is.Equal(t, 2, len(fs))
+		is.Equal(t, "Project", fs[0].Name)
+		is.Equal(t, "Work", fs[1].Name)
+	})
+
+	t.Run("should return folder not found if the parent doesn't exist", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		parentID := model.FolderID("fo_doesnotexist")
+		_, err := db.SaveFolder(t.Context(), model.Folder{Name: "Work", ParentID: &parentID})
+		is.Error(t, model.ErrorFolderNotFound, err)
+	})
+
+	t.Run("should not move a folder inside itself", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		work, err := db.SaveFolder(t.Context(), model.Folder{Name: "Work"})
+		is.NotError(t, err)
+		project, err := db.SaveFolder(t.Context(), model.Folder{Name: "Project", ParentID: &work.ID})
+		is.NotError(t, err)
+
+		work.ParentID = &project.ID
+		_, err = db.SaveFolder(t.Context(), work)
+		is.Error(t, model.ErrorFolderCycle, err)
+
+		work.ParentID = &work.ID
+		_, err = db.SaveFolder(t.Context(), work)
+		is.Error(t, model.ErrorFolderCycle, err)
+	})
+}
+
+func TestDatabase_DeleteFolder(t *testing.T) {
+	t.Run("should delete nested folders and keep their conversations", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		c := sqlitetest.NewConversation(t, db, "Birds")
+
+		work, err := db.SaveFolder(t.Context(), model.Folder{Name: "Work"})
+		is.NotError(t, err)
+		project, err := db.SaveFolder(t.Context(), model.Folder{Name: "Project", ParentID: &work.ID})
+		is.NotError(t, err)
+		err = db.MoveConversation(t.Context(), c.ID, &project.ID)
+		is.NotError(t, err)
+
+		err = db.DeleteFolder(t.Context(), work.ID)
+		is.NotError(t, err)
+
+		fs, err := db.GetFolders(t.Context())
+		is.NotError(t, err)
+		is.Equal(t, 0, len(fs))
+
+		cd, err := db.GetConversationDocument(t.Context(), c.ID)
+		is.NotError(t, err)
+		is.True(t, cd.Conversation.FolderID == nil)
+
+		err = db.DeleteFolder(t.Context(), work.ID)
+		is.Error(t, model.ErrorFolderNotFound, err)
+	})
+}
+
+func TestDatabase_MoveConversation(t *testing.T) {
+	t.Run("should move the conversation into and out of a folder", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		c := sqlitetest.NewConversation(t, db, "Birds")
+		f, err := db.SaveFolder(t.Context(), model.Folder{Name: "Work"})
+		is.NotError(t, err)
+
+		err = db.MoveConversation(t.Context(), c.ID, &f.ID)
+		is.NotError(t, err)
+		cd, err := db.GetConversationDocument(t.Context(), c.ID)
+		is.NotError(t, err)
+		is.Equal(t, f.ID, *cd.Conversation.FolderID)
+
+		err = db.MoveConversation(t.Context(), c.ID, nil)
+		is.NotError(t, err)
+		cd, err = db.GetConversationDocument(t.Context(), c.ID)
+		is.NotError(t, err)
+		is.True(t, cd.Conversation.FolderID == nil)
+	})
+
+	t.Run("should return folder not found if the folder doesn't exist", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		c := sqlitetest.NewConversation(t, db, "Birds")
+
+		folderID := model.FolderID("fo_doesnotexist")
+		err := db.MoveConversation(t.Context(), c.ID, &folderID)
+		is.Error(t, model.ErrorFolderNotFound, err)
+	})
+}
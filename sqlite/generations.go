@@ -0,0 +1,57 @@
+package sqlite
+
+import (
+	"context"
+	"sync"
+
+	"app/model"
+)
+
+// generations that are in progress, so cancelling a turn can stop its generation right away,
+// instead of when the generation next saves the turn.
+type generations struct {
+	cancels map[model.TurnID]context.CancelCauseFunc
+	mutex   sync.Mutex
+}
+
+func newGenerations() *generations {
+	return &generations{
+		cancels: map[model.TurnID]context.CancelCauseFunc{},
+	}
+}
+
+// start a generation of the turn, returning a context that's cancelled with [model.ErrorTurnCancelled]
+// when the turn is cancelled, and a function to call when the generation is done.
+func (g *generations) start(ctx context.Context, id model.TurnID) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	g.mutex.Lock()
+	g.cancels[id] = cancel
+	g.mutex.Unlock()
+
+	return ctx, func() {
+		g.mutex.Lock()
+		delete(g.cancels, id)
+		g.mutex.Unlock()
+		cancel(nil)
+	}
+}
+
+// cancel the generations of the turns with the given IDs, if they're in progress.
+func (g *generations) cancel(ids ...model.TurnID) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	for _, id := range ids {
+		if cancel, ok := g.cancels[id]; ok {
+			cancel(model.ErrorTurnCancelled)
+		}
+	}
+}
+
+// StartGeneration of the turn with the given ID, returning a context for the generation that's cancelled
+// with [model.ErrorTurnCancelled] as the cause when the turn is cancelled with [Database.CancelTurn]
+// or its conversation is paused. Call the returned function when the generation is done.
+func (d *Database) StartGeneration(ctx context.Context, id model.TurnID) (context.Context, func()) {
+	return d.generations.start(ctx, id)
+}
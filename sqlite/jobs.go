@@ -0,0 +1,92 @@
+package sqlite
+
+import (
+	"context"
+	"time"
+
+	"maragu.dev/errors"
+	"maragu.dev/goqite"
+	goqitejobs "maragu.dev/goqite/jobs"
+)
+
+// GetJobQueueDepths by queue name, which is the number of jobs waiting or running in each queue.
+func (d *Database) GetJobQueueDepths(ctx context.Context) (map[string]int, error) {
+	var rows []struct {
+		Queue string
+		Depth int
+	}
+	if err := d.H.Select(ctx, &rows, `select queue, count(*) as depth from goqite group by queue`); err != nil {
+		return nil, err
+	}
+
+	depths := map[string]int{}
+	for _, r := range rows {
+		depths[r.Queue] = r.Depth
+	}
+	return depths, nil
+}
+
+// GetOldestReadyJobAge in the queue, which is how long the oldest job that could run has been waiting.
+// Running jobs are not ready, since their timeout is extended while they run. Zero means no jobs are ready.
+func (d *Database) GetOldestReadyJobAge(ctx context.Context, queue string) (time.Duration, error) {
+	var seconds float64
+	query := `
+		select coalesce(max(julianday('now') - julianday(timeout)), 0) * 86400
+		from goqite
+		where queue = ? and timeout <= strftime('%Y-%m-%dT%H:%M:%fZ')`
+	if err := d.H.Get(ctx, &seconds, query, queue); err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// ScheduleJob with the given name to run after delay, replacing any run already scheduled for it.
+// Scheduled jobs have no message body, and are expected to schedule their next run themselves.
+// The replaced run is deleted from the queue, also when it's the one that's running, so a run that fails
+// after scheduling the next one isn't retried, and there's only ever one run scheduled.
+func (d *Database) ScheduleJob(ctx context.Context, name string, delay time.Duration) error {
+	return d.H.InTx(ctx, func(ctx context.Context, tx *Tx) error {
+		return d.scheduleJob(ctx, tx, name, delay)
+	})
+}
+
+// EnsureJobScheduled with the given name to run after delay, unless a run is already scheduled.
+// Use it at startup, so restarts don't reset the schedule.
+func (d *Database) EnsureJobScheduled(ctx context.Context, name string, delay time.Duration) error {
+	return d.H.InTx(ctx, func(ctx context.Context, tx *Tx) error {
+		var exists bool
+		query := `
+			select exists (
+				select 1 from job_schedules js
+				join goqite g on g.id = js.message_id
+				where js.name = ?
+			)`
+		if err := tx.Get(ctx, &exists, query, name); err != nil {
+			return err
+		}
+		if exists {
+			return nil
+		}
+		return d.scheduleJob(ctx, tx, name, delay)
+	})
+}
+
+func (d *Database) scheduleJob(ctx context.Context, tx *Tx, name string, delay time.Duration) error {
+	query := `delete from goqite where id = (select message_id from job_schedules where name = ?)`
+	if err := tx.Exec(ctx, query, name); err != nil {
+		return errors.Wrap(err, "error deleting replaced job")
+	}
+
+	id, err := goqitejobs.CreateTx(ctx, tx.Tx.Tx, d.H.JobsQ, name, goqite.Message{Delay: delay})
+	if err != nil {
+		return errors.Wrap(err, "error creating scheduled job")
+	}
+
+	query = `
+		insert into job_schedules (name, message_id) values (?, ?)
+		on conflict (name) do update set message_id = excluded.message_id`
+	if err := tx.Exec(ctx, query, name, id); err != nil {
+		return errors.Wrap(err, "error saving job schedule")
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package sqlite_test
+
+import (
+	"testing"
+	"time"
+
+	"maragu.dev/is"
+
+	"app/sqlitetest"
+)
+
+func TestDatabase_GetJobQueueDepths(t *testing.T) {
+	t.Run("should count the jobs in each queue", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		depths, err := db.GetJobQueueDepths(t.Context())
+		is.NotError(t, err)
+		is.Equal(t, 0, depths["jobs"])
+
+		err = db.CreateGenerateTurnJob(t.Context(), "t_123", 0, 0)
+		is.NotError(t, err)
+		err = db.CreateGenerateTurnJob(t.Context(), "t_456", 0, 0)
+		is.NotError(t, err)
+
+		depths, err = db.GetJobQueueDepths(t.Context())
+		is.NotError(t, err)
+		is.Equal(t, 2, depths["jobs"])
+	})
+}
+
+func TestDatabase_GetOldestReadyJobAge(t *testing.T) {
+	t.Run("should be zero without ready jobs, and the wait of the oldest ready job otherwise", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		age, err := db.GetOldestReadyJobAge(t.Context(), "jobs")
+		is.NotError(t, err)
+		is.Equal(t, time.Duration(0), age)
+
+		err = db.CreateGenerateTurnJob(t.Context(), "t_123", 0, time.Hour)
+		is.NotError(t, err)
+
+		age, err = db.GetOldestReadyJobAge(t.Context(), "jobs")
+		is.NotError(t, err)
+		is.Equal(t, time.Duration(0), age)
+
+		_, err = db.H.DB.ExecContext(t.Context(), `update goqite set timeout = strftime('%Y-%m-%dT%H:%M:%fZ', 'now', '-2 minutes')`)
+		is.NotError(t, err)
+
+		age, err = db.GetOldestReadyJobAge(t.Context(), "jobs")
+		is.NotError(t, err)
+		is.True(t, age > 119*time.Second && age < 121*time.Second)
+	})
+}
+
+func TestDatabase_EnsureJobScheduled(t *testing.T) {
+	t.Run("should schedule the job once, until it's scheduled again", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		err := db.EnsureJobScheduled(t.Context(), "backup", time.Hour)
+		is.NotError(t, err)
+		err = db.EnsureJobScheduled(t.Context(), "backup", time.Hour)
+		is.NotError(t, err)
+
+		depths, err := db.GetJobQueueDepths(t.Context())
+		is.NotError(t, err)
+		is.Equal(t, 1, depths["jobs"])
+
+		// Like when the job has run, and its message is deleted
+		_, err = db.H.DB.ExecContext(t.Context(), `delete from goqite`)
+		is.NotError(t, err)
+
+		err = db.EnsureJobScheduled(t.Context(), "backup", time.Hour)
+		is.NotError(t, err)
+
+		depths, err = db.GetJobQueueDepths(t.Context())
+		is.NotError(t, err)
+		is.Equal(t, 1, depths["jobs"])
+	})
+}
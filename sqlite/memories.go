@@ -0,0 +1,172 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"maragu.dev/errors"
+
+	"app/model"
+)
+
+// GetMemories of the speaker with the given ID, newest first.
+func (d *Database) GetMemories(ctx context.Context, id model.SpeakerID) ([]model.Memory, error) {
+	var ms []model.Memory
+	err := d.H.Select(ctx, &ms, `select * from memories where speaker_id = ? order by created desc, id desc`, id)
+	return ms, err
+}
+
+// SaveMemory by creating it if its ID is empty, or otherwise changing the content of the existing memory.
+// If the speaker of a new memory doesn't exist, [model.ErrorSpeakerNotFound] is returned.
+// If the existing memory doesn't exist, [model.ErrorMemoryNotFound] is returned.
+func (d *Database) SaveMemory(ctx context.Context, m model.Memory) (model.Memory, error) {
+	if m.ID == "" {
+		err := d.H.InTx(ctx, func(ctx context.Context, tx *Tx) error {
+			var speakerExists bool
+			if err := tx.Get(ctx, &speakerExists, `select exists (select 1 from speakers where id = ?)`, m.SpeakerID); err != nil {
+				return err
+			}
+			if !speakerExists {
+				return model.ErrorSpeakerNotFound
+			}
+
+			return tx.Get(ctx, &m, `insert into memories (speaker_id, content) values (?, ?) returning *`, m.SpeakerID, m.Content)
+		})
+		return m, err
+	}
+
+	if err := d.H.Get(ctx, &m, `update memories set content = ? where id = ? returning *`, m.Content, m.ID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return m, model.ErrorMemoryNotFound
+		}
+		return m, err
+	}
+	return m, nil
+}
+
+// DeleteMemory by ID, so the speaker forgets it.
+// If the memory doesn't exist, [model.ErrorMemoryNotFound] is returned.
+func (d *Database) DeleteMemory(ctx context.Context, id model.MemoryID) error {
+	var conversationID *model.ConversationID
+	if err := d.H.Get(ctx, &conversationID, `delete from memories where id = ? returning conversation_id`, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.ErrorMemoryNotFound
+		}
+		return err
+	}
+	if conversationID != nil {
+		d.docs.invalidate(*conversationID)
+	}
+	return nil
+}
+
+// RememberTurn by saving its content as a memory of every AI speaker in its conversation,
+// which are the speakers whose model doesn't have the brain provider.
+// Speakers that already remember the turn are skipped. The new memories are returned.
+// If the turn doesn't exist or is in the trash, [model.ErrorTurnNotFound] is returned.
+func (d *Database) RememberTurn(ctx context.Context, id model.TurnID) ([]model.Memory, error) {
+	var conversationID model.ConversationID
+	var ms []model.Memory
+	err := d.H.InTx(ctx, func(ctx context.Context, tx *Tx) error {
+		if err := tx.Get(ctx, &conversationID, `select conversation_id from turns where id = ? and deleted is null`, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return model.ErrorTurnNotFound
+			}
+			return err
+		}
+
+		const query = `
+			insert into memories (speaker_id, content, conversation_id, turn_id)
+			select s.id, t.content, t.conversation_id, t.id
+			from turns t
+			join speakers s on s.id in (select speaker_id from turns where conversation_id = t.conversation_id and deleted is null)
+			join models m on m.id = s.model_id
+			where t.id = ? and t.content != '' and s.deleted is null and m.provider != 'brain'
+				and not exists (select 1 from memories where speaker_id = s.id and turn_id = t.id)
+			returning *`
+		return tx.Select(ctx, &ms, query, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	d.docs.invalidate(conversationID)
+	return ms, nil
+}
+
+// ForgetTurn by deleting the memories remembered from it with [Database.RememberTurn].
+// If the turn doesn't exist, [model.ErrorTurnNotFound] is returned.
+func (d *Database) ForgetTurn(ctx context.Context, id model.TurnID) error {
+	var conversationID model.ConversationID
+	err := d.H.InTx(ctx, func(ctx context.Context, tx *Tx) error {
+		if err := tx.Get(ctx, &conversationID, `select conversation_id from turns where id = ?`, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return model.ErrorTurnNotFound
+			}
+			return err
+		}
+
+		return tx.Exec(ctx, `delete from memories where turn_id = ?`, id)
+	})
+	if err != nil {
+		return err
+	}
+	d.docs.invalidate(conversationID)
+	return nil
+}
+
+// GetConversationsForMemoryExtraction that have turns memories haven't been extracted from yet,
+// and no turns created since the given time, so extraction waits for conversations to go quiet.
+// Conversations in the trash and anonymized conversations are left out.
+func (d *Database) GetConversationsForMemoryExtraction(ctx context.Context, before time.Time) ([]model.ConversationID, error) {
+	const query = `
+		select c.id
+		from conversations c
+		join (
+			select conversation_id, max(created) as latest
+			from turns
+			where deleted is null
+			group by conversation_id
+		) t on t.conversation_id = c.id
+		left join memory_extractions me on me.conversation_id = c.id
+		where c.deleted is null and c.anonymized is null and t.latest < ? and t.latest > coalesce(me.until, '')
+		order by t.latest`
+	var ids []model.ConversationID
+	err := d.H.Select(ctx, &ids, query, model.Time{T: before})
+	return ids, err
+}
+
+// GetMemoriesExtractedUntil is when the latest turn in the conversation with the given ID was created,
+// that memories have been extracted from. It's zero if memories haven't been extracted from the conversation yet.
+func (d *Database) GetMemoriesExtractedUntil(ctx context.Context, id model.ConversationID) (time.Time, error) {
+	var until model.Time
+	if err := d.H.Get(ctx, &until, `select until from memory_extractions where conversation_id = ?`, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+	return until.T, nil
+}
+
+// SaveExtractedMemories from the conversation with the given ID, and that memories have been extracted
+// from the turns created until the given time.
+// Memories a speaker already has, ignoring case, are skipped.
+func (d *Database) SaveExtractedMemories(ctx context.Context, id model.ConversationID, until time.Time, ms []model.Memory) error {
+	return d.H.InTx(ctx, func(ctx context.Context, tx *Tx) error {
+		for _, m := range ms {
+			const query = `
+				insert into memories (speaker_id, content, conversation_id)
+				select ?, ?, ?
+				where not exists (select 1 from memories where speaker_id = ? and lower(content) = lower(?))`
+			if err := tx.Exec(ctx, query, m.SpeakerID, m.Content, id, m.SpeakerID, m.Content); err != nil {
+				return errors.Wrap(err, "error saving memory")
+			}
+		}
+
+		const query = `
+			insert into memory_extractions (conversation_id, until) values (?, ?)
+			on conflict (conversation_id) do update set until = excluded.until`
+		return tx.Exec(ctx, query, id, model.Time{T: until})
+	})
+}
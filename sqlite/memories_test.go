@@ -0,0 +1,148 @@
+package sqlite_test
+
+import (
+	"testing"
+	"time"
+
+	"maragu.dev/is"
+
+	"app/model"
+	"app/sqlitetest"
+)
+
+func TestDatabase_SaveMemory(t *testing.T) {
+	t.Run("should create, change, and delete memories", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		parrot := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+
+		m, err := db.SaveMemory(t.Context(), model.Memory{SpeakerID: parrot.ID, Content: "Likes crackers."})
+		is.NotError(t, err)
+		is.True(t, m.ID != "")
+
+		m.Content = "Loves crackers."
+		_, err = db.SaveMemory(t.Context(), m)
+		is.NotError(t, err)
+
+		memories, err := db.GetMemories(t.Context(), parrot.ID)
+		is.NotError(t, err)
+		is.Equal(t, 1, len(memories))
+		is.Equal(t, "Loves crackers.", memories[0].Content)
+
+		err = db.DeleteMemory(t.Context(), m.ID)
+		is.NotError(t, err)
+		err = db.DeleteMemory(t.Context(), m.ID)
+		is.Error(t, model.ErrorMemoryNotFound, err)
+
+		_, err = db.SaveMemory(t.Context(), m)
+		is.Error(t, model.ErrorMemoryNotFound, err)
+	})
+
+	t.Run("should return ErrorSpeakerNotFound when the speaker does not exist", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		_, err := db.SaveMemory(t.Context(), model.Memory{SpeakerID: "sp_nonexistent", Content: "Hi"})
+		is.Error(t, model.ErrorSpeakerNotFound, err)
+	})
+}
+
+func TestDatabase_RememberTurn(t *testing.T) {
+	t.Run("should remember the turn for the AI speakers in the conversation until it's forgotten", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		me, err := db.GetSpeaker(t.Context(), model.GetSpeakerFilter{Name: "Me"})
+		is.NotError(t, err)
+		parrot := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+		sqlitetest.NewFakeSpeaker(t, db, "Elsewhere", "")
+		c := sqlitetest.NewConversation(t, db, "Birds")
+
+		turn, err := db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: me.ID, Content: "My name is Polly."})
+		is.NotError(t, err)
+		_, err = db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: parrot.ID, Content: "Squawk!"})
+		is.NotError(t, err)
+
+		memories, err := db.RememberTurn(t.Context(), turn.ID)
+		is.NotError(t, err)
+		is.Equal(t, 1, len(memories))
+		is.Equal(t, parrot.ID, memories[0].SpeakerID)
+		is.Equal(t, "My name is Polly.", memories[0].Content)
+
+		memories, err = db.RememberTurn(t.Context(), turn.ID)
+		is.NotError(t, err)
+		is.Equal(t, 0, len(memories))
+
+		cd, err := db.GetConversationDocument(t.Context(), c.ID)
+		is.NotError(t, err)
+		is.True(t, cd.RememberedTurns[turn.ID])
+
+		err = db.ForgetTurn(t.Context(), turn.ID)
+		is.NotError(t, err)
+
+		memories, err = db.GetMemories(t.Context(), parrot.ID)
+		is.NotError(t, err)
+		is.Equal(t, 0, len(memories))
+
+		cd, err = db.GetConversationDocument(t.Context(), c.ID)
+		is.NotError(t, err)
+		is.True(t, !cd.RememberedTurns[turn.ID])
+	})
+
+	t.Run("should return ErrorTurnNotFound when the turn does not exist", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		_, err := db.RememberTurn(t.Context(), "tu_nonexistent")
+		is.Error(t, model.ErrorTurnNotFound, err)
+		err = db.ForgetTurn(t.Context(), "tu_nonexistent")
+		is.Error(t, model.ErrorTurnNotFound, err)
+	})
+}
+
+func TestDatabase_SaveExtractedMemories(t *testing.T) {
+	t.Run("should skip memories the speaker already has, and extract again only after new turns", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		parrot := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+		c := sqlitetest.NewConversation(t, db, "Birds")
+		turn, err := db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: parrot.ID, Content: "Squawk!"})
+		is.NotError(t, err)
+
+		_, err = db.SaveMemory(t.Context(), model.Memory{SpeakerID: parrot.ID, Content: "Likes crackers."})
+		is.NotError(t, err)
+
+		ids, err := db.GetConversationsForMemoryExtraction(t.Context(), time.Now().Add(time.Minute))
+		is.NotError(t, err)
+		is.Equal(t, 1, len(ids))
+
+		until, err := db.GetMemoriesExtractedUntil(t.Context(), c.ID)
+		is.NotError(t, err)
+		is.True(t, until.IsZero())
+
+		err = db.SaveExtractedMemories(t.Context(), c.ID, turn.Created.T, []model.Memory{
+			{SpeakerID: parrot.ID, Content: "likes crackers."},
+			{SpeakerID: parrot.ID, Content: "Lives in a cage."},
+		})
+		is.NotError(t, err)
+
+		memories, err := db.GetMemories(t.Context(), parrot.ID)
+		is.NotError(t, err)
+		is.Equal(t, 2, len(memories))
+
+		until, err = db.GetMemoriesExtractedUntil(t.Context(), c.ID)
+		is.NotError(t, err)
+		is.True(t, until.Equal(turn.Created.T))
+
+		ids, err = db.GetConversationsForMemoryExtraction(t.Context(), time.Now().Add(time.Minute))
+		is.NotError(t, err)
+		is.Equal(t, 0, len(ids))
+
+		time.Sleep(time.Millisecond)
+		_, err = db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: parrot.ID, Content: "Squawk?"})
+		is.NotError(t, err)
+
+		ids, err = db.GetConversationsForMemoryExtraction(t.Context(), time.Now().Add(time.Minute))
+		is.NotError(t, err)
+		is.Equal(t, 1, len(ids))
+
+		// Not while the conversation is still going
+		ids, err = db.GetConversationsForMemoryExtraction(t.Context(), time.Now().Add(-time.Minute))
+		is.NotError(t, err)
+		is.Equal(t, 0, len(ids))
+	})
+}
@@ -0,0 +1,5 @@
+drop index turns_speaker_revision_id;
+alter table turns drop column speaker_revision_id;
+drop trigger speakers_revision_updated;
+drop trigger speakers_revision_inserted;
+drop table speaker_revisions;
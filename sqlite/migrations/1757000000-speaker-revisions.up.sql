@@ -0,0 +1,41 @@
+-- speaker_revisions are immutable snapshots of speakers.
+-- A new revision is recorded by triggers every time a speaker is created or changed,
+-- so turns can reference exactly which version of a persona produced them.
+create table speaker_revisions (
+  id text primary key default ('sr_' || lower(hex(randomblob(16)))),
+  created text not null default (strftime('%Y-%m-%dT%H:%M:%fZ')),
+  speaker_id text not null references speakers (id) on delete cascade,
+  revision integer not null,
+  model_id text not null references models (id) on delete restrict,
+  name text not null,
+  system text not null,
+  config text not null check (json_valid(config)),
+  unique (speaker_id, revision)
+) strict;
+
+create trigger speakers_revision_inserted after insert on speakers begin
+  insert into speaker_revisions (speaker_id, revision, model_id, name, system, config)
+  values (new.id, 1, new.model_id, new.name, new.system, new.config);
+end;
+
+create trigger speakers_revision_updated after update of model_id, name, system, config on speakers
+when old.model_id is not new.model_id or old.name is not new.name or old.system is not new.system or old.config is not new.config
+begin
+  insert into speaker_revisions (speaker_id, revision, model_id, name, system, config)
+  values (
+    new.id,
+    (select coalesce(max(revision), 0) + 1 from speaker_revisions where speaker_id = new.id),
+    new.model_id, new.name, new.system, new.config
+  );
+end;
+
+insert into speaker_revisions (speaker_id, revision, model_id, name, system, config)
+select id, 1, model_id, name, system, config from speakers;
+
+alter table turns add column speaker_revision_id text references speaker_revisions (id) on delete restrict;
+
+update turns set speaker_revision_id = (
+  select id from speaker_revisions where speaker_id = turns.speaker_id and revision = 1
+);
+
+create index turns_speaker_revision_id on turns (speaker_revision_id);
@@ -0,0 +1,3 @@
+drop index turns_reply_to_id;
+alter table turns drop column candidate;
+alter table turns drop column reply_to_id;
@@ -0,0 +1,7 @@
+-- Turns generated in reply to another turn reference it.
+-- When a turn fans out to several speakers for comparison, the replies are candidates,
+-- which are not part of the conversation thread until one of them is picked.
+alter table turns add column reply_to_id text references turns (id) on delete cascade;
+alter table turns add column candidate integer not null default 0 check (candidate in (0, 1));
+
+create index turns_reply_to_id on turns (reply_to_id);
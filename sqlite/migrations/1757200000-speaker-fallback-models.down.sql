@@ -0,0 +1,2 @@
+alter table turns drop column model_id;
+drop table speaker_fallback_models;
@@ -0,0 +1,10 @@
+-- speaker_fallback_models are tried in order of position when the speaker's own model is unavailable.
+create table speaker_fallback_models (
+  speaker_id text not null references speakers (id) on delete cascade,
+  position integer not null,
+  model_id text not null references models (id) on delete restrict,
+  primary key (speaker_id, position)
+) strict;
+
+-- model_id on turns is the model that actually generated the turn, which can be a fallback model.
+alter table turns add column model_id text references models (id) on delete restrict;
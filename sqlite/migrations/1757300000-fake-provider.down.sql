@@ -0,0 +1,2 @@
+delete from models where provider = 'fake';
+delete from providers where name = 'fake';
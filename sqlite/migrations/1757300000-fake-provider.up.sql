@@ -0,0 +1,6 @@
+-- The fake provider generates deterministic responses without calling out to anything,
+-- for tests and local development. See the llm package for how to configure fake models.
+insert into providers (name) values ('fake');
+
+insert into models (id, provider, name, config) values
+  ('mo_9f3d2c4b1a0e4f6d8c7b5a3e2d1f0c9b', 'fake', 'echo', '{}');
@@ -0,0 +1,3 @@
+alter table conversations drop column paused;
+
+alter table turns drop column status;
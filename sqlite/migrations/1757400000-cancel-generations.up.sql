@@ -0,0 +1,6 @@
+-- status of turns, which are generating while an AI speaker's reply streams in,
+-- and cancelled if generation was stopped before it completed.
+alter table turns add column status text not null default 'complete';
+
+-- paused conversations don't generate replies by AI speakers.
+alter table conversations add column paused integer not null default 0;
@@ -0,0 +1,11 @@
+alter table turns drop column finished;
+alter table turns drop column started;
+alter table turns drop column error;
+
+alter table turns add column status_unchecked text not null default 'complete';
+update turns set status_unchecked = status;
+alter table turns drop column status;
+alter table turns rename column status_unchecked to status;
+
+update turns set status = 'generating' where status in ('pending', 'streaming');
+update turns set status = 'cancelled' where status = 'failed';
@@ -0,0 +1,16 @@
+-- Generating turns are split into pending, before generation starts, and streaming.
+-- Turns that couldn't be generated are failed, with an error message.
+update turns set status = 'pending' where status = 'generating';
+
+-- SQLite can't add a check constraint to an existing column, so the status column is replaced with one that has it.
+alter table turns add column status_checked text not null default 'complete'
+  check (status_checked in ('pending', 'streaming', 'complete', 'failed', 'cancelled'));
+update turns set status_checked = status;
+alter table turns drop column status;
+alter table turns rename column status_checked to status;
+
+alter table turns add column error text not null default '';
+
+-- started and finished are when generation started and finished, if the turn is generated.
+alter table turns add column started text;
+alter table turns add column finished text;
@@ -0,0 +1 @@
+alter table turns drop column reasoning;
@@ -0,0 +1,2 @@
+-- reasoning of the model before generating the turn content, as JSON blocks. See model.ReasoningBlock.
+alter table turns add column reasoning text not null default '[]' check (json_valid(reasoning));
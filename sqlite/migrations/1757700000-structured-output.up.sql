@@ -0,0 +1,2 @@
+-- output of turns by speakers with an output schema, which is the content parsed and validated as JSON.
+alter table turns add column output text not null default '' check (output = '' or json_valid(output));
@@ -0,0 +1 @@
+drop table job_schedules;
@@ -0,0 +1,11 @@
+-- job_schedules are jobs that run repeatedly, such as backups, with the goqite message of the next run.
+create table job_schedules (
+  name text primary key,
+  created text not null default (strftime('%Y-%m-%dT%H:%M:%fZ')),
+  updated text not null default (strftime('%Y-%m-%dT%H:%M:%fZ')),
+  message_id text not null
+) strict;
+
+create trigger job_schedules_updated_timestamp after update on job_schedules begin
+  update job_schedules set updated = strftime('%Y-%m-%dT%H:%M:%fZ') where name = old.name;
+end;
@@ -0,0 +1,2 @@
+alter table conversations drop column anonymized;
+alter table conversations drop column pinned;
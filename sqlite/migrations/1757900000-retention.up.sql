@@ -0,0 +1,5 @@
+-- pinned conversations are kept regardless of retention.
+alter table conversations add column pinned integer not null default 0;
+
+-- anonymized is when retention removed the content of the conversation, keeping the rest.
+alter table conversations add column anonymized text;
@@ -0,0 +1,3 @@
+alter table speakers drop column deleted;
+alter table turns drop column deleted;
+alter table conversations drop column deleted;
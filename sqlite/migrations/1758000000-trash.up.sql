@@ -0,0 +1,5 @@
+-- deleted is when the conversation, turn, or speaker was moved to the trash, where it can be restored from
+-- until the trash is purged.
+alter table conversations add column deleted text;
+alter table turns add column deleted text;
+alter table speakers add column deleted text;
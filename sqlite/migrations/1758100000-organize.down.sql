@@ -0,0 +1,5 @@
+drop table conversation_tags;
+drop table tags;
+drop index conversations_folder_id;
+alter table conversations drop column folder_id;
+drop table folders;
@@ -0,0 +1,35 @@
+-- folders organize conversations, and can be nested inside other folders.
+create table folders (
+  id text primary key default ('fo_' || lower(hex(randomblob(16)))),
+  created text not null default (strftime('%Y-%m-%dT%H:%M:%fZ')),
+  updated text not null default (strftime('%Y-%m-%dT%H:%M:%fZ')),
+  parent_id text references folders (id) on delete cascade,
+  name text not null
+) strict;
+
+create trigger folders_updated_timestamp after update on folders begin
+  update folders set updated = strftime('%Y-%m-%dT%H:%M:%fZ') where id = new.id;
+end;
+
+create index folders_parent_id on folders (parent_id);
+
+-- folder_id is the folder the conversation is in, if any. Conversations are kept if their folder is deleted.
+alter table conversations add column folder_id text references folders (id) on delete set null;
+
+create index conversations_folder_id on conversations (folder_id);
+
+-- tags label conversations, and are created when first used.
+create table tags (
+  id text primary key default ('ta_' || lower(hex(randomblob(16)))),
+  created text not null default (strftime('%Y-%m-%dT%H:%M:%fZ')),
+  name text unique not null
+) strict;
+
+create table conversation_tags (
+  conversation_id text not null references conversations (id) on delete cascade,
+  tag_id text not null references tags (id) on delete cascade,
+  created text not null default (strftime('%Y-%m-%dT%H:%M:%fZ')),
+  primary key (conversation_id, tag_id)
+) strict;
+
+create index conversation_tags_tag_id on conversation_tags (tag_id);
@@ -0,0 +1 @@
+drop index conversations_created_id;
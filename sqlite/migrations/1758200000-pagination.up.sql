@@ -0,0 +1,2 @@
+-- conversations are paged through newest first, by when they were created and then by ID.
+create index conversations_created_id on conversations (created, id);
@@ -0,0 +1,2 @@
+drop table share_turns;
+drop table shares;
@@ -0,0 +1,41 @@
+-- shares are public read-only links to conversations, by an unguessable token.
+create table shares (
+  id text primary key default ('sh_' || lower(hex(randomblob(16)))),
+  created text not null default (strftime('%Y-%m-%dT%H:%M:%fZ')),
+  updated text not null default (strftime('%Y-%m-%dT%H:%M:%fZ')),
+  conversation_id text not null references conversations (id) on delete cascade,
+  token text unique not null,
+  -- expires is when the link stops working, if ever.
+  expires text,
+  -- revoked is when the link was revoked, if it was.
+  revoked text
+) strict;
+
+create trigger shares_updated_timestamp after update on shares begin
+  update shares set updated = strftime('%Y-%m-%dT%H:%M:%fZ') where id = new.id;
+end;
+
+create index shares_conversation_id on shares (conversation_id);
+
+-- share_turns are the turns of a conversation as they were when it was shared, so shares don't change afterwards.
+-- Only finished turns are kept, and without errors, since those can have details from providers.
+-- There are no references to turns, speakers, or models, so deleting and purging them doesn't change shares either.
+create table share_turns (
+  share_id text not null references shares (id) on delete cascade,
+  position integer not null,
+  turn_id text not null,
+  created text not null,
+  updated text not null,
+  speaker_id text not null,
+  speaker_revision_id text not null,
+  reply_to_id text,
+  candidate integer not null check (candidate in (0, 1)),
+  model_id text,
+  status text not null check (status in ('complete', 'failed', 'cancelled')),
+  started text,
+  finished text,
+  content text not null,
+  reasoning text not null check (json_valid(reasoning)),
+  output text not null,
+  primary key (share_id, position)
+) strict;
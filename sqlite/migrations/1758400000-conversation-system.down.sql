@@ -0,0 +1,3 @@
+alter table share_turns drop column pinned;
+alter table turns drop column pinned;
+alter table conversations drop column system;
@@ -0,0 +1,6 @@
+-- system is added to the system prompt of every speaker in the conversation.
+alter table conversations add column system text not null default '';
+
+-- pinned turns are always included in prompts.
+alter table turns add column pinned integer not null default 0 check (pinned in (0, 1));
+alter table share_turns add column pinned integer not null default 0 check (pinned in (0, 1));
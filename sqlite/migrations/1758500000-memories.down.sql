@@ -0,0 +1,2 @@
+drop table memory_extractions;
+drop table memories;
@@ -0,0 +1,29 @@
+-- memories are what a speaker remembers across conversations.
+-- Memories are deleted with the conversation and turn they're from, instead of outliving them,
+-- so deleting a conversation also deletes what was learned from it.
+create table memories (
+  id text primary key default ('me_' || lower(hex(randomblob(16)))),
+  created text not null default (strftime('%Y-%m-%dT%H:%M:%fZ')),
+  updated text not null default (strftime('%Y-%m-%dT%H:%M:%fZ')),
+  speaker_id text not null references speakers (id) on delete cascade,
+  content text not null,
+  -- conversation_id is the conversation the memory is from, if any.
+  conversation_id text references conversations (id) on delete cascade,
+  -- turn_id is the turn the memory was explicitly remembered from, if any.
+  turn_id text references turns (id) on delete cascade
+) strict;
+
+create trigger memories_updated_timestamp after update on memories begin
+  update memories set updated = strftime('%Y-%m-%dT%H:%M:%fZ') where id = new.id;
+end;
+
+create index memories_speaker_id_created on memories (speaker_id, created);
+create index memories_conversation_id on memories (conversation_id);
+create index memories_turn_id on memories (turn_id);
+
+-- memory_extractions is how far memories have been extracted from each conversation.
+create table memory_extractions (
+  conversation_id text primary key references conversations (id) on delete cascade,
+  -- until is when the latest turn that memories were extracted from was created.
+  until text not null
+) strict;
@@ -0,0 +1 @@
+alter table conversations drop column variables;
@@ -0,0 +1,2 @@
+-- variables are custom template variables for the system prompts of speakers in the conversation, as a JSON object of strings.
+alter table conversations add column variables text not null default '{}' check (json_valid(variables) and json_type(variables) = 'object');
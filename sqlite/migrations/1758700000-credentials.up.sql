@@ -0,0 +1,12 @@
+-- credentials are secrets like API keys, referenced by name from the config of models.
+-- Values are encrypted with AES-GCM and the key from CREDENTIALS_KEY, and are never shown.
+create table credentials (
+  name text primary key,
+  created text not null default (strftime('%Y-%m-%dT%H:%M:%fZ')),
+  updated text not null default (strftime('%Y-%m-%dT%H:%M:%fZ')),
+  value blob not null
+) strict;
+
+create trigger credentials_updated_timestamp after update on credentials begin
+  update credentials set updated = strftime('%Y-%m-%dT%H:%M:%fZ') where name = new.name;
+end;
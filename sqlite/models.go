@@ -0,0 +1,58 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+
+	"maragu.dev/errors"
+
+	"app/model"
+)
+
+// GetModels by provider and name.
+func (d *Database) GetModels(ctx context.Context) ([]model.Model, error) {
+	var ms []model.Model
+	err := d.H.Select(ctx, &ms, "select * from models order by provider, name")
+	return ms, err
+}
+
+// GetModel by ID.
+func (d *Database) GetModel(ctx context.Context, id model.ModelID) (model.Model, error) {
+	var m model.Model
+	err := d.H.Get(ctx, &m, "select * from models where id = ?", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return m, model.ErrorModelNotFound
+	}
+	return m, err
+}
+
+// SaveModel via upsert.
+// If the model's ID is empty, a new model is created.
+// Otherwise, the existing model is updated.
+func (d *Database) SaveModel(ctx context.Context, m model.Model) (model.Model, error) {
+	defer d.docs.invalidateAll()
+
+	if m.Config == "" {
+		m.Config = "{}"
+	}
+
+	if m.ID == "" {
+		const query = `
+			insert into models (provider, name, config)
+			values (?, ?, ?)
+			returning *`
+		err := d.H.Get(ctx, &m, query, m.Provider, m.Name, m.Config)
+		return m, err
+	}
+
+	const query = `
+		insert into models (id, provider, name, config)
+		values (?, ?, ?, ?)
+		on conflict (id) do update set
+			provider = excluded.provider,
+			name = excluded.name,
+			config = excluded.config
+		returning *`
+	err := d.H.Get(ctx, &m, query, m.ID, m.Provider, m.Name, m.Config)
+	return m, err
+}
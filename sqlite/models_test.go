@@ -0,0 +1,29 @@
+package sqlite_test
+
+import (
+	"testing"
+
+	"maragu.dev/is"
+
+	"app/model"
+	"app/sqlitetest"
+)
+
+func TestDatabase_SaveModel(t *testing.T) {
+	t.Run("should create a new model when ID is empty, and update it otherwise", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		m, err := db.SaveModel(t.Context(), model.Model{Provider: model.ProviderFake, Name: "parrot"})
+		is.NotError(t, err)
+		is.True(t, m.ID != "")
+		is.Equal(t, "{}", string(m.Config))
+
+		m.Config = `{"responses":["Squawk!"]}`
+		_, err = db.SaveModel(t.Context(), m)
+		is.NotError(t, err)
+
+		m, err = db.GetModel(t.Context(), m.ID)
+		is.NotError(t, err)
+		is.Equal(t, `{"responses":["Squawk!"]}`, string(m.Config))
+	})
+}
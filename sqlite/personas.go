@@ -0,0 +1,131 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"maragu.dev/errors"
+
+	"app/model"
+)
+
+// ExportSpeaker with the given ID as a [model.Persona].
+func (d *Database) ExportSpeaker(ctx context.Context, id model.SpeakerID) (model.Persona, error) {
+	var p model.Persona
+	var row struct {
+		Name     string
+		System   string
+		Config   model.JSON
+		Provider model.Provider
+		Model    string
+	}
+	const query = `
+		select s.name, s.system, s.config, m.provider, m.name as model
+		from speakers s
+		join models m on m.id = s.model_id
+		where s.id = ?`
+	if err := d.H.Get(ctx, &row, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return p, model.ErrorSpeakerNotFound
+		}
+		return p, err
+	}
+
+	p = model.Persona{
+		Name:   row.Name,
+		Model:  model.PersonaModel{Provider: row.Provider, Name: row.Model},
+		System: row.System,
+	}
+	if err := json.Unmarshal([]byte(row.Config), &p.Config); err != nil {
+		return p, errors.Wrap(err, "error unmarshalling speaker config")
+	}
+	return p, nil
+}
+
+// ImportPersona as a speaker, with the model that has the persona's provider and name, which is created if there isn't one.
+// If a speaker with the persona's name exists and replace is false, [model.ErrorSpeakerNameConflict] is returned.
+// Otherwise, the existing speaker is updated if it differs from the persona.
+// A speaker in the trash with the persona's name gives up its name, see [freeSpeakerName].
+// If the provider doesn't exist, [model.ErrorProviderNotFound] is returned.
+func (d *Database) ImportPersona(ctx context.Context, p model.Persona, replace bool) (model.Speaker, model.Change, error) {
+	var s model.Speaker
+	var change model.Change
+	err := d.H.InTx(ctx, func(ctx context.Context, tx *Tx) error {
+		var err error
+		s, change, err = importPersona(ctx, tx, p, replace)
+		return err
+	})
+	if err != nil {
+		return s, "", err
+	}
+
+	if change != model.ChangeUnchanged {
+		d.docs.invalidateAll()
+	}
+	return s, change, nil
+}
+
+// importPersona in the transaction, see [Database.ImportPersona].
+func importPersona(ctx context.Context, tx *Tx, p model.Persona, replace bool) (model.Speaker, model.Change, error) {
+	var s model.Speaker
+
+	config, err := model.PersonaConfig(p)
+	if err != nil {
+		return s, "", errors.Wrap(err, "error marshalling persona config")
+	}
+
+	var providerExists bool
+	if err := tx.Get(ctx, &providerExists, `select exists (select 1 from providers where name = ?)`, p.Model.Provider); err != nil {
+		return s, "", err
+	}
+	if !providerExists {
+		return s, "", model.ErrorProviderNotFound
+	}
+
+	var modelID model.ModelID
+	err = tx.Get(ctx, &modelID, `select id from models where provider = ? and name = ? order by created limit 1`, p.Model.Provider, p.Model.Name)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = tx.Get(ctx, &modelID, `insert into models (provider, name) values (?, ?) returning id`, p.Model.Provider, p.Model.Name)
+	}
+	if err != nil {
+		return s, "", errors.Wrap(err, "error getting or creating model")
+	}
+
+	if err := freeSpeakerName(ctx, tx, p.Name, ""); err != nil {
+		return s, "", err
+	}
+
+	err = tx.Get(ctx, &s, `select * from speakers where name = ?`, p.Name)
+	if errors.Is(err, sql.ErrNoRows) {
+		const query = `insert into speakers (model_id, name, system, config) values (?, ?, ?, ?) returning *`
+		err = tx.Get(ctx, &s, query, modelID, p.Name, p.System, config)
+		return s, model.ChangeCreated, err
+	}
+	if err != nil {
+		return s, "", err
+	}
+
+	if !replace {
+		return s, "", model.ErrorSpeakerNameConflict
+	}
+
+	if s.ModelID == modelID && s.System == p.System && equalJSON(s.Config, config) {
+		return s, model.ChangeUnchanged, nil
+	}
+
+	const query = `update speakers set model_id = ?, system = ?, config = ? where id = ? returning *`
+	err = tx.Get(ctx, &s, query, modelID, p.System, config, s.ID)
+	return s, model.ChangeUpdated, err
+}
+
+// equalJSON if a and b are the same JSON, regardless of formatting and key order.
+func equalJSON(a, b model.JSON) bool {
+	var av, bv any
+	if json.Unmarshal([]byte(a), &av) != nil || json.Unmarshal([]byte(b), &bv) != nil {
+		return false
+	}
+	ab, _ := json.Marshal(av)
+	bb, _ := json.Marshal(bv)
+	return string(ab) == string(bb)
+}
@@ -0,0 +1,136 @@
+package sqlite_test
+
+import (
+	"strings"
+	"testing"
+
+	"maragu.dev/is"
+
+	"app/model"
+	"app/sqlitetest"
+)
+
+func TestDatabase_ExportSpeaker(t *testing.T) {
+	t.Run("should export the speaker with its model by provider and name", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		parrot := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+		parrot.Config = `{"outputSchema": {"type": "string"}}`
+		_, err := db.SaveSpeaker(t.Context(), parrot)
+		is.NotError(t, err)
+
+		p, err := db.ExportSpeaker(t.Context(), parrot.ID)
+		is.NotError(t, err)
+		is.Equal(t, "Parrot", p.Name)
+		is.Equal(t, "You are Parrot.", p.System)
+		is.Equal(t, model.ProviderFake, p.Model.Provider)
+		is.Equal(t, "Parrot", p.Model.Name)
+		is.Equal(t, "string", p.Config["outputSchema"].(map[string]any)["type"])
+	})
+
+	t.Run("should return ErrorSpeakerNotFound when the speaker does not exist", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		_, err := db.ExportSpeaker(t.Context(), "sp_nonexistent")
+		is.Error(t, model.ErrorSpeakerNotFound, err)
+	})
+}
+
+func TestDatabase_ImportPersona(t *testing.T) {
+	t.Run("should create the speaker with an existing model", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		parrot := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+
+		s, change, err := db.ImportPersona(t.Context(), model.Persona{
+			Name:   "Pirate",
+			Model:  model.PersonaModel{Provider: model.ProviderFake, Name: "Parrot"},
+			System: "Arr.",
+			Config: map[string]any{"temperature": 1},
+		}, false)
+		is.NotError(t, err)
+		is.Equal(t, model.ChangeCreated, change)
+		is.Equal(t, "Pirate", s.Name)
+		is.Equal(t, parrot.ModelID, s.ModelID)
+		is.Equal(t, "Arr.", s.System)
+		is.Equal(t, `{"temperature":1}`, string(s.Config))
+	})
+
+	t.Run("should create the model if there isn't one with the provider and name", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		s, _, err := db.ImportPersona(t.Context(), model.Persona{
+			Name:  "Pirate",
+			Model: model.PersonaModel{Provider: model.ProviderFake, Name: "Pirate model"},
+		}, false)
+		is.NotError(t, err)
+
+		m, err := db.GetModel(t.Context(), s.ModelID)
+		is.NotError(t, err)
+		is.Equal(t, model.ProviderFake, m.Provider)
+		is.Equal(t, "Pirate model", m.Name)
+		is.Equal(t, "{}", string(s.Config))
+	})
+
+	t.Run("should return ErrorSpeakerNameConflict when a speaker has the name and replace is false", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+
+		_, _, err := db.ImportPersona(t.Context(), model.Persona{
+			Name:  "Parrot",
+			Model: model.PersonaModel{Provider: model.ProviderFake, Name: "Parrot"},
+		}, false)
+		is.Error(t, model.ErrorSpeakerNameConflict, err)
+	})
+
+	t.Run("should update the speaker with the name when replacing, and leave it unchanged when it's the same", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		parrot := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+
+		p := model.Persona{
+			Name:   "Parrot",
+			Model:  model.PersonaModel{Provider: model.ProviderFake, Name: "Parrot"},
+			System: "Squawk.",
+		}
+		s, change, err := db.ImportPersona(t.Context(), p, true)
+		is.NotError(t, err)
+		is.Equal(t, model.ChangeUpdated, change)
+		is.Equal(t, parrot.ID, s.ID)
+		is.Equal(t, "Squawk.", s.System)
+
+		_, change, err = db.ImportPersona(t.Context(), p, true)
+		is.NotError(t, err)
+		is.Equal(t, model.ChangeUnchanged, change)
+
+		revisions, err := db.GetSpeakerRevisions(t.Context(), parrot.ID)
+		is.NotError(t, err)
+		is.Equal(t, 2, len(revisions))
+	})
+
+	t.Run("should create a new speaker when the speaker with the name is in the trash", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		parrot := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+		err := db.DeleteSpeaker(t.Context(), parrot.ID)
+		is.NotError(t, err)
+
+		s, change, err := db.ImportPersona(t.Context(), model.Persona{
+			Name:  "Parrot",
+			Model: model.PersonaModel{Provider: model.ProviderFake, Name: "Parrot"},
+		}, true)
+		is.NotError(t, err)
+		is.Equal(t, model.ChangeCreated, change)
+		is.True(t, s.ID != parrot.ID)
+
+		trashed, err := db.GetSpeaker(t.Context(), model.GetSpeakerFilter{ID: parrot.ID})
+		is.NotError(t, err)
+		is.True(t, strings.HasPrefix(trashed.Name, "Parrot (deleted "))
+	})
+
+	t.Run("should return ErrorProviderNotFound when the provider does not exist", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		_, _, err := db.ImportPersona(t.Context(), model.Persona{
+			Name:  "Pirate",
+			Model: model.PersonaModel{Provider: "nope", Name: "Pirate"},
+		}, false)
+		is.Error(t, model.ErrorProviderNotFound, err)
+	})
+}
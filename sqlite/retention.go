@@ -0,0 +1,80 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"maragu.dev/errors"
+
+	"app/model"
+)
+
+// GetExpiredConversations with no activity since before, which aren't pinned, oldest activity first.
+// Conversations that are already anonymized are included, so they can still be deleted.
+func (d *Database) GetExpiredConversations(ctx context.Context, before time.Time) ([]model.ExpiredConversation, error) {
+	const query = `
+		select c.*, max(c.created, coalesce(max(t.created), '')) as last_activity, count(t.id) as turns
+		from conversations c
+		left join turns t on t.conversation_id = c.id
+		where not c.pinned
+		group by c.id
+		having last_activity < ?
+		order by last_activity, c.id`
+	var cs []model.ExpiredConversation
+	err := d.H.Select(ctx, &cs, query, model.Time{T: before})
+	return cs, err
+}
+
+// DeleteExpiredConversation by ID with its turns and the memories from it, which are deleted by cascade.
+// If the conversation doesn't exist or has been pinned since it expired, [model.ErrorConversationNotFound] is returned.
+func (d *Database) DeleteExpiredConversation(ctx context.Context, id model.ConversationID) error {
+	defer d.docs.invalidate(id)
+
+	var exists bool
+	if err := d.H.Get(ctx, &exists, `delete from conversations where id = ? and not pinned returning true`, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.ErrorConversationNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// AnonymizeExpiredConversation by ID, by removing the topic, the system context, and the content of its turns,
+// also where they're kept for shares. Memories from the conversation are deleted, since they have content from it.
+// Speakers, models, and timings are kept, so the conversation still counts in statistics.
+// If the conversation doesn't exist or has been pinned since it expired, [model.ErrorConversationNotFound] is returned.
+func (d *Database) AnonymizeExpiredConversation(ctx context.Context, id model.ConversationID) error {
+	defer d.docs.invalidate(id)
+
+	return d.H.InTx(ctx, func(ctx context.Context, tx *Tx) error {
+		const query = `
+			update conversations set topic = '', system = '', variables = '{}', anonymized = strftime('%Y-%m-%dT%H:%M:%fZ')
+			where id = ? and not pinned
+			returning true`
+		var exists bool
+		if err := tx.Get(ctx, &exists, query, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return model.ErrorConversationNotFound
+			}
+			return err
+		}
+
+		const update = `
+			update turns set content = '', reasoning = '[]', output = '', error = ''
+			where conversation_id = ?`
+		if err := tx.Exec(ctx, update, id); err != nil {
+			return err
+		}
+
+		const updateShares = `
+			update share_turns set content = '', reasoning = '[]', output = ''
+			where share_id in (select id from shares where conversation_id = ?)`
+		if err := tx.Exec(ctx, updateShares, id); err != nil {
+			return err
+		}
+
+		return tx.Exec(ctx, `delete from memories where conversation_id = ?`, id)
+	})
+}
@@ -0,0 +1,161 @@
+package sqlite_test
+
+import (
+	"testing"
+	"time"
+
+	"maragu.dev/is"
+
+	"app/model"
+	"app/sqlite"
+	"app/sqlitetest"
+)
+
+func TestDatabase_GetExpiredConversations(t *testing.T) {
+	t.Run("should get unpinned conversations without activity since before", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		speaker := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+
+		old := sqlitetest.NewConversation(t, db, "Old")
+		_, err := db.SaveTurn(t.Context(), model.Turn{ConversationID: old.ID, SpeakerID: speaker.ID, Content: "Squawk!"})
+		is.NotError(t, err)
+
+		pinned := sqlitetest.NewConversation(t, db, "Pinned")
+		err = db.PinConversation(t.Context(), pinned.ID, true)
+		is.NotError(t, err)
+
+		active := sqlitetest.NewConversation(t, db, "Active")
+		_, err = db.SaveTurn(t.Context(), model.Turn{ConversationID: active.ID, SpeakerID: speaker.ID, Content: "Squawk!"})
+		is.NotError(t, err)
+
+		// Everything is old, except the latest turn in the active conversation
+		_, err = db.H.DB.ExecContext(t.Context(), `update conversations set created = '2020-01-01T00:00:00.000Z'`)
+		is.NotError(t, err)
+		_, err = db.H.DB.ExecContext(t.Context(), `update turns set created = '2020-01-01T00:00:00.000Z' where conversation_id = ?`, old.ID)
+		is.NotError(t, err)
+
+		cs, err := db.GetExpiredConversations(t.Context(), time.Now().AddDate(0, 0, -30))
+		is.NotError(t, err)
+		is.Equal(t, 1, len(cs))
+		is.Equal(t, old.ID, cs[0].ID)
+		is.Equal(t, 1, cs[0].Turns)
+		is.Equal(t, 2020, cs[0].LastActivity.T.Year())
+	})
+}
+
+func TestDatabase_DeleteExpiredConversation(t *testing.T) {
+	t.Run("should delete the conversation with its turns, unless it's pinned", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		speaker := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+		c := sqlitetest.NewConversation(t, db, "Birds")
+		turn, err := db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: speaker.ID, Content: "Squawk!"})
+		is.NotError(t, err)
+
+		err = db.PinConversation(t.Context(), c.ID, true)
+		is.NotError(t, err)
+		err = db.DeleteExpiredConversation(t.Context(), c.ID)
+		is.Error(t, model.ErrorConversationNotFound, err)
+
+		err = db.PinConversation(t.Context(), c.ID, false)
+		is.NotError(t, err)
+		err = db.DeleteExpiredConversation(t.Context(), c.ID)
+		is.NotError(t, err)
+
+		_, err = db.GetTurn(t.Context(), turn.ID)
+		is.Error(t, model.ErrorTurnNotFound, err)
+	})
+
+	t.Run("should delete the memories from the conversation", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		speaker := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+		c := newConversationWithMemories(t, db, speaker)
+
+		err := db.DeleteExpiredConversation(t.Context(), c.ID)
+		is.NotError(t, err)
+
+		memories, err := db.GetMemories(t.Context(), speaker.ID)
+		is.NotError(t, err)
+		is.Equal(t, 1, len(memories))
+		is.Equal(t, "Crackers are tasty.", memories[0].Content)
+	})
+}
+
+func TestDatabase_AnonymizeExpiredConversation(t *testing.T) {
+	t.Run("should remove the topic and turn content, and keep the rest", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		speaker := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+		c := sqlitetest.NewConversation(t, db, "Birds")
+		err := db.UpdateConversationSystem(t.Context(), c.ID, "We're all birds here.")
+		is.NotError(t, err)
+		turn, err := db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: speaker.ID, Content: "Squawk!"})
+		is.NotError(t, err)
+
+		err = db.AnonymizeExpiredConversation(t.Context(), c.ID)
+		is.NotError(t, err)
+
+		cd, err := db.GetConversationDocument(t.Context(), c.ID)
+		is.NotError(t, err)
+		is.Equal(t, "", cd.Conversation.Topic)
+		is.Equal(t, "", cd.Conversation.System)
+		is.True(t, !cd.Conversation.Anonymized.T.IsZero())
+		is.Equal(t, 1, len(cd.Turns))
+		is.Equal(t, turn.ID, cd.Turns[0].ID)
+		is.Equal(t, "", cd.Turns[0].Content)
+		is.Equal(t, speaker.ID, cd.Turns[0].SpeakerID)
+	})
+
+	t.Run("should remove the turn content of shares", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		speaker := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+		c := sqlitetest.NewConversation(t, db, "Birds")
+		_, err := db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: speaker.ID, Content: "Squawk!"})
+		is.NotError(t, err)
+		s, err := db.CreateShare(t.Context(), c.ID, time.Time{})
+		is.NotError(t, err)
+
+		err = db.AnonymizeExpiredConversation(t.Context(), c.ID)
+		is.NotError(t, err)
+
+		cd, err := db.GetSharedConversationDocument(t.Context(), s.Token)
+		is.NotError(t, err)
+		is.Equal(t, 1, len(cd.Turns))
+		is.Equal(t, "", cd.Turns[0].Content)
+	})
+
+	t.Run("should delete the memories from the conversation", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		speaker := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+		c := newConversationWithMemories(t, db, speaker)
+
+		err := db.AnonymizeExpiredConversation(t.Context(), c.ID)
+		is.NotError(t, err)
+
+		memories, err := db.GetMemories(t.Context(), speaker.ID)
+		is.NotError(t, err)
+		is.Equal(t, 1, len(memories))
+		is.Equal(t, "Crackers are tasty.", memories[0].Content)
+	})
+}
+
+// newConversationWithMemories for the speaker, one remembered from a turn and one extracted from the conversation,
+// and a memory the speaker has from elsewhere.
+func newConversationWithMemories(t *testing.T, db *sqlite.Database, speaker model.Speaker) model.Conversation {
+	t.Helper()
+
+	c := sqlitetest.NewConversation(t, db, "Birds")
+	turn, err := db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: speaker.ID, Content: "Squawk!"})
+	is.NotError(t, err)
+
+	_, err = db.RememberTurn(t.Context(), turn.ID)
+	is.NotError(t, err)
+	err = db.SaveExtractedMemories(t.Context(), c.ID, turn.Created.T, []model.Memory{{SpeakerID: speaker.ID, Content: "Birds squawk."}})
+	is.NotError(t, err)
+	_, err = db.SaveMemory(t.Context(), model.Memory{SpeakerID: speaker.ID, Content: "Crackers are tasty."})
+	is.NotError(t, err)
+
+	memories, err := db.GetMemories(t.Context(), speaker.ID)
+	is.NotError(t, err)
+	is.Equal(t, 3, len(memories))
+
+	return c
+}
@@ -0,0 +1,155 @@
+package sqlite
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"time"
+
+	"maragu.dev/errors"
+
+	"app/model"
+)
+
+// GetShares of the conversation with the given ID, newest first, including revoked and expired ones.
+func (d *Database) GetShares(ctx context.Context, id model.ConversationID) ([]model.Share, error) {
+	var shares []model.Share
+	err := d.H.Select(ctx, &shares, `select * from shares where conversation_id = ? order by created desc, id desc`, id)
+	return shares, err
+}
+
+// CreateShare of the conversation with the given ID, with a new unguessable token.
+// The finished turns of the conversation are kept with the share as they are now, see [Database.GetSharedConversationDocument].
+// If expires is zero, the share doesn't expire.
+// If the conversation doesn't exist or is in the trash, [model.ErrorConversationNotFound] is returned.
+func (d *Database) CreateShare(ctx context.Context, id model.ConversationID, expires time.Time) (model.Share, error) {
+	var s model.Share
+	err := d.H.InTx(ctx, func(ctx context.Context, tx *Tx) error {
+		var conversationExists bool
+		if err := tx.Get(ctx, &conversationExists, `select exists (select 1 from conversations where id = ? and deleted is null)`, id); err != nil {
+			return err
+		}
+		if !conversationExists {
+			return model.ErrorConversationNotFound
+		}
+
+		var expiresValue *model.Time
+		if !expires.IsZero() {
+			expiresValue = &model.Time{T: expires}
+		}
+
+		const query = `
+			insert into shares (conversation_id, token, expires)
+			values (?, ?, ?)
+			returning *`
+		if err := tx.Get(ctx, &s, query, id, rand.Text(), expiresValue); err != nil {
+			return err
+		}
+
+		// Turns in the trash and replies to them are left out, like in conversation documents
+		const insert = `
+			insert into share_turns (share_id, position, turn_id, created, updated, speaker_id, speaker_revision_id,
+				reply_to_id, candidate, model_id, status, started, finished, content, reasoning, output, pinned)
+			select ?, row_number() over (order by t.created, t.rowid), t.id, t.created, t.updated, t.speaker_id,
+				coalesce(t.speaker_revision_id, ''), t.reply_to_id, t.candidate, t.model_id, t.status, t.started, t.finished,
+				t.content, t.reasoning, t.output, t.pinned
+			from turns t
+			left join turns r on r.id = t.reply_to_id
+			where t.conversation_id = ? and t.deleted is null and r.deleted is null and t.status in ('complete', 'failed', 'cancelled')`
+		if err := tx.Exec(ctx, insert, s.ID, id); err != nil {
+			return errors.Wrap(err, "error saving shared turns")
+		}
+		return nil
+	})
+	return s, err
+}
+
+// RevokeShare with the given ID, so its link stops working. Revoking can't be undone.
+// If the share doesn't exist or is already revoked, [model.ErrorShareNotFound] is returned.
+func (d *Database) RevokeShare(ctx context.Context, id model.ShareID) error {
+	const query = `
+		update shares set revoked = strftime('%Y-%m-%dT%H:%M:%fZ')
+		where id = ? and revoked is null
+		returning true`
+	var exists bool
+	if err := d.H.Get(ctx, &exists, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.ErrorShareNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// GetSharedConversationDocument by share token, for showing to anyone with the link.
+// The document has the turns as they were when the conversation was shared, without errors,
+// and system prompts and remembered turns are left out.
+// If there's no share with the token, or it's revoked or expired, [model.ErrorShareNotFound] is returned.
+// If the conversation is in the trash, [model.ErrorConversationNotFound] is returned.
+func (d *Database) GetSharedConversationDocument(ctx context.Context, token string) (model.ConversationDocument, error) {
+	var s model.Share
+	if err := d.H.Get(ctx, &s, `select * from shares where token = ?`, token); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.ConversationDocument{}, model.ErrorShareNotFound
+		}
+		return model.ConversationDocument{}, err
+	}
+	if !s.Active(time.Now()) {
+		return model.ConversationDocument{}, model.ErrorShareNotFound
+	}
+
+	cd := model.ConversationDocument{
+		Models:           map[model.ModelID]model.Model{},
+		Speakers:         map[model.SpeakerID]model.Speaker{},
+		SpeakerRevisions: map[model.SpeakerRevisionID]model.SpeakerRevision{},
+		RememberedTurns:  map[model.TurnID]bool{},
+	}
+
+	err := d.H.InTx(ctx, func(ctx context.Context, tx *Tx) error {
+		if err := tx.Get(ctx, &cd.Conversation, `select * from conversations where id = ? and deleted is null`, s.ConversationID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return model.ErrorConversationNotFound
+			}
+			return err
+		}
+
+		const turnsQuery = `
+			select turn_id as id, created, updated, ? as conversation_id, speaker_id, speaker_revision_id, reply_to_id,
+				candidate, model_id, status, started, finished, content, reasoning, output, pinned
+			from share_turns
+			where share_id = ?
+			order by position`
+		if err := tx.Select(ctx, &cd.Turns, turnsQuery, s.ConversationID, s.ID); err != nil {
+			return err
+		}
+
+		const tagsQuery = `
+			select t.*
+			from tags t
+			join conversation_tags ct on ct.tag_id = t.id
+			where ct.conversation_id = ?
+			order by t.name`
+		if err := tx.Select(ctx, &cd.Tags, tagsQuery, s.ConversationID); err != nil {
+			return err
+		}
+
+		return getTurnRelations(ctx, tx, d.stmts, &cd)
+	})
+	if err != nil {
+		return cd, err
+	}
+
+	cd.Conversation.System = ""
+
+	for id, speaker := range cd.Speakers {
+		speaker.System = ""
+		cd.Speakers[id] = speaker
+	}
+
+	for id, sr := range cd.SpeakerRevisions {
+		sr.System = ""
+		cd.SpeakerRevisions[id] = sr
+	}
+
+	return cd, nil
+}
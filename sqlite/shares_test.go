@@ -0,0 +1,143 @@
+package sqlite_test
+
+import (
+	"testing"
+	"time"
+
+	"maragu.dev/is"
+
+	"app/model"
+	"app/sqlitetest"
+)
+
+func TestDatabase_CreateShare(t *testing.T) {
+	t.Run("should create a share with a unique token", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		c := sqlitetest.NewConversation(t, db, "Birds")
+
+		s1, err := db.CreateShare(t.Context(), c.ID, time.Time{})
+		is.NotError(t, err)
+		s2, err := db.CreateShare(t.Context(), c.ID, time.Now().Add(time.Hour))
+		is.NotError(t, err)
+
+		is.True(t, len(s1.Token) >= 26)
+		is.True(t, s1.Token != s2.Token)
+		is.True(t, s1.Expires.T.IsZero())
+		is.True(t, !s2.Expires.T.IsZero())
+
+		shares, err := db.GetShares(t.Context(), c.ID)
+		is.NotError(t, err)
+		is.Equal(t, 2, len(shares))
+	})
+
+	t.Run("should return not found if the conversation is in the trash", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		c := sqlitetest.NewConversation(t, db, "Birds")
+		is.NotError(t, db.DeleteConversation(t.Context(), c.ID))
+
+		_, err := db.CreateShare(t.Context(), c.ID, time.Time{})
+		is.Error(t, model.ErrorConversationNotFound, err)
+	})
+}
+
+func TestDatabase_GetSharedConversationDocument(t *testing.T) {
+	t.Run("should return the turns before the share without system prompts", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		speaker := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+		speaker.System = "You are secretly a parrot."
+		speaker, err := db.SaveSpeaker(t.Context(), speaker)
+		is.NotError(t, err)
+		c := sqlitetest.NewConversation(t, db, "Birds")
+
+		turn, err := db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: speaker.ID, Content: "Squawk!"})
+		is.NotError(t, err)
+
+		s, err := db.CreateShare(t.Context(), c.ID, time.Time{})
+		is.NotError(t, err)
+
+		time.Sleep(time.Millisecond)
+		_, err = db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: speaker.ID, Content: "Squawk?"})
+		is.NotError(t, err)
+
+		cd, err := db.GetSharedConversationDocument(t.Context(), s.Token)
+		is.NotError(t, err)
+		is.Equal(t, 1, len(cd.Turns))
+		is.Equal(t, turn.ID, cd.Turns[0].ID)
+		is.Equal(t, "Parrot", cd.Speakers[speaker.ID].Name)
+		is.Equal(t, "", cd.Speakers[speaker.ID].System)
+		is.Equal(t, "", cd.SpeakerRevisions[turn.SpeakerRevisionID].System)
+
+		// The conversation document itself still has everything
+		cd, err = db.GetConversationDocument(t.Context(), c.ID)
+		is.NotError(t, err)
+		is.Equal(t, 2, len(cd.Turns))
+		is.Equal(t, "You are secretly a parrot.", cd.Speakers[speaker.ID].System)
+	})
+
+	t.Run("should keep the turns as they were shared, without unfinished turns and errors", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		speaker := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+		c := sqlitetest.NewConversation(t, db, "Birds")
+
+		kept, err := db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: speaker.ID, Content: "Squawk!"})
+		is.NotError(t, err)
+		failed, err := db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: speaker.ID, Status: model.TurnStatusFailed,
+			Error: "Invalid API key sk-123"})
+		is.NotError(t, err)
+		streaming, err := db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: speaker.ID, Status: model.TurnStatusStreaming})
+		is.NotError(t, err)
+
+		s, err := db.CreateShare(t.Context(), c.ID, time.Time{})
+		is.NotError(t, err)
+
+		// Changes after sharing don't show in the share
+		streaming.Content = "Squawk?"
+		streaming.Status = model.TurnStatusComplete
+		err = db.UpdateTurnGeneration(t.Context(), streaming)
+		is.NotError(t, err)
+		err = db.DeleteTurn(t.Context(), kept.ID)
+		is.NotError(t, err)
+
+		cd, err := db.GetSharedConversationDocument(t.Context(), s.Token)
+		is.NotError(t, err)
+		is.Equal(t, 2, len(cd.Turns))
+		is.Equal(t, kept.ID, cd.Turns[0].ID)
+		is.Equal(t, "Squawk!", cd.Turns[0].Content)
+		is.Equal(t, c.ID, cd.Turns[0].ConversationID)
+		is.Equal(t, failed.ID, cd.Turns[1].ID)
+		is.Equal(t, model.TurnStatusFailed, cd.Turns[1].Status)
+		is.Equal(t, "", cd.Turns[1].Error)
+		is.Equal(t, "Parrot", cd.Speakers[speaker.ID].Name)
+	})
+
+	t.Run("should return not found for unknown, revoked, and expired shares", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		c := sqlitetest.NewConversation(t, db, "Birds")
+
+		_, err := db.GetSharedConversationDocument(t.Context(), "unknown")
+		is.Error(t, model.ErrorShareNotFound, err)
+
+		s, err := db.CreateShare(t.Context(), c.ID, time.Time{})
+		is.NotError(t, err)
+		is.NotError(t, db.RevokeShare(t.Context(), s.ID))
+		_, err = db.GetSharedConversationDocument(t.Context(), s.Token)
+		is.Error(t, model.ErrorShareNotFound, err)
+		is.Error(t, model.ErrorShareNotFound, db.RevokeShare(t.Context(), s.ID))
+
+		s, err = db.CreateShare(t.Context(), c.ID, time.Now().Add(-time.Minute))
+		is.NotError(t, err)
+		_, err = db.GetSharedConversationDocument(t.Context(), s.Token)
+		is.Error(t, model.ErrorShareNotFound, err)
+	})
+
+	t.Run("should return conversation not found if the conversation is in the trash", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		c := sqlitetest.NewConversation(t, db, "Birds")
+		s, err := db.CreateShare(t.Context(), c.ID, time.Time{})
+		is.NotError(t, err)
+		is.NotError(t, db.DeleteConversation(t.Context(), c.ID))
+
+		_, err = db.GetSharedConversationDocument(t.Context(), s.Token)
+		is.Error(t, model.ErrorConversationNotFound, err)
+	})
+}
@@ -12,7 +12,11 @@ import (
 // SaveSpeaker via upsert.
 // If the speaker's ID is empty, a new speaker is created.
 // Otherwise, the existing speaker is updated.
+// Every change to the speaker is recorded as a new [model.SpeakerRevision].
+// A speaker in the trash with the same name gives up its name, see [freeSpeakerName].
 func (d *Database) SaveSpeaker(ctx context.Context, s model.Speaker) (model.Speaker, error) {
+	defer d.docs.invalidateAll()
+
 	err := d.H.InTx(ctx, func(ctx context.Context, tx *Tx) error {
 		var modelExists bool
 		if err := tx.Get(ctx, &modelExists, `select exists (select 1 from models where id = ?)`, s.ModelID); err != nil {
@@ -22,6 +26,10 @@ func (d *Database) SaveSpeaker(ctx context.Context, s model.Speaker) (model.Spea
 			return model.ErrorModelNotFound
 		}
 
+		if err := freeSpeakerName(ctx, tx, s.Name, s.ID); err != nil {
+			return err
+		}
+
 		if s.ID == "" {
 			const query = `
 				insert into speakers (model_id, name, system, config)
@@ -53,14 +61,14 @@ func (d *Database) SaveSpeaker(ctx context.Context, s model.Speaker) (model.Spea
 	return s, err
 }
 
-// GetSpeakers by name.
+// GetSpeakers that aren't in the trash, by name.
 func (d *Database) GetSpeakers(ctx context.Context) ([]model.Speaker, error) {
 	var speakers []model.Speaker
-	err := d.H.Select(ctx, &speakers, "select * from speakers order by name")
+	err := d.H.Select(ctx, &speakers, "select * from speakers where deleted is null order by name")
 	return speakers, err
 }
 
-// GetSpeaker by ID or name.
+// GetSpeaker by ID or name, also if it's in the trash.
 // ID has precedence over name.
 func (d *Database) GetSpeaker(ctx context.Context, f model.GetSpeakerFilter) (model.Speaker, error) {
 	var s model.Speaker
@@ -80,3 +88,103 @@ func (d *Database) GetSpeaker(ctx context.Context, f model.GetSpeakerFilter) (mo
 	}
 	return s, err
 }
+
+// GetSpeakerRevisions for the speaker with the given ID, newest revision first.
+func (d *Database) GetSpeakerRevisions(ctx context.Context, id model.SpeakerID) ([]model.SpeakerRevision, error) {
+	var srs []model.SpeakerRevision
+	err := d.H.Select(ctx, &srs, "select * from speaker_revisions where speaker_id = ? order by revision desc", id)
+	return srs, err
+}
+
+// GetSpeakerRevision by ID.
+func (d *Database) GetSpeakerRevision(ctx context.Context, id model.SpeakerRevisionID) (model.SpeakerRevision, error) {
+	var sr model.SpeakerRevision
+	err := d.H.Get(ctx, &sr, "select * from speaker_revisions where id = ?", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return sr, model.ErrorSpeakerRevisionNotFound
+	}
+	return sr, err
+}
+
+// RollbackSpeaker to the revision with the given ID, which must belong to the speaker.
+// The rollback itself is recorded as a new revision, so no history is lost.
+func (d *Database) RollbackSpeaker(ctx context.Context, id model.SpeakerID, revisionID model.SpeakerRevisionID) (model.Speaker, error) {
+	defer d.docs.invalidateAll()
+
+	var s model.Speaker
+	err := d.H.InTx(ctx, func(ctx context.Context, tx *Tx) error {
+		var sr model.SpeakerRevision
+		if err := tx.Get(ctx, &sr, `select * from speaker_revisions where id = ? and speaker_id = ?`, revisionID, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return model.ErrorSpeakerRevisionNotFound
+			}
+			return err
+		}
+
+		if err := freeSpeakerName(ctx, tx, sr.Name, id); err != nil {
+			return err
+		}
+
+		const query = `
+			update speakers set model_id = ?, name = ?, system = ?, config = ?
+			where id = ?
+			returning *`
+		return tx.Get(ctx, &s, query, sr.ModelID, sr.Name, sr.System, sr.Config, id)
+	})
+
+	return s, err
+}
+
+// GetSpeakerFallbackModels for the speaker with the given ID, in the order they should be tried.
+func (d *Database) GetSpeakerFallbackModels(ctx context.Context, id model.SpeakerID) ([]model.ModelID, error) {
+	var ids []model.ModelID
+	err := d.H.Select(ctx, &ids, "select model_id from speaker_fallback_models where speaker_id = ? order by position", id)
+	return ids, err
+}
+
+// SaveSpeakerFallbackModels for the speaker with the given ID, replacing any existing fallback models.
+// The models are tried in the given order when the speaker's own model is unavailable.
+func (d *Database) SaveSpeakerFallbackModels(ctx context.Context, id model.SpeakerID, modelIDs []model.ModelID) error {
+	return d.H.InTx(ctx, func(ctx context.Context, tx *Tx) error {
+		var speakerExists bool
+		if err := tx.Get(ctx, &speakerExists, `select exists (select 1 from speakers where id = ?)`, id); err != nil {
+			return err
+		}
+		if !speakerExists {
+			return model.ErrorSpeakerNotFound
+		}
+
+		if err := tx.Exec(ctx, `delete from speaker_fallback_models where speaker_id = ?`, id); err != nil {
+			return err
+		}
+
+		for i, modelID := range modelIDs {
+			var modelExists bool
+			if err := tx.Get(ctx, &modelExists, `select exists (select 1 from models where id = ?)`, modelID); err != nil {
+				return err
+			}
+			if !modelExists {
+				return model.ErrorModelNotFound
+			}
+
+			if err := tx.Exec(ctx, `insert into speaker_fallback_models (speaker_id, position, model_id) values (?, ?, ?)`, id, i, modelID); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// freeSpeakerName taken by a speaker in the trash other than the one with the given ID, if any,
+// by adding when it was deleted to its name. Speakers in the trash keep their names, so their turns still show them,
+// until another speaker needs the name.
+func freeSpeakerName(ctx context.Context, tx *Tx, name string, id model.SpeakerID) error {
+	const query = `
+		update speakers set name = name || ' (deleted ' || deleted || ')'
+		where name = ? and id != ? and deleted is not null`
+	if err := tx.Exec(ctx, query, name, id); err != nil {
+		return errors.Wrap(err, "error freeing speaker name")
+	}
+	return nil
+}
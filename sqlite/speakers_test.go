@@ -195,3 +195,160 @@ func TestDatabase_GetSpeaker(t *testing.T) {
 		_, _ = db.GetSpeaker(t.Context(), filter)
 	})
 }
+
+func TestDatabase_GetSpeakerRevisions(t *testing.T) {
+	t.Run("should record a revision when a speaker is created and when it changes", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		s, err := db.SaveSpeaker(t.Context(), model.Speaker{
+			ModelID: modelGPT5,
+			Name:    "Test Speaker",
+			System:  "First system prompt",
+			Config:  `{}`,
+		})
+		is.NotError(t, err)
+
+		s.System = "Second system prompt"
+		s, err = db.SaveSpeaker(t.Context(), s)
+		is.NotError(t, err)
+
+		revisions, err := db.GetSpeakerRevisions(t.Context(), s.ID)
+		is.NotError(t, err)
+		is.Equal(t, 2, len(revisions))
+		is.Equal(t, 2, revisions[0].Revision)
+		is.Equal(t, "Second system prompt", revisions[0].System)
+		is.Equal(t, 1, revisions[1].Revision)
+		is.Equal(t, "First system prompt", revisions[1].System)
+	})
+
+	t.Run("should not record a revision when nothing changed", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		s, err := db.SaveSpeaker(t.Context(), model.Speaker{
+			ModelID: modelGPT5,
+			Name:    "Test Speaker",
+			System:  "System prompt",
+			Config:  `{}`,
+		})
+		is.NotError(t, err)
+
+		_, err = db.SaveSpeaker(t.Context(), s)
+		is.NotError(t, err)
+
+		revisions, err := db.GetSpeakerRevisions(t.Context(), s.ID)
+		is.NotError(t, err)
+		is.Equal(t, 1, len(revisions))
+	})
+
+	t.Run("should have revisions for seeded speakers", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		s, err := db.GetSpeaker(t.Context(), model.GetSpeakerFilter{Name: "The Caretaker"})
+		is.NotError(t, err)
+
+		revisions, err := db.GetSpeakerRevisions(t.Context(), s.ID)
+		is.NotError(t, err)
+		is.Equal(t, 1, len(revisions))
+		is.Equal(t, s.System, revisions[0].System)
+	})
+}
+
+func TestDatabase_RollbackSpeaker(t *testing.T) {
+	t.Run("should restore the speaker to the revision and record a new revision", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		s, err := db.SaveSpeaker(t.Context(), model.Speaker{
+			ModelID: modelGPT5,
+			Name:    "Test Speaker",
+			System:  "First system prompt",
+			Config:  `{"temperature": 0.5}`,
+		})
+		is.NotError(t, err)
+
+		s.ModelID = modelClaudeOpus
+		s.System = "Second system prompt"
+		s.Config = `{"temperature": 0.9}`
+		_, err = db.SaveSpeaker(t.Context(), s)
+		is.NotError(t, err)
+
+		revisions, err := db.GetSpeakerRevisions(t.Context(), s.ID)
+		is.NotError(t, err)
+
+		rolledBack, err := db.RollbackSpeaker(t.Context(), s.ID, revisions[1].ID)
+		is.NotError(t, err)
+		is.Equal(t, modelGPT5, rolledBack.ModelID)
+		is.Equal(t, "First system prompt", rolledBack.System)
+		is.Equal(t, model.JSON(`{"temperature": 0.5}`), rolledBack.Config)
+
+		revisions, err = db.GetSpeakerRevisions(t.Context(), s.ID)
+		is.NotError(t, err)
+		is.Equal(t, 3, len(revisions))
+		is.Equal(t, "First system prompt", revisions[0].System)
+	})
+
+	t.Run("should return ErrorSpeakerRevisionNotFound when revision belongs to another speaker", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		s1, err := db.SaveSpeaker(t.Context(), model.Speaker{ModelID: modelGPT5, Name: "Speaker One", Config: `{}`})
+		is.NotError(t, err)
+		s2, err := db.SaveSpeaker(t.Context(), model.Speaker{ModelID: modelGPT5, Name: "Speaker Two", Config: `{}`})
+		is.NotError(t, err)
+
+		revisions, err := db.GetSpeakerRevisions(t.Context(), s2.ID)
+		is.NotError(t, err)
+
+		_, err = db.RollbackSpeaker(t.Context(), s1.ID, revisions[0].ID)
+		is.Error(t, model.ErrorSpeakerRevisionNotFound, err)
+	})
+}
+
+func TestDatabase_SaveSpeakerFallbackModels(t *testing.T) {
+	t.Run("should save and replace fallback models in order", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		s, err := db.SaveSpeaker(t.Context(), model.Speaker{ModelID: modelClaudeOpus, Name: "Test Speaker", Config: `{}`})
+		is.NotError(t, err)
+
+		ids, err := db.GetSpeakerFallbackModels(t.Context(), s.ID)
+		is.NotError(t, err)
+		is.Equal(t, 0, len(ids))
+
+		err = db.SaveSpeakerFallbackModels(t.Context(), s.ID, []model.ModelID{modelGemini, modelGPT5})
+		is.NotError(t, err)
+
+		ids, err = db.GetSpeakerFallbackModels(t.Context(), s.ID)
+		is.NotError(t, err)
+		is.EqualSlice(t, []model.ModelID{modelGemini, modelGPT5}, ids)
+
+		err = db.SaveSpeakerFallbackModels(t.Context(), s.ID, []model.ModelID{modelGPT5})
+		is.NotError(t, err)
+
+		ids, err = db.GetSpeakerFallbackModels(t.Context(), s.ID)
+		is.NotError(t, err)
+		is.EqualSlice(t, []model.ModelID{modelGPT5}, ids)
+	})
+
+	t.Run("should return ErrorModelNotFound and keep existing fallback models when a model does not exist", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		s, err := db.SaveSpeaker(t.Context(), model.Speaker{ModelID: modelClaudeOpus, Name: "Test Speaker", Config: `{}`})
+		is.NotError(t, err)
+
+		err = db.SaveSpeakerFallbackModels(t.Context(), s.ID, []model.ModelID{modelGemini})
+		is.NotError(t, err)
+
+		err = db.SaveSpeakerFallbackModels(t.Context(), s.ID, []model.ModelID{"mo_nonexistent"})
+		is.Error(t, model.ErrorModelNotFound, err)
+
+		ids, err := db.GetSpeakerFallbackModels(t.Context(), s.ID)
+		is.NotError(t, err)
+		is.EqualSlice(t, []model.ModelID{modelGemini}, ids)
+	})
+
+	t.Run("should return ErrorSpeakerNotFound when the speaker does not exist", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		err := db.SaveSpeakerFallbackModels(t.Context(), "sp_nonexistent", []model.ModelID{modelGemini})
+		is.Error(t, model.ErrorSpeakerNotFound, err)
+	})
+}
@@ -0,0 +1,67 @@
+package sqlite
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+	"maragu.dev/glue/sql"
+)
+
+// statements that are prepared once and reused in transactions, for the queries of conversation documents,
+// which are read on every poll of a conversation that isn't in the document cache.
+// Every query string is kept, so only use it for queries built from a fixed set of strings.
+type statements struct {
+	h     *sql.Helper
+	db    *sqlx.DB
+	mutex sync.Mutex
+	stmts map[string]*sqlx.Stmt
+}
+
+func newStatements(h *sql.Helper) *statements {
+	return &statements{
+		h:     h,
+		stmts: map[string]*sqlx.Stmt{},
+	}
+}
+
+// prepare the query on the database, or get it if it's prepared already.
+func (s *statements) prepare(ctx context.Context, query string) (*sqlx.Stmt, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// Statements belong to a connection pool, so start over if the helper connected again
+	if s.db != s.h.DB {
+		s.db = s.h.DB
+		s.stmts = map[string]*sqlx.Stmt{}
+	}
+
+	if stmt, ok := s.stmts[query]; ok {
+		return stmt, nil
+	}
+
+	stmt, err := s.db.PreparexContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	s.stmts[query] = stmt
+	return stmt, nil
+}
+
+// get like [Tx.Get], with the prepared statement for the query.
+func (s *statements) get(ctx context.Context, tx *Tx, dest any, query string, args ...any) error {
+	stmt, err := s.prepare(ctx, query)
+	if err != nil {
+		return err
+	}
+	return tx.Tx.StmtxContext(ctx, stmt).GetContext(ctx, dest, args...)
+}
+
+// selekt like [Tx.Select], with the prepared statement for the query.
+func (s *statements) selekt(ctx context.Context, tx *Tx, dest any, query string, args ...any) error {
+	stmt, err := s.prepare(ctx, query)
+	if err != nil {
+		return err
+	}
+	return tx.Tx.StmtxContext(ctx, stmt).SelectContext(ctx, dest, args...)
+}
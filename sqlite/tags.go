@@ -0,0 +1,66 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+
+	"maragu.dev/errors"
+
+	"app/model"
+)
+
+// GetTags by name.
+func (d *Database) GetTags(ctx context.Context) ([]model.Tag, error) {
+	var ts []model.Tag
+	err := d.H.Select(ctx, &ts, `select * from tags order by name`)
+	return ts, err
+}
+
+// TagConversation with the tag with the given name, which is created if it doesn't exist.
+// Tagging a conversation that already has the tag does nothing.
+// If the conversation doesn't exist, [model.ErrorConversationNotFound] is returned.
+func (d *Database) TagConversation(ctx context.Context, id model.ConversationID, name string) (model.Tag, error) {
+	defer d.docs.invalidate(id)
+
+	var t model.Tag
+	err := d.H.InTx(ctx, func(ctx context.Context, tx *Tx) error {
+		var conversationExists bool
+		if err := tx.Get(ctx, &conversationExists, `select exists (select 1 from conversations where id = ?)`, id); err != nil {
+			return err
+		}
+		if !conversationExists {
+			return model.ErrorConversationNotFound
+		}
+
+		// The no-op update makes the existing tag be returned
+		const query = `
+			insert into tags (name) values (?)
+			on conflict (name) do update set name = excluded.name
+			returning *`
+		if err := tx.Get(ctx, &t, query, name); err != nil {
+			return err
+		}
+
+		return tx.Exec(ctx, `insert into conversation_tags (conversation_id, tag_id) values (?, ?) on conflict do nothing`, id, t.ID)
+	})
+	return t, err
+}
+
+// UntagConversation by removing the tag with the given ID from it.
+// Tags that no conversation has anymore are deleted.
+// If the conversation doesn't have the tag, [model.ErrorTagNotFound] is returned.
+func (d *Database) UntagConversation(ctx context.Context, id model.ConversationID, tagID model.TagID) error {
+	defer d.docs.invalidate(id)
+
+	return d.H.InTx(ctx, func(ctx context.Context, tx *Tx) error {
+		var exists bool
+		if err := tx.Get(ctx, &exists, `delete from conversation_tags where conversation_id = ? and tag_id = ? returning true`, id, tagID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return model.ErrorTagNotFound
+			}
+			return err
+		}
+
+		return tx.Exec(ctx, `delete from tags where id = ? and not exists (select 1 from conversation_tags where tag_id = tags.id)`, tagID)
+	})
+}
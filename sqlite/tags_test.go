@@ -0,0 +1,71 @@
+package sqlite_test
+
+import (
+	"testing"
+
+	"maragu.dev/is"
+
+	"app/model"
+	"app/sqlitetest"
+)
+
+func TestDatabase_TagConversation(t *testing.T) {
+	t.Run("should tag conversations, creating the tag on first use", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		c1 := sqlitetest.NewConversation(t, db, "Birds")
+		c2 := sqlitetest.NewConversation(t, db, "Bees")
+
+		tag1, err := db.TagConversation(t.Context(), c1.ID, "nature")
+		is.NotError(t, err)
+		tag2, err := db.TagConversation(t.Context(), c2.ID, "nature")
+		is.NotError(t, err)
+		is.Equal(t, tag1.ID, tag2.ID)
+
+		// Tagging again does nothing
+		_, err = db.TagConversation(t.Context(), c1.ID, "nature")
+		is.NotError(t, err)
+
+		cd, err := db.GetConversationDocument(t.Context(), c1.ID)
+		is.NotError(t, err)
+		is.Equal(t, 1, len(cd.Tags))
+		is.Equal(t, "nature", cd.Tags[0].Name)
+
+		ts, err := db.GetTags(t.Context())
+		is.NotError(t, err)
+		is.Equal(t, 1, len(ts))
+	})
+
+	t.Run("should return conversation not found if the conversation doesn't exist", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		_, err := db.TagConversation(t.Context(), "co_doesnotexist", "nature")
+		is.Error(t, model.ErrorConversationNotFound, err)
+	})
+}
+
+func TestDatabase_UntagConversation(t *testing.T) {
+	t.Run("should remove the tag, and delete it when no conversation has it", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		c1 := sqlitetest.NewConversation(t, db, "Birds")
+		c2 := sqlitetest.NewConversation(t, db, "Bees")
+		tag, err := db.TagConversation(t.Context(), c1.ID, "nature")
+		is.NotError(t, err)
+		_, err = db.TagConversation(t.Context(), c2.ID, "nature")
+		is.NotError(t, err)
+
+		err = db.UntagConversation(t.Context(), c1.ID, tag.ID)
+		is.NotError(t, err)
+		ts, err := db.GetTags(t.Context())
+		is.NotError(t, err)
+		is.Equal(t, 1, len(ts))
+
+		err = db.UntagConversation(t.Context(), c2.ID, tag.ID)
+		is.NotError(t, err)
+		ts, err = db.GetTags(t.Context())
+		is.NotError(t, err)
+		is.Equal(t, 0, len(ts))
+
+		err = db.UntagConversation(t.Context(), c2.ID, tag.ID)
+		is.Error(t, model.ErrorTagNotFound, err)
+	})
+}
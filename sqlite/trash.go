@@ -0,0 +1,192 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"maragu.dev/errors"
+
+	"app/model"
+)
+
+// DeleteConversation by moving it to the trash, from where it can be restored with [Database.RestoreConversation].
+// Turns that are generating in the conversation are cancelled.
+// If the conversation doesn't exist or is already in the trash, [model.ErrorConversationNotFound] is returned.
+func (d *Database) DeleteConversation(ctx context.Context, id model.ConversationID) error {
+	defer d.docs.invalidate(id)
+
+	return d.H.InTx(ctx, func(ctx context.Context, tx *Tx) error {
+		const query = `
+			update conversations set deleted = strftime('%Y-%m-%dT%H:%M:%fZ')
+			where id = ? and deleted is null
+			returning true`
+		var exists bool
+		if err := tx.Get(ctx, &exists, query, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return model.ErrorConversationNotFound
+			}
+			return err
+		}
+
+		const update = `
+			update turns set status = 'cancelled', finished = strftime('%Y-%m-%dT%H:%M:%fZ')
+			where conversation_id = ? and status in ('pending', 'streaming')`
+		return tx.Exec(ctx, update, id)
+	})
+}
+
+// RestoreConversation from the trash.
+// If the conversation doesn't exist or isn't in the trash, [model.ErrorConversationNotFound] is returned.
+func (d *Database) RestoreConversation(ctx context.Context, id model.ConversationID) error {
+	defer d.docs.invalidate(id)
+
+	var exists bool
+	if err := d.H.Get(ctx, &exists, `update conversations set deleted = null where id = ? and deleted is not null returning true`, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.ErrorConversationNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// DeleteTurn by moving it to the trash, from where it can be restored with [Database.RestoreTurn].
+// Replies to the turn are hidden with it, and the turn and its replies are cancelled if they're generating.
+// If the turn doesn't exist or is already in the trash, [model.ErrorTurnNotFound] is returned.
+func (d *Database) DeleteTurn(ctx context.Context, id model.TurnID) error {
+	var conversationID model.ConversationID
+	err := d.H.InTx(ctx, func(ctx context.Context, tx *Tx) error {
+		const query = `
+			update turns set deleted = strftime('%Y-%m-%dT%H:%M:%fZ')
+			where id = ? and deleted is null
+			returning conversation_id`
+		if err := tx.Get(ctx, &conversationID, query, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return model.ErrorTurnNotFound
+			}
+			return err
+		}
+
+		const update = `
+			update turns set status = 'cancelled', finished = strftime('%Y-%m-%dT%H:%M:%fZ')
+			where (id = ? or reply_to_id = ?) and status in ('pending', 'streaming')`
+		return tx.Exec(ctx, update, id, id)
+	})
+	if err != nil {
+		return err
+	}
+	d.docs.invalidate(conversationID)
+	return nil
+}
+
+// RestoreTurn from the trash, together with its replies.
+// If the turn doesn't exist or isn't in the trash, [model.ErrorTurnNotFound] is returned.
+func (d *Database) RestoreTurn(ctx context.Context, id model.TurnID) error {
+	var conversationID model.ConversationID
+	if err := d.H.Get(ctx, &conversationID, `update turns set deleted = null where id = ? and deleted is not null returning conversation_id`, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.ErrorTurnNotFound
+		}
+		return err
+	}
+	d.docs.invalidate(conversationID)
+	return nil
+}
+
+// DeleteSpeaker by moving it to the trash, from where it can be restored with [Database.RestoreSpeaker].
+// Speakers in the trash can't take new turns, but their existing turns are kept.
+// The speaker keeps its name in the trash, until another speaker is saved with it, see [freeSpeakerName].
+// If the speaker doesn't exist or is already in the trash, [model.ErrorSpeakerNotFound] is returned.
+func (d *Database) DeleteSpeaker(ctx context.Context, id model.SpeakerID) error {
+	defer d.docs.invalidateAll()
+
+	const query = `
+		update speakers set deleted = strftime('%Y-%m-%dT%H:%M:%fZ')
+		where id = ? and deleted is null
+		returning true`
+	var exists bool
+	if err := d.H.Get(ctx, &exists, query, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.ErrorSpeakerNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// RestoreSpeaker from the trash.
+// If the speaker doesn't exist or isn't in the trash, [model.ErrorSpeakerNotFound] is returned.
+func (d *Database) RestoreSpeaker(ctx context.Context, id model.SpeakerID) error {
+	defer d.docs.invalidateAll()
+
+	var exists bool
+	if err := d.H.Get(ctx, &exists, `update speakers set deleted = null where id = ? and deleted is not null returning true`, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return model.ErrorSpeakerNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// GetTrash with everything that can be restored.
+// Turns in conversations that are in the trash are left out, since they're restored with the conversation.
+func (d *Database) GetTrash(ctx context.Context) (model.Trash, error) {
+	var trash model.Trash
+	err := d.H.InTx(ctx, func(ctx context.Context, tx *Tx) error {
+		if err := tx.Select(ctx, &trash.Conversations, `select * from conversations where deleted is not null order by deleted desc`); err != nil {
+			return err
+		}
+
+		if err := tx.Select(ctx, &trash.Speakers, `select * from speakers where deleted is not null order by deleted desc`); err != nil {
+			return err
+		}
+
+		const query = `
+			select t.*, c.topic, s.name as speaker_name
+			from turns t
+			join conversations c on c.id = t.conversation_id
+			join speakers s on s.id = t.speaker_id
+			where t.deleted is not null and c.deleted is null
+			order by t.deleted desc`
+		return tx.Select(ctx, &trash.Turns, query)
+	})
+	return trash, err
+}
+
+// PurgeTrash by permanently deleting everything that was moved to the trash before the given time.
+// Replies to purged turns and turns in purged conversations are deleted with them,
+// as are the memories from purged conversations and turns.
+// Speakers are kept until no turns reference them anymore, so conversations they took part in stay intact.
+func (d *Database) PurgeTrash(ctx context.Context, before time.Time) (model.PurgedTrash, error) {
+	defer d.docs.invalidateAll()
+
+	var purged model.PurgedTrash
+	err := d.H.InTx(ctx, func(ctx context.Context, tx *Tx) error {
+		var ids []string
+		if err := tx.Select(ctx, &ids, `delete from turns where deleted < ? returning id`, model.Time{T: before}); err != nil {
+			return errors.Wrap(err, "error purging turns")
+		}
+		purged.Turns = len(ids)
+
+		ids = nil
+		if err := tx.Select(ctx, &ids, `delete from conversations where deleted < ? returning id`, model.Time{T: before}); err != nil {
+			return errors.Wrap(err, "error purging conversations")
+		}
+		purged.Conversations = len(ids)
+
+		const query = `
+			delete from speakers
+			where deleted < ? and not exists (select 1 from turns where speaker_id = speakers.id)
+			returning id`
+		ids = nil
+		if err := tx.Select(ctx, &ids, query, model.Time{T: before}); err != nil {
+			return errors.Wrap(err, "error purging speakers")
+		}
+		purged.Speakers = len(ids)
+
+		return nil
+	})
+	return purged, err
+}
@@ -0,0 +1,264 @@
+package sqlite_test
+
+import (
+	"testing"
+	"time"
+
+	"maragu.dev/is"
+
+	"app/model"
+	"app/sqlitetest"
+)
+
+func TestDatabase_DeleteConversation(t *testing.T) {
+	t.Run("should hide the conversation until it's restored", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		c := sqlitetest.NewConversation(t, db, "Birds")
+
+		err := db.DeleteConversation(t.Context(), c.ID)
+		is.NotError(t, err)
+
+		_, err = db.GetConversationDocument(t.Context(), c.ID)
+		is.Error(t, model.ErrorConversationNotFound, err)
+		cs, err := db.GetConversations(t.Context(), model.GetConversationsFilter{})
+		is.NotError(t, err)
+		is.Equal(t, 0, len(cs))
+
+		trash, err := db.GetTrash(t.Context())
+		is.NotError(t, err)
+		is.Equal(t, 1, len(trash.Conversations))
+		is.Equal(t, c.ID, trash.Conversations[0].ID)
+		is.True(t, !trash.Conversations[0].Deleted.T.IsZero())
+
+		err = db.DeleteConversation(t.Context(), c.ID)
+		is.Error(t, model.ErrorConversationNotFound, err)
+
+		err = db.RestoreConversation(t.Context(), c.ID)
+		is.NotError(t, err)
+
+		_, err = db.GetConversationDocument(t.Context(), c.ID)
+		is.NotError(t, err)
+
+		err = db.RestoreConversation(t.Context(), c.ID)
+		is.Error(t, model.ErrorConversationNotFound, err)
+	})
+
+	t.Run("should cancel turns that are generating", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		speaker := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+		c := sqlitetest.NewConversation(t, db, "Birds")
+		turn, err := db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: speaker.ID, Status: model.TurnStatusPending})
+		is.NotError(t, err)
+
+		err = db.DeleteConversation(t.Context(), c.ID)
+		is.NotError(t, err)
+
+		turn, err = db.GetTurn(t.Context(), turn.ID)
+		is.NotError(t, err)
+		is.Equal(t, model.TurnStatusCancelled, turn.Status)
+	})
+
+	t.Run("should not allow new turns in a deleted conversation", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		speaker := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+		c := sqlitetest.NewConversation(t, db, "Birds")
+
+		err := db.DeleteConversation(t.Context(), c.ID)
+		is.NotError(t, err)
+
+		_, err = db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: speaker.ID, Content: "Squawk!"})
+		is.Error(t, model.ErrorConversationNotFound, err)
+	})
+}
+
+func TestDatabase_DeleteTurn(t *testing.T) {
+	t.Run("should hide the turn and its replies until it's restored", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		human := sqlitetest.NewFakeSpeaker(t, db, "Human", "")
+		parrot := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+		c := sqlitetest.NewConversation(t, db, "Birds")
+
+		first, err := db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: human.ID, Content: "Hi"})
+		is.NotError(t, err)
+		turn, replies, err := db.SaveTurnWithReplies(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: human.ID, Content: "Polly?"},
+			[]model.SpeakerID{parrot.ID})
+		is.NotError(t, err)
+
+		err = db.DeleteTurn(t.Context(), turn.ID)
+		is.NotError(t, err)
+
+		cd, err := db.GetConversationDocument(t.Context(), c.ID)
+		is.NotError(t, err)
+		is.Equal(t, 1, len(cd.Turns))
+		is.Equal(t, first.ID, cd.Turns[0].ID)
+
+		reply, err := db.GetTurn(t.Context(), replies[0].ID)
+		is.NotError(t, err)
+		is.Equal(t, model.TurnStatusCancelled, reply.Status)
+
+		trash, err := db.GetTrash(t.Context())
+		is.NotError(t, err)
+		is.Equal(t, 1, len(trash.Turns))
+		is.Equal(t, turn.ID, trash.Turns[0].ID)
+		is.Equal(t, "Birds", trash.Turns[0].Topic)
+		is.Equal(t, "Human", trash.Turns[0].SpeakerName)
+
+		err = db.RestoreTurn(t.Context(), turn.ID)
+		is.NotError(t, err)
+
+		cd, err = db.GetConversationDocument(t.Context(), c.ID)
+		is.NotError(t, err)
+		is.Equal(t, 3, len(cd.Turns))
+	})
+
+	t.Run("should return not found if the turn is already deleted", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		speaker := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+		c := sqlitetest.NewConversation(t, db, "Birds")
+		turn, err := db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: speaker.ID, Content: "Squawk!"})
+		is.NotError(t, err)
+
+		err = db.DeleteTurn(t.Context(), turn.ID)
+		is.NotError(t, err)
+		err = db.DeleteTurn(t.Context(), turn.ID)
+		is.Error(t, model.ErrorTurnNotFound, err)
+	})
+}
+
+func TestDatabase_DeleteSpeaker(t *testing.T) {
+	t.Run("should hide the speaker and keep its turns until it's restored", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		speaker := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+		c := sqlitetest.NewConversation(t, db, "Birds")
+		_, err := db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: speaker.ID, Content: "Squawk!"})
+		is.NotError(t, err)
+
+		err = db.DeleteSpeaker(t.Context(), speaker.ID)
+		is.NotError(t, err)
+
+		speakers, err := db.GetSpeakers(t.Context())
+		is.NotError(t, err)
+		for _, s := range speakers {
+			is.True(t, s.ID != speaker.ID)
+		}
+
+		cd, err := db.GetConversationDocument(t.Context(), c.ID)
+		is.NotError(t, err)
+		is.Equal(t, 1, len(cd.Turns))
+		is.Equal(t, "Parrot", cd.Speakers[speaker.ID].Name)
+
+		_, err = db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: speaker.ID, Content: "Squawk?"})
+		is.Error(t, model.ErrorSpeakerNotFound, err)
+
+		err = db.RestoreSpeaker(t.Context(), speaker.ID)
+		is.NotError(t, err)
+
+		_, err = db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: speaker.ID, Content: "Squawk?"})
+		is.NotError(t, err)
+	})
+
+	t.Run("should let a new speaker take the name of a speaker in the trash that has turns", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		speaker := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+		c := sqlitetest.NewConversation(t, db, "Birds")
+		_, err := db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: speaker.ID, Content: "Squawk!"})
+		is.NotError(t, err)
+
+		err = db.DeleteSpeaker(t.Context(), speaker.ID)
+		is.NotError(t, err)
+
+		cd, err := db.GetConversationDocument(t.Context(), c.ID)
+		is.NotError(t, err)
+		is.Equal(t, "Parrot", cd.Speakers[speaker.ID].Name)
+
+		parrot, err := db.SaveSpeaker(t.Context(), model.Speaker{ModelID: speaker.ModelID, Name: "Parrot", Config: "{}"})
+		is.NotError(t, err)
+		is.True(t, parrot.ID != speaker.ID)
+
+		trashed, err := db.GetSpeaker(t.Context(), model.GetSpeakerFilter{ID: speaker.ID})
+		is.NotError(t, err)
+		is.Equal(t, "Parrot (deleted "+trashed.Deleted.String()+")", trashed.Name)
+
+		err = db.RestoreSpeaker(t.Context(), speaker.ID)
+		is.NotError(t, err)
+
+		found, err := db.GetSpeaker(t.Context(), model.GetSpeakerFilter{Name: "Parrot"})
+		is.NotError(t, err)
+		is.Equal(t, parrot.ID, found.ID)
+	})
+}
+
+func TestDatabase_PurgeTrash(t *testing.T) {
+	t.Run("should permanently delete what was deleted before the given time", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		speaker := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+		unused := sqlitetest.NewFakeSpeaker(t, db, "Unused", "")
+
+		kept := sqlitetest.NewConversation(t, db, "Kept")
+		turn, err := db.SaveTurn(t.Context(), model.Turn{ConversationID: kept.ID, SpeakerID: speaker.ID, Content: "Squawk!"})
+		is.NotError(t, err)
+		recent, err := db.SaveTurn(t.Context(), model.Turn{ConversationID: kept.ID, SpeakerID: speaker.ID, Content: "Squawk?"})
+		is.NotError(t, err)
+
+		deleted := sqlitetest.NewConversation(t, db, "Deleted")
+
+		is.NotError(t, db.DeleteTurn(t.Context(), turn.ID))
+		is.NotError(t, db.DeleteConversation(t.Context(), deleted.ID))
+		is.NotError(t, db.DeleteSpeaker(t.Context(), speaker.ID))
+		is.NotError(t, db.DeleteSpeaker(t.Context(), unused.ID))
+
+		_, err = db.H.DB.ExecContext(t.Context(), `update turns set deleted = '2020-01-01T00:00:00.000Z' where deleted is not null`)
+		is.NotError(t, err)
+		_, err = db.H.DB.ExecContext(t.Context(), `update conversations set deleted = '2020-01-01T00:00:00.000Z' where deleted is not null`)
+		is.NotError(t, err)
+		_, err = db.H.DB.ExecContext(t.Context(), `update speakers set deleted = '2020-01-01T00:00:00.000Z' where deleted is not null`)
+		is.NotError(t, err)
+
+		// Something recently deleted is kept
+		is.NotError(t, db.DeleteTurn(t.Context(), recent.ID))
+
+		purged, err := db.PurgeTrash(t.Context(), time.Now().AddDate(0, 0, -30))
+		is.NotError(t, err)
+		is.Equal(t, model.PurgedTrash{Conversations: 1, Speakers: 1, Turns: 1}, purged)
+
+		_, err = db.GetTurn(t.Context(), turn.ID)
+		is.Error(t, model.ErrorTurnNotFound, err)
+		_, err = db.GetTurn(t.Context(), recent.ID)
+		is.NotError(t, err)
+
+		// The speaker is still referenced by the recently deleted turn
+		_, err = db.GetSpeaker(t.Context(), model.GetSpeakerFilter{ID: speaker.ID})
+		is.NotError(t, err)
+		_, err = db.GetSpeaker(t.Context(), model.GetSpeakerFilter{ID: unused.ID})
+		is.Error(t, model.ErrorSpeakerNotFound, err)
+	})
+
+	t.Run("should delete the memories from purged conversations and turns", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+		speaker := sqlitetest.NewFakeSpeaker(t, db, "Parrot", "")
+		c := sqlitetest.NewConversation(t, db, "Birds")
+		turn, err := db.SaveTurn(t.Context(), model.Turn{ConversationID: c.ID, SpeakerID: speaker.ID, Content: "Squawk!"})
+		is.NotError(t, err)
+		_, err = db.RememberTurn(t.Context(), turn.ID)
+		is.NotError(t, err)
+
+		other := sqlitetest.NewConversation(t, db, "Bees")
+		err = db.SaveExtractedMemories(t.Context(), other.ID, time.Now(), []model.Memory{{SpeakerID: speaker.ID, Content: "Bees buzz."}})
+		is.NotError(t, err)
+
+		is.NotError(t, db.DeleteTurn(t.Context(), turn.ID))
+		is.NotError(t, db.DeleteConversation(t.Context(), other.ID))
+
+		// Memories stay while what they're from is in the trash, so it can be restored
+		memories, err := db.GetMemories(t.Context(), speaker.ID)
+		is.NotError(t, err)
+		is.Equal(t, 2, len(memories))
+
+		_, err = db.PurgeTrash(t.Context(), time.Now().Add(time.Minute))
+		is.NotError(t, err)
+
+		memories, err = db.GetMemories(t.Context(), speaker.ID)
+		is.NotError(t, err)
+		is.Equal(t, 0, len(memories))
+	})
+}
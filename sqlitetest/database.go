@@ -2,22 +2,33 @@
 package sqlitetest
 
 import (
+	"path/filepath"
 	"testing"
 
-	"maragu.dev/glue/sqlitetest"
+	"maragu.dev/glue/sql"
 
 	"app/sqlite"
 )
 
-// NewDatabase for testing.
-func NewDatabase(t *testing.T) *sqlite.Database {
+// CredentialsKey of databases from [NewDatabase].
+var CredentialsKey = []byte("0123456789abcdef0123456789abcdef")
+
+// NewDatabase for testing or benchmarking, in a temporary directory that's removed after the test.
+func NewDatabase(t testing.TB) *sqlite.Database {
 	t.Helper()
 
-	h := sqlitetest.NewHelper(t)
-	db := sqlite.NewDatabase(sqlite.NewDatabaseOptions{H: h})
+	h := sql.NewHelper(sql.NewHelperOptions{
+		SQLite: sql.SQLiteOptions{
+			Path: filepath.Join(t.TempDir(), "app.db"),
+		},
+	})
+	db := sqlite.NewDatabase(sqlite.NewDatabaseOptions{CredentialsKey: CredentialsKey, H: h})
 	if err := h.Connect(t.Context()); err != nil {
 		t.Fatal(err)
 	}
+	t.Cleanup(func() {
+		_ = h.DB.Close()
+	})
 
 	if err := db.H.MigrateUp(t.Context()); err != nil {
 		t.Fatal(err)
@@ -0,0 +1,47 @@
+package sqlitetest
+
+import (
+	"testing"
+
+	"app/model"
+	"app/sqlite"
+)
+
+// NewFakeSpeaker for testing, backed by a new model with the fake provider and the given model config.
+// See the llm package for the config options of the fake provider. An empty config echoes messages back.
+func NewFakeSpeaker(t testing.TB, db *sqlite.Database, name, config string) model.Speaker {
+	t.Helper()
+
+	m, err := db.SaveModel(t.Context(), model.Model{
+		Provider: model.ProviderFake,
+		Name:     name,
+		Config:   model.JSON(config),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := db.SaveSpeaker(t.Context(), model.Speaker{
+		ModelID: m.ID,
+		Name:    name,
+		System:  "You are " + name + ".",
+		Config:  "{}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+// NewConversation for testing, with the given topic.
+func NewConversation(t testing.TB, db *sqlite.Database, topic string) model.Conversation {
+	t.Helper()
+
+	c, err := db.SaveConversation(t.Context(), model.Conversation{Topic: topic})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
@@ -0,0 +1,34 @@
+package sqlitetest_test
+
+import (
+	"testing"
+
+	"maragu.dev/is"
+
+	"app/model"
+	"app/sqlitetest"
+)
+
+func TestNewFakeSpeaker(t *testing.T) {
+	t.Run("should create a speaker backed by a fake model with the given config", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		s := sqlitetest.NewFakeSpeaker(t, db, "Parrot", `{"responses":["Squawk!"]}`)
+
+		m, err := db.GetModel(t.Context(), s.ModelID)
+		is.NotError(t, err)
+		is.Equal(t, model.ProviderFake, m.Provider)
+		is.Equal(t, `{"responses":["Squawk!"]}`, string(m.Config))
+		is.Equal(t, "Parrot", s.Name)
+	})
+}
+
+func TestNewConversation(t *testing.T) {
+	t.Run("should create a conversation with the given topic", func(t *testing.T) {
+		db := sqlitetest.NewDatabase(t)
+
+		c := sqlitetest.NewConversation(t, db, "Birds")
+		is.True(t, c.ID != "")
+		is.Equal(t, "Birds", c.Topic)
+	})
+}